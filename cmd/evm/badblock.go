@@ -0,0 +1,91 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var badBlockCommand = cli.Command{
+	Action:    badBlockCmd,
+	Name:      "badblock",
+	Usage:     "replays a bad block bundle exported by geth export-badblocks",
+	ArgsUsage: "<file>",
+}
+
+// BadBlockResult contains the outcome of replaying a bad block, next to the
+// error it was originally rejected with.
+type BadBlockResult struct {
+	Number     uint64      `json:"number"`
+	Hash       common.Hash `json:"hash"`
+	Reason     string      `json:"reason"`
+	Error      string      `json:"error,omitempty"`
+	Reproduced bool        `json:"reproduced"`
+}
+
+func badBlockCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-bundle argument required")
+	}
+	bundle, err := utils.ReadBadBlockBundle(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	block, err := bundle.DecodeBlock()
+	if err != nil {
+		return err
+	}
+	config, err := bundle.DecodeConfig()
+	if err != nil {
+		return fmt.Errorf("invalid chain config: %v", err)
+	}
+	// Replay the block on top of the recorded parent state. Seals aren't verified,
+	// only the execution and the post state are.
+	var engine consensus.Engine = ethash.NewFaker()
+	if config.GetConsensusEngineType().IsClique() {
+		engine = clique.New(&ctypes.CliqueConfig{
+			Period: config.GetCliquePeriod(),
+			Epoch:  config.GetCliqueEpoch(),
+		}, rawdb.NewMemoryDatabase())
+	}
+	result := &BadBlockResult{
+		Number: block.NumberU64(),
+		Hash:   block.Hash(),
+		Reason: bundle.Reason,
+	}
+	if err := core.VerifyWitness(config, engine, block, bundle.Witness()); err != nil {
+		result.Error = err.Error()
+	}
+	result.Reproduced = result.Error == result.Reason
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/confp/generic"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/tests"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var blockTestCommand = cli.Command{
+	Action:    blockTestCmd,
+	Name:      "blocktest",
+	Usage:     "executes the given blockchain tests",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		ChainspecFlag,
+	},
+}
+
+// BlocktestResult contains the execution status after running a blockchain
+// test and any error that might have occurred.
+type BlocktestResult struct {
+	Name  string `json:"name"`
+	Pass  bool   `json:"pass"`
+	Fork  string `json:"fork"`
+	Error string `json:"error,omitempty"`
+}
+
+// readChainspec reads the chain configuration from the file set by the chainspec
+// flag, if any. All the formats supported by echainspec are accepted.
+func readChainspec(ctx *cli.Context) (ctypes.ChainConfigurator, error) {
+	path := ctx.String(ChainspecFlag.Name)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := generic.UnmarshalChainspec(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chainspec %s: %v", path, err)
+	}
+	return config, nil
+}
+
+func blockTestCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-test argument required")
+	}
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	config, err := readChainspec(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := runBlockTests(ctx.Args().First(), config, ctx.String(ChainspecFlag.Name))
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(out))
+
+	failed := 0
+	for _, result := range results {
+		if !result.Pass {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	return nil
+}
+
+// runBlockTests runs the blockchain tests of the given file in the order of
+// their names. The tests run with the given chain configuration, reported as
+// the given fork, or with the fork they name if there's none.
+func runBlockTests(path string, config ctypes.ChainConfigurator, fork string) ([]BlocktestResult, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]tests.BlockTest
+	if err = json.Unmarshal(src, &tests); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]BlocktestResult, 0, len(tests))
+	for _, name := range names {
+		test := tests[name]
+		result := BlocktestResult{Name: name, Fork: test.Network(), Pass: true}
+		if config != nil {
+			result.Fork = fork
+			err = test.RunWithConfig(config, false)
+		} else {
+			err = test.Run(false)
+		}
+		if err != nil {
+			result.Pass, result.Error = false, err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,528 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var debugCommand = cli.Command{
+	Action:    debugCmd,
+	Name:      "debug",
+	Usage:     "interactively step through the execution of evm code",
+	ArgsUsage: "<code>",
+	Flags: []cli.Flag{
+		SourceMapFlag,
+		SourcesFlag,
+	},
+	Description: `
+The debug command executes arbitrary EVM code the same way the run command does,
+recording every step of the execution. It then opens an interactive prompt to
+move back and forth through the recorded trace, set breakpoints and inspect the
+machine state at any step. Type 'help' at the prompt for the list of commands.
+
+If the code was compiled by solc, the runtime source map (--srcmap) and the
+source files it refers to (--sources) can be given to show the source position
+of every step executed in the top level code.`,
+}
+
+// debugStep is a single recorded step of the execution, extending the struct
+// log with the state the debugger can additionally inspect.
+type debugStep struct {
+	vm.StructLog
+	address    common.Address // Address of the account whose context the step executes in
+	codeAddr   common.Address // Address of the account the executed code belongs to
+	code       []byte         // Code being executed
+	storage    vm.Storage     // Storage slots of the account read or written so far
+	returnData []byte         // Return data of the last call made by the frame
+}
+
+// debugTracer records the execution trace stepped through by the debugger. The
+// struct logs are collected by the embedded logger, everything else is kept in
+// the extension steps, aligned with the logs by index.
+type debugTracer struct {
+	*vm.StructLogger
+
+	steps   []debugStep
+	storage map[common.Address]vm.Storage
+}
+
+func newDebugTracer(cfg *vm.LogConfig) *debugTracer {
+	cfg.DisableStorage = true // storage is tracked by the debug tracer itself
+	return &debugTracer{
+		StructLogger: vm.NewStructLogger(cfg),
+		storage:      make(map[common.Address]vm.Storage),
+	}
+}
+
+// CaptureState implements the Tracer interface, recording the context of the
+// operation on top of the struct log.
+func (t *debugTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if err := t.StructLogger.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err); err != nil {
+		return err
+	}
+	step := debugStep{
+		address:  contract.Address(),
+		codeAddr: contract.Address(),
+		code:     contract.Code,
+	}
+	if contract.CodeAddr != nil {
+		step.codeAddr = *contract.CodeAddr
+	}
+	// Track the storage slots touched by the contract. The storage container is
+	// copied on modification, so unchanged steps can share the same one.
+	storage := t.storage[step.address]
+	if err == nil {
+		var (
+			key, value common.Hash
+			accessed   bool
+		)
+		switch {
+		case op == vm.SLOAD && len(stack.Data()) >= 1:
+			key, accessed = common.BigToHash(stack.Back(0)), true
+			value = env.StateDB.GetState(step.address, key)
+		case op == vm.SSTORE && len(stack.Data()) >= 2:
+			key, accessed = common.BigToHash(stack.Back(0)), true
+			value = common.BigToHash(stack.Back(1))
+		}
+		if current, ok := storage[key]; accessed && (!ok || current != value) {
+			storage = storage.Copy()
+			storage[key] = value
+			t.storage[step.address] = storage
+		}
+	}
+	step.storage = storage
+
+	// The return data buffers are never modified once set, no need to copy them
+	if interpreter, ok := env.Interpreter().(*vm.EVMInterpreter); ok {
+		step.returnData = interpreter.ReturnData()
+	}
+	t.steps = append(t.steps, step)
+	return nil
+}
+
+// Steps returns the recorded steps of the execution.
+func (t *debugTracer) Steps() []debugStep {
+	logs := t.StructLogs()
+	for i := range t.steps {
+		t.steps[i].StructLog = logs[i]
+	}
+	return t.steps
+}
+
+// breakpoint stops the execution either at a program counter or at an opcode.
+type breakpoint struct {
+	pc    uint64
+	op    vm.OpCode
+	useOp bool
+}
+
+func (b breakpoint) matches(step *debugStep) bool {
+	if b.useOp {
+		return step.Op == b.op
+	}
+	return step.Pc == b.pc
+}
+
+func (b breakpoint) String() string {
+	if b.useOp {
+		return fmt.Sprintf("op %v", b.op)
+	}
+	return fmt.Sprintf("pc %d (0x%x)", b.pc, b.pc)
+}
+
+// debugger is an interactive session over a recorded execution trace.
+type debugger struct {
+	steps       []debugStep
+	cursor      int
+	breakpoints []breakpoint
+	srcmap      *sourceMap // Source map of the top level code, nil if none was given
+	out         io.Writer
+}
+
+// errQuit is returned by a command to end the debugging session.
+var errQuit = errors.New("quit")
+
+const debugHelp = `Commands:
+  step, s [n]          step forward n steps (default 1)
+  back, b [n]          step backward n steps (default 1)
+  next, n              step forward over calls made by the current frame
+  continue, c          run forward to the next breakpoint or the end
+  rcontinue, rc        run backward to the previous breakpoint or the start
+  goto, g <step>       jump to the given step
+  break, bp <pc|op>    add a breakpoint at a program counter or an opcode
+  breakpoints, bl      list the breakpoints
+  delete, d [n]        delete breakpoint n, or all breakpoints
+  where, w             show the current step
+  stack, st            show the stack
+  memory, mem          show the memory
+  storage, sto         show the storage slots read or written so far
+  returndata, rd       show the return data of the last call
+  source, src [n]      show n lines of source around the current step (default 5)
+  help, h              show this help
+  quit, q              end the session
+An empty line repeats the last command.`
+
+// run reads commands from the input until it is exhausted or the session is
+// quit.
+func (d *debugger) run(in io.Reader) error {
+	var (
+		scanner = bufio.NewScanner(in)
+		last    string
+	)
+	d.where()
+	for {
+		fmt.Fprint(d.out, "(evm) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		if line == "" {
+			continue
+		}
+		last = line
+		if err := d.exec(strings.Fields(line)); err == errQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(d.out, "error: %v\n", err)
+		}
+	}
+}
+
+// exec executes a single debugger command.
+func (d *debugger) exec(args []string) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "step", "s":
+		n, err := countArg(args)
+		if err != nil {
+			return err
+		}
+		d.move(d.cursor + n)
+
+	case "back", "b":
+		n, err := countArg(args)
+		if err != nil {
+			return err
+		}
+		d.move(d.cursor - n)
+
+	case "next", "n":
+		depth := d.steps[d.cursor].Depth
+		next := d.cursor + 1
+		for next < len(d.steps)-1 && d.steps[next].Depth > depth {
+			next++
+		}
+		d.move(next)
+
+	case "continue", "c":
+		d.move(d.findBreakpoint(1))
+
+	case "rcontinue", "rc":
+		d.move(d.findBreakpoint(-1))
+
+	case "goto", "g":
+		if len(args) != 1 {
+			return errors.New("usage: goto <step>")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid step: %v", err)
+		}
+		d.move(n)
+
+	case "break", "bp":
+		if len(args) != 1 {
+			return errors.New("usage: break <pc|op>")
+		}
+		bp, err := parseBreakpoint(args[0])
+		if err != nil {
+			return err
+		}
+		d.breakpoints = append(d.breakpoints, bp)
+		fmt.Fprintf(d.out, "breakpoint %d at %v\n", len(d.breakpoints)-1, bp)
+
+	case "breakpoints", "bl":
+		if len(d.breakpoints) == 0 {
+			fmt.Fprintln(d.out, "no breakpoints")
+		}
+		for i, bp := range d.breakpoints {
+			fmt.Fprintf(d.out, "%d: %v\n", i, bp)
+		}
+
+	case "delete", "d":
+		if len(args) == 0 {
+			d.breakpoints = nil
+			return nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 || n >= len(d.breakpoints) {
+			return fmt.Errorf("unknown breakpoint %s", args[0])
+		}
+		d.breakpoints = append(d.breakpoints[:n], d.breakpoints[n+1:]...)
+
+	case "where", "w":
+		d.where()
+
+	case "stack", "st":
+		stack := d.steps[d.cursor].Stack
+		if len(stack) == 0 {
+			fmt.Fprintln(d.out, "empty stack")
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(d.out, "%4d: 0x%064x\n", len(stack)-1-i, stack[i])
+		}
+
+	case "memory", "mem":
+		memory := d.steps[d.cursor].Memory
+		if len(memory) == 0 {
+			fmt.Fprintln(d.out, "empty memory")
+		}
+		for offset := 0; offset < len(memory); offset += 32 {
+			end := offset + 32
+			if end > len(memory) {
+				end = len(memory)
+			}
+			fmt.Fprintf(d.out, "0x%04x: %x\n", offset, memory[offset:end])
+		}
+
+	case "storage", "sto":
+		storage := d.steps[d.cursor].storage
+		if len(storage) == 0 {
+			fmt.Fprintln(d.out, "no storage accessed")
+		}
+		keys := make([]common.Hash, 0, len(storage))
+		for key := range storage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		for _, key := range keys {
+			fmt.Fprintf(d.out, "%x: %x\n", key, storage[key])
+		}
+
+	case "returndata", "rd":
+		fmt.Fprintf(d.out, "0x%x\n", d.steps[d.cursor].returnData)
+
+	case "source", "src":
+		n := 5
+		if len(args) > 0 {
+			var err error
+			if n, err = countArg(args); err != nil {
+				return err
+			}
+		}
+		return d.source(n)
+
+	case "help", "h":
+		fmt.Fprintln(d.out, debugHelp)
+
+	case "quit", "q":
+		return errQuit
+
+	default:
+		return fmt.Errorf("unknown command %q, type 'help' for the list of commands", cmd)
+	}
+	return nil
+}
+
+// countArg parses the optional positive count argument of a command.
+func countArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
+// parseBreakpoint parses a breakpoint given either as a decimal or hexadecimal
+// program counter, or as an opcode name.
+func parseBreakpoint(arg string) (breakpoint, error) {
+	if pc, err := strconv.ParseUint(arg, 0, 64); err == nil {
+		return breakpoint{pc: pc}, nil
+	}
+	name := strings.ToUpper(arg)
+	if op := vm.StringToOp(name); op.String() == name {
+		return breakpoint{op: op, useOp: true}, nil
+	}
+	return breakpoint{}, fmt.Errorf("invalid breakpoint %q, expected a program counter or opcode", arg)
+}
+
+// findBreakpoint searches the steps in the given direction for the closest one
+// matching a breakpoint, returning the first or last step if there is none.
+func (d *debugger) findBreakpoint(dir int) int {
+	i := d.cursor + dir
+	for ; i >= 0 && i < len(d.steps); i += dir {
+		for _, bp := range d.breakpoints {
+			if bp.matches(&d.steps[i]) {
+				return i
+			}
+		}
+	}
+	return i - dir
+}
+
+// move sets the cursor to the given step, clamped to the recorded trace, and
+// shows it.
+func (d *debugger) move(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(d.steps) {
+		n = len(d.steps) - 1
+	}
+	d.cursor = n
+	d.where()
+}
+
+// where shows the current step, along with its source position if known.
+func (d *debugger) where() {
+	step := &d.steps[d.cursor]
+
+	fmt.Fprintf(d.out, "[%d/%d] depth %d  %v  pc %d (0x%x)  %v", d.cursor, len(d.steps)-1, step.Depth, step.codeAddr.Hex(), step.Pc, step.Pc, step.Op)
+	if step.Op.IsPush() {
+		start := step.Pc + 1
+		end := start + uint64(step.Op-vm.PUSH1) + 1
+		if end > uint64(len(step.code)) {
+			end = uint64(len(step.code))
+		}
+		if start < end {
+			fmt.Fprintf(d.out, " 0x%x", step.code[start:end])
+		}
+	}
+	fmt.Fprintf(d.out, "  gas %d  cost %d\n", step.Gas, step.GasCost)
+	if step.Err != nil {
+		fmt.Fprintf(d.out, "  error: %v\n", step.Err)
+	}
+	if loc, ok := d.location(); ok {
+		if line, col, text, ok := d.srcmap.position(loc); ok {
+			fmt.Fprintf(d.out, "  %d:%d: %s\n", line, col, strings.TrimSpace(text))
+		} else {
+			fmt.Fprintf(d.out, "  source %d offset %d length %d\n", loc.File, loc.Start, loc.Length)
+		}
+	}
+}
+
+// location returns the source location of the current step, if it executes the
+// top level code and a source map was given.
+func (d *debugger) location() (sourceLocation, bool) {
+	if d.srcmap == nil || d.steps[d.cursor].codeAddr != d.steps[0].codeAddr {
+		return sourceLocation{}, false
+	}
+	return d.srcmap.lookup(d.steps[d.cursor].Pc)
+}
+
+// source shows the source lines around the position of the current step.
+func (d *debugger) source(n int) error {
+	loc, ok := d.location()
+	if !ok {
+		return errors.New("no source position for the current step")
+	}
+	line, _, _, ok := d.srcmap.position(loc)
+	if !ok {
+		return fmt.Errorf("source file %d not available", loc.File)
+	}
+	lines := strings.Split(d.srcmap.sources[loc.File], "\n")
+	for i := line - n; i <= line+n; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		marker := "  "
+		if i == line {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %4d  %s\n", marker, i, lines[i-1])
+	}
+	return nil
+}
+
+func debugCmd(ctx *cli.Context) error {
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// The prompt reads from stdin, so the code can't be read from there
+	if ctx.GlobalString(CodeFileFlag.Name) == "-" {
+		return errors.New("code can't be read from stdin while debugging")
+	}
+	code, err := readCode(ctx)
+	if err != nil {
+		return err
+	}
+	input, err := readInput(ctx)
+	if err != nil {
+		return err
+	}
+	tracer := newDebugTracer(&vm.LogConfig{
+		DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+		DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+	})
+	runtimeConfig, receiver := makeRuntimeConfig(ctx, tracer)
+
+	ret, leftOverGas, err := execute(runtimeConfig, receiver, code, input, ctx.GlobalBool(CreateFlag.Name))
+	fmt.Printf("Recorded %d steps, gas used %d, return data 0x%x\n", len(tracer.steps), runtimeConfig.GasLimit-leftOverGas, ret)
+	if err != nil {
+		fmt.Printf("Execution error: %v\n", err)
+	}
+	if len(tracer.steps) == 0 {
+		return nil
+	}
+	dbg := &debugger{
+		steps: tracer.Steps(),
+		out:   os.Stdout,
+	}
+	if path := ctx.String(SourceMapFlag.Name); path != "" {
+		srcmap, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not load source map: %v", err)
+		}
+		var sources []string
+		if paths := ctx.String(SourcesFlag.Name); paths != "" {
+			for _, path := range strings.Split(paths, ",") {
+				src, err := ioutil.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not load source file: %v", err)
+				}
+				sources = append(sources, string(src))
+			}
+		}
+		if dbg.srcmap, err = newSourceMap(string(srcmap), dbg.steps[0].code, sources); err != nil {
+			return err
+		}
+	}
+	return dbg.run(os.Stdin)
+}
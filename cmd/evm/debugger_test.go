@@ -0,0 +1,153 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+)
+
+// debugProgram stores 0x2a into slot 1, loads it back into memory and passes it
+// to the identity precompile, leaving it as the return data:
+//
+//	PUSH1 0x2a, PUSH1 0x01, SSTORE, PUSH1 0x01, SLOAD, PUSH1 0x00, MSTORE,
+//	PUSH1 0x00, PUSH1 0x00, PUSH1 0x20, PUSH1 0x00, PUSH1 0x00, PUSH1 0x04,
+//	GAS, CALL, POP, STOP
+var debugProgram = common.FromHex("602a6001556001546000526000600060206000600060045af15000")
+
+// newTestDebugger records the execution of the given code into a debugger
+// writing its output into the returned buffer.
+func newTestDebugger(t *testing.T, code []byte) (*debugger, *bytes.Buffer) {
+	tracer := newDebugTracer(new(vm.LogConfig))
+	if _, _, err := runtime.Execute(code, nil, &runtime.Config{EVMConfig: vm.Config{Debug: true, Tracer: tracer}}); err != nil {
+		t.Fatalf("failed to execute code: %v", err)
+	}
+	out := new(bytes.Buffer)
+	return &debugger{steps: tracer.Steps(), out: out}, out
+}
+
+// Tests a scripted debugging session over a recorded execution.
+func TestDebuggerSession(t *testing.T) {
+	dbg, out := newTestDebugger(t, debugProgram)
+	if len(dbg.steps) != 17 {
+		t.Fatalf("step count mismatch: have %d, want 17", len(dbg.steps))
+	}
+	script := []string{
+		"break sload", // breakpoint 0 on the opcode
+		"continue",    // run to the SLOAD
+		"storage",     // slot 1 was written before
+		"stack",       // the slot to load is on top of the stack
+		"bp 0x19",     // breakpoint 1 on the POP after the CALL
+		"c",           // run to the POP
+		"returndata",  // the identity precompile echoed the loaded value
+		"rc",          // back to the SLOAD
+		"",            // repeat, stays at the start as there's no earlier match
+		"step 3",      // forward to the PUSH1 before the SLOAD
+		"memory",      // memory not yet expanded
+		"goto 100",    // clamped to the last step
+		"back",        // to the POP
+		"bl",          // list both breakpoints
+		"d 0",         // delete the opcode breakpoint
+		"d 5",         // unknown breakpoint
+		"bogus",       // unknown command
+		"src",         // no source map given
+		"quit",
+		"step", // never executed
+	}
+	if err := dbg.run(strings.NewReader(strings.Join(script, "\n"))); err != nil {
+		t.Fatalf("session failed: %v", err)
+	}
+	if dbg.cursor != 15 {
+		t.Errorf("final step mismatch: have %d, want 15", dbg.cursor)
+	}
+	if len(dbg.breakpoints) != 1 || dbg.breakpoints[0].pc != 0x19 {
+		t.Errorf("breakpoints mismatch: have %v", dbg.breakpoints)
+	}
+	output := out.String()
+	for _, want := range []string{
+		"[0/16] depth 1",
+		"breakpoint 0 at op SLOAD",
+		"[4/16] depth 1",
+		"pc 7 (0x7)  SLOAD",
+		"0000000000000000000000000000000000000000000000000000000000000001: 000000000000000000000000000000000000000000000000000000000000002a\n",
+		"   0: 0x0000000000000000000000000000000000000000000000000000000000000001\n",
+		"breakpoint 1 at pc 25 (0x19)",
+		"[15/16] depth 1",
+		"0x000000000000000000000000000000000000000000000000000000000000002a\n",
+		"[3/16] depth 1",
+		"pc 5 (0x5)  PUSH1 0x01",
+		"empty memory",
+		"[16/16] depth 1",
+		"0: op SLOAD\n1: pc 25 (0x19)\n",
+		"error: unknown breakpoint 5",
+		"error: unknown command \"bogus\"",
+		"error: no source position for the current step",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("session output:\n%s", output)
+	}
+}
+
+// Tests that the debugger shows the source position of the steps executing the
+// top level code covered by the source map.
+func TestDebuggerLocation(t *testing.T) {
+	dbg, out := newTestDebugger(t, debugProgram)
+
+	srcmap, err := newSourceMap("0:7:0;8:6", dbg.steps[0].code, []string{"x = 42;\ny = x;\nz = y;\n"})
+	if err != nil {
+		t.Fatalf("failed to parse source map: %v", err)
+	}
+	dbg.srcmap = srcmap
+
+	// Steps covered by the source map resolve to their source position
+	if loc, ok := dbg.location(); !ok || loc.Start != 0 || loc.Length != 7 {
+		t.Fatalf("first step location mismatch: have %+v (%v)", loc, ok)
+	}
+	dbg.move(1)
+	if !strings.Contains(out.String(), "  2:1: y = x;\n") {
+		t.Errorf("source position not shown: %q", out.String())
+	}
+	out.Reset()
+	if err := dbg.source(1); err != nil {
+		t.Fatalf("failed to show source: %v", err)
+	}
+	if want := "      1  x = 42;\n=>    2  y = x;\n      3  z = y;\n"; out.String() != want {
+		t.Errorf("source listing mismatch: have %q, want %q", out.String(), want)
+	}
+	// Steps past the end of the source map, or executing other code, don't
+	dbg.cursor = 2
+	if loc, ok := dbg.location(); ok {
+		t.Errorf("location found for step not covered by the source map: %+v", loc)
+	}
+	dbg.cursor = 1
+	dbg.steps[1].codeAddr = common.Address{0x04}
+	if loc, ok := dbg.location(); ok {
+		t.Errorf("location found for step executing other code: %+v", loc)
+	}
+	if err := dbg.source(1); err == nil {
+		t.Errorf("source shown for step executing other code")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/tests"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var difficultyTestCommand = cli.Command{
+	Action:    difficultyTestCmd,
+	Name:      "difficultytest",
+	Usage:     "executes the given difficulty tests",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		ChainspecFlag,
+		DifficultyForkFlag,
+	},
+}
+
+// DifficultytestResult contains the outcome of running a difficulty test and
+// any error that might have occurred.
+type DifficultytestResult struct {
+	Name    string `json:"name"`
+	Pass    bool   `json:"pass"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Fork    string `json:"fork"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readDifficultyTests reads difficulty tests either from a JSON object keyed by
+// test name, or from a stream of newline delimited JSON tests.
+func readDifficultyTests(src []byte) (map[string]*tests.DifficultyTest, error) {
+	var set map[string]*tests.DifficultyTest
+	if err := json.Unmarshal(src, &set); err == nil {
+		return set, nil
+	}
+	set = make(map[string]*tests.DifficultyTest)
+	decoder := json.NewDecoder(bytes.NewReader(src))
+	for {
+		test := new(tests.DifficultyTest)
+		if err := decoder.Decode(test); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", len(set))
+		}
+		set[name] = test
+	}
+	return set, nil
+}
+
+func difficultyTestCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-test argument required")
+	}
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Resolve the chain configuration to compute the difficulties with
+	config, err := readChainspec(ctx)
+	if err != nil {
+		return err
+	}
+	fork := ctx.String(ChainspecFlag.Name)
+	if config == nil {
+		fork = ctx.String(DifficultyForkFlag.Name)
+		var ok bool
+		if config, ok = tests.DifficultyConfig(fork); !ok {
+			return tests.UnsupportedForkError{Name: fork}
+		}
+	}
+	results, err := runDifficultyTests(ctx.Args().First(), config, fork)
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(out))
+
+	failed := 0
+	for _, result := range results {
+		if !result.Pass {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	return nil
+}
+
+// runDifficultyTests runs the difficulty tests of the given file in the order
+// of their names, computing the difficulties with the given chain configuration.
+// Tests with a parent difficulty below the minimum are skipped.
+func runDifficultyTests(path string, config ctypes.ChainConfigurator, fork string) ([]DifficultytestResult, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := readDifficultyTests(src)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]DifficultytestResult, 0, len(set))
+	for _, name := range names {
+		test := set[name]
+		result := DifficultytestResult{Name: name, Fork: fork, Pass: true}
+		switch {
+		case test.ParentDifficulty == nil || test.CurrentDifficulty == nil:
+			result.Pass, result.Error = false, "missing difficulty"
+		case test.ParentDifficulty.Cmp(vars.MinimumDifficulty) < 0:
+			result.Skipped = true
+		default:
+			if err := test.Run(config); err != nil {
+				result.Pass, result.Error = false, err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+	"golang.org/x/crypto/sha3"
+)
+
+// Prestate is the state the transactions are applied on top of.
+type Prestate struct {
+	Env stEnv                 `json:"env"`
+	Pre genesisT.GenesisAlloc `json:"pre"`
+}
+
+// ExecutionResult contains the outcome of applying the transactions, as the
+// roots and receipts a block including them would carry.
+type ExecutionResult struct {
+	StateRoot   common.Hash    `json:"stateRoot"`
+	TxRoot      common.Hash    `json:"txRoot"`
+	ReceiptRoot common.Hash    `json:"receiptRoot"`
+	LogsHash    common.Hash    `json:"logsHash"`
+	Bloom       types.Bloom    `json:"logsBloom"`
+	Receipts    types.Receipts `json:"receipts"`
+	Rejected    []int          `json:"rejected,omitempty"`
+}
+
+// ommer is an uncle of the block being built, identified by the distance to
+// the block and the address to credit.
+type ommer struct {
+	Delta   uint64         `json:"delta"`
+	Address common.Address `json:"address"`
+}
+
+// stEnv is the block environment the transactions are executed in.
+type stEnv struct {
+	Coinbase    common.Address                      `json:"currentCoinbase"`
+	Difficulty  *math.HexOrDecimal256               `json:"currentDifficulty"`
+	GasLimit    math.HexOrDecimal64                 `json:"currentGasLimit"`
+	Number      math.HexOrDecimal64                 `json:"currentNumber"`
+	Timestamp   math.HexOrDecimal64                 `json:"currentTimestamp"`
+	BlockHashes map[math.HexOrDecimal64]common.Hash `json:"blockHashes,omitempty"`
+	Ommers      []ommer                             `json:"ommers,omitempty"`
+}
+
+// Apply applies a set of transactions to a pre-state, returning the post state
+// and the execution result. Transactions that can't be applied are skipped and
+// reported as rejected.
+func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig ctypes.ChainConfigurator,
+	txs types.Transactions, miningReward int64,
+	getTracerFn func(txIndex int, txHash common.Hash) (tracer vm.Tracer, err error)) (*state.StateDB, *ExecutionResult, error) {
+
+	if pre.Env.Difficulty == nil {
+		return nil, nil, NewError(ErrorConfig, fmt.Errorf("missing currentDifficulty in env"))
+	}
+	// Capture errors for BLOCKHASH operation, if we haven't been supplied the
+	// required blockhashes
+	var hashError error
+	getHash := func(num uint64) common.Hash {
+		if pre.Env.BlockHashes == nil {
+			hashError = fmt.Errorf("getHash(%d) invoked, no blockhashes provided", num)
+			return common.Hash{}
+		}
+		h, ok := pre.Env.BlockHashes[math.HexOrDecimal64(num)]
+		if !ok {
+			hashError = fmt.Errorf("getHash(%d) invoked, blockhash for that block not provided", num)
+		}
+		return h
+	}
+	var (
+		statedb     = tests.MakePreState(rawdb.NewMemoryDatabase(), pre.Pre)
+		number      = new(big.Int).SetUint64(uint64(pre.Env.Number))
+		signer      = types.MakeSigner(chainConfig, number)
+		gaspool     = new(core.GasPool).AddGas(uint64(pre.Env.GasLimit))
+		eip161d     = chainConfig.IsEnabled(chainConfig.GetEIP161dTransition, number)
+		blockHash   = common.Hash{0x13, 0x37}
+		rejectedTxs []int
+		includedTxs types.Transactions
+		gasUsed     = uint64(0)
+		receipts    = make(types.Receipts, 0)
+		logs        = make([]*types.Log, 0)
+		txIndex     = 0
+	)
+	vmContext := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    pre.Env.Coinbase,
+		BlockNumber: number,
+		Time:        new(big.Int).SetUint64(uint64(pre.Env.Timestamp)),
+		Difficulty:  (*big.Int)(pre.Env.Difficulty),
+		GasLimit:    uint64(pre.Env.GasLimit),
+		GetHash:     getHash,
+	}
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			log.Info("Rejected transaction", "index", i, "hash", tx.Hash(), "error", err)
+			rejectedTxs = append(rejectedTxs, i)
+			continue
+		}
+		tracer, err := getTracerFn(txIndex, tx.Hash())
+		if err != nil {
+			return nil, nil, err
+		}
+		vmConfig.Tracer = tracer
+		vmConfig.Debug = (tracer != nil)
+		statedb.Prepare(tx.Hash(), blockHash, txIndex)
+		vmContext.Origin = msg.From()
+		vmContext.GasPrice = msg.GasPrice()
+
+		evm := vm.NewEVM(vmContext, statedb, chainConfig, vmConfig)
+		snapshot := statedb.Snapshot()
+
+		_, msgGasUsed, failed, err := core.ApplyMessage(evm, msg, gaspool)
+		if err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			log.Info("Rejected transaction", "index", i, "hash", tx.Hash(), "from", msg.From(), "error", err)
+			rejectedTxs = append(rejectedTxs, i)
+			continue
+		}
+		includedTxs = append(includedTxs, tx)
+		if hashError != nil {
+			return nil, nil, NewError(ErrorMissingBlockhash, hashError)
+		}
+		gasUsed += msgGasUsed
+
+		// Update the state with pending changes and create the receipt, in the
+		// same way the state processor does
+		var root []byte
+		if chainConfig.IsEnabled(chainConfig.GetEIP658Transition, number) {
+			statedb.Finalise(eip161d)
+		} else {
+			root = statedb.IntermediateRoot(eip161d).Bytes()
+		}
+		receipt := types.NewReceipt(root, failed, gasUsed)
+		receipt.TxHash = tx.Hash()
+		receipt.GasUsed = msgGasUsed
+		if msg.To() == nil {
+			receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
+		}
+		receipt.Logs = statedb.GetLogs(tx.Hash())
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipt.BlockHash = blockHash
+		receipt.BlockNumber = number
+		receipt.TransactionIndex = uint(txIndex)
+		receipts = append(receipts, receipt)
+		logs = append(logs, receipt.Logs...)
+
+		txIndex++
+	}
+	// Add mining reward?
+	if miningReward >= 0 {
+		// Add mining reward. The mining reward may be `0`, which only makes a difference in the cases
+		// where
+		// - the coinbase suicided, or
+		// - there are only 'bad' transactions, which aren't executed. In those cases,
+		//   the coinbase gets no txfee, so isn't created, and thus needs to be touched
+		//
+		// The rewards are credited by the consensus engine, which reduces them by
+		// era once ECIP-1017 is enabled
+		header := &types.Header{Number: number, Coinbase: pre.Env.Coinbase}
+		uncles := make([]*types.Header, len(pre.Env.Ommers))
+		for i, ommer := range pre.Env.Ommers {
+			if ommer.Delta > number.Uint64() {
+				return nil, nil, NewError(ErrorConfig, fmt.Errorf("invalid ommer delta %d at block %d", ommer.Delta, number))
+			}
+			uncles[i] = &types.Header{
+				Number:   new(big.Int).Sub(number, new(big.Int).SetUint64(ommer.Delta)),
+				Coinbase: ommer.Address,
+			}
+		}
+		ethash.AccumulateRewards(chainConfig, statedb, header, uncles, big.NewInt(miningReward))
+	}
+	// Commit block
+	root, err := statedb.Commit(eip161d)
+	if err != nil {
+		return nil, nil, NewError(ErrorEVM, fmt.Errorf("could not commit state: %v", err))
+	}
+	execRs := &ExecutionResult{
+		StateRoot:   root,
+		TxRoot:      types.DeriveSha(includedTxs),
+		ReceiptRoot: types.DeriveSha(receipts),
+		Bloom:       types.CreateBloom(receipts),
+		LogsHash:    rlpHash(logs),
+		Receipts:    receipts,
+		Rejected:    rejectedTxs,
+	}
+	return statedb, execRs, nil
+}
+
+func rlpHash(x interface{}) (h common.Hash) {
+	hw := sha3.NewLegacyKeccak256()
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
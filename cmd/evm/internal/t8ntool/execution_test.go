@@ -0,0 +1,139 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/types/multigeth"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/tests"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// newTestContext creates a command line context with the given flags set.
+func newTestContext(t *testing.T, flags map[string]string) *cli.Context {
+	set := flag.NewFlagSet("t8n", flag.ContinueOnError)
+	for _, name := range []string{ForknameFlag.Name, ChainspecFlag.Name, ChainIDFlag.Name} {
+		set.String(name, "", "")
+	}
+	for name, value := range flags {
+		if err := set.Set(name, value); err != nil {
+			t.Fatalf("failed to set flag %s: %v", name, err)
+		}
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+// Tests that the mining rewards of a Classic chainspec are credited the way the
+// consensus engine does, including the reductions by era of ECIP-1017.
+func TestApplyClassicRewards(t *testing.T) {
+	// Shorten the eras of the Classic configuration to five blocks, wrapped into
+	// a genesis like the chainspecs shipped for it
+	classic := &multigeth.MultiGethChainConfig{}
+	if err := confp.Convert(params.ClassicChainConfig, classic); err != nil {
+		t.Fatalf("failed to copy classic config: %v", err)
+	}
+	transition, rounds := uint64(1), uint64(5)
+	classic.SetEthashECIP1017Transition(&transition)
+	classic.SetEthashECIP1017EraRounds(&rounds)
+
+	spec, err := json.Marshal(map[string]interface{}{"config": classic})
+	if err != nil {
+		t.Fatalf("failed to encode chainspec: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "t8n-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chainspec.json")
+	if err := ioutil.WriteFile(path, spec, 0644); err != nil {
+		t.Fatalf("failed to write chainspec: %v", err)
+	}
+	config, _, err := chainConfig(newTestContext(t, map[string]string{ChainspecFlag.Name: path}))
+	if err != nil {
+		t.Fatalf("failed to load chainspec: %v", err)
+	}
+	var (
+		coinbase = common.Address{0xc0}
+		uncle    = common.Address{0x0c}
+		reward   = vars.FrontierBlockReward
+		micro    = func(n int64) *big.Int {
+			return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e12))
+		}
+	)
+	cases := []struct {
+		number      uint64
+		miner, ommr *big.Int
+	}{
+		// Last block of the first era: 5 + 5/32 for the miner, 7/8 * 5 for the uncle
+		{5, micro(5156250), micro(4375000)},
+		// First block of the second era: 4 + 4/32 for the miner, 4/32 for the uncle
+		{6, micro(4125000), micro(125000)},
+		// Third era: 3.2 + 3.2/32 for the miner, 3.2/32 for the uncle
+		{11, micro(3300000), micro(100000)},
+	}
+	for _, tt := range cases {
+		pre := &Prestate{Env: stEnv{
+			Coinbase:   coinbase,
+			Difficulty: (*math.HexOrDecimal256)(big.NewInt(0x20000)),
+			GasLimit:   8000000,
+			Number:     math.HexOrDecimal64(tt.number),
+			Ommers:     []ommer{{Delta: 1, Address: uncle}},
+		}}
+		statedb, _, err := pre.Apply(vm.Config{}, config, nil, reward.Int64(), func(int, common.Hash) (vm.Tracer, error) { return nil, nil })
+		if err != nil {
+			t.Fatalf("block %d: failed to apply: %v", tt.number, err)
+		}
+		if have := statedb.GetBalance(coinbase); have.Cmp(tt.miner) != 0 {
+			t.Errorf("block %d: miner reward mismatch: have %v, want %v", tt.number, have, tt.miner)
+		}
+		if have := statedb.GetBalance(uncle); have.Cmp(tt.ommr) != 0 {
+			t.Errorf("block %d: ommer reward mismatch: have %v, want %v", tt.number, have, tt.ommr)
+		}
+	}
+}
+
+// Tests that customizing the chain ID of a named fork leaves the shared fork
+// configuration untouched.
+func TestChainConfigForkCopy(t *testing.T) {
+	want := new(big.Int).Set(tests.Forks["Byzantium"].GetChainID())
+
+	config, _, err := chainConfig(newTestContext(t, map[string]string{ForknameFlag.Name: "Byzantium", ChainIDFlag.Name: "1337"}))
+	if err != nil {
+		t.Fatalf("failed to load fork config: %v", err)
+	}
+	if have := config.GetChainID(); have.Uint64() != 1337 {
+		t.Fatalf("chain id mismatch: have %v, want 1337", have)
+	}
+	if have := tests.Forks["Byzantium"].GetChainID(); have.Cmp(want) != 0 {
+		t.Fatalf("shared fork config modified: chain id %v, want %v", have, want)
+	}
+}
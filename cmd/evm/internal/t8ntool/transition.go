@@ -0,0 +1,317 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/confp/generic"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/types/multigeth"
+	"github.com/ethereum/go-ethereum/tests"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	ErrorEVM              = 2
+	ErrorConfig           = 3
+	ErrorMissingBlockhash = 4
+
+	ErrorJson = 10
+	ErrorIO   = 11
+
+	stdinSelector = "stdin"
+)
+
+// NumberedError is an error carrying the exit code the tool terminates with.
+type NumberedError struct {
+	errorCode int
+	err       error
+}
+
+// NewError wraps an error with the given exit code.
+func NewError(errorCode int, err error) *NumberedError {
+	return &NumberedError{errorCode, err}
+}
+
+func (n *NumberedError) Error() string {
+	return fmt.Sprintf("ERROR(%d): %v", n.errorCode, n.err.Error())
+}
+
+// ExitCode returns the exit code of the error, implementing cli.ExitCoder.
+func (n *NumberedError) ExitCode() int {
+	return n.errorCode
+}
+
+// input is the combined input of the tool when read from stdin.
+type input struct {
+	Alloc genesisT.GenesisAlloc `json:"alloc,omitempty"`
+	Env   *stEnv                `json:"env,omitempty"`
+	Txs   types.Transactions    `json:"txs,omitempty"`
+}
+
+// Main runs the state transition tool with the given command line context.
+func Main(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	baseDir, err := createBasedir(ctx)
+	if err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed creating output basedir: %v", err))
+	}
+	// Configure the EVM tracer, writing one trace file per transaction
+	var (
+		traces      []*os.File
+		getTracerFn = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			return nil, nil
+		}
+	)
+	defer func() {
+		for _, trace := range traces {
+			trace.Close()
+		}
+	}()
+	if ctx.Bool(TraceFlag.Name) {
+		logConfig := &vm.LogConfig{
+			DisableStack:  ctx.Bool(TraceDisableStackFlag.Name),
+			DisableMemory: ctx.Bool(TraceDisableMemoryFlag.Name),
+		}
+		getTracerFn = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			traceFile, err := os.Create(filepath.Join(baseDir, fmt.Sprintf("trace-%d-%v.jsonl", txIndex, txHash.String())))
+			if err != nil {
+				return nil, NewError(ErrorIO, fmt.Errorf("failed creating trace-file: %v", err))
+			}
+			traces = append(traces, traceFile)
+			return vm.NewJSONLogger(logConfig, traceFile), nil
+		}
+	}
+	// Load the prestate, the environment and the transactions, any of which may
+	// be read from the combined input on stdin
+	var (
+		prestate  Prestate
+		txs       types.Transactions
+		inputData = &input{}
+	)
+	allocStr, envStr, txStr := ctx.String(InputAllocFlag.Name), ctx.String(InputEnvFlag.Name), ctx.String(InputTxsFlag.Name)
+	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector {
+		decoder := json.NewDecoder(os.Stdin)
+		if err := decoder.Decode(inputData); err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
+		}
+	}
+	if allocStr != stdinSelector {
+		if err := readJSONFile(allocStr, &inputData.Alloc); err != nil {
+			return err
+		}
+	}
+	prestate.Pre = inputData.Alloc
+
+	if envStr != stdinSelector {
+		inputData.Env = new(stEnv)
+		if err := readJSONFile(envStr, inputData.Env); err != nil {
+			return err
+		}
+	}
+	if inputData.Env == nil {
+		return NewError(ErrorJson, fmt.Errorf("missing env in input"))
+	}
+	prestate.Env = *inputData.Env
+
+	if txStr != stdinSelector {
+		if err := readJSONFile(txStr, &inputData.Txs); err != nil {
+			return err
+		}
+	}
+	txs = inputData.Txs
+
+	// Resolve the chain configuration and apply the transactions
+	chainConfig, eips, err := chainConfig(ctx)
+	if err != nil {
+		return NewError(ErrorConfig, err)
+	}
+	vmConfig := vm.Config{ExtraEips: eips}
+
+	s, result, err := prestate.Apply(vmConfig, chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracerFn)
+	if err != nil {
+		return err
+	}
+	return dispatchOutput(ctx, baseDir, result, collectAlloc(s))
+}
+
+// chainConfig resolves the chain configuration to run with, either from the
+// given chainspec file or from the named fork and its extra EIPs.
+func chainConfig(ctx *cli.Context) (ctypes.ChainConfigurator, []int, error) {
+	var (
+		config ctypes.ChainConfigurator
+		eips   []int
+	)
+	if path := ctx.String(ChainspecFlag.Name); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed reading chainspec file: %v", err)
+		}
+		if config, err = generic.UnmarshalChainspec(data); err != nil {
+			return nil, nil, fmt.Errorf("failed parsing chainspec file: %v", err)
+		}
+	} else {
+		forks := strings.Split(ctx.String(ForknameFlag.Name), "+")
+		fork, ok := tests.Forks[forks[0]]
+		if !ok {
+			return nil, nil, tests.UnsupportedForkError{Name: forks[0]}
+		}
+		// Copy the shared fork configuration before customizing it
+		config = &multigeth.MultiGethChainConfig{}
+		if err := confp.Convert(fork, config); ctypes.IsFatalUnsupportedErr(err) {
+			return nil, nil, err
+		}
+		for _, eip := range forks[1:] {
+			num, err := strconv.Atoi(eip)
+			if err != nil {
+				return nil, nil, fmt.Errorf("syntax error, invalid eip number %v", eip)
+			}
+			eips = append(eips, num)
+		}
+	}
+	if ctx.IsSet(ChainIDFlag.Name) {
+		if err := config.SetChainID(big.NewInt(ctx.Int64(ChainIDFlag.Name))); err != nil {
+			return nil, nil, err
+		}
+	}
+	return config, eips, nil
+}
+
+// readJSONFile decodes the JSON content of the given file into dest.
+func readJSONFile(path string, dest interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed reading %s file: %v", path, err))
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(dest); err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed unmarshaling %s file: %v", path, err))
+	}
+	return nil
+}
+
+// createBasedir makes sure the output directory exists, returning its path.
+func createBasedir(ctx *cli.Context) (string, error) {
+	baseDir := ""
+	if ctx.IsSet(OutputBasedir.Name) {
+		if base := ctx.String(OutputBasedir.Name); len(base) > 0 {
+			if err := os.MkdirAll(base, 0755); err != nil {
+				return "", err
+			}
+			baseDir = base
+		}
+	}
+	return baseDir, nil
+}
+
+// collectAlloc converts the post state into a genesis allocation.
+func collectAlloc(statedb *state.StateDB) genesisT.GenesisAlloc {
+	alloc := make(genesisT.GenesisAlloc)
+	for addr, account := range statedb.RawDump(false, false, true).Accounts {
+		balance, _ := new(big.Int).SetString(account.Balance, 10)
+		genesisAccount := genesisT.GenesisAccount{
+			Code:    common.FromHex(account.Code),
+			Nonce:   account.Nonce,
+			Balance: balance,
+		}
+		if len(account.Storage) > 0 {
+			genesisAccount.Storage = make(map[common.Hash]common.Hash, len(account.Storage))
+			for key, value := range account.Storage {
+				genesisAccount.Storage[key] = common.HexToHash(value)
+			}
+		}
+		alloc[addr] = genesisAccount
+	}
+	return alloc
+}
+
+// saveFile marshals the object to the given file
+func saveFile(baseDir, filename string, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+	}
+	location := filepath.Join(baseDir, filename)
+	if err = ioutil.WriteFile(location, b, 0644); err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed writing output: %v", err))
+	}
+	log.Info("Wrote file", "file", location)
+	return nil
+}
+
+// dispatchOutput writes the output data to either stderr or stdout, or to the specified
+// files
+func dispatchOutput(ctx *cli.Context, baseDir string, result *ExecutionResult, alloc genesisT.GenesisAlloc) error {
+	stdOutObject := make(map[string]interface{})
+	stdErrObject := make(map[string]interface{})
+	dispatch := func(baseDir, fName, name string, obj interface{}) error {
+		switch fName {
+		case "stdout":
+			stdOutObject[name] = obj
+		case "stderr":
+			stdErrObject[name] = obj
+		default: // save to file
+			if err := saveFile(baseDir, fName, obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := dispatch(baseDir, ctx.String(OutputAllocFlag.Name), "alloc", alloc); err != nil {
+		return err
+	}
+	if err := dispatch(baseDir, ctx.String(OutputResultFlag.Name), "result", result); err != nil {
+		return err
+	}
+	if len(stdOutObject) > 0 {
+		b, err := json.MarshalIndent(stdOutObject, "", " ")
+		if err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+		}
+		os.Stdout.Write(b)
+		os.Stdout.Write([]byte("\n"))
+	}
+	if len(stdErrObject) > 0 {
+		b, err := json.MarshalIndent(stdErrObject, "", " ")
+		if err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+		}
+		os.Stderr.Write(b)
+		os.Stderr.Write([]byte("\n"))
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"math/big"
 	"os"
 
+	"github.com/ethereum/go-ethereum/cmd/evm/internal/t8ntool"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -120,8 +121,48 @@ var (
 		Usage: "External EVM configuration (default = built-in interpreter)",
 		Value: "",
 	}
+	ChainspecFlag = cli.StringFlag{
+		Name:  "chainspec",
+		Usage: "File containing the chain configuration to run the tests with, in any format supported by echainspec",
+	}
+	DifficultyForkFlag = cli.StringFlag{
+		Name:  "fork",
+		Usage: "Name of the difficulty test configuration to run the tests with",
+		Value: "MainNetwork",
+	}
+	SourceMapFlag = cli.StringFlag{
+		Name:  "srcmap",
+		Usage: "File containing the solc source map of the code to debug",
+	}
+	SourcesFlag = cli.StringFlag{
+		Name:  "sources",
+		Usage: "Comma separated list of the source files referenced by the source map, in order of their index",
+	}
 )
 
+var stateTransitionCommand = cli.Command{
+	Name:    "transition",
+	Aliases: []string{"t8n"},
+	Usage:   "executes a full state transition",
+	Action:  t8ntool.Main,
+	Flags: []cli.Flag{
+		t8ntool.TraceFlag,
+		t8ntool.TraceDisableMemoryFlag,
+		t8ntool.TraceDisableStackFlag,
+		t8ntool.OutputBasedir,
+		t8ntool.OutputAllocFlag,
+		t8ntool.OutputResultFlag,
+		t8ntool.InputAllocFlag,
+		t8ntool.InputEnvFlag,
+		t8ntool.InputTxsFlag,
+		t8ntool.ForknameFlag,
+		t8ntool.ChainspecFlag,
+		t8ntool.ChainIDFlag,
+		t8ntool.RewardFlag,
+		t8ntool.VerbosityFlag,
+	},
+}
+
 func init() {
 	app.Flags = []cli.Flag{
 		CreateFlag,
@@ -150,14 +191,23 @@ func init() {
 		compileCommand,
 		disasmCommand,
 		runCommand,
+		debugCommand,
 		stateTestCommand,
+		blockTestCommand,
+		difficultyTestCommand,
+		badBlockCommand,
+		stateTransitionCommand,
 	}
 	cli.CommandHelpTemplate = utils.OriginCommandHelpTemplate
 }
 
 func main() {
 	if err := app.Run(os.Args); err != nil {
+		code := 1
+		if ec, ok := err.(*t8ntool.NumberedError); ok {
+			code = ec.ExitCode()
+		}
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(code)
 	}
 }
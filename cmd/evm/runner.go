@@ -71,78 +71,29 @@ func readGenesis(genesisPath string) *genesisT.Genesis {
 	return genesis
 }
 
-func runCmd(ctx *cli.Context) error {
-	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
-	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
-	log.Root().SetHandler(glogger)
-	logconfig := &vm.LogConfig{
-		DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
-		DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
-		Debug:         ctx.GlobalBool(DebugFlag.Name),
-	}
-
-	var (
-		tracer        vm.Tracer
-		debugLogger   *vm.StructLogger
-		statedb       *state.StateDB
-		chainConfig   ctypes.ChainConfigurator
-		sender        = common.BytesToAddress([]byte("sender"))
-		receiver      = common.BytesToAddress([]byte("receiver"))
-		genesisConfig *genesisT.Genesis
-	)
-	if ctx.GlobalBool(MachineFlag.Name) {
-		tracer = vm.NewJSONLogger(logconfig, os.Stdout)
-	} else if ctx.GlobalBool(DebugFlag.Name) {
-		debugLogger = vm.NewStructLogger(logconfig)
-		tracer = debugLogger
-	} else {
-		debugLogger = vm.NewStructLogger(logconfig)
-	}
-	if ctx.GlobalString(GenesisFlag.Name) != "" {
-		gen := readGenesis(ctx.GlobalString(GenesisFlag.Name))
-		genesisConfig = gen
-		db := rawdb.NewMemoryDatabase()
-		genesis := core.GenesisToBlock(gen, db)
-		statedb, _ = state.New(genesis.Root(), state.NewDatabase(db))
-		chainConfig = gen.Config
-	} else {
-		statedb, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
-		genesisConfig = new(genesisT.Genesis)
-	}
-	if ctx.GlobalString(SenderFlag.Name) != "" {
-		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
-	}
-	statedb.CreateAccount(sender)
-
-	if ctx.GlobalString(ReceiverFlag.Name) != "" {
-		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
-	}
-
-	var (
-		code []byte
-		ret  []byte
-		err  error
-	)
+// readCode loads the code to execute, either from the '--code' or '--codefile'
+// flags, or by compiling the EASM file given as the first argument.
+func readCode(ctx *cli.Context) ([]byte, error) {
 	codeFileFlag := ctx.GlobalString(CodeFileFlag.Name)
 	codeFlag := ctx.GlobalString(CodeFlag.Name)
 
 	// The '--code' or '--codefile' flag overrides code in state
 	if codeFileFlag != "" || codeFlag != "" {
-		var hexcode []byte
+		var (
+			hexcode []byte
+			err     error
+		)
 		if codeFileFlag != "" {
-			var err error
 			// If - is specified, it means that code comes from stdin
 			if codeFileFlag == "-" {
 				//Try reading from stdin
 				if hexcode, err = ioutil.ReadAll(os.Stdin); err != nil {
-					fmt.Printf("Could not load code from stdin: %v\n", err)
-					os.Exit(1)
+					return nil, fmt.Errorf("could not load code from stdin: %v", err)
 				}
 			} else {
 				// Codefile with hex assembly
 				if hexcode, err = ioutil.ReadFile(codeFileFlag); err != nil {
-					fmt.Printf("Could not load code from file: %v\n", err)
-					os.Exit(1)
+					return nil, fmt.Errorf("could not load code from file: %v", err)
 				}
 			}
 		} else {
@@ -150,27 +101,73 @@ func runCmd(ctx *cli.Context) error {
 		}
 		hexcode = bytes.TrimSpace(hexcode)
 		if len(hexcode)%2 != 0 {
-			fmt.Printf("Invalid input length for hex data (%d)\n", len(hexcode))
-			os.Exit(1)
+			return nil, fmt.Errorf("invalid input length for hex data (%d)", len(hexcode))
 		}
-		code = common.FromHex(string(hexcode))
-	} else if fn := ctx.Args().First(); len(fn) > 0 {
+		return common.FromHex(string(hexcode)), nil
+	}
+	if fn := ctx.Args().First(); len(fn) > 0 {
 		// EASM-file to compile
 		src, err := ioutil.ReadFile(fn)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		bin, err := compiler.Compile(fn, src, false)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		return common.Hex2Bytes(bin), nil
+	}
+	return nil, nil
+}
+
+// readInput loads the call data from the '--inputfile' or '--input' flags.
+func readInput(ctx *cli.Context) ([]byte, error) {
+	var hexInput []byte
+	if inputFileFlag := ctx.GlobalString(InputFileFlag.Name); inputFileFlag != "" {
+		var err error
+		if hexInput, err = ioutil.ReadFile(inputFileFlag); err != nil {
+			return nil, fmt.Errorf("could not load input from file: %v", err)
 		}
-		code = common.Hex2Bytes(bin)
+	} else {
+		hexInput = []byte(ctx.GlobalString(InputFlag.Name))
+	}
+	return common.FromHex(string(bytes.TrimSpace(hexInput))), nil
+}
+
+// makeRuntimeConfig assembles the execution environment from the global flags,
+// returning it along with the address of the receiver to call.
+func makeRuntimeConfig(ctx *cli.Context, tracer vm.Tracer) (*runtime.Config, common.Address) {
+	var (
+		statedb       *state.StateDB
+		chainConfig   ctypes.ChainConfigurator
+		sender        = common.BytesToAddress([]byte("sender"))
+		receiver      = common.BytesToAddress([]byte("receiver"))
+		genesisConfig *genesisT.Genesis
+	)
+	if ctx.GlobalString(GenesisFlag.Name) != "" {
+		gen := readGenesis(ctx.GlobalString(GenesisFlag.Name))
+		genesisConfig = gen
+		db := rawdb.NewMemoryDatabase()
+		genesis := core.GenesisToBlock(gen, db)
+		statedb, _ = state.New(genesis.Root(), state.NewDatabase(db))
+		chainConfig = gen.Config
+	} else {
+		statedb, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		genesisConfig = new(genesisT.Genesis)
+	}
+	if ctx.GlobalString(SenderFlag.Name) != "" {
+		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
+	}
+	statedb.CreateAccount(sender)
+
+	if ctx.GlobalString(ReceiverFlag.Name) != "" {
+		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
 	}
 	initialGas := ctx.GlobalUint64(GasFlag.Name)
 	if genesisConfig.GasLimit != 0 {
 		initialGas = genesisConfig.GasLimit
 	}
-	runtimeConfig := runtime.Config{
+	cfg := &runtime.Config{
 		Origin:      sender,
 		State:       statedb,
 		GasLimit:    initialGas,
@@ -182,10 +179,64 @@ func runCmd(ctx *cli.Context) error {
 		BlockNumber: new(big.Int).SetUint64(genesisConfig.Number),
 		EVMConfig: vm.Config{
 			Tracer:         tracer,
-			Debug:          ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(MachineFlag.Name),
+			Debug:          tracer != nil,
 			EVMInterpreter: ctx.GlobalString(EVMInterpreterFlag.Name),
 		},
 	}
+	if chainConfig != nil {
+		cfg.ChainConfig = chainConfig
+	} else {
+		cfg.ChainConfig = params.AllEthashProtocolChanges
+	}
+	return cfg, receiver
+}
+
+// execute runs the code against the configured environment, either deploying
+// it with the input appended if create is set, or calling it at the receiver.
+func execute(cfg *runtime.Config, receiver common.Address, code, input []byte, create bool) (ret []byte, leftOverGas uint64, err error) {
+	if create {
+		input = append(code, input...)
+		ret, _, leftOverGas, err = runtime.Create(input, cfg)
+		return ret, leftOverGas, err
+	}
+	if len(code) > 0 {
+		cfg.State.SetCode(receiver, code)
+	}
+	return runtime.Call(receiver, input, cfg)
+}
+
+func runCmd(ctx *cli.Context) error {
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+	logconfig := &vm.LogConfig{
+		DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+		DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		Debug:         ctx.GlobalBool(DebugFlag.Name),
+	}
+
+	var (
+		tracer      vm.Tracer
+		debugLogger *vm.StructLogger
+	)
+	if ctx.GlobalBool(MachineFlag.Name) {
+		tracer = vm.NewJSONLogger(logconfig, os.Stdout)
+	} else if ctx.GlobalBool(DebugFlag.Name) {
+		debugLogger = vm.NewStructLogger(logconfig)
+		tracer = debugLogger
+	} else {
+		debugLogger = vm.NewStructLogger(logconfig)
+	}
+	code, err := readCode(ctx)
+	if err != nil {
+		return err
+	}
+	input, err := readInput(ctx)
+	if err != nil {
+		return err
+	}
+	runtimeConfig, receiver := makeRuntimeConfig(ctx, tracer)
+	statedb := runtimeConfig.State
 
 	if cpuProfilePath := ctx.GlobalString(CPUProfileFlag.Name); cpuProfilePath != "" {
 		f, err := os.Create(cpuProfilePath)
@@ -200,32 +251,8 @@ func runCmd(ctx *cli.Context) error {
 		defer pprof.StopCPUProfile()
 	}
 
-	if chainConfig != nil {
-		runtimeConfig.ChainConfig = chainConfig
-	} else {
-		runtimeConfig.ChainConfig = params.AllEthashProtocolChanges
-	}
 	tstart := time.Now()
-	var leftOverGas uint64
-	var hexInput []byte
-	if inputFileFlag := ctx.GlobalString(InputFileFlag.Name); inputFileFlag != "" {
-		if hexInput, err = ioutil.ReadFile(inputFileFlag); err != nil {
-			fmt.Printf("could not load input from file: %v\n", err)
-			os.Exit(1)
-		}
-	} else {
-		hexInput = []byte(ctx.GlobalString(InputFlag.Name))
-	}
-	input := common.FromHex(string(bytes.TrimSpace(hexInput)))
-	if ctx.GlobalBool(CreateFlag.Name) {
-		input = append(code, input...)
-		ret, _, leftOverGas, err = runtime.Create(input, &runtimeConfig)
-	} else {
-		if len(code) > 0 {
-			statedb.SetCode(receiver, code)
-		}
-		ret, leftOverGas, err = runtime.Call(receiver, input, &runtimeConfig)
-	}
+	ret, leftOverGas, err := execute(runtimeConfig, receiver, code, input, ctx.GlobalBool(CreateFlag.Name))
 	execTime := time.Since(tstart)
 
 	if ctx.GlobalBool(DumpFlag.Name) {
@@ -266,7 +293,7 @@ total allocations:  %d
 GC calls:           %d
 Gas used:           %d
 
-`, execTime, mem.HeapObjects, mem.Alloc, mem.TotalAlloc, mem.NumGC, initialGas-leftOverGas)
+`, execTime, mem.HeapObjects, mem.Alloc, mem.TotalAlloc, mem.NumGC, runtimeConfig.GasLimit-leftOverGas)
 	}
 	if tracer == nil {
 		fmt.Printf("0x%x\n", ret)
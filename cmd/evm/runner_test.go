@@ -0,0 +1,95 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// Tests that the blockchain test runner reports the outcome of every test and
+// fails the command if any of them fails.
+func TestBlockTestRunner(t *testing.T) {
+	pass := filepath.Join("testdata", "blocktest_pass.json")
+	results, err := runBlockTests(pass, nil, "")
+	if err != nil {
+		t.Fatalf("failed to run tests: %v", err)
+	}
+	if len(results) != 1 || !results[0].Pass || results[0].Fork != "Frontier" {
+		t.Fatalf("passing test results mismatch: %+v", results)
+	}
+	// Running with an explicit configuration reports the chainspec as the fork
+	if results, err = runBlockTests(pass, tests.Forks["Frontier"], "frontier.json"); err != nil {
+		t.Fatalf("failed to run tests: %v", err)
+	}
+	if len(results) != 1 || !results[0].Pass || results[0].Fork != "frontier.json" {
+		t.Fatalf("chainspec test results mismatch: %+v", results)
+	}
+	fail := filepath.Join("testdata", "blocktest_fail.json")
+	if results, err = runBlockTests(fail, nil, ""); err != nil {
+		t.Fatalf("failed to run tests: %v", err)
+	}
+	if len(results) != 1 || results[0].Pass || results[0].Error == "" {
+		t.Fatalf("failing test results mismatch: %+v", results)
+	}
+	if err := app.Run([]string{"evm", "blocktest", pass}); err != nil {
+		t.Fatalf("passing tests failed the command: %v", err)
+	}
+	if err := app.Run([]string{"evm", "blocktest", fail}); err == nil {
+		t.Fatalf("failing tests passed the command")
+	}
+}
+
+// Tests that the difficulty test runner reports the outcome of every test and
+// fails the command if any of them fails, but not for the skipped ones.
+func TestDifficultyTestRunner(t *testing.T) {
+	config, _ := tests.DifficultyConfig("Homestead")
+
+	pass := filepath.Join("testdata", "difficultytest_pass.json")
+	results, err := runDifficultyTests(pass, config, "Homestead")
+	if err != nil {
+		t.Fatalf("failed to run tests: %v", err)
+	}
+	want := []DifficultytestResult{
+		{Name: "belowMinimum", Pass: true, Skipped: true, Fork: "Homestead"},
+		{Name: "decrease", Pass: true, Fork: "Homestead"},
+		{Name: "increase", Pass: true, Fork: "Homestead"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d mismatch: have %+v, want %+v", i, results[i], want[i])
+		}
+	}
+	fail := filepath.Join("testdata", "difficultytest_fail.json")
+	if results, err = runDifficultyTests(fail, config, "Homestead"); err != nil {
+		t.Fatalf("failed to run tests: %v", err)
+	}
+	if len(results) != 2 || !results[0].Pass || results[1].Pass || results[1].Error == "" {
+		t.Fatalf("failing test results mismatch: %+v", results)
+	}
+	if err := app.Run([]string{"evm", "difficultytest", "--fork", "Homestead", pass}); err != nil {
+		t.Fatalf("passing tests failed the command: %v", err)
+	}
+	if err := app.Run([]string{"evm", "difficultytest", "--fork", "Homestead", fail}); err == nil {
+		t.Fatalf("failing tests passed the command")
+	}
+}
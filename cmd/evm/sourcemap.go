@@ -0,0 +1,122 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// sourceLocation is a single entry of a solc source map, locating the source
+// range an instruction was generated from.
+type sourceLocation struct {
+	Start  int    // Byte offset of the range in the source file
+	Length int    // Byte length of the range
+	File   int    // Index of the source file, -1 if generated by the compiler
+	Jump   string // Whether the instruction jumps into (i) or out of (o) a function
+}
+
+// sourceMap maps the program counters of a piece of code back to the source
+// files it was compiled from.
+type sourceMap struct {
+	locations []sourceLocation // Source locations, indexed by instruction
+	pcs       map[uint64]int   // Instruction index of each program counter
+	sources   []string         // Contents of the source files, indexed by file
+}
+
+// newSourceMap parses a solc source map in its compressed "s:l:f:j" form, where
+// empty fields inherit the value of the preceding entry, and ties it to the code
+// it was emitted for.
+func newSourceMap(srcmap string, code []byte, sources []string) (*sourceMap, error) {
+	var (
+		locations []sourceLocation
+		last      = sourceLocation{File: -1}
+	)
+	for i, entry := range strings.Split(strings.TrimSpace(srcmap), ";") {
+		loc := last
+		for j, field := range strings.Split(entry, ":") {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				loc.Jump = field
+				continue
+			}
+			if j > 3 {
+				break
+			}
+			num, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d: %v", i, err)
+			}
+			switch j {
+			case 0:
+				loc.Start = num
+			case 1:
+				loc.Length = num
+			case 2:
+				loc.File = num
+			}
+		}
+		locations = append(locations, loc)
+		last = loc
+	}
+	// Number the instructions of the code, skipping over push data
+	pcs := make(map[uint64]int)
+	for pc, idx := uint64(0), 0; pc < uint64(len(code)); idx++ {
+		pcs[pc] = idx
+		op := vm.OpCode(code[pc])
+		if op.IsPush() {
+			pc += uint64(op - vm.PUSH1 + 1)
+		}
+		pc++
+	}
+	return &sourceMap{locations: locations, pcs: pcs, sources: sources}, nil
+}
+
+// lookup returns the source location of the instruction at the given program
+// counter, if it is covered by the source map.
+func (m *sourceMap) lookup(pc uint64) (sourceLocation, bool) {
+	idx, ok := m.pcs[pc]
+	if !ok || idx >= len(m.locations) {
+		return sourceLocation{}, false
+	}
+	return m.locations[idx], true
+}
+
+// position resolves a source location to its line and column, both counted from
+// one, along with the text of the line it starts on. The line is only known if
+// the referenced source file was provided.
+func (m *sourceMap) position(loc sourceLocation) (line, col int, text string, ok bool) {
+	if loc.File < 0 || loc.File >= len(m.sources) || loc.Start > len(m.sources[loc.File]) {
+		return 0, 0, "", false
+	}
+	src := m.sources[loc.File]
+	lineStart := strings.LastIndexByte(src[:loc.Start], '\n') + 1
+	lineEnd := strings.IndexByte(src[loc.Start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += loc.Start
+	}
+	line = strings.Count(src[:loc.Start], "\n") + 1
+	col = loc.Start - lineStart + 1
+	return line, col, src[lineStart:lineEnd], true
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that compressed source maps are expanded and tied to the instructions of
+// the code, skipping over push data.
+func TestSourceMap(t *testing.T) {
+	var (
+		code    = common.FromHex("602a60015500") // PUSH1 0x2a, PUSH1 0x01, SSTORE, STOP
+		sources = []string{"contract A {\n  uint x;\n}\n"}
+	)
+	srcmap, err := newSourceMap("0:10:0:i;15:6;;:::o", code, sources)
+	if err != nil {
+		t.Fatalf("failed to parse source map: %v", err)
+	}
+	tests := []struct {
+		pc  uint64
+		ok  bool
+		loc sourceLocation
+	}{
+		{0, true, sourceLocation{Start: 0, Length: 10, File: 0, Jump: "i"}},
+		{1, false, sourceLocation{}}, // push data
+		{2, true, sourceLocation{Start: 15, Length: 6, File: 0, Jump: "i"}},
+		{4, true, sourceLocation{Start: 15, Length: 6, File: 0, Jump: "i"}},
+		{5, true, sourceLocation{Start: 15, Length: 6, File: 0, Jump: "o"}},
+		{6, false, sourceLocation{}}, // past the code
+	}
+	for _, tt := range tests {
+		loc, ok := srcmap.lookup(tt.pc)
+		if ok != tt.ok || loc != tt.loc {
+			t.Errorf("pc %d: location mismatch: have %+v (%v), want %+v (%v)", tt.pc, loc, ok, tt.loc, tt.ok)
+		}
+	}
+	// Resolve locations to their line and column in the source
+	line, col, text, ok := srcmap.position(sourceLocation{Start: 15, Length: 6, File: 0})
+	if !ok || line != 2 || col != 3 || text != "  uint x;" {
+		t.Errorf("position mismatch: have %d:%d %q (%v), want 2:3 %q", line, col, text, ok, "  uint x;")
+	}
+	if line, col, text, ok = srcmap.position(sourceLocation{Start: 0, File: 0}); !ok || line != 1 || col != 1 || text != "contract A {" {
+		t.Errorf("position mismatch: have %d:%d %q (%v), want 1:1 %q", line, col, text, ok, "contract A {")
+	}
+	for _, loc := range []sourceLocation{{File: -1}, {File: 1}, {Start: 100, File: 0}} {
+		if _, _, _, ok := srcmap.position(loc); ok {
+			t.Errorf("position resolved for unavailable source location %+v", loc)
+		}
+	}
+	// Malformed entries must be rejected
+	if _, err := newSourceMap("0:10:0;x:1", code, sources); err == nil {
+		t.Errorf("malformed source map accepted")
+	}
+}
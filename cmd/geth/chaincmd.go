@@ -97,11 +97,47 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	importEraCommand = cli.Command{
+		Action:    utils.MigrateFlags(importEra),
+		Name:      "import-era",
+		Usage:     "Import ancient chain segments from era archives",
+		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The import-era command imports blocks, receipts and total difficulties from era
+archives produced by export-era directly into the ancient store, without
+re-executing the blocks. The archives must be imported in chain order.`,
+	}
+	exportEraCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportEra),
+		Name:      "export-era",
+		Usage:     "Export ancient chain segments into an era archive",
+		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Requires a first argument of the file to write to.
+Optional second and third arguments control the first and
+last block to write, otherwise all frozen blocks are exported.
+Only blocks already moved into the ancient store can be exported.
+If the file ends with .gz, the output will be gzipped.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
 		Name:      "import-preimages",
-		Usage:     "Import the preimage database from an RLP stream",
+		Usage:     "Import the preimage database from a preimage index or an RLP stream",
 		ArgsUsage: "<datafile>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
@@ -110,12 +146,14 @@ be gzipped.`,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
-	The import-preimages command imports hash preimages from an RLP encoded stream.`,
+The import-preimages command imports hash preimages from a preimage index as
+produced by export-preimages, or from an RLP encoded stream. If the file ends
+with .gz, the stream is gunzipped.`,
 	}
 	exportPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(exportPreimages),
 		Name:      "export-preimages",
-		Usage:     "Export the preimage database into an RLP stream",
+		Usage:     "Export the preimage database into a preimage index",
 		ArgsUsage: "<dumpfile>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
@@ -124,7 +162,48 @@ be gzipped.`,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
-The export-preimages command export hash preimages to an RLP encoded stream`,
+The export-preimages command exports hash preimages into a preimage index: a
+compact file holding the addresses, storage keys and any other preimages ordered
+by hash, with a trailer allowing lookups without loading the file. If the file
+ends with .gz, the preimages are exported as a gzipped RLP stream instead.`,
+	}
+	exportBadBlocksCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportBadBlocks),
+		Name:      "export-badblocks",
+		Usage:     "Export bad blocks into replayable bundles",
+		ArgsUsage: "<directory> [<blockHash>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The export-badblocks command writes a JSON bundle for every bad block persisted
+by the node into the given directory. Each bundle holds the block RLP, the error
+it was rejected with, the receipts produced before the failure, the chain config
+and the part of the parent state accessed by the block, so the rejection can be
+reproduced offline with 'evm badblock'. An optional block hash limits the export
+to a single bad block.`,
+	}
+	exportStateDiffsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportStateDiffs),
+		Name:      "export-statediffs",
+		Usage:     "Export the state changes made by a range of blocks",
+		ArgsUsage: "<filename> <blockNumFirst> <blockNumLast>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The export-statediffs command re-executes the given range of blocks and writes
+the state diff of each of them into the file as a line of JSON: every account
+changed by the block along with the pre and post values of its balance, nonce,
+code and storage. Only the state of the parent of the first block is required,
+the state of the rest is regenerated while exporting. If the file ends with .gz,
+the output will be gzipped.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -178,6 +257,28 @@ Remove blockchain and state databases`,
 		Description: `
 The arguments are interpreted as block numbers or hashes.
 Use "ethereum dump 0" to dump the genesis block.`,
+	}
+	verifyStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(verifyState),
+		Name:      "verify-state",
+		Usage:     "Verify the integrity of a state trie",
+		ArgsUsage: "[<root>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.StateStartFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The verify-state command walks the account trie with the given root and the storage
+trie of every account, checking that all trie nodes are present and match their
+hashes, and that the code of every contract is available. If no root is given, the
+state of the current head block is verified.
+
+Long verifications can be interrupted and resumed later via --start, using the
+cursor reported on interruption.`,
 	}
 	inspectCommand = cli.Command{
 		Action:    utils.MigrateFlags(inspect),
@@ -361,6 +462,62 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// importEra imports ancient chain segments from the specified era archives.
+func importEra(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack)
+	defer chain.Stop()
+
+	start := time.Now()
+	for _, arg := range ctx.Args() {
+		if err := utils.ImportEra(chain, arg); err != nil {
+			utils.Fatalf("Import error in %s: %v\n", arg, err)
+		}
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
+// exportEra dumps a range of frozen chain data into an era archive.
+func exportEra(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	frozen, err := db.Ancients()
+	if err != nil {
+		utils.Fatalf("Failed to retrieve ancient store size: %v", err)
+	}
+	if frozen == 0 {
+		utils.Fatalf("Ancient store is empty, nothing to export")
+	}
+	first, last := uint64(0), frozen-1
+	if len(ctx.Args()) >= 3 {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+	}
+	start := time.Now()
+	if err := utils.ExportEra(db, ctx.Args().First(), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -397,6 +554,53 @@ func exportPreimages(ctx *cli.Context) error {
 	return nil
 }
 
+func exportBadBlocks(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	var hash *common.Hash
+	if len(ctx.Args()) > 1 {
+		h := common.HexToHash(ctx.Args().Get(1))
+		hash = &h
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer chain.Stop()
+
+	start := time.Now()
+	if err := utils.ExportBadBlocks(chain, db, ctx.Args().First(), hash); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+// exportStateDiffs writes the state diffs of a range of blocks into a file.
+func exportStateDiffs(ctx *cli.Context) error {
+	if len(ctx.Args()) < 3 {
+		utils.Fatalf("This command requires three arguments.")
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer chain.Stop()
+
+	start := time.Now()
+	if err := utils.ExportStateDiffs(chain, db, ctx.Args().First(), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) < 1 {
@@ -416,7 +620,7 @@ func copyDb(ctx *cli.Context) error {
 	if syncMode == downloader.FastSync {
 		syncBloom = trie.NewSyncBloom(uint64(ctx.GlobalInt(utils.CacheFlag.Name)/2), chainDb)
 	}
-	dl := downloader.New(0, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
+	dl := downloader.New(nil, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
 	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "")
@@ -552,6 +756,42 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+// verifyState checks the integrity of the state trie with the given root.
+func verifyState(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var root common.Hash
+	if ctx.NArg() > 0 {
+		if !hashish(ctx.Args().First()) {
+			utils.Fatalf("Invalid state root: %s", ctx.Args().First())
+		}
+		root = common.HexToHash(ctx.Args().First())
+	} else {
+		head := rawdb.ReadHeadBlockHash(db)
+		number := rawdb.ReadHeaderNumber(db, head)
+		if number == nil {
+			utils.Fatalf("Failed to retrieve the head block")
+		}
+		header := rawdb.ReadHeader(db, head, *number)
+		if header == nil {
+			utils.Fatalf("Failed to retrieve the head header #%d [%x]", *number, head)
+		}
+		root = header.Root
+	}
+	var start common.Hash
+	if ctx.IsSet(utils.StateStartFlag.Name) {
+		start = common.HexToHash(ctx.String(utils.StateStartFlag.Name))
+	}
+	if err := utils.VerifyState(db, root, start); err != nil {
+		utils.Fatalf("State verification failed: %v", err)
+	}
+	return nil
+}
+
 func inspect(ctx *cli.Context) error {
 	node, _ := makeConfigNode(ctx)
 	defer node.Close()
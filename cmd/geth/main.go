@@ -92,6 +92,9 @@ var (
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
+		utils.HistoryLimitFlag,
+		utils.TxLookupLimitFlag,
+		utils.ParallelExecFlag,
 		utils.LightServeFlag,
 		utils.LightLegacyServFlag,
 		utils.LightIngressFlag,
@@ -176,6 +179,7 @@ var (
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCap,
+		utils.RPCStateReexecFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -207,12 +211,17 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		importEraCommand,
+		exportEraCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
+		exportBadBlocksCommand,
+		exportStateDiffsCommand,
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
 		inspectCommand,
+		verifyStateCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
@@ -0,0 +1,172 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/confp/generic"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BadBlockBundle is everything needed to reproduce the rejection of a bad block
+// offline: the block itself, the chain config it was executed with, the part of
+// the parent state and the ancestor headers accessed while executing it, and the
+// outcome recorded by the node which rejected it.
+type BadBlockBundle struct {
+	Block    hexutil.Bytes    `json:"block"`    // RLP encoded bad block
+	Reason   string           `json:"reason"`   // Error the block was rejected with
+	Receipts []*types.Receipt `json:"receipts"` // Receipts of the transactions executed before the failure
+	Config   json.RawMessage  `json:"config"`   // Chain configuration the block was executed with
+
+	Headers []*types.Header `json:"headers"` // Parent header followed by any older ancestor accessed
+	Root    common.Hash     `json:"root"`    // State root of the parent block
+	Nodes   []hexutil.Bytes `json:"nodes"`   // Parent state trie nodes accessed by the block
+	Codes   []hexutil.Bytes `json:"codes"`   // Contract codes accessed by the block
+}
+
+// DecodeBlock returns the bad block contained in the bundle.
+func (b *BadBlockBundle) DecodeBlock() (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(b.Block, block); err != nil {
+		return nil, fmt.Errorf("invalid block: %v", err)
+	}
+	return block, nil
+}
+
+// DecodeConfig returns the chain configuration contained in the bundle.
+func (b *BadBlockBundle) DecodeConfig() (ctypes.ChainConfigurator, error) {
+	return generic.UnmarshalChainConfigurator(b.Config)
+}
+
+// Witness returns the stateless witness of the bad block contained in the bundle.
+func (b *BadBlockBundle) Witness() *core.BlockWitness {
+	witness := state.NewWitness(b.Root)
+	for _, blob := range b.Nodes {
+		witness.Nodes[crypto.Keccak256Hash(blob)] = blob
+	}
+	for _, code := range b.Codes {
+		witness.Codes[crypto.Keccak256Hash(code)] = code
+	}
+	return &core.BlockWitness{Headers: b.Headers, State: witness}
+}
+
+// ReadBadBlockBundle loads a bad block bundle from the given file.
+func ReadBadBlockBundle(fn string) (*BadBlockBundle, error) {
+	blob, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	bundle := new(BadBlockBundle)
+	if err := json.Unmarshal(blob, bundle); err != nil {
+		return nil, fmt.Errorf("invalid bad block bundle: %v", err)
+	}
+	return bundle, nil
+}
+
+// ExportBadBlocks writes a replayable bundle of each persisted bad block into the
+// given directory, named after the number and hash of the block. If a hash is
+// given, only the matching bad block is exported.
+func ExportBadBlocks(chain *core.BlockChain, db ethdb.Database, dir string, hash *common.Hash) error {
+	var bad []*rawdb.BadBlock
+	if hash == nil {
+		bad = rawdb.ReadAllBadBlocks(db)
+	} else if b := rawdb.ReadBadBlock(db, *hash); b != nil {
+		bad = append(bad, b)
+	}
+	if len(bad) == 0 {
+		return fmt.Errorf("no bad blocks found")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, b := range bad {
+		bundle, err := newBadBlockBundle(chain, db, b)
+		if err != nil {
+			log.Warn("Failed to export bad block", "number", b.Block.Number(), "hash", b.Block.Hash(), "err", err)
+			continue
+		}
+		blob, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return err
+		}
+		fn := filepath.Join(dir, fmt.Sprintf("badblock-%d-%x.json", b.Block.NumberU64(), b.Block.Hash().Bytes()[:4]))
+		if err := ioutil.WriteFile(fn, blob, 0644); err != nil {
+			return err
+		}
+		log.Info("Exported bad block", "number", b.Block.Number(), "hash", b.Block.Hash(), "file", fn)
+	}
+	return nil
+}
+
+// newBadBlockBundle assembles the bundle of a bad block from the witness recorded
+// when the block was rejected.
+func newBadBlockBundle(chain *core.BlockChain, db ethdb.Database, bad *rawdb.BadBlock) (*BadBlockBundle, error) {
+	block := bad.Block
+	witness := bad.Witness
+	if witness == nil {
+		witness = rawdb.ReadBadBlockWitness(db, block.Hash())
+	}
+	if witness == nil {
+		return nil, fmt.Errorf("no witness recorded on rejection")
+	}
+	blockRLP, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(chain.Config())
+	if err != nil {
+		return nil, err
+	}
+	bundle := &BadBlockBundle{
+		Block:    blockRLP,
+		Reason:   bad.Reason,
+		Receipts: bad.Receipts,
+		Config:   config,
+		Headers:  witness.Headers,
+		Root:     witness.Root,
+		Nodes:    make([]hexutil.Bytes, len(witness.Nodes)),
+		Codes:    make([]hexutil.Bytes, len(witness.Codes)),
+	}
+	if bundle.Receipts == nil {
+		bundle.Receipts = []*types.Receipt{}
+	}
+	if txs := block.Transactions(); len(bad.Receipts) <= len(txs) {
+		bad.Receipts.DeriveFields(chain.Config(), block.Hash(), block.NumberU64(), txs[:len(bad.Receipts)])
+	}
+	for i, blob := range witness.Nodes {
+		bundle.Nodes[i] = blob
+	}
+	for i, code := range witness.Codes {
+		bundle.Codes[i] = code
+	}
+	return bundle, nil
+}
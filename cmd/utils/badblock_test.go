@@ -0,0 +1,120 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that rejected blocks are persisted and can be exported into bundles which
+// reproduce the rejection offline.
+func TestExportBadBlocks(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(vars.Ether)}},
+		}
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, gendb, 2, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	// Corrupt the state root of the last block to have it rejected
+	header := types.CopyHeader(blocks[1].Header())
+	header.Root = common.Hash{0x01}
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[1].Transactions(), blocks[1].Uncles())
+
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks[:1]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	_, reason := chain.InsertChain(types.Blocks{bad})
+	if reason == nil {
+		t.Fatalf("bad block accepted")
+	}
+	if blocks := chain.BadBlocks(); len(blocks) != 1 || blocks[0].Hash() != bad.Hash() {
+		t.Fatalf("bad block not persisted: %v", blocks)
+	}
+	if rawdb.ReadBadBlockWitness(db, bad.Hash()) == nil {
+		t.Fatalf("bad block witness not recorded on rejection")
+	}
+	// Export the bad block and replay it from the bundle
+	dir, err := ioutil.TempDir("", "badblocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hash := bad.Hash()
+	if err := ExportBadBlocks(chain, db, dir, &hash); err != nil {
+		t.Fatalf("failed to export bad blocks: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("exported bundle count mismatch: have %d, want 1", len(files))
+	}
+	bundle, err := ReadBadBlockBundle(files[0])
+	if err != nil {
+		t.Fatalf("failed to read bundle: %v", err)
+	}
+	if bundle.Reason != reason.Error() {
+		t.Fatalf("reason mismatch: have %q, want %q", bundle.Reason, reason)
+	}
+	block, err := bundle.DecodeBlock()
+	if err != nil {
+		t.Fatalf("failed to decode block: %v", err)
+	}
+	config, err := bundle.DecodeConfig()
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	err = core.VerifyWitness(config, ethash.NewFaker(), block, bundle.Witness())
+	if err == nil || err.Error() != bundle.Reason {
+		t.Fatalf("replay error mismatch: have %v, want %q", err, bundle.Reason)
+	}
+}
@@ -21,15 +21,18 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"os/signal"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -237,54 +240,206 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
-// ImportPreimages imports a batch of exported hash preimages into the database.
-func ImportPreimages(db ethdb.Database, fn string) error {
-	log.Info("Importing preimages", "file", fn)
+// ExportEra exports the frozen ancient chain segment between first and last
+// (inclusive) into a self-describing, checksummed era archive.
+func ExportEra(db ethdb.Database, fn string, first uint64, last uint64) error {
+	log.Info("Exporting era archive", "file", fn, "first", first, "last", last)
 
-	// Open the file handle and potentially unwrap the gzip stream
-	fh, err := os.Open(fn)
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	if err := rawdb.ExportAncients(db, writer, first, last); err != nil {
+		return err
+	}
+	log.Info("Exported era archive", "file", fn)
+	return nil
+}
+
+// openEra opens an era archive, potentially unwrapping the gzip stream.
+func openEra(fn string) (*rawdb.EraReader, io.Closer, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
 	var reader io.Reader = fh
 	if strings.HasSuffix(fn, ".gz") {
 		if reader, err = gzip.NewReader(reader); err != nil {
-			return err
+			fh.Close()
+			return nil, nil, err
 		}
 	}
-	stream := rlp.NewStream(reader, 0)
+	era, err := rawdb.NewEraReader(reader)
+	if err != nil {
+		fh.Close()
+		return nil, nil, err
+	}
+	return era, fh, nil
+}
 
-	// Import the preimages in batches to prevent disk trashing
-	preimages := make(map[common.Hash][]byte)
+// ImportEra imports the chain segment contained in an era archive straight into
+// the ancient store. Blocks are not re-executed, but every block is checked for
+// internal consistency and the headers are verified by the consensus engine.
+func ImportEra(chain *core.BlockChain, fn string) error {
+	log.Info("Importing era archive", "file", fn)
 
+	// Verify the archive checksum before touching the database
+	era, closer, err := openEra(fn)
+	if err != nil {
+		return err
+	}
 	for {
-		// Read the next entry and ensure it's not junk
-		var blob []byte
+		if _, err = era.Next(); err != nil {
+			break
+		}
+	}
+	closer.Close()
+	if err != io.EOF {
+		return err
+	}
+	// Archive intact, make sure it belongs to our chain and import it
+	if era, closer, err = openEra(fn); err != nil {
+		return err
+	}
+	defer closer.Close()
 
-		if err := stream.Decode(&blob); err != nil {
-			if err == io.EOF {
-				break
+	if genesis := era.Header().Genesis; genesis != chain.Genesis().Hash() {
+		return fmt.Errorf("genesis mismatch: %x (archive) != %x (local)", genesis, chain.Genesis().Hash())
+	}
+	var (
+		blocks   = make(types.Blocks, 0, importBatchSize)
+		receipts = make([]types.Receipts, 0, importBatchSize)
+		tds      = make([]*big.Int, 0, importBatchSize)
+	)
+	for done := false; !done; {
+		entry, err := era.Next()
+		switch {
+		case err == io.EOF:
+			done = true
+		case err != nil:
+			return err
+		default:
+			block, blockReceipts, td, err := entry.Block()
+			if err != nil {
+				return err
 			}
+			// Skip the genesis and anything we already have
+			if block.NumberU64() == 0 || chain.HasFastBlock(block.Hash(), block.NumberU64()) {
+				continue
+			}
+			blocks, receipts, tds = append(blocks, block), append(receipts, blockReceipts), append(tds, td)
+			if len(blocks) < importBatchSize {
+				continue
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if err := importEraBatch(chain, blocks, receipts, tds); err != nil {
 			return err
 		}
-		// Accumulate the preimages and flush when enough ws gathered
+		blocks, receipts, tds = blocks[:0], receipts[:0], tds[:0]
+	}
+	return nil
+}
+
+// importEraBatch inserts a contiguous batch of archived blocks and their receipts
+// into the ancient store, cross-checking the archived total difficulties.
+func importEraBatch(chain *core.BlockChain, blocks types.Blocks, receipts []types.Receipts, tds []*big.Int) error {
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 100); err != nil {
+		return fmt.Errorf("invalid header #%d: %v", headers[n].Number, err)
+	}
+	for i, block := range blocks {
+		if td := chain.GetTd(block.Hash(), block.NumberU64()); td == nil || td.Cmp(tds[i]) != 0 {
+			return fmt.Errorf("total difficulty mismatch #%d: have %v, want %v", block.NumberU64(), td, tds[i])
+		}
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, blocks[len(blocks)-1].NumberU64()); err != nil {
+		return fmt.Errorf("invalid block #%d: %v", blocks[n].NumberU64(), err)
+	}
+	return nil
+}
+
+// ImportPreimages imports a batch of exported hash preimages into the database.
+// Both preimage indexes and gzipped or plain RLP streams are accepted.
+func ImportPreimages(db ethdb.Database, fn string) error {
+	log.Info("Importing preimages", "file", fn)
+
+	// Open the file handle and potentially unwrap the gzip stream
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	// Import the preimages in batches to prevent disk trashing
+	var (
+		preimages = make(map[common.Hash][]byte)
+		imported  int
+	)
+	add := func(blob []byte) error {
 		preimages[crypto.Keccak256Hash(blob)] = common.CopyBytes(blob)
 		if len(preimages) > 1024 {
 			rawdb.WritePreimages(db, preimages)
+			imported += len(preimages)
 			preimages = make(map[common.Hash][]byte)
 		}
+		return nil
+	}
+	if info, err := fh.Stat(); err == nil && rawdb.IsPreimageIndex(fh, info.Size()) {
+		index, err := rawdb.OpenPreimageIndex(fh, info.Size())
+		if err != nil {
+			return err
+		}
+		if err := index.Iterate(add); err != nil {
+			return err
+		}
+	} else {
+		var reader io.Reader = fh
+		if strings.HasSuffix(fn, ".gz") {
+			if reader, err = gzip.NewReader(reader); err != nil {
+				return err
+			}
+		}
+		stream := rlp.NewStream(reader, 0)
+		for {
+			// Read the next entry and ensure it's not junk
+			var blob []byte
+
+			if err := stream.Decode(&blob); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			add(blob)
+		}
 	}
 	// Flush the last batch preimage data
 	if len(preimages) > 0 {
 		rawdb.WritePreimages(db, preimages)
+		imported += len(preimages)
 	}
+	log.Info("Imported preimages", "file", fn, "count", imported)
 	return nil
 }
 
 // ExportPreimages exports all known hash preimages into the specified file,
-// truncating any data already present in the file.
+// truncating any data already present in the file. The preimages are written
+// into a preimage index, unless the file ends with .gz, in which case they are
+// written as a gzipped RLP stream.
 func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exporting preimages", "file", fn)
 
@@ -295,11 +450,17 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	}
 	defer fh.Close()
 
-	var writer io.Writer = fh
-	if strings.HasSuffix(fn, ".gz") {
-		writer = gzip.NewWriter(writer)
-		defer writer.(*gzip.Writer).Close()
+	if !strings.HasSuffix(fn, ".gz") {
+		count, err := rawdb.ExportPreimageIndex(db, fh)
+		if err != nil {
+			return err
+		}
+		log.Info("Exported preimages", "file", fn, "count", count)
+		return nil
 	}
+	writer := gzip.NewWriter(fh)
+	defer writer.Close()
+
 	// Iterate over the preimages and export them
 	it := db.NewIteratorWithPrefix([]byte("secure-key-"))
 	defer it.Release()
@@ -312,3 +473,48 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exported preimages", "file", fn)
 	return nil
 }
+
+// VerifyState checks the integrity of the state with the given root, logging every
+// missing or corrupt trie node and missing contract code found. The verification
+// starts at the account with the given hashed address; if it's interrupted, the
+// cursor to resume from is reported.
+func VerifyState(db ethdb.Database, root common.Hash, start common.Hash) error {
+	// Watch for Ctrl-C while the verification is running.
+	// If a signal is received, the verification will stop at the next account.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	log.Info("Verifying state", "root", root, "start", start)
+
+	var (
+		accounts int
+		faults   int
+		begin    = time.Now()
+		logged   = time.Now()
+	)
+	err := state.VerifyState(state.NewDatabase(db), root, start, func(hash common.Hash) error {
+		select {
+		case <-interrupt:
+			return fmt.Errorf("interrupted, resume with --%s %x", StateStartFlag.Name, hash)
+		default:
+		}
+		accounts++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying state", "accounts", accounts, "faults", faults, "cursor", hash, "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+		return nil
+	}, func(fault *state.VerifyFault) {
+		faults++
+		log.Error("State fault detected", "owner", fault.Owner, "err", fault.Err)
+	})
+	if err != nil {
+		return err
+	}
+	if faults > 0 {
+		return fmt.Errorf("state %x has %d faults", root, faults)
+	}
+	log.Info("State verified", "root", root, "accounts", accounts, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
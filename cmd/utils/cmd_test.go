@@ -0,0 +1,216 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// eraTestChain is a generated chain frozen into an ancient store, to export era
+// archives from.
+type eraTestChain struct {
+	gspec    *genesisT.Genesis
+	blocks   []*types.Block
+	receipts []types.Receipts
+	tds      []*big.Int
+	db       ethdb.Database
+}
+
+// newEraTestChain generates a chain of the given length with a transaction in
+// every block and freezes it, genesis included, into a new ancient store in dir.
+func newEraTestChain(t *testing.T, dir string, n int) *eraTestChain {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config:     params.TestChainConfig,
+			Difficulty: vars.GenesisDifficulty,
+			Alloc:      genesisT.GenesisAlloc{address: {Balance: big.NewInt(vars.Ether)}},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, n, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "")
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	chain := &eraTestChain{gspec: gspec, db: db}
+	td := new(big.Int)
+	for i, block := range append([]*types.Block{genesis}, blocks...) {
+		var blockReceipts types.Receipts
+		if i > 0 {
+			blockReceipts = receipts[i-1]
+		}
+		td = new(big.Int).Add(td, block.Difficulty())
+		rawdb.WriteAncientBlock(db, block, blockReceipts, td)
+
+		chain.blocks = append(chain.blocks, block)
+		chain.receipts = append(chain.receipts, blockReceipts)
+		chain.tds = append(chain.tds, td)
+	}
+	return chain
+}
+
+// newEraImportChain creates an empty chain with the given genesis and its own
+// ancient store in dir, to import era archives into.
+func newEraImportChain(t *testing.T, dir string, gspec *genesisT.Genesis) (*core.BlockChain, ethdb.Database) {
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "")
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	core.MustCommitGenesis(db, gspec)
+
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	return chain, db
+}
+
+// Tests that a chain segment exported into an era archive, plain or gzipped, is
+// imported into a fresh chain with its total difficulties and receipts.
+func TestEraRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := newEraTestChain(t, filepath.Join(dir, "src"), 8)
+	defer src.db.Close()
+
+	for _, name := range []string{"chain.era", "chain.era.gz"} {
+		fn := filepath.Join(dir, name)
+		if err := ExportEra(src.db, fn, 0, 8); err != nil {
+			t.Fatalf("%s: failed to export era archive: %v", name, err)
+		}
+		chain, _ := newEraImportChain(t, filepath.Join(dir, name+".ancient"), src.gspec)
+		if err := ImportEra(chain, fn); err != nil {
+			t.Fatalf("%s: failed to import era archive: %v", name, err)
+		}
+		head := src.blocks[len(src.blocks)-1]
+		if have := chain.CurrentFastBlock().Hash(); have != head.Hash() {
+			t.Fatalf("%s: fast head mismatch: have %x, want %x", name, have, head.Hash())
+		}
+		if have := chain.CurrentHeader().Hash(); have != head.Hash() {
+			t.Fatalf("%s: header head mismatch: have %x, want %x", name, have, head.Hash())
+		}
+		for i, block := range src.blocks {
+			if td := chain.GetTd(block.Hash(), block.NumberU64()); td == nil || td.Cmp(src.tds[i]) != 0 {
+				t.Errorf("%s: block #%d td mismatch: have %v, want %v", name, i, td, src.tds[i])
+			}
+			if i == 0 {
+				continue
+			}
+			receipts := chain.GetReceiptsByHash(block.Hash())
+			if len(receipts) != len(src.receipts[i]) {
+				t.Fatalf("%s: block #%d receipt count mismatch: have %d, want %d", name, i, len(receipts), len(src.receipts[i]))
+			}
+			if have, want := types.DeriveSha(receipts), block.ReceiptHash(); have != want {
+				t.Errorf("%s: block #%d receipt root mismatch: have %x, want %x", name, i, have, want)
+			}
+			if receipts[0].TxHash != block.Transactions()[0].Hash() || receipts[0].BlockNumber.Uint64() != block.NumberU64() {
+				t.Errorf("%s: block #%d receipt fields not derived: %+v", name, i, receipts[0])
+			}
+		}
+		// Importing the same archive again is a no-op
+		if err := ImportEra(chain, fn); err != nil {
+			t.Fatalf("%s: failed to reimport era archive: %v", name, err)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that corrupted, truncated and foreign era archives are rejected without
+// importing anything.
+func TestEraImportCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := newEraTestChain(t, filepath.Join(dir, "src"), 8)
+	defer src.db.Close()
+
+	fn := filepath.Join(dir, "chain.era")
+	if err := ExportEra(src.db, fn, 0, 8); err != nil {
+		t.Fatalf("failed to export era archive: %v", err)
+	}
+	archive, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("failed to read era archive: %v", err)
+	}
+	corrupt := common.CopyBytes(archive)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	damaged := map[string][]byte{
+		"corrupt.era":   corrupt,
+		"truncated.era": archive[:len(archive)/2],
+	}
+	for name, blob := range damaged {
+		fn := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fn, blob, 0644); err != nil {
+			t.Fatalf("%s: failed to write era archive: %v", name, err)
+		}
+		chain, db := newEraImportChain(t, filepath.Join(dir, name+".ancient"), src.gspec)
+		if err := ImportEra(chain, fn); err == nil {
+			t.Errorf("%s: damaged era archive imported", name)
+		}
+		if head := chain.CurrentHeader().Number.Uint64(); head != 0 {
+			t.Errorf("%s: headers imported from damaged archive: head #%d", name, head)
+		}
+		if frozen, _ := db.Ancients(); frozen != 0 {
+			t.Errorf("%s: blocks frozen from damaged archive: %d", name, frozen)
+		}
+		chain.Stop()
+	}
+	// An intact archive of a different network is rejected too
+	foreign := &genesisT.Genesis{Config: src.gspec.Config, Difficulty: vars.GenesisDifficulty, ExtraData: []byte("foreign")}
+	chain, _ := newEraImportChain(t, filepath.Join(dir, "foreign.ancient"), foreign)
+	defer chain.Stop()
+
+	if err := ImportEra(chain, fn); err == nil {
+		t.Errorf("era archive of another network imported")
+	}
+	if head := chain.CurrentHeader().Number.Uint64(); head != 0 {
+		t.Errorf("headers imported from foreign archive: head #%d", head)
+	}
+}
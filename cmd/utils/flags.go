@@ -240,6 +240,10 @@ var (
 		Name:  "nocode",
 		Usage: "Exclude contract code (save db lookups)",
 	}
+	StateStartFlag = cli.StringFlag{
+		Name:  "start",
+		Usage: "Hashed account address to resume the state verification from",
+	}
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
@@ -251,6 +255,20 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	HistoryLimitFlag = cli.Uint64Flag{
+		Name:  "historylimit",
+		Usage: "Number of recent blocks to retain ancient bodies and receipts for (0 = entire chain)",
+		Value: eth.DefaultConfig.HistoryLimit,
+	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to maintain transaction lookup indices for (0 = entire chain)",
+		Value: eth.DefaultConfig.TxLookupLimit,
+	}
+	ParallelExecFlag = cli.BoolFlag{
+		Name:  "parallelexec",
+		Usage: "Execute the transactions of imported blocks optimistically in parallel (experimental)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -516,6 +534,11 @@ var (
 		Name:  "rpc.gascap",
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas",
 	}
+	RPCStateReexecFlag = cli.Uint64Flag{
+		Name:  "rpc.statereexec",
+		Usage: "Maximum number of blocks re-executed to regenerate a pruned state for eth_call (0 = disabled)",
+		Value: eth.DefaultConfig.RPCStateReexec,
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -1494,6 +1517,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(GCModeFlag.Name) {
 		cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 	}
+	if ctx.GlobalIsSet(HistoryLimitFlag.Name) {
+		cfg.HistoryLimit = ctx.GlobalUint64(HistoryLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(ParallelExecFlag.Name) {
+		cfg.ParallelExec = ctx.GlobalBool(ParallelExecFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 	}
@@ -1521,6 +1553,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalGasCap.Name) {
 		cfg.RPCGasCap = new(big.Int).SetUint64(ctx.GlobalUint64(RPCGlobalGasCap.Name))
 	}
+	if ctx.GlobalIsSet(RPCStateReexecFlag.Name) {
+		cfg.RPCStateReexec = ctx.GlobalUint64(RPCStateReexecFlag.Name)
+	}
 
 	// Override any default configs for hard coded networks.
 
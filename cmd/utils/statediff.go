@@ -0,0 +1,122 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// StateDiffEntry is a single line of a state diff export, holding the changes
+// made to the state by one block.
+type StateDiffEntry struct {
+	Number uint64          `json:"number"`
+	Hash   common.Hash     `json:"hash"`
+	Diff   state.StateDiff `json:"diff"`
+}
+
+// ExportStateDiffs re-executes the blocks between first and last (inclusive) on
+// top of the state of the parent of first, streaming the state diff of each of
+// them into the given file as a line of JSON. Only the state of the parent of
+// the first block needs to be available, the rest is regenerated on the fly.
+func ExportStateDiffs(chain *core.BlockChain, db ethdb.Database, fn string, first uint64, last uint64) error {
+	if first == 0 {
+		return errors.New("genesis block has no state diff")
+	}
+	if first > last {
+		return fmt.Errorf("invalid range: %d > %d", first, last)
+	}
+	parent := chain.GetBlockByNumber(first - 1)
+	if parent == nil {
+		return fmt.Errorf("block #%d not found", first-1)
+	}
+	database := state.NewDatabaseWithCache(db, 16)
+	statedb, err := state.New(parent.Root(), database)
+	if err != nil {
+		return fmt.Errorf("state of block #%d unavailable: %v", parent.NumberU64(), err)
+	}
+	log.Info("Exporting state diffs", "file", fn, "first", first, "last", last)
+
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	var (
+		enc       = json.NewEncoder(writer)
+		processor = core.NewStateProcessor(chain.Config(), chain, chain.Engine())
+		proot     common.Hash
+		start     = time.Now()
+		logged    = time.Now()
+	)
+	for number := first; number <= last; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("block #%d not found", number)
+		}
+		diff, err := processor.StateDiff(block, statedb, vm.Config{})
+		if err != nil {
+			return fmt.Errorf("failed to process block #%d: %v", number, err)
+		}
+		if err := enc.Encode(&StateDiffEntry{Number: number, Hash: block.Hash(), Diff: diff}); err != nil {
+			return err
+		}
+		// Move the state over to the next block, releasing the previous one
+		root, err := statedb.Commit(chain.Config().IsEnabled(chain.Config().GetEIP161dTransition, block.Number()))
+		if err != nil {
+			return err
+		}
+		if root != block.Root() {
+			return fmt.Errorf("state root mismatch at block #%d: have %x, want %x", number, root, block.Root())
+		}
+		if err := statedb.Reset(root); err != nil {
+			return err
+		}
+		database.TrieDB().Reference(root, common.Hash{})
+		if proot != (common.Hash{}) {
+			database.TrieDB().Dereference(proot)
+		}
+		proot = root
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state diffs", "number", number, "last", last, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Exported state diffs", "file", fn, "blocks", last-first+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
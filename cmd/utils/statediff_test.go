@@ -0,0 +1,117 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that the state diffs of a chain segment can be exported, each of them
+// holding the balance changes made by the block.
+func TestExportStateDiffs(t *testing.T) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.Address{0x01}
+		gspec     = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(vars.Ether)}},
+		}
+		engine  = ethash.NewFaker()
+		db      = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, 3, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), recipient, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "statediffs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "diffs.json")
+	if err := ExportStateDiffs(chain, db, fn, 2, 3); err != nil {
+		t.Fatalf("failed to export state diffs: %v", err)
+	}
+	blob, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("exported diff count mismatch: have %d, want 2", len(lines))
+	}
+	for i, line := range lines {
+		var entry StateDiffEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("diff %d: failed to decode: %v", i, err)
+		}
+		block := blocks[i+1]
+		if entry.Number != block.NumberU64() || entry.Hash != block.Hash() {
+			t.Errorf("diff %d: block mismatch: have #%d [%x], want #%d [%x]", i, entry.Number, entry.Hash, block.NumberU64(), block.Hash())
+		}
+		// Sender, recipient and coinbase all change
+		if len(entry.Diff) != 3 {
+			t.Errorf("diff %d: account count mismatch: have %d, want 3", i, len(entry.Diff))
+		}
+		account := entry.Diff[recipient]
+		if account == nil || account.Balance == nil {
+			t.Fatalf("diff %d: recipient balance change missing", i)
+		}
+		pre, post := account.Balance.Pre.ToInt(), account.Balance.Post.ToInt()
+		if want := big.NewInt(int64(1000 * (i + 1))); pre.Cmp(want) != 0 {
+			t.Errorf("diff %d: recipient pre balance mismatch: have %v, want %v", i, pre, want)
+		}
+		if want := big.NewInt(int64(1000 * (i + 2))); post.Cmp(want) != 0 {
+			t.Errorf("diff %d: recipient post balance mismatch: have %v, want %v", i, post, want)
+		}
+		if nonce := entry.Diff[address].Nonce; nonce == nil || uint64(nonce.Post) != uint64(i+2) {
+			t.Errorf("diff %d: sender nonce change mismatch: have %+v", i, nonce)
+		}
+	}
+}
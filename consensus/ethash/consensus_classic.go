@@ -18,28 +18,24 @@ package ethash
 import (
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
-	"github.com/ethereum/go-ethereum/params/vars"
 )
 
-func ecip1017BlockReward(config ctypes.ChainConfigurator, state *state.StateDB, header *types.Header, uncles []*types.Header) {
-	blockReward := vars.FrontierBlockReward
-
+func ecip1017BlockRewards(config ctypes.ChainConfigurator, header *types.Header, uncles []*types.Header, blockReward *big.Int) (*big.Int, []*big.Int) {
 	// Ensure value 'era' is configured.
 	eraLen := config.GetEthashECIP1017EraRounds()
 	era := GetBlockEra(header.Number, new(big.Int).SetUint64(*eraLen))
 	wr := GetBlockWinnerRewardByEra(era, blockReward)                    // wr "winner reward". 5, 4, 3.2, 2.56, ...
 	wurs := GetBlockWinnerRewardForUnclesByEra(era, uncles, blockReward) // wurs "winner uncle rewards"
 	wr.Add(wr, wurs)
-	state.AddBalance(header.Coinbase, wr) // $$
 
 	// Reward uncle miners.
-	for _, uncle := range uncles {
-		ur := GetBlockUncleRewardByEra(era, header, uncle, blockReward)
-		state.AddBalance(uncle.Coinbase, ur) // $$
+	urs := make([]*big.Int, len(uncles))
+	for i, uncle := range uncles {
+		urs[i] = GetBlockUncleRewardByEra(era, header, uncle, blockReward)
 	}
+	return wr, urs
 }
 
 func ecip1010Explosion(config ctypes.ChainConfigurator, next *big.Int, exPeriodRef *big.Int) {
@@ -80,8 +80,9 @@ const (
 	receiptsCacheLimit  = 32
 	txLookupCacheLimit  = 1024
 	maxFutureBlocks     = 256
+	blockOriginLimit    = 4096
+	reorgJournalLimit   = 90000 // Number of blocks after which reorgs are dropped from the journal
 	maxTimeFutureBlocks = 30
-	badBlockLimit       = 10
 	TriesInMemory       = 128
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
@@ -115,6 +116,9 @@ type CacheConfig struct {
 	TrieDirtyLimit      int           // Memory limit (MB) at which to start flushing dirty trie nodes to disk
 	TrieDirtyDisabled   bool          // Whether to disable trie write caching and GC altogether (archive node)
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
+	HistoryLimit        uint64        // Number of recent blocks to retain ancient bodies and receipts for (0 = all)
+	TxLookupLimit       uint64        // Number of recent blocks to maintain transaction lookup indices for (0 = all)
+	ParallelExec        bool          // Whether to execute the transactions of a block optimistically in parallel
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -146,6 +150,7 @@ type BlockChain struct {
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
+	reorgFeed     event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -161,6 +166,7 @@ type BlockChain struct {
 	blockCache    *lru.Cache     // Cache for the most recent entire blocks
 	txLookupCache *lru.Cache     // Cache for the most recent transaction lookup data.
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
+	blockOrigins  *lru.Cache     // Peers which supplied the most recent blocks to import
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -174,7 +180,6 @@ type BlockChain struct {
 	processor  Processor  // Block transaction processor interface
 	vmConfig   vm.Config
 
-	badBlocks       *lru.Cache                     // Bad block cache
 	shouldPreserve  func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
 }
@@ -196,7 +201,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 	blockCache, _ := lru.New(blockCacheLimit)
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
-	badBlocks, _ := lru.New(badBlockLimit)
+	blockOrigins, _ := lru.New(blockOriginLimit)
 
 	bc := &BlockChain{
 		chainConfig:    chainConfig,
@@ -212,9 +217,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 		blockCache:     blockCache,
 		txLookupCache:  txLookupCache,
 		futureBlocks:   futureBlocks,
+		blockOrigins:   blockOrigins,
 		engine:         engine,
 		vmConfig:       vmConfig,
-		badBlocks:      badBlocks,
 	}
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
@@ -293,6 +298,16 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 			}
 		}
 	}
+	// Start pruning ancient chain history if a retention limit was configured
+	if cacheConfig.HistoryLimit > 0 {
+		bc.wg.Add(1)
+		go bc.pruneHistory()
+	}
+	// Start maintaining the transaction indices if a limit is or was configured
+	if cacheConfig.TxLookupLimit > 0 || rawdb.ReadTxIndexTail(bc.db) != nil {
+		bc.wg.Add(1)
+		go bc.maintainTxIndex()
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
@@ -979,10 +994,17 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	}
 
 	var (
-		stats = struct{ processed, ignored int32 }{}
-		start = time.Now()
-		size  = 0
+		stats     = struct{ processed, ignored int32 }{}
+		start     = time.Now()
+		size      = 0
+		unindexed uint64 // Number of the first block above the ones left unindexed
 	)
+	// indexTx returns whether the transactions of a block are within the configured
+	// lookup limit and should be indexed.
+	indexTx := func(number uint64) bool {
+		limit := bc.cacheConfig.TxLookupLimit
+		return limit == 0 || number+limit > bc.CurrentHeader().Number.Uint64()
+	}
 	// updateHead updates the head fast sync block if the inserted blocks are better
 	// and returns a indicator whether the inserted blocks are canonical.
 	updateHead := func(head *types.Block) bool {
@@ -1095,10 +1117,18 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			}
 			// Flush data into ancient database.
 			size += rawdb.WriteAncientBlock(bc.db, block, receiptChain[i], bc.GetTd(block.Hash(), block.NumberU64()))
-			rawdb.WriteTxLookupEntries(batch, block)
+			if indexTx(block.NumberU64()) {
+				rawdb.WriteTxLookupEntries(batch, block)
+			} else {
+				unindexed = block.NumberU64() + 1
+			}
 
 			stats.processed++
 		}
+		// Move the index tail past the blocks left unindexed
+		if tail := rawdb.ReadTxIndexTail(bc.db); unindexed > 0 && (tail == nil || *tail < unindexed) {
+			rawdb.WriteTxIndexTail(batch, unindexed)
+		}
 		// Flush all tx-lookup index data.
 		size += batch.ValueSize()
 		if err := batch.Write(); err != nil {
@@ -1170,7 +1200,11 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			// Write all the data out into the database
 			rawdb.WriteBody(batch, block.Hash(), block.NumberU64(), block.Body())
 			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receiptChain[i])
-			rawdb.WriteTxLookupEntries(batch, block)
+			if indexTx(block.NumberU64()) {
+				rawdb.WriteTxLookupEntries(batch, block)
+			} else {
+				unindexed = block.NumberU64() + 1
+			}
 
 			stats.processed++
 			if batch.ValueSize() >= ethdb.IdealBatchSize {
@@ -1181,6 +1215,10 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 				batch.Reset()
 			}
 		}
+		// Move the index tail past the blocks left unindexed
+		if tail := rawdb.ReadTxIndexTail(bc.db); unindexed > 0 && (tail == nil || *tail < unindexed) {
+			rawdb.WriteTxIndexTail(batch, unindexed)
+		}
 		if batch.ValueSize() > 0 {
 			size += batch.ValueSize()
 			if err := batch.Write(); err != nil {
@@ -1501,6 +1539,11 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	for i, block := range chain {
 		headers[i] = block.Header()
 		seals[i] = verifySeals
+
+		// Remember the peer supplying the block to attribute reorgs to it
+		if block.ReceivedFrom != nil {
+			bc.blockOrigins.Add(block.Hash(), fmt.Sprint(block.ReceivedFrom))
+		}
 	}
 	abort, results := bc.engine.VerifyHeaders(bc, headers, seals)
 	defer close(abort)
@@ -1576,7 +1619,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	case err != nil:
 		bc.futureBlocks.Remove(block.Hash())
 		stats.ignored += len(it.chain)
-		bc.reportBlock(block, nil, err)
+		bc.reportBlock(block, nil, nil, err)
 		return it.index, err
 	}
 	// No validation errors for the first block (or chain prefix skipped)
@@ -1588,7 +1631,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		}
 		// If the header is a banned one, straight out abort
 		if BadHashes[block.Hash()] {
-			bc.reportBlock(block, nil, ErrBlacklistedHash)
+			bc.reportBlock(block, nil, nil, ErrBlacklistedHash)
 			return it.index, ErrBlacklistedHash
 		}
 		// If the block is known (in the middle of the chain), it's a special case for
@@ -1626,6 +1669,8 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		if err != nil {
 			return it.index, err
 		}
+		statedb.StartWitness()
+
 		// If we have a followup block, run that against the current state to pre-cache
 		// transactions and probabilistically some of the account/storage trie nodes.
 		var followupInterrupt uint32
@@ -1647,7 +1692,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		substart := time.Now()
 		receipts, logs, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
 		if err != nil {
-			bc.reportBlock(block, receipts, err)
+			bc.reportBlock(block, statedb, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
 		}
@@ -1666,7 +1711,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// Validate the state using the default validator
 		substart = time.Now()
 		if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
-			bc.reportBlock(block, receipts, err)
+			bc.reportBlock(block, statedb, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
 		}
@@ -1873,6 +1918,9 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 // potential missing transactions and post an event about them.
 func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	var (
+		oldHead = oldBlock
+		newHead = newBlock
+
 		newChain    types.Blocks
 		oldChain    types.Blocks
 		commonBlock *types.Block
@@ -1984,6 +2032,8 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			"drop", len(oldChain), "dropfrom", oldChain[0].Hash(), "add", len(newChain), "addfrom", newChain[0].Hash())
 		blockReorgAddMeter.Mark(int64(len(newChain)))
 		blockReorgDropMeter.Mark(int64(len(oldChain)))
+
+		bc.journalReorg(commonBlock, oldHead, newHead, oldChain, newChain)
 	} else {
 		log.Error("Impossible reorg, please file an issue", "oldnum", oldBlock.Number(), "oldhash", oldBlock.Hash(), "newnum", newBlock.Number(), "newhash", newBlock.Hash())
 	}
@@ -2034,6 +2084,39 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	return nil
 }
 
+// journalReorg persists a chain reorganisation into the reorg journal and feeds
+// it to the subscribers. Reorgs with a common ancestor older than the journal
+// limit are dropped from it.
+func (bc *BlockChain) journalReorg(ancestor, oldHead, newHead *types.Block, oldChain, newChain types.Blocks) {
+	reorg := &rawdb.Reorg{
+		Number:   ancestor.NumberU64(),
+		Ancestor: ancestor.Hash(),
+		Dropped:  make([]common.Hash, len(oldChain)),
+		Added:    make([]common.Hash, len(newChain)),
+		TdDelta:  new(big.Int),
+		Time:     uint64(time.Now().Unix()),
+	}
+	for i, block := range oldChain {
+		reorg.Dropped[i] = block.Hash()
+	}
+	for i, block := range newChain {
+		reorg.Added[i] = block.Hash()
+		if origin, ok := bc.blockOrigins.Get(block.Hash()); ok && reorg.Origin == "" {
+			reorg.Origin = origin.(string)
+		}
+	}
+	oldTd := bc.GetTd(oldHead.Hash(), oldHead.NumberU64())
+	newTd := bc.GetTd(newHead.Hash(), newHead.NumberU64())
+	if oldTd != nil && newTd != nil {
+		reorg.TdDelta.Sub(newTd, oldTd)
+	}
+	rawdb.WriteReorg(bc.db, reorg)
+	if head := newHead.NumberU64(); head > reorgJournalLimit {
+		rawdb.DeleteReorgs(bc.db, head-reorgJournalLimit)
+	}
+	bc.reorgFeed.Send(ChainReorgEvent{Reorg: reorg})
+}
+
 func (bc *BlockChain) update() {
 	futureTimer := time.NewTicker(5 * time.Second)
 	defer futureTimer.Stop()
@@ -2047,26 +2130,180 @@ func (bc *BlockChain) update() {
 	}
 }
 
+// pruneHistory is a background thread that deletes the bodies and receipts of the
+// ancient blocks falling out of the configured history retention window.
+//
+// Only data already moved into the ancient store is pruned, so at least the most
+// recent vars.ImmutabilityThreshold blocks are always retained.
+func (bc *BlockChain) pruneHistory() {
+	defer bc.wg.Done()
+
+	headCh := make(chan ChainHeadEvent, 1)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	bc.truncateHistory(bc.CurrentBlock().NumberU64())
+	for {
+		select {
+		case head := <-headCh:
+			bc.truncateHistory(head.Block.NumberU64())
+		case <-sub.Err():
+			return
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// truncateHistory deletes the ancient bodies and receipts of all the blocks more
+// than the configured history limit behind the given head.
+func (bc *BlockChain) truncateHistory(head uint64) {
+	limit := bc.cacheConfig.HistoryLimit
+	if head <= limit {
+		return
+	}
+	frozen, err := bc.db.Ancients()
+	if err != nil {
+		return // No ancient store, nothing to prune
+	}
+	threshold := head - limit
+	if threshold > frozen {
+		threshold = frozen
+	}
+	if tail, err := bc.db.AncientTail(); err != nil || tail >= threshold {
+		return
+	}
+	if err := bc.db.TruncateAncientTail(threshold); err != nil {
+		log.Error("Failed to prune chain history", "threshold", threshold, "err", err)
+		return
+	}
+	if tail, err := bc.db.AncientTail(); err == nil && tail > 0 {
+		log.Debug("Pruned ancient chain history", "tail", tail, "threshold", threshold)
+	}
+}
+
+// HistoryTail returns the number of the first block whose body and receipts are
+// still available. Blocks below it only retain their headers.
+func (bc *BlockChain) HistoryTail() uint64 {
+	tail, err := bc.db.AncientTail()
+	if err != nil {
+		return 0
+	}
+	return tail
+}
+
+// TxIndexTail returns the number of the oldest block whose transactions are
+// indexed, the ones of older blocks having been unindexed due to the configured
+// lookup limit.
+func (bc *BlockChain) TxIndexTail() uint64 {
+	if tail := rawdb.ReadTxIndexTail(bc.db); tail != nil {
+		return *tail
+	}
+	return 0
+}
+
+// maintainTxIndex is a background thread that keeps the transaction lookup indices
+// confined to the configured number of recent blocks, indexing blocks entering
+// the window and unindexing the ones falling out of it.
+//
+// If the limit is lifted, the previously unindexed blocks are reindexed.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	// indexBlocks reindexes or unindexes transactions depending on the configured
+	// limit and the current index tail.
+	indexBlocks := func(head uint64, interrupt chan struct{}, done chan struct{}) {
+		defer close(done)
+
+		limit := bc.cacheConfig.TxLookupLimit
+		from := uint64(0)
+		if limit != 0 && head >= limit {
+			from = head - limit + 1
+		}
+		tail := rawdb.ReadTxIndexTail(bc.db)
+		switch {
+		case tail == nil:
+			// Legacy database with all blocks indexed
+			rawdb.UnindexTransactions(bc.db, 0, from, interrupt)
+		case *tail < from:
+			rawdb.UnindexTransactions(bc.db, *tail, from, interrupt)
+		case *tail > from:
+			rawdb.IndexTransactions(bc.db, from, *tail, interrupt)
+		}
+	}
+	var (
+		done      chan struct{}
+		interrupt chan struct{}
+	)
+	headCh := make(chan ChainHeadEvent, 1)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	if head := bc.CurrentBlock().NumberU64(); head > 0 {
+		done, interrupt = make(chan struct{}), make(chan struct{})
+		go indexBlocks(head, interrupt, done)
+	}
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				done, interrupt = make(chan struct{}), make(chan struct{})
+				go indexBlocks(head.Block.NumberU64(), interrupt, done)
+			}
+		case <-done:
+			done = nil
+		case <-sub.Err():
+			if done != nil {
+				close(interrupt)
+				<-done
+			}
+			return
+		case <-bc.quit:
+			if done != nil {
+				close(interrupt)
+				<-done
+			}
+			return
+		}
+	}
+}
+
 // BadBlocks returns a list of the last 'bad blocks' that the client has seen on the network
 func (bc *BlockChain) BadBlocks() []*types.Block {
-	blocks := make([]*types.Block, 0, bc.badBlocks.Len())
-	for _, hash := range bc.badBlocks.Keys() {
-		if blk, exist := bc.badBlocks.Peek(hash); exist {
-			block := blk.(*types.Block)
-			blocks = append(blocks, block)
-		}
+	bad := rawdb.ReadAllBadBlocks(bc.db)
+
+	blocks := make([]*types.Block, 0, len(bad))
+	for _, b := range bad {
+		blocks = append(blocks, b.Block)
 	}
 	return blocks
 }
 
-// addBadBlock adds a bad block to the bad-block LRU cache
-func (bc *BlockChain) addBadBlock(block *types.Block) {
-	bc.badBlocks.Add(block.Hash(), block)
+// addBadBlock persists a bad block along with the receipts of the transactions
+// executed before the failure and the reason it was rejected. If the block was
+// rejected after executing it, the witness needed to replay it is assembled from
+// the state it accessed and recorded too, as the parent state might be pruned by
+// the time the block is inspected.
+func (bc *BlockChain) addBadBlock(block *types.Block, statedb *state.StateDB, receipts types.Receipts, err error) {
+	bad := &rawdb.BadBlock{
+		Block:    block,
+		Receipts: receipts,
+		Reason:   err.Error(),
+	}
+	if statedb != nil {
+		witness, err := bc.badBlockWitness(block, statedb)
+		if err != nil {
+			log.Warn("Failed to record bad block witness", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+		bad.Witness = witness
+	}
+	rawdb.WriteBadBlock(bc.db, bad)
 }
 
-// reportBlock logs a bad block error.
-func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
-	bc.addBadBlock(block)
+// reportBlock logs a bad block error. The state is the one the block was executed
+// on, or nil if the block was rejected before execution.
+func (bc *BlockChain) reportBlock(block *types.Block, statedb *state.StateDB, receipts types.Receipts, err error) {
+	bc.addBadBlock(block, statedb, receipts, err)
 
 	var receiptString string
 	for i, receipt := range receipts {
@@ -2214,6 +2451,11 @@ func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Su
 	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
 }
 
+// SubscribeChainReorgEvent registers a subscription of ChainReorgEvent.
+func (bc *BlockChain) SubscribeChainReorgEvent(ch chan<- ChainReorgEvent) event.Subscription {
+	return bc.scope.Track(bc.reorgFeed.Subscribe(ch))
+}
+
 // SubscribeChainSideEvent registers a subscription of ChainSideEvent.
 func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Subscription {
 	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
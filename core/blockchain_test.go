@@ -153,12 +153,12 @@ func testBlockChainImport(chain types.Blocks, blockchain *BlockChain) error {
 		}
 		receipts, _, usedGas, err := blockchain.processor.Process(block, statedb, vm.Config{})
 		if err != nil {
-			blockchain.reportBlock(block, receipts, err)
+			blockchain.reportBlock(block, statedb, receipts, err)
 			return err
 		}
 		err = blockchain.validator.ValidateState(block, statedb, receipts, usedGas)
 		if err != nil {
-			blockchain.reportBlock(block, receipts, err)
+			blockchain.reportBlock(block, statedb, receipts, err)
 			return err
 		}
 		blockchain.chainmu.Lock()
@@ -2140,6 +2140,74 @@ func TestReorgToShorterRemovesCanonMappingHeaderChain(t *testing.T) {
 	}
 }
 
+// Tests that the transaction lookup indices are confined to the configured number
+// of recent blocks, and that lifting the limit reindexes the old transactions.
+func TestTransactionIndices(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 64, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	// check waits for the index tail to reach the expected value and verifies that
+	// exactly the transactions from the tail onward are indexed.
+	check := func(db ethdb.Database, tail uint64) {
+		for i := 0; ; i++ {
+			if stored := rawdb.ReadTxIndexTail(db); stored != nil && *stored == tail {
+				break
+			}
+			if i == 100 {
+				t.Fatalf("index tail mismatch: have %v, want %d", rawdb.ReadTxIndexTail(db), tail)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, block := range blocks {
+			for _, tx := range block.Transactions() {
+				indexed := rawdb.ReadTxLookupEntry(db, tx.Hash()) != nil
+				if want := block.NumberU64() >= tail; indexed != want {
+					t.Fatalf("block #%d: transaction indexed mismatch: have %v, want %v", block.NumberU64(), indexed, want)
+				}
+			}
+		}
+	}
+	db := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(db, gspec)
+
+	chain, err := NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true, TxLookupLimit: 16}, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	check(db, 64-16+1)
+	if tail := chain.TxIndexTail(); tail != 64-16+1 {
+		t.Fatalf("index tail mismatch: have %d, want %d", tail, 64-16+1)
+	}
+	chain.Stop()
+
+	// Lift the limit and ensure all transactions are indexed again
+	chain, err = NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true}, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+	check(db, 0)
+}
+
 // Benchmarks large blocks with value transfers to non-existing accounts
 func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks int, recipientFn func(uint64) common.Address, dataFn func(uint64) []byte) {
 	var (
@@ -2369,3 +2437,78 @@ func TestDeleteCreateRevert(t *testing.T) {
 		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
 	}
 }
+
+// Tests that chain reorganisations are recorded in the reorg journal along with
+// the peer supplying the new chain, and announced to the subscribers.
+func TestReorgJournal(t *testing.T) {
+	db, blockchain, err := newCanonical(ethash.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	reorgs := make(chan ChainReorgEvent, 1)
+	sub := blockchain.SubscribeChainReorgEvent(reorgs)
+	defer sub.Unsubscribe()
+
+	// Insert an easy chain and a longer, more difficult one afterwards
+	genesis := blockchain.CurrentBlock()
+	easyBlocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 2, func(i int, b *BlockGen) {
+		b.OffsetTime(60)
+	})
+	diffBlocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 3, func(i int, b *BlockGen) {
+		b.OffsetTime(-9)
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(easyBlocks); err != nil {
+		t.Fatalf("failed to insert easy chain: %v", err)
+	}
+	for _, block := range diffBlocks {
+		block.ReceivedFrom = "peer"
+	}
+	if _, err := blockchain.InsertChain(diffBlocks); err != nil {
+		t.Fatalf("failed to insert difficult chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != diffBlocks[2].Hash() {
+		t.Fatalf("difficult chain not canonical: head %x", head.Hash())
+	}
+	journal := rawdb.ReadReorgs(db, 0, 10)
+	if len(journal) != 1 {
+		t.Fatalf("journaled reorg count mismatch: have %d, want 1", len(journal))
+	}
+	reorg := journal[0]
+	if reorg.Number != 0 || reorg.Ancestor != genesis.Hash() {
+		t.Errorf("ancestor mismatch: have #%d [%x], want #0 [%x]", reorg.Number, reorg.Ancestor, genesis.Hash())
+	}
+	if reorg.Depth() != len(easyBlocks) {
+		t.Errorf("depth mismatch: have %d, want %d", reorg.Depth(), len(easyBlocks))
+	}
+	for i, hash := range reorg.Dropped {
+		if want := easyBlocks[len(easyBlocks)-1-i].Hash(); hash != want {
+			t.Errorf("dropped block %d mismatch: have %x, want %x", i, hash, want)
+		}
+	}
+	// The chain is reorganised as soon as the second difficult block is imported
+	if len(reorg.Added) != 2 || reorg.Added[0] != diffBlocks[1].Hash() || reorg.Added[1] != diffBlocks[0].Hash() {
+		t.Errorf("added blocks mismatch: have %x, want [%x %x]", reorg.Added, diffBlocks[1].Hash(), diffBlocks[0].Hash())
+	}
+	oldTd := blockchain.GetTd(easyBlocks[1].Hash(), 2)
+	newTd := blockchain.GetTd(diffBlocks[1].Hash(), 2)
+	if want := new(big.Int).Sub(newTd, oldTd); reorg.TdDelta.Cmp(want) != 0 {
+		t.Errorf("td delta mismatch: have %v, want %v", reorg.TdDelta, want)
+	}
+	if reorg.Origin != "peer" {
+		t.Errorf("origin mismatch: have %q, want %q", reorg.Origin, "peer")
+	}
+	select {
+	case ev := <-reorgs:
+		if ev.Reorg.Ancestor != reorg.Ancestor || ev.Reorg.Depth() != reorg.Depth() {
+			t.Errorf("announced reorg mismatch: have %+v, want %+v", ev.Reorg, reorg)
+		}
+	default:
+		t.Errorf("reorg not announced")
+	}
+	if journal := rawdb.ReadReorgs(db, 1, 10); len(journal) != 0 {
+		t.Errorf("reorgs out of range returned: %d", len(journal))
+	}
+}
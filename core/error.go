@@ -35,4 +35,8 @@ var (
 
 	// ErrNoGenesis is returned when there is no Genesis Block.
 	ErrNoGenesis = errors.New("genesis not found in chain")
+
+	// ErrHistoryPruned is returned when the body or receipts of a block are
+	// requested, which were deleted due to the configured history limit.
+	ErrHistoryPruned = errors.New("block history pruned")
 )
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -172,6 +173,25 @@ func WriteFastTrieProgress(db ethdb.KeyValueWriter, count uint64) {
 	}
 }
 
+// ReadTxIndexTail retrieves the number of the oldest block whose transaction
+// lookup entries are indexed. A nil result means all blocks are indexed.
+func ReadTxIndexTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteTxIndexTail stores the number of the oldest block whose transaction lookup
+// entries are indexed.
+func WriteTxIndexTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(txIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the transaction index tail", "err", err)
+	}
+}
+
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -613,3 +633,168 @@ func FindCommonAncestor(db ethdb.Reader, a, b *types.Header) *types.Header {
 	}
 	return a
 }
+
+// badBlockToKeep is the maximum number of bad blocks to keep in the database.
+const badBlockToKeep = 10
+
+// BadBlock is a block rejected during import, along with the receipts of the
+// transactions executed before it was rejected and the reason of the rejection.
+type BadBlock struct {
+	Block    *types.Block
+	Receipts types.Receipts
+	Reason   string
+	Witness  *BadBlockWitness // Witness recorded on rejection, nil if unavailable
+}
+
+// BadBlockWitness is the part of the chain and of the parent state accessed while
+// executing a bad block, recorded when the block was rejected so that it can be
+// replayed even after the parent state is gone.
+type BadBlockWitness struct {
+	Headers []*types.Header // Parent header followed by any older ancestor accessed
+	Root    common.Hash     // State root of the parent block
+	Nodes   [][]byte        // Parent state trie nodes accessed by the block
+	Codes   [][]byte        // Contract codes accessed by the block
+}
+
+// storedBadBlock is the database representation of a bad block. Witnesses are
+// stored separately, keeping the list cheap to read and rewrite.
+type storedBadBlock struct {
+	Header   *types.Header
+	Body     *types.Body
+	Receipts []*types.ReceiptForStorage
+	Reason   string
+}
+
+func (b *storedBadBlock) decode() *BadBlock {
+	receipts := make(types.Receipts, len(b.Receipts))
+	for i, receipt := range b.Receipts {
+		receipts[i] = (*types.Receipt)(receipt)
+	}
+	return &BadBlock{
+		Block:    types.NewBlockWithHeader(b.Header).WithBody(b.Body.Transactions, b.Body.Uncles),
+		Receipts: receipts,
+		Reason:   b.Reason,
+	}
+}
+
+func readStoredBadBlocks(db ethdb.KeyValueReader) []*storedBadBlock {
+	blob, err := db.Get(badBlockKey)
+	if err != nil {
+		return nil
+	}
+	var blocks []*storedBadBlock
+	if err := rlp.DecodeBytes(blob, &blocks); err != nil {
+		log.Error("Invalid bad block list RLP", "err", err)
+		return nil
+	}
+	return blocks
+}
+
+// ReadBadBlock retrieves the bad block with the given hash, along with its
+// witness if one was recorded.
+func ReadBadBlock(db ethdb.KeyValueReader, hash common.Hash) *BadBlock {
+	for _, bad := range readStoredBadBlocks(db) {
+		if bad.Header.Hash() == hash {
+			block := bad.decode()
+			block.Witness = ReadBadBlockWitness(db, hash)
+			return block
+		}
+	}
+	return nil
+}
+
+// ReadAllBadBlocks retrieves all the bad blocks in the database, ordered by
+// number, the highest first. Witnesses are not loaded, use ReadBadBlockWitness
+// to retrieve them.
+func ReadAllBadBlocks(db ethdb.KeyValueReader) []*BadBlock {
+	var blocks []*BadBlock
+	for _, bad := range readStoredBadBlocks(db) {
+		blocks = append(blocks, bad.decode())
+	}
+	return blocks
+}
+
+// ReadBadBlockWitness retrieves the witness recorded for the bad block with the
+// given hash.
+func ReadBadBlockWitness(db ethdb.KeyValueReader, hash common.Hash) *BadBlockWitness {
+	blob, err := db.Get(badBlockWitnessKey(hash))
+	if err != nil {
+		return nil
+	}
+	witness := new(BadBlockWitness)
+	if err := rlp.DecodeBytes(blob, witness); err != nil {
+		log.Error("Invalid bad block witness RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return witness
+}
+
+// WriteBadBlock serializes a bad block and its witness, if any, into the database.
+// If the number of bad blocks exceeds the limit, the oldest ones are dropped
+// along with their witnesses.
+func WriteBadBlock(db ethdb.KeyValueStore, bad *BadBlock) {
+	blocks := readStoredBadBlocks(db)
+	for _, b := range blocks {
+		if b.Header.Number.Uint64() == bad.Block.NumberU64() && b.Header.Hash() == bad.Block.Hash() {
+			log.Info("Skip duplicated bad block", "number", bad.Block.NumberU64(), "hash", bad.Block.Hash())
+			return
+		}
+	}
+	receipts := make([]*types.ReceiptForStorage, len(bad.Receipts))
+	for i, receipt := range bad.Receipts {
+		receipts[i] = (*types.ReceiptForStorage)(receipt)
+	}
+	blocks = append(blocks, &storedBadBlock{
+		Header:   bad.Block.Header(),
+		Body:     bad.Block.Body(),
+		Receipts: receipts,
+		Reason:   bad.Reason,
+	})
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Header.Number.Uint64() > blocks[j].Header.Number.Uint64()
+	})
+	var dropped []*storedBadBlock
+	if len(blocks) > badBlockToKeep {
+		blocks, dropped = blocks[:badBlockToKeep], blocks[badBlockToKeep:]
+	}
+	data, err := rlp.EncodeToBytes(blocks)
+	if err != nil {
+		log.Crit("Failed to encode bad blocks", "err", err)
+	}
+	if err := db.Put(badBlockKey, data); err != nil {
+		log.Crit("Failed to write bad blocks", "err", err)
+	}
+	for _, b := range dropped {
+		if err := db.Delete(badBlockWitnessKey(b.Header.Hash())); err != nil {
+			log.Crit("Failed to delete bad block witness", "err", err)
+		}
+	}
+	// Store the witness unless the block itself was too old to be kept
+	if bad.Witness == nil {
+		return
+	}
+	for _, b := range dropped {
+		if b.Header.Hash() == bad.Block.Hash() {
+			return
+		}
+	}
+	data, err = rlp.EncodeToBytes(bad.Witness)
+	if err != nil {
+		log.Crit("Failed to encode bad block witness", "err", err)
+	}
+	if err := db.Put(badBlockWitnessKey(bad.Block.Hash()), data); err != nil {
+		log.Crit("Failed to write bad block witness", "err", err)
+	}
+}
+
+// DeleteBadBlocks deletes all the bad blocks and their witnesses from the database.
+func DeleteBadBlocks(db ethdb.KeyValueStore) {
+	for _, b := range readStoredBadBlocks(db) {
+		if err := db.Delete(badBlockWitnessKey(b.Header.Hash())); err != nil {
+			log.Crit("Failed to delete bad block witness", "err", err)
+		}
+	}
+	if err := db.Delete(badBlockKey); err != nil {
+		log.Crit("Failed to delete bad blocks", "err", err)
+	}
+}
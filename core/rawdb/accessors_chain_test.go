@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -187,6 +188,110 @@ func TestPartialBlockStorage(t *testing.T) {
 	}
 }
 
+// Tests bad block storage and retrieval operations.
+func TestBadBlockStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Create a test block to move around the database and make sure it's really new
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:      big.NewInt(1),
+		Extra:       []byte("bad block"),
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+	})
+	if entry := ReadBadBlock(db, block.Hash()); entry != nil {
+		t.Fatalf("Non existent bad block returned: %v", entry)
+	}
+	// Write it and verify it can be retrieved along with its receipts and reason
+	receipts := types.Receipts{types.NewReceipt(nil, false, 21000)}
+	witness := &BadBlockWitness{
+		Headers: []*types.Header{{Number: big.NewInt(0), Extra: []byte("parent")}},
+		Root:    common.Hash{0x01},
+		Nodes:   [][]byte{{0x02}},
+		Codes:   [][]byte{{0x03}},
+	}
+	WriteBadBlock(db, &BadBlock{Block: block, Receipts: receipts, Reason: "invalid merkle root", Witness: witness})
+
+	entry := ReadBadBlock(db, block.Hash())
+	if entry == nil {
+		t.Fatalf("Stored bad block not found")
+	}
+	if entry.Block.Hash() != block.Hash() {
+		t.Fatalf("Retrieved bad block mismatch: have %x, want %x", entry.Block.Hash(), block.Hash())
+	}
+	if entry.Reason != "invalid merkle root" {
+		t.Fatalf("Retrieved bad block reason mismatch: have %q, want %q", entry.Reason, "invalid merkle root")
+	}
+	if len(entry.Receipts) != 1 || entry.Receipts[0].CumulativeGasUsed != 21000 {
+		t.Fatalf("Retrieved bad block receipts mismatch: have %v", entry.Receipts)
+	}
+	if entry.Witness == nil {
+		t.Fatalf("Stored bad block witness not found")
+	}
+	if entry.Witness.Root != witness.Root || len(entry.Witness.Headers) != 1 || entry.Witness.Headers[0].Hash() != witness.Headers[0].Hash() {
+		t.Fatalf("Retrieved bad block witness mismatch: have %v, want %v", entry.Witness, witness)
+	}
+	if !reflect.DeepEqual(entry.Witness.Nodes, witness.Nodes) || !reflect.DeepEqual(entry.Witness.Codes, witness.Codes) {
+		t.Fatalf("Retrieved bad block witness content mismatch: have %v, want %v", entry.Witness, witness)
+	}
+	// Write a bunch of other bad blocks, ensuring only the highest ones are kept
+	for i := 2; i <= 2*badBlockToKeep; i++ {
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:      big.NewInt(int64(i)),
+			Extra:       []byte("bad block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		})
+		WriteBadBlock(db, &BadBlock{Block: block, Reason: "test", Witness: witness})
+		WriteBadBlock(db, &BadBlock{Block: block, Reason: "duplicate"})
+	}
+	// Write a bad block too old to be kept, ensuring its witness isn't stored either
+	old := types.NewBlockWithHeader(&types.Header{
+		Number:      big.NewInt(0),
+		Extra:       []byte("old bad block"),
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+	})
+	WriteBadBlock(db, &BadBlock{Block: old, Reason: "test", Witness: witness})
+	if ReadBadBlockWitness(db, old.Hash()) != nil {
+		t.Fatalf("Witness of dropped bad block stored")
+	}
+	if ReadBadBlockWitness(db, block.Hash()) != nil {
+		t.Fatalf("Witness of dropped bad block kept")
+	}
+	blocks := ReadAllBadBlocks(db)
+	if len(blocks) != badBlockToKeep {
+		t.Fatalf("Bad block count mismatch: have %d, want %d", len(blocks), badBlockToKeep)
+	}
+	for i, bad := range blocks {
+		if want := uint64(2*badBlockToKeep - i); bad.Block.NumberU64() != want {
+			t.Fatalf("Bad block %d number mismatch: have %d, want %d", i, bad.Block.NumberU64(), want)
+		}
+		if bad.Reason != "test" {
+			t.Fatalf("Bad block %d reason mismatch: have %q, want %q", i, bad.Reason, "test")
+		}
+		if bad.Witness != nil {
+			t.Fatalf("Bad block %d witness loaded with the list", i)
+		}
+		if ReadBadBlockWitness(db, bad.Block.Hash()) == nil {
+			t.Fatalf("Bad block %d witness not found", i)
+		}
+	}
+	// Delete the bad blocks and verify they're gone
+	DeleteBadBlocks(db)
+	if blocks := ReadAllBadBlocks(db); len(blocks) != 0 {
+		t.Fatalf("Deleted bad blocks returned: %v", blocks)
+	}
+	for _, bad := range blocks {
+		if ReadBadBlockWitness(db, bad.Block.Hash()) != nil {
+			t.Fatalf("Deleted bad block witness returned: %x", bad.Block.Hash())
+		}
+	}
+}
+
 // Tests block total difficulty storage and retrieval operations.
 func TestTdStorage(t *testing.T) {
 	db := NewMemoryDatabase()
@@ -63,6 +63,14 @@ func WriteTxLookupEntries(db ethdb.KeyValueWriter, block *types.Block) {
 	}
 }
 
+// WriteTxLookupEntry stores a positional metadata for a single transaction,
+// enabling hash based transaction and receipt lookups.
+func WriteTxLookupEntry(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Put(txLookupKey(hash), new(big.Int).SetUint64(number).Bytes()); err != nil {
+		log.Crit("Failed to store transaction lookup entry", "err", err)
+	}
+}
+
 // DeleteTxLookupEntry removes all transaction data associated with a hash.
 func DeleteTxLookupEntry(db ethdb.KeyValueWriter, hash common.Hash) {
 	db.Delete(txLookupKey(hash))
@@ -0,0 +1,108 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Reorg is a chain reorganisation recorded in the reorg journal.
+type Reorg struct {
+	Number   uint64        // Number of the common ancestor
+	Ancestor common.Hash   // Hash of the common ancestor
+	Dropped  []common.Hash // Blocks removed from the canonical chain, newest first
+	Added    []common.Hash // Blocks added to the canonical chain, newest first
+	TdDelta  *big.Int      // Total difficulty of the new head minus that of the old one
+	Time     uint64        // Unix timestamp of the reorg
+	Origin   string        // Peer which supplied the new chain, empty if unknown
+}
+
+// Depth returns the number of blocks removed from the canonical chain.
+func (r *Reorg) Depth() int {
+	return len(r.Dropped)
+}
+
+// ReadReorgs retrieves all the reorgs in the journal with a common ancestor
+// numbered in the given inclusive range, ordered by ancestor number.
+func ReadReorgs(db ethdb.Iteratee, from, to uint64) []*Reorg {
+	it := db.NewIteratorWithStart(append(reorgPrefix, encodeBlockNumber(from)...))
+	defer it.Release()
+
+	var reorgs []*Reorg
+	for it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, reorgPrefix) || len(key) != len(reorgPrefix)+8+common.HashLength {
+			break
+		}
+		if binary.BigEndian.Uint64(key[len(reorgPrefix):]) > to {
+			break
+		}
+		reorg := new(Reorg)
+		if err := rlp.DecodeBytes(it.Value(), reorg); err != nil {
+			log.Error("Invalid reorg journal entry RLP", "key", key, "err", err)
+			continue
+		}
+		reorgs = append(reorgs, reorg)
+	}
+	return reorgs
+}
+
+// WriteReorg stores a reorg into the journal.
+func WriteReorg(db ethdb.KeyValueWriter, reorg *Reorg) {
+	var head common.Hash
+	if len(reorg.Added) > 0 {
+		head = reorg.Added[0]
+	}
+	data, err := rlp.EncodeToBytes(reorg)
+	if err != nil {
+		log.Crit("Failed to encode reorg", "err", err)
+	}
+	if err := db.Put(reorgKey(reorg.Number, head), data); err != nil {
+		log.Crit("Failed to store reorg", "err", err)
+	}
+}
+
+// DeleteReorgs removes all the reorgs from the journal with a common ancestor
+// numbered below the given limit.
+func DeleteReorgs(db ethdb.KeyValueStore, limit uint64) {
+	it := db.NewIteratorWithPrefix(reorgPrefix)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(reorgPrefix)+8+common.HashLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(reorgPrefix):]) >= limit {
+			break
+		}
+		if err := batch.Delete(key); err != nil {
+			log.Crit("Failed to delete reorg", "err", err)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to delete stale reorgs", "err", err)
+	}
+}
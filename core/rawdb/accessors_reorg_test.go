@@ -0,0 +1,57 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests reorg journal storage, retrieval and pruning operations.
+func TestReorgStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	for i := uint64(1); i <= 10; i++ {
+		WriteReorg(db, &Reorg{
+			Number:   i * 10,
+			Ancestor: common.Hash{byte(i)},
+			Dropped:  []common.Hash{{0x01}},
+			Added:    []common.Hash{{byte(i), 0x02}},
+			TdDelta:  big.NewInt(1),
+		})
+	}
+	if reorgs := ReadReorgs(db, 0, 100); len(reorgs) != 10 {
+		t.Fatalf("reorg count mismatch: have %d, want 10", len(reorgs))
+	}
+	if reorgs := ReadReorgs(db, 25, 55); len(reorgs) != 3 || reorgs[0].Number != 30 || reorgs[2].Number != 50 {
+		t.Fatalf("reorg range mismatch: have %v", reorgs)
+	}
+	// Drop the stale reorgs and ensure only the recent ones are kept
+	DeleteReorgs(db, 60)
+
+	reorgs := ReadReorgs(db, 0, 100)
+	if len(reorgs) != 5 {
+		t.Fatalf("reorg count mismatch after pruning: have %d, want 5", len(reorgs))
+	}
+	for i, reorg := range reorgs {
+		if want := uint64(60 + 10*i); reorg.Number != want {
+			t.Errorf("reorg %d ancestor mismatch: have %d, want %d", i, reorg.Number, want)
+		}
+	}
+}
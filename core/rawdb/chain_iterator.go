@@ -0,0 +1,135 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// IndexTransactions creates the transaction lookup entries of the canonical blocks
+// in the range [from, to), moving the index tail backwards as it goes. Blocks are
+// processed in reverse order, so that an interruption leaves a contiguous index.
+//
+// Indexing stops at the first block whose body is unavailable (e.g. because its
+// history was pruned), leaving the tail right above it.
+func IndexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
+	if from >= to {
+		return
+	}
+	var (
+		batch  = db.NewBatch()
+		start  = time.Now()
+		logged = time.Now()
+		tail   = to
+	)
+	for number := to; number > from; number-- {
+		if interrupted(interrupt) {
+			break
+		}
+		hash := ReadCanonicalHash(db, number-1)
+		body := ReadBody(db, hash, number-1)
+		if body == nil {
+			log.Warn("Block body missing, can't index transactions", "number", number-1, "hash", hash)
+			break
+		}
+		for _, tx := range body.Transactions {
+			WriteTxLookupEntry(batch, tx.Hash(), number-1)
+		}
+		tail = number - 1
+
+		// Flush the batch along with the new tail to keep both consistent
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing transactions", "blocks", to-tail, "tail", tail, "total", to-from, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	WriteTxIndexTail(batch, tail)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed writing batch to db", "error", err)
+	}
+	log.Info("Indexed transactions", "blocks", to-tail, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// UnindexTransactions removes the transaction lookup entries of the canonical
+// blocks in the range [from, to), moving the index tail forward as it goes.
+//
+// Blocks whose body is unavailable can't be unindexed (their transaction hashes
+// are unknown), so their lookup entries are left dangling.
+func UnindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
+	if from >= to {
+		return
+	}
+	var (
+		batch  = db.NewBatch()
+		start  = time.Now()
+		logged = time.Now()
+		tail   = from
+	)
+	for number := from; number < to; number++ {
+		if interrupted(interrupt) {
+			break
+		}
+		hash := ReadCanonicalHash(db, number)
+		if body := ReadBody(db, hash, number); body != nil {
+			for _, tx := range body.Transactions {
+				DeleteTxLookupEntry(batch, tx.Hash())
+			}
+		} else {
+			log.Debug("Block body missing, can't unindex transactions", "number", number, "hash", hash)
+		}
+		tail = number + 1
+
+		// Flush the batch along with the new tail to keep both consistent
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Unindexing transactions", "blocks", tail-from, "tail", tail, "total", to-from, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	WriteTxIndexTail(batch, tail)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed writing batch to db", "error", err)
+	}
+	log.Info("Unindexed transactions", "blocks", tail-from, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// interrupted returns whether the given interrupt channel was closed.
+func interrupted(interrupt chan struct{}) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+		return false
+	}
+}
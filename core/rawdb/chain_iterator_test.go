@@ -0,0 +1,82 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that transaction lookup entries can be created and removed for block
+// ranges, with the index tail tracking the oldest indexed block.
+func TestIndexTransactions(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	var txs []*types.Transaction
+	for i := uint64(0); i < 10; i++ {
+		tx := types.NewTransaction(i, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), nil)
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(i)}, []*types.Transaction{tx}, nil, nil)
+
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), i)
+		txs = append(txs, tx)
+	}
+	// verify checks that exactly the transactions from tail onward are indexed
+	verify := func(tail uint64) {
+		if have := ReadTxIndexTail(db); have == nil || *have != tail {
+			t.Fatalf("index tail mismatch: have %v, want %d", have, tail)
+		}
+		for i, tx := range txs {
+			number := ReadTxLookupEntry(db, tx.Hash())
+			if uint64(i) < tail && number != nil {
+				t.Fatalf("tx #%d: unexpected lookup entry", i)
+			}
+			if uint64(i) >= tail && (number == nil || *number != uint64(i)) {
+				t.Fatalf("tx #%d: lookup entry mismatch: have %v, want %d", i, number, i)
+			}
+		}
+	}
+	if tail := ReadTxIndexTail(db); tail != nil {
+		t.Fatalf("unexpected index tail in pristine database: %d", *tail)
+	}
+	IndexTransactions(db, 5, 10, nil)
+	verify(5)
+
+	IndexTransactions(db, 2, 5, nil)
+	verify(2)
+
+	UnindexTransactions(db, 2, 7, nil)
+	verify(7)
+
+	// Interrupted runs must not make any progress
+	interrupt := make(chan struct{})
+	close(interrupt)
+
+	IndexTransactions(db, 0, 7, interrupt)
+	verify(7)
+
+	UnindexTransactions(db, 7, 9, interrupt)
+	verify(7)
+
+	// Blocks with missing bodies stop the indexing
+	DeleteBody(db, ReadCanonicalHash(db, 3), 3)
+	IndexTransactions(db, 0, 7, nil)
+	verify(4)
+}
@@ -163,6 +163,18 @@ func (f *freezer) Ancients() (uint64, error) {
 	return atomic.LoadUint64(&f.frozen), nil
 }
 
+// AncientTail returns the number of the first block whose bodies and receipts
+// are still retained in the freezer.
+func (f *freezer) AncientTail() (uint64, error) {
+	var tail uint64
+	for _, kind := range freezerHistoryTables {
+		if t := f.tables[kind].tail(); t > tail {
+			tail = t
+		}
+	}
+	return tail, nil
+}
+
 // AncientSize returns the ancient size of the specified category.
 func (f *freezer) AncientSize(kind string) (uint64, error) {
 	if table := f.tables[kind]; table != nil {
@@ -232,6 +244,21 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateAncientTail discards the bodies and receipts of the blocks below the
+// provided threshold number. Data is deleted in whole files, so some blocks below
+// the threshold might be retained.
+func (f *freezer) TruncateAncientTail(items uint64) error {
+	if frozen := atomic.LoadUint64(&f.frozen); items > frozen {
+		items = frozen
+	}
+	for _, kind := range freezerHistoryTables {
+		if err := f.tables[kind].truncateTail(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
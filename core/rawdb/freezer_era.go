@@ -0,0 +1,242 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// eraVersion is the version of the era archive format produced by this package.
+const eraVersion = 1
+
+var (
+	// errEraVersion is returned if an era archive was produced by an unsupported
+	// version of the format.
+	errEraVersion = errors.New("unsupported era archive version")
+
+	// errEraChecksum is returned if the checksum stored in the trailer of an era
+	// archive doesn't match the archived content.
+	errEraChecksum = errors.New("era archive checksum mismatch")
+
+	// errEraTruncated is returned if an era archive ends before all the entries
+	// announced in its header were read.
+	errEraTruncated = errors.New("era archive truncated")
+)
+
+// EraHeader is the self-describing preamble of an era archive. It identifies the
+// network the archived chain segment belongs to and the range of blocks contained.
+type EraHeader struct {
+	Version uint64      // Version of the archive format
+	Genesis common.Hash // Hash of the genesis block of the archived chain
+	First   uint64      // Number of the first archived block
+	Count   uint64      // Number of archived blocks
+}
+
+// EraEntry contains all the ancient data of a single archived block, in the exact
+// binary form it is stored in the freezer tables.
+type EraEntry struct {
+	Number   uint64
+	Hash     common.Hash
+	Header   rlp.RawValue
+	Body     rlp.RawValue
+	Receipts rlp.RawValue
+	Td       rlp.RawValue
+}
+
+// eraTrailer terminates an era archive with the checksum of everything preceding it.
+type eraTrailer struct {
+	Checksum common.Hash
+}
+
+// Block decodes the archived block data, cross-checking all the components against
+// each other to ensure the entry was not tampered with. Receipts are returned in
+// their consensus form without any derived fields filled in.
+func (e *EraEntry) Block() (*types.Block, types.Receipts, *big.Int, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(e.Header, header); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid header #%d: %v", e.Number, err)
+	}
+	if header.Number.Uint64() != e.Number || header.Hash() != e.Hash {
+		return nil, nil, nil, fmt.Errorf("header mismatch: have #%d [%x…], want #%d [%x…]", header.Number, header.Hash().Bytes()[:4], e.Number, e.Hash.Bytes()[:4])
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(e.Body, body); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid body #%d: %v", e.Number, err)
+	}
+	if hash := types.DeriveSha(types.Transactions(body.Transactions)); hash != header.TxHash {
+		return nil, nil, nil, fmt.Errorf("transaction root mismatch #%d: have %x, want %x", e.Number, hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(body.Uncles); hash != header.UncleHash {
+		return nil, nil, nil, fmt.Errorf("uncle root mismatch #%d: have %x, want %x", e.Number, hash, header.UncleHash)
+	}
+	var storage []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(e.Receipts, &storage); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid receipts #%d: %v", e.Number, err)
+	}
+	receipts := make(types.Receipts, len(storage))
+	for i, receipt := range storage {
+		receipts[i] = (*types.Receipt)(receipt)
+	}
+	if hash := types.DeriveSha(receipts); hash != header.ReceiptHash {
+		return nil, nil, nil, fmt.Errorf("receipt root mismatch #%d: have %x, want %x", e.Number, hash, header.ReceiptHash)
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(e.Td, td); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid total difficulty #%d: %v", e.Number, err)
+	}
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), receipts, td, nil
+}
+
+// ExportAncients writes the ancient data of the blocks within the given (inclusive)
+// range into an era archive. All the requested blocks must already be frozen.
+func ExportAncients(db ethdb.AncientReader, w io.Writer, first, last uint64) error {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if first > last {
+		return fmt.Errorf("invalid range: first (%d) > last (%d)", first, last)
+	}
+	if last >= frozen {
+		return fmt.Errorf("block #%d not in ancient store (frozen %d)", last, frozen)
+	}
+	genesis, err := db.Ancient(freezerHashTable, 0)
+	if err != nil {
+		return err
+	}
+	hasher := sha3.NewLegacyKeccak256()
+	out := io.MultiWriter(w, hasher)
+
+	if err := rlp.Encode(out, &EraHeader{
+		Version: eraVersion,
+		Genesis: common.BytesToHash(genesis),
+		First:   first,
+		Count:   last - first + 1,
+	}); err != nil {
+		return err
+	}
+	for number := first; number <= last; number++ {
+		entry := &EraEntry{Number: number}
+		blob, err := db.Ancient(freezerHashTable, number)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve hash #%d: %v", number, err)
+		}
+		entry.Hash = common.BytesToHash(blob)
+		if entry.Header, err = db.Ancient(freezerHeaderTable, number); err != nil {
+			return fmt.Errorf("failed to retrieve header #%d: %v", number, err)
+		}
+		if entry.Body, err = db.Ancient(freezerBodiesTable, number); err != nil {
+			return fmt.Errorf("failed to retrieve body #%d: %v", number, err)
+		}
+		if entry.Receipts, err = db.Ancient(freezerReceiptTable, number); err != nil {
+			return fmt.Errorf("failed to retrieve receipts #%d: %v", number, err)
+		}
+		if entry.Td, err = db.Ancient(freezerDifficultyTable, number); err != nil {
+			return fmt.Errorf("failed to retrieve total difficulty #%d: %v", number, err)
+		}
+		if err := rlp.Encode(out, entry); err != nil {
+			return err
+		}
+	}
+	var trailer eraTrailer
+	hasher.Sum(trailer.Checksum[:0])
+	return rlp.Encode(w, &trailer)
+}
+
+// EraReader iterates over the entries of an era archive, verifying the archive
+// checksum once all the entries have been consumed.
+type EraReader struct {
+	stream *rlp.Stream
+	hasher hash.Hash
+	header EraHeader
+	read   uint64
+}
+
+// NewEraReader decodes the header of an era archive and returns an iterator over
+// the contained entries.
+func NewEraReader(r io.Reader) (*EraReader, error) {
+	reader := &EraReader{
+		stream: rlp.NewStream(r, 0),
+		hasher: sha3.NewLegacyKeccak256(),
+	}
+	if err := reader.decode(&reader.header); err != nil {
+		return nil, err
+	}
+	if reader.header.Version != eraVersion {
+		return nil, fmt.Errorf("%v: %d", errEraVersion, reader.header.Version)
+	}
+	return reader, nil
+}
+
+// decode reads the next raw item from the archive, feeds it into the checksum
+// and decodes it into val.
+func (r *EraReader) decode(val interface{}) error {
+	blob, err := r.stream.Raw()
+	if err != nil {
+		return err
+	}
+	r.hasher.Write(blob)
+	return rlp.DecodeBytes(blob, val)
+}
+
+// Header returns the preamble of the era archive.
+func (r *EraReader) Header() EraHeader {
+	return r.header
+}
+
+// Next retrieves the next entry from the archive. Once all the entries announced
+// by the header are read, the checksum trailer is verified and io.EOF returned.
+func (r *EraReader) Next() (*EraEntry, error) {
+	if r.read == r.header.Count {
+		var (
+			trailer eraTrailer
+			want    = r.hasher.Sum(nil)
+		)
+		if err := r.decode(&trailer); err != nil {
+			if err == io.EOF {
+				return nil, errEraTruncated
+			}
+			return nil, err
+		}
+		if common.BytesToHash(want) != trailer.Checksum {
+			return nil, errEraChecksum
+		}
+		return nil, io.EOF
+	}
+	entry := new(EraEntry)
+	if err := r.decode(entry); err != nil {
+		if err == io.EOF {
+			return nil, errEraTruncated
+		}
+		return nil, err
+	}
+	if want := r.header.First + r.read; entry.Number != want {
+		return nil, fmt.Errorf("unexpected era entry: have #%d, want #%d", entry.Number, want)
+	}
+	r.read++
+	return entry, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that ancient data can be exported into an era archive and read back,
+// and that damaged archives are rejected.
+func TestEraExportImport(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "")
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend")
+	}
+	defer db.Close()
+
+	// Freeze a short chain of empty blocks
+	var blocks []*types.Block
+	for i := 0; i < 8; i++ {
+		header := &types.Header{
+			Number:      big.NewInt(int64(i)),
+			Difficulty:  big.NewInt(1),
+			Extra:       []byte("test block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		}
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		block := types.NewBlockWithHeader(header)
+		WriteAncientBlock(db, block, nil, big.NewInt(int64(i+1)))
+		blocks = append(blocks, block)
+	}
+	// Export a sub-range and ensure it can be read back
+	buf := new(bytes.Buffer)
+	if err := ExportAncients(db, buf, 2, 5); err != nil {
+		t.Fatalf("failed to export ancients: %v", err)
+	}
+	archive := buf.Bytes()
+
+	reader, err := NewEraReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("failed to open era archive: %v", err)
+	}
+	if header := reader.Header(); header.Genesis != blocks[0].Hash() || header.First != 2 || header.Count != 4 {
+		t.Fatalf("era header mismatch: have %+v", header)
+	}
+	for number := uint64(2); ; number++ {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			if number != 6 {
+				t.Fatalf("era archive ended early: have %d, want %d", number, 6)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read era entry #%d: %v", number, err)
+		}
+		block, receipts, td, err := entry.Block()
+		if err != nil {
+			t.Fatalf("invalid era entry #%d: %v", number, err)
+		}
+		if block.Hash() != blocks[number].Hash() {
+			t.Fatalf("block #%d mismatch: have %x, want %x", number, block.Hash(), blocks[number].Hash())
+		}
+		if len(receipts) != 0 {
+			t.Fatalf("block #%d receipts mismatch: have %d, want 0", number, len(receipts))
+		}
+		if td.Uint64() != number+1 {
+			t.Fatalf("block #%d td mismatch: have %v, want %d", number, td, number+1)
+		}
+	}
+	// Ensure that ranges not yet frozen are rejected
+	if err := ExportAncients(db, new(bytes.Buffer), 2, 8); err == nil {
+		t.Fatalf("export of unfrozen range succeeded")
+	}
+	// Ensure that damaged and truncated archives are rejected
+	corrupt := common.CopyBytes(archive)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if err := drainEra(corrupt); err != errEraChecksum {
+		t.Fatalf("corrupt archive error mismatch: have %v, want %v", err, errEraChecksum)
+	}
+	if err := drainEra(archive[:len(archive)-34]); err != errEraTruncated {
+		t.Fatalf("truncated archive error mismatch: have %v, want %v", err, errEraTruncated)
+	}
+}
+
+// drainEra iterates over all the entries of an era archive, returning the first
+// error encountered or nil if the archive is intact.
+func drainEra(archive []byte) error {
+	reader, err := NewEraReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := reader.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
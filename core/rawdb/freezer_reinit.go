@@ -58,7 +58,15 @@ func InitDatabaseFromFreezer(db ethdb.Database) error {
 				// Retrieve the block from the freezer. If successful, pre-cache
 				// the block hash and the individual transaction hashes for storing
 				// into the database.
-				block := ReadBlock(db, ReadCanonicalHash(db, n), n)
+				hash := ReadCanonicalHash(db, n)
+				block := ReadBlock(db, hash, n)
+				if block == nil {
+					// The body might have been pruned from the ancient store, in
+					// which case only the header mapping can be reinitialized.
+					if header := ReadHeader(db, hash, n); header != nil {
+						block = types.NewBlockWithHeader(header)
+					}
+				}
 				if block != nil {
 					block.Hash()
 					for _, tx := range block.Transactions() {
@@ -118,6 +126,10 @@ func InitDatabaseFromFreezer(db ethdb.Database) error {
 			}
 		}
 	}
+	// Transactions of pruned blocks could not be indexed, mark the index tail
+	if tail, err := db.AncientTail(); err == nil && tail > 0 {
+		WriteTxIndexTail(db, tail)
+	}
 	hash := ReadCanonicalHash(db, frozen-1)
 	WriteHeadHeaderHash(db, hash)
 	WriteHeadFastBlockHash(db, hash)
@@ -23,6 +23,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -232,11 +233,14 @@ func (t *freezerTable) repair() error {
 	t.index.ReadAt(buffer, 0)
 	firstIndex.unmarshalBinary(buffer)
 
-	t.tailId = firstIndex.offset
-	t.itemOffset = firstIndex.filenum
+	t.tailId = firstIndex.filenum
+	t.itemOffset = firstIndex.offset
 
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
+	if offsetsSize == indexEntrySize {
+		lastIndex = indexEntry{filenum: t.tailId}
+	}
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
 		return err
@@ -268,6 +272,9 @@ func (t *freezerTable) repair() error {
 			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
+			if offsetsSize == indexEntrySize {
+				newLastIndex = indexEntry{filenum: t.tailId}
+			}
 			// We might have slipped back into an earlier head-file here
 			if newLastIndex.filenum != lastIndex.filenum {
 				// Release earlier opened file
@@ -338,18 +345,25 @@ func (t *freezerTable) truncate(items uint64) error {
 	if err != nil {
 		return err
 	}
+	// Ensure we're not truncating into the already deleted tail
+	offset := uint64(atomic.LoadUint32(&t.itemOffset))
+	if items < offset {
+		return fmt.Errorf("truncating below tail: items %d, tail %d", items, offset)
+	}
 	// Something's out of sync, truncate the table's offset index
 	t.logger.Warn("Truncating freezer table", "items", t.items, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+	if err := truncateFreezerFile(t.index, int64(items-offset+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
-	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
-		return err
+	expected := indexEntry{filenum: t.tailId}
+	if items > offset {
+		buffer := make([]byte, indexEntrySize)
+		if _, err := t.index.ReadAt(buffer, int64((items-offset)*indexEntrySize)); err != nil {
+			return err
+		}
+		expected.unmarshalBinary(buffer)
 	}
-	var expected indexEntry
-	expected.unmarshalBinary(buffer)
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -383,6 +397,117 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards any data below the provided threshold number. Since data
+// is only ever deleted in whole files, items sharing a data file with the new tail
+// item are retained, so the table may keep a few more items than requested.
+func (t *freezerTable) truncateTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible and there's something to delete
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	offset := uint64(atomic.LoadUint32(&t.itemOffset))
+	if items <= offset {
+		return nil
+	}
+	// Always retain the last item, otherwise the index can't track the head
+	total := atomic.LoadUint64(&t.items)
+	if total <= offset+1 {
+		return nil
+	}
+	if items >= total {
+		items = total - 1
+	}
+	// Locate the data file containing the new tail item. If it's the current tail
+	// file, there's nothing we can delete.
+	buffer := make([]byte, indexEntrySize)
+	readEntry := func(pos uint64) (indexEntry, error) {
+		var entry indexEntry
+		if _, err := t.index.ReadAt(buffer, int64(pos*indexEntrySize)); err != nil {
+			return entry, err
+		}
+		entry.unmarshalBinary(buffer)
+		return entry, nil
+	}
+	last, err := readEntry(items - offset + 1)
+	if err != nil {
+		return err
+	}
+	tailId := last.filenum
+	if tailId == t.tailId {
+		return nil
+	}
+	// Find the first item stored in the new tail file, it will become the first
+	// item retained by the table.
+	var serr error
+	first := sort.Search(int(items-offset), func(n int) bool {
+		entry, err := readEntry(uint64(n) + 1)
+		if err != nil && serr == nil {
+			serr = err
+		}
+		return entry.filenum >= tailId
+	})
+	if serr != nil {
+		return serr
+	}
+	// We need to truncate, save the old size for metrics tracking
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Info("Truncating freezer table tail", "tail", offset, "limit", items, "retained", offset+uint64(first))
+
+	// Write out the new index, starting with the tail metadata followed by the
+	// entries of all the retained items, and atomically swap it in place.
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	retained := make([]byte, stat.Size()-int64(first+1)*indexEntrySize)
+	if _, err := t.index.ReadAt(retained, int64(first+1)*indexEntrySize); err != nil {
+		return err
+	}
+	meta := indexEntry{filenum: tailId, offset: uint32(offset + uint64(first))}
+
+	name := t.index.Name()
+	index, err := openFreezerFileTruncated(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := index.Write(append(meta.marshallBinary(), retained...)); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	index.Close()
+
+	t.index.Close()
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return err
+	}
+	// Index swapped, delete all the data files preceding the new tail
+	t.releaseFilesBefore(tailId, true)
+	t.tailId = tailId
+	atomic.StoreUint32(&t.itemOffset, meta.offset)
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -448,6 +573,19 @@ func (t *freezerTable) releaseFilesAfter(num uint32, remove bool) {
 	}
 }
 
+// releaseFilesBefore closes all open files with a lower number, and optionally also deletes the files
+func (t *freezerTable) releaseFilesBefore(num uint32, remove bool) {
+	for fnum, f := range t.files {
+		if fnum < num {
+			delete(t.files, fnum)
+			f.Close()
+			if remove {
+				os.Remove(f.Name())
+			}
+		}
+	}
+}
+
 // Append injects a binary blob at the end of the freezer table. The item number
 // is a precautionary parameter to ensure data correctness, but the table will
 // reject already existing data.
@@ -529,6 +667,12 @@ func (t *freezerTable) getBounds(item uint64) (uint32, uint32, uint32, error) {
 		return 0, 0, 0, err
 	}
 	endIdx.unmarshalBinary(buffer)
+	if item == 0 {
+		// The first index entry carries the tail metadata instead of a position.
+		// Data is only ever deleted in whole files, so the first retained item
+		// always starts at the beginning of its file.
+		return 0, endIdx.offset, endIdx.filenum, nil
+	}
 	if startIdx.filenum != endIdx.filenum {
 		// If a piece of data 'crosses' a data-file,
 		// it's actually in one piece on the second data-file.
@@ -549,11 +693,12 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 		return nil, errOutOfBounds
 	}
 	// Ensure the item was not deleted from the tail either
+	t.lock.RLock()
 	offset := atomic.LoadUint32(&t.itemOffset)
 	if uint64(offset) > item {
+		t.lock.RUnlock()
 		return nil, errOutOfBounds
 	}
-	t.lock.RLock()
 	startOffset, endOffset, filenum, err := t.getBounds(item - uint64(offset))
 	if err != nil {
 		t.lock.RUnlock()
@@ -582,7 +727,12 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && uint64(atomic.LoadUint32(&t.itemOffset)) <= number
+}
+
+// tail returns the number of the first item retained in the freezer table.
+func (t *freezerTable) tail() uint64 {
+	return uint64(atomic.LoadUint32(&t.itemOffset))
 }
 
 // size returns the total data size in the freezer table.
@@ -552,8 +552,8 @@ func TestOffset(t *testing.T) {
 		tailId := uint32(2)     // First file is 2
 		itemOffset := uint32(4) // We have removed four items
 		zeroIndex := indexEntry{
-			offset:  tailId,
-			filenum: itemOffset,
+			filenum: tailId,
+			offset:  itemOffset,
 		}
 		buf := zeroIndex.marshallBinary()
 		// Overwrite index zero
@@ -602,6 +602,89 @@ func TestOffset(t *testing.T) {
 	}
 }
 
+// TestFreezerTruncateTail tests that deleting items from the tail drops whole data
+// files only, and that the remaining items stay accessible across restarts.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("tailtruncation-%d", rand.Uint64())
+
+	{ // Fill table
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write 10 x 20 bytes, splitting out into five files
+		for x := 0; x < 10; x++ {
+			f.Append(uint64(x), getChunk(20, x))
+		}
+		// Truncating within the first file should be a noop
+		if err := f.truncateTail(1); err != nil {
+			t.Fatal(err)
+		}
+		if f.tail() != 0 {
+			t.Fatalf("expected tail %d, got %d", 0, f.tail())
+		}
+		// Truncating into the middle of a file should retain the whole file
+		if err := f.truncateTail(5); err != nil {
+			t.Fatal(err)
+		}
+		if f.tail() != 4 {
+			t.Fatalf("expected tail %d, got %d", 4, f.tail())
+		}
+		for i := 0; i < 2; i++ {
+			p := filepath.Join(os.TempDir(), fmt.Sprintf("%v.%04d.rdat", fname, i))
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Fatalf("data file %d not deleted: %v", i, err)
+			}
+		}
+		f.Close()
+	}
+	// Reopen, check contents and keep appending
+	{
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if f.tail() != 4 || f.items != 10 {
+			t.Fatalf("expected tail %d and %d items, got %d and %d", 4, 10, f.tail(), f.items)
+		}
+		f.Append(10, getChunk(20, 10))
+		for i := 0; i < 11; i++ {
+			got, err := f.Retrieve(uint64(i))
+			if i < 4 {
+				if err == nil {
+					t.Fatalf("expected error for item %d", i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := getChunk(20, i); !bytes.Equal(got, exp) {
+				t.Fatalf("item %d: expected %x got %x", i, exp, got)
+			}
+		}
+		// Truncating the head back to the tail should leave an empty table
+		if err := f.truncate(4); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Retrieve(4); err == nil {
+			t.Fatal("expected error for truncated item")
+		}
+		if err := f.Append(4, getChunk(20, 0xff)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := f.Retrieve(4); err != nil {
+			t.Fatal(err)
+		} else if exp := getChunk(20, 0xff); !bytes.Equal(got, exp) {
+			t.Fatalf("expected %x got %x", exp, got)
+		}
+	}
+}
+
 // TODO (?)
 // - test that if we remove several head-files, aswell as data last data-file,
 //   the index is truncated accordingly
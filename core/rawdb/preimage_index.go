@@ -0,0 +1,310 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// The preimage index is a compact, randomly accessible archive of hash preimages.
+// Preimages are split into three tables: addresses (20 bytes), storage keys (32
+// bytes) and everything else (length prefixed). Within each table the preimages
+// are ordered by their hash, which isn't stored as it can be recomputed. A fixed
+// size trailer holds, for every table, the end offset of the preimages whose hash
+// starts with each possible byte, allowing a lookup to binary search the right
+// bucket of the fixed size tables.
+const (
+	preimageIndexVersion = 1
+
+	preimageTableAddresses = 0 // Table of 20 byte preimages
+	preimageTableSlots     = 1 // Table of 32 byte preimages
+	preimageTableOthers    = 2 // Table of length prefixed preimages of any other size
+	preimageTableCount     = 3
+
+	// preimageIndexTrailerSize is the size of the trailer: the bucket end offsets
+	// of all the tables, the version and the magic.
+	preimageIndexTrailerSize = preimageTableCount*256*8 + 8 + 8
+
+	// preimageIndexMaxSize is the largest length prefixed preimage accepted, to
+	// avoid huge allocations when reading a corrupt index.
+	preimageIndexMaxSize = 16 * 1024 * 1024
+)
+
+// preimageIndexMagic terminates every preimage index.
+var preimageIndexMagic = []byte("gethpidx")
+
+var (
+	// errPreimageIndexMagic is returned if a file is not a preimage index.
+	errPreimageIndexMagic = errors.New("not a preimage index")
+
+	// errPreimageIndexVersion is returned if a preimage index was produced by an
+	// unsupported version of the format.
+	errPreimageIndexVersion = errors.New("unsupported preimage index version")
+
+	// errPreimageIndexCorrupt is returned if the tables of a preimage index don't
+	// match its trailer.
+	errPreimageIndexCorrupt = errors.New("corrupt preimage index")
+)
+
+// preimageWidths is the size of the preimages in the fixed size tables.
+var preimageWidths = [preimageTableCount]int{
+	preimageTableAddresses: common.AddressLength,
+	preimageTableSlots:     common.HashLength,
+}
+
+// preimageTable returns the table a preimage of the given size belongs into.
+func preimageTable(size int) int {
+	switch size {
+	case common.AddressLength:
+		return preimageTableAddresses
+	case common.HashLength:
+		return preimageTableSlots
+	default:
+		return preimageTableOthers
+	}
+}
+
+// ExportPreimageIndex writes all the preimages in the database into a preimage
+// index, returning the number of preimages exported. The database is iterated
+// once for every table, relying on the preimages being stored in hash order.
+func ExportPreimageIndex(db ethdb.Iteratee, w io.Writer) (uint64, error) {
+	var (
+		out   = bufio.NewWriter(w)
+		ends  [preimageTableCount][256]uint64
+		count uint64
+	)
+	for table := 0; table < preimageTableCount; table++ {
+		var sizes [256]uint64
+
+		it := db.NewIteratorWithPrefix(preimagePrefix)
+		for it.Next() {
+			key, blob := it.Key(), it.Value()
+			if len(key) != len(preimagePrefix)+common.HashLength || preimageTable(len(blob)) != table {
+				continue
+			}
+			size := len(blob)
+			if table == preimageTableOthers {
+				var prefix [binary.MaxVarintLen64]byte
+				n := binary.PutUvarint(prefix[:], uint64(len(blob)))
+				if _, err := out.Write(prefix[:n]); err != nil {
+					it.Release()
+					return 0, err
+				}
+				size += n
+			}
+			if _, err := out.Write(blob); err != nil {
+				it.Release()
+				return 0, err
+			}
+			sizes[key[len(preimagePrefix)]] += uint64(size)
+			count++
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return 0, err
+		}
+		// Convert the bucket sizes into cumulative end offsets
+		var end uint64
+		for i, size := range sizes {
+			end += size
+			ends[table][i] = end
+		}
+	}
+	// Terminate the index with the trailer
+	var trailer [preimageIndexTrailerSize]byte
+	for table := range ends {
+		for i, end := range ends[table] {
+			binary.BigEndian.PutUint64(trailer[(table*256+i)*8:], end)
+		}
+	}
+	binary.BigEndian.PutUint64(trailer[preimageTableCount*256*8:], preimageIndexVersion)
+	copy(trailer[preimageTableCount*256*8+8:], preimageIndexMagic)
+
+	if _, err := out.Write(trailer[:]); err != nil {
+		return 0, err
+	}
+	return count, out.Flush()
+}
+
+// PreimageIndex gives random access to the preimages in a preimage index.
+type PreimageIndex struct {
+	r       io.ReaderAt
+	offsets [preimageTableCount]int64       // Offset of each table within the index
+	ends    [preimageTableCount][256]uint64 // Bucket end offsets within each table
+}
+
+// IsPreimageIndex reports whether the data of the given size accessible through r
+// is terminated like a preimage index.
+func IsPreimageIndex(r io.ReaderAt, size int64) bool {
+	if size < preimageIndexTrailerSize {
+		return false
+	}
+	magic := make([]byte, len(preimageIndexMagic))
+	if _, err := r.ReadAt(magic, size-int64(len(magic))); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, preimageIndexMagic)
+}
+
+// OpenPreimageIndex decodes the trailer of the preimage index of the given size
+// accessible through r.
+func OpenPreimageIndex(r io.ReaderAt, size int64) (*PreimageIndex, error) {
+	if size < preimageIndexTrailerSize {
+		return nil, errPreimageIndexMagic
+	}
+	var trailer [preimageIndexTrailerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-preimageIndexTrailerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer[preimageTableCount*256*8+8:], preimageIndexMagic) {
+		return nil, errPreimageIndexMagic
+	}
+	if version := binary.BigEndian.Uint64(trailer[preimageTableCount*256*8:]); version != preimageIndexVersion {
+		return nil, fmt.Errorf("%w: %d", errPreimageIndexVersion, version)
+	}
+	index := &PreimageIndex{r: r}
+
+	var offset int64
+	for table := 0; table < preimageTableCount; table++ {
+		var prev uint64
+		for i := range index.ends[table] {
+			end := binary.BigEndian.Uint64(trailer[(table*256+i)*8:])
+			if end < prev || (preimageWidths[table] > 0 && end%uint64(preimageWidths[table]) != 0) {
+				return nil, errPreimageIndexCorrupt
+			}
+			index.ends[table][i], prev = end, end
+		}
+		index.offsets[table] = offset
+		offset += int64(prev)
+	}
+	if offset != size-preimageIndexTrailerSize {
+		return nil, errPreimageIndexCorrupt
+	}
+	return index, nil
+}
+
+// bucket returns the start and end offset of the preimages in the given table
+// whose hash starts with the given byte.
+func (idx *PreimageIndex) bucket(table int, b byte) (uint64, uint64) {
+	var start uint64
+	if b > 0 {
+		start = idx.ends[table][b-1]
+	}
+	return start, idx.ends[table][b]
+}
+
+// Get retrieves the preimage of the given hash, or nil if the index doesn't
+// contain it.
+func (idx *PreimageIndex) Get(hash common.Hash) ([]byte, error) {
+	// Binary search the bucket of the fixed size tables
+	for table := preimageTableAddresses; table <= preimageTableSlots; table++ {
+		var (
+			width      = uint64(preimageWidths[table])
+			start, end = idx.bucket(table, hash[0])
+			blob       = make([]byte, width)
+			failure    error
+		)
+		n := sort.Search(int((end-start)/width), func(i int) bool {
+			if failure != nil {
+				return true
+			}
+			if _, failure = idx.r.ReadAt(blob, idx.offsets[table]+int64(start+uint64(i)*width)); failure != nil {
+				return true
+			}
+			return bytes.Compare(crypto.Keccak256(blob), hash[:]) >= 0
+		})
+		if failure != nil {
+			return nil, failure
+		}
+		if uint64(n) < (end-start)/width {
+			if _, err := idx.r.ReadAt(blob, idx.offsets[table]+int64(start+uint64(n)*width)); err != nil {
+				return nil, err
+			}
+			if crypto.Keccak256Hash(blob) == hash {
+				return blob, nil
+			}
+		}
+	}
+	// Scan the bucket of the variable size table
+	start, end := idx.bucket(preimageTableOthers, hash[0])
+	section := io.NewSectionReader(idx.r, idx.offsets[preimageTableOthers]+int64(start), int64(end-start))
+
+	var found []byte
+	err := iteratePreimages(bufio.NewReader(section), 0, func(blob []byte) error {
+		if crypto.Keccak256Hash(blob) == hash {
+			found = blob
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Iterate invokes fn with every preimage in the index. Returning an error from
+// fn aborts the iteration.
+func (idx *PreimageIndex) Iterate(fn func(preimage []byte) error) error {
+	for table := 0; table < preimageTableCount; table++ {
+		size := int64(idx.ends[table][255])
+		section := io.NewSectionReader(idx.r, idx.offsets[table], size)
+		if err := iteratePreimages(bufio.NewReader(section), preimageWidths[table], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iteratePreimages reads preimages of the given width from r until it's drained,
+// invoking fn with each of them. A zero width reads length prefixed preimages.
+func iteratePreimages(r *bufio.Reader, width int, fn func(preimage []byte) error) error {
+	for {
+		size := width
+		if size == 0 {
+			length, err := binary.ReadUvarint(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil || length > preimageIndexMaxSize {
+				return errPreimageIndexCorrupt
+			}
+			size = int(length)
+		}
+		blob := make([]byte, size)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			if err == io.EOF && width > 0 {
+				return nil
+			}
+			return errPreimageIndexCorrupt
+		}
+		if err := fn(blob); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that preimages can be exported into a preimage index, looked up in it
+// and iterated over, and that damaged indexes are rejected.
+func TestPreimageIndex(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Store a mix of addresses, storage keys and other preimages
+	preimages := make(map[common.Hash][]byte)
+	for i := 0; i < 1000; i++ {
+		var blob []byte
+		switch i % 3 {
+		case 0:
+			blob = make([]byte, common.AddressLength)
+		case 1:
+			blob = make([]byte, common.HashLength)
+		default:
+			blob = make([]byte, 1+rand.Intn(100))
+		}
+		rand.Read(blob)
+		preimages[crypto.Keccak256Hash(blob)] = blob
+	}
+	WritePreimages(db, preimages)
+
+	var buf bytes.Buffer
+	count, err := ExportPreimageIndex(db, &buf)
+	if err != nil {
+		t.Fatalf("failed to export preimage index: %v", err)
+	}
+	if count != uint64(len(preimages)) {
+		t.Fatalf("exported preimage count mismatch: have %d, want %d", count, len(preimages))
+	}
+	blob := buf.Bytes()
+	if !IsPreimageIndex(bytes.NewReader(blob), int64(len(blob))) {
+		t.Fatalf("preimage index not recognised")
+	}
+	index, err := OpenPreimageIndex(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		t.Fatalf("failed to open preimage index: %v", err)
+	}
+	// Look up every preimage, as well as an unknown one
+	for hash, want := range preimages {
+		have, err := index.Get(hash)
+		if err != nil {
+			t.Fatalf("failed to look up preimage %x: %v", hash, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("preimage %x mismatch: have %x, want %x", hash, have, want)
+		}
+	}
+	if have, err := index.Get(common.Hash{0xff}); have != nil || err != nil {
+		t.Fatalf("unknown preimage found: %x, %v", have, err)
+	}
+	// Iterate over the entire index
+	seen := make(map[common.Hash]bool)
+	if err := index.Iterate(func(preimage []byte) error {
+		hash := crypto.Keccak256Hash(preimage)
+		if _, ok := preimages[hash]; !ok {
+			t.Errorf("unexpected preimage %x", preimage)
+		}
+		seen[hash] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to iterate preimage index: %v", err)
+	}
+	if len(seen) != len(preimages) {
+		t.Fatalf("iterated preimage count mismatch: have %d, want %d", len(seen), len(preimages))
+	}
+	// Ensure damaged indexes are rejected
+	if _, err := OpenPreimageIndex(bytes.NewReader(blob[1:]), int64(len(blob)-1)); err != errPreimageIndexCorrupt {
+		t.Errorf("truncated index error mismatch: have %v, want %v", err, errPreimageIndexCorrupt)
+	}
+	if IsPreimageIndex(bytes.NewReader(blob[:len(blob)-1]), int64(len(blob)-1)) {
+		t.Errorf("index without magic recognised")
+	}
+}
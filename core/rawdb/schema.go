@@ -41,6 +41,12 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
+	txIndexTailKey = []byte("TransactionIndexTail")
+
+	// badBlockKey tracks the list of bad blocks seen by the local node.
+	badBlockKey = []byte("InvalidBlock")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -53,6 +59,10 @@ var (
 	txLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 
+	reorgPrefix = []byte("J") // reorgPrefix + num (uint64 big endian) + hash -> chain reorganisation
+
+	badBlockWitnessPrefix = []byte("W") // badBlockWitnessPrefix + hash -> bad block witness
+
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	ConfigPrefix   = []byte("ethereum-config-") // config prefix for the db
 
@@ -90,6 +100,11 @@ var freezerNoSnappy = map[string]bool{
 	freezerDifficultyTable: true,
 }
 
+// freezerHistoryTables lists the ancient-tables holding block history that can
+// be pruned from the tail. Headers, hashes and difficulties are always retained
+// as they are needed to verify and serve the header chain.
+var freezerHistoryTables = []string{freezerBodiesTable, freezerReceiptTable}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
@@ -155,6 +170,16 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// reorgKey = reorgPrefix + num (uint64 big endian) + hash
+func reorgKey(number uint64, hash common.Hash) []byte {
+	return append(append(reorgPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// badBlockWitnessKey = badBlockWitnessPrefix + hash
+func badBlockWitnessKey(hash common.Hash) []byte {
+	return append(badBlockWitnessPrefix, hash.Bytes()...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
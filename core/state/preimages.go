@@ -0,0 +1,94 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// missingPreimageSamples is the maximum number of hashed addresses without a
+// known preimage collected by a preimage coverage check.
+const missingPreimageSamples = 1024
+
+// PreimageCoverage reports how many of the hashed keys of a state have a known
+// preimage, i.e. how many accounts and storage slots a state dump can name.
+type PreimageCoverage struct {
+	Root            common.Hash   `json:"root"`            // Root of the checked state
+	Accounts        uint64        `json:"accounts"`        // Number of accounts checked
+	MissingAccounts uint64        `json:"missingAccounts"` // Number of accounts without a known address
+	Slots           uint64        `json:"slots"`           // Number of storage slots checked
+	MissingSlots    uint64        `json:"missingSlots"`    // Number of storage slots without a known key
+	Missing         []common.Hash `json:"missing"`         // Sample of hashed addresses without a known address
+}
+
+// Copy returns an independent copy of the coverage report.
+func (c *PreimageCoverage) Copy() *PreimageCoverage {
+	cpy := *c
+	cpy.Missing = append([]common.Hash(nil), c.Missing...)
+	return &cpy
+}
+
+// CheckPreimages walks the account trie with the given root and the storage trie
+// of every account in it, counting the hashed keys whose preimage is unknown. The
+// report is updated in place while walking; onAccount is invoked with it after
+// every account and returning an error from it aborts the check.
+func CheckPreimages(db Database, root common.Hash, onAccount func(*PreimageCoverage) error) (*PreimageCoverage, error) {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	coverage := &PreimageCoverage{Root: root}
+
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		coverage.Accounts++
+		if tr.GetKey(it.Key) == nil {
+			coverage.MissingAccounts++
+			if len(coverage.Missing) < missingPreimageSamples {
+				coverage.Missing = append(coverage.Missing, common.BytesToHash(it.Key))
+			}
+		}
+		var account Account
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return coverage, err
+		}
+		if account.Root != emptyRoot {
+			st, err := db.OpenStorageTrie(common.BytesToHash(it.Key), account.Root)
+			if err != nil {
+				return coverage, err
+			}
+			sit := trie.NewIterator(st.NodeIterator(nil))
+			for sit.Next() {
+				coverage.Slots++
+				if st.GetKey(sit.Key) == nil {
+					coverage.MissingSlots++
+				}
+			}
+			if sit.Err != nil {
+				return coverage, sit.Err
+			}
+		}
+		if onAccount != nil {
+			if err := onAccount(coverage); err != nil {
+				return coverage, err
+			}
+		}
+	}
+	return coverage, it.Err
+}
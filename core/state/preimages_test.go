@@ -0,0 +1,65 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the preimage coverage check counts the accounts and storage slots
+// whose preimage is missing.
+func TestCheckPreimages(t *testing.T) {
+	diskdb := rawdb.NewMemoryDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(diskdb))
+
+	for i := byte(0); i < 10; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		state.SetState(addr, common.Hash{i}, common.Hash{1})
+		state.SetState(addr, common.Hash{i, 0xff}, common.Hash{2})
+	}
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := state.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit tries: %v", err)
+	}
+	// Drop the preimage of an account and of a storage slot
+	missing := crypto.Keccak256Hash(common.BytesToAddress([]byte{3}).Bytes())
+	diskdb.Delete(append([]byte("secure-key-"), missing.Bytes()...))
+	diskdb.Delete(append([]byte("secure-key-"), crypto.Keccak256(common.Hash{5, 0xff}.Bytes())...))
+
+	coverage, err := CheckPreimages(NewDatabase(diskdb), root, nil)
+	if err != nil {
+		t.Fatalf("failed to check preimages: %v", err)
+	}
+	if coverage.Accounts != 10 || coverage.MissingAccounts != 1 {
+		t.Errorf("account coverage mismatch: have %d/%d missing, want 1/10", coverage.MissingAccounts, coverage.Accounts)
+	}
+	if coverage.Slots != 20 || coverage.MissingSlots != 1 {
+		t.Errorf("slot coverage mismatch: have %d/%d missing, want 1/20", coverage.MissingSlots, coverage.Slots)
+	}
+	if len(coverage.Missing) != 1 || coverage.Missing[0] != missing {
+		t.Errorf("missing accounts mismatch: have %x, want [%x]", coverage.Missing, missing)
+	}
+}
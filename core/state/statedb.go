@@ -88,6 +88,12 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	// State diff recording, nil unless explicitly started
+	diff *diffRecorder
+
+	// Witness tracking, nil unless explicitly started
+	witness *witnessTracker
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        *journal
@@ -151,6 +157,8 @@ func (s *StateDB) Reset(root common.Hash) error {
 	s.logs = make(map[common.Hash][]*types.Log)
 	s.logSize = 0
 	s.preimages = make(map[common.Hash][]byte)
+	s.diff = nil
+	s.witness = nil
 	s.clearJournalAndRefund()
 	return nil
 }
@@ -476,6 +484,9 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 	// Load the object from the database
 	enc, err := s.trie.TryGet(addr[:])
 	if len(enc) == 0 {
+		if s.witness != nil {
+			s.witness.absent[addr] = struct{}{}
+		}
 		s.setError(err)
 		return nil
 	}
@@ -510,6 +521,12 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 
 	newobj = newObject(s, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
+	if s.witness != nil && prev != nil {
+		s.witness.replaced = append(s.witness.replaced, prev)
+	}
+	if s.diff != nil {
+		s.diff.created[newobj] = struct{}{}
+	}
 	if prev == nil {
 		s.journal.append(createObjectChange{account: &addr})
 	} else {
@@ -671,6 +688,9 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 			// Thus, we can safely ignore it here
 			continue
 		}
+		if s.diff != nil {
+			s.recordDiff(obj)
+		}
 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
 			obj.deleted = true
 		} else {
@@ -0,0 +1,253 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// StateDiff is the set of accounts changed by a state transition, keyed by
+// address.
+type StateDiff map[common.Address]*AccountDiff
+
+// AccountDiff is the change of a single account. Fields left unchanged by the
+// transition are omitted.
+type AccountDiff struct {
+	Created        bool                         `json:"created,omitempty"`        // Account didn't exist before the transition
+	Deleted        bool                         `json:"deleted,omitempty"`        // Account doesn't exist after the transition
+	StorageCleared bool                         `json:"storageCleared,omitempty"` // Storage from before the transition was dropped
+	Balance        *BalanceDiff                 `json:"balance,omitempty"`
+	Nonce          *NonceDiff                   `json:"nonce,omitempty"`
+	Code           *CodeDiff                    `json:"code,omitempty"`
+	Storage        map[common.Hash]*StorageDiff `json:"storage,omitempty"`
+}
+
+// BalanceDiff is the change of an account balance.
+type BalanceDiff struct {
+	Pre  *hexutil.Big `json:"pre"`
+	Post *hexutil.Big `json:"post"`
+}
+
+// NonceDiff is the change of an account nonce.
+type NonceDiff struct {
+	Pre  hexutil.Uint64 `json:"pre"`
+	Post hexutil.Uint64 `json:"post"`
+}
+
+// CodeDiff is the change of a contract code.
+type CodeDiff struct {
+	Pre  hexutil.Bytes `json:"pre"`
+	Post hexutil.Bytes `json:"post"`
+}
+
+// StorageDiff is the change of a single storage slot.
+type StorageDiff struct {
+	Pre  common.Hash `json:"pre"`
+	Post common.Hash `json:"post"`
+}
+
+// diffRecorder collects the accounts and storage slots dirtied since recording
+// was started, along with the account trie they need to be compared against.
+type diffRecorder struct {
+	trie    Trie                                        // Account trie at the start of recording
+	slots   map[common.Address]map[common.Hash]struct{} // Dirtied accounts and storage slots
+	created map[*stateObject]struct{}                   // Objects (re)created since recording started
+}
+
+// StartStateDiff starts recording the changes made to the state, to be retrieved
+// by StateDiff. Any previous recording is discarded. The changes are collected
+// from the dirty sets as the state is finalised, so recording must be started
+// on a state without pending changes.
+func (s *StateDB) StartStateDiff() {
+	s.diff = &diffRecorder{
+		trie:    s.db.CopyTrie(s.trie),
+		slots:   make(map[common.Address]map[common.Hash]struct{}),
+		created: make(map[*stateObject]struct{}),
+	}
+}
+
+// recordDiff marks the account and its dirty storage slots as changed. It needs
+// to be called before the dirty storage is finalised.
+func (s *StateDB) recordDiff(obj *stateObject) {
+	slots := s.diff.slots[obj.address]
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		s.diff.slots[obj.address] = slots
+	}
+	for key := range obj.dirtyStorage {
+		slots[key] = struct{}{}
+	}
+}
+
+// StateDiff returns the changes made to the state since StartStateDiff was called,
+// with both the values at the start of the recording and the current ones. Only
+// finalised changes are included, so Finalise or IntermediateRoot needs to be
+// called first. Nil is returned if no recording was started.
+//
+// Storage slots are reported if they were written to. If an account is deleted
+// or recreated by the transition, dropping its storage, it's flagged with
+// StorageCleared and all of its original slots are reported too. These are
+// enumerated from the storage trie, so slots whose hashed keys have no known
+// preimage are covered by the flag only.
+func (s *StateDB) StateDiff() (StateDiff, error) {
+	if s.diff == nil {
+		return nil, nil
+	}
+	diff := make(StateDiff)
+	for addr, slots := range s.diff.slots {
+		// Retrieve the account from before and after the transition
+		enc, err := s.diff.trie.TryGet(addr[:])
+		if err != nil {
+			return nil, err
+		}
+		var pre *Account
+		if len(enc) > 0 {
+			pre = new(Account)
+			if err := rlp.DecodeBytes(enc, pre); err != nil {
+				return nil, err
+			}
+		}
+		var post *stateObject
+		if obj := s.stateObjects[addr]; obj != nil && !obj.deleted {
+			post = obj
+		}
+		if pre == nil && post == nil {
+			continue // Account touched and removed as empty
+		}
+		account := &AccountDiff{
+			Created: pre == nil,
+			Deleted: post == nil,
+		}
+		_, recreated := s.diff.created[post]
+		// Compare the account fields
+		var (
+			addrHash                  = crypto.Keccak256Hash(addr[:])
+			preBalance, postBalance   = new(big.Int), new(big.Int)
+			preNonce, postNonce       uint64
+			preCodeHash, postCodeHash = emptyCodeHash, emptyCodeHash
+			preCode, postCode         []byte
+			preRoot                   = emptyRoot
+		)
+		if pre != nil {
+			preBalance, preNonce, preCodeHash, preRoot = pre.Balance, pre.Nonce, pre.CodeHash, pre.Root
+		}
+		if post != nil {
+			postBalance, postNonce, postCodeHash = post.Balance(), post.Nonce(), post.CodeHash()
+		}
+		if preBalance.Cmp(postBalance) != 0 {
+			account.Balance = &BalanceDiff{Pre: (*hexutil.Big)(preBalance), Post: (*hexutil.Big)(new(big.Int).Set(postBalance))}
+		}
+		if preNonce != postNonce {
+			account.Nonce = &NonceDiff{Pre: hexutil.Uint64(preNonce), Post: hexutil.Uint64(postNonce)}
+		}
+		if !bytes.Equal(preCodeHash, postCodeHash) {
+			if !bytes.Equal(preCodeHash, emptyCodeHash) {
+				if preCode, err = s.db.ContractCode(addrHash, common.BytesToHash(preCodeHash)); err != nil {
+					return nil, err
+				}
+			}
+			if post != nil {
+				postCode = post.Code(s.db)
+			}
+			account.Code = &CodeDiff{Pre: preCode, Post: postCode}
+		}
+		// Compare the written storage slots, along with all the original ones if
+		// the storage was dropped
+		account.StorageCleared = preRoot != emptyRoot && (post == nil || recreated)
+
+		if len(slots) > 0 || account.StorageCleared {
+			var (
+				tr     Trie
+				before = make(map[common.Hash]common.Hash)
+			)
+			if preRoot != emptyRoot {
+				if tr, err = s.db.OpenStorageTrie(addrHash, preRoot); err != nil {
+					return nil, err
+				}
+			}
+			if account.StorageCleared {
+				it := trie.NewIterator(tr.NodeIterator(nil))
+				for it.Next() {
+					key := tr.GetKey(it.Key)
+					if key == nil {
+						continue // Preimage unknown, only covered by the flag
+					}
+					value, err := decodeSlot(it.Value)
+					if err != nil {
+						return nil, err
+					}
+					before[common.BytesToHash(key)] = value
+				}
+				if it.Err != nil {
+					return nil, it.Err
+				}
+			}
+			for key := range slots {
+				if _, ok := before[key]; ok {
+					continue
+				}
+				var value common.Hash
+				if tr != nil {
+					enc, err := tr.TryGet(key[:])
+					if err != nil {
+						return nil, err
+					}
+					if value, err = decodeSlot(enc); err != nil {
+						return nil, err
+					}
+				}
+				before[key] = value
+			}
+			for key, value := range before {
+				var after common.Hash
+				if post != nil {
+					after = post.GetState(s.db, key)
+				}
+				if value != after {
+					if account.Storage == nil {
+						account.Storage = make(map[common.Hash]*StorageDiff)
+					}
+					account.Storage[key] = &StorageDiff{Pre: value, Post: after}
+				}
+			}
+		}
+		if account.Created || account.Deleted || account.StorageCleared || account.Balance != nil || account.Nonce != nil || account.Code != nil || account.Storage != nil {
+			diff[addr] = account
+		}
+	}
+	return diff, nil
+}
+
+// decodeSlot decodes a storage slot value as stored in the storage trie.
+func decodeSlot(enc []byte) (common.Hash, error) {
+	var value common.Hash
+	if len(enc) > 0 {
+		_, content, _, err := rlp.Split(enc)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		value.SetBytes(content)
+	}
+	return value, nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the state diff contains the pre and post values of everything
+// changed since recording started, and nothing else.
+func TestStateDiff(t *testing.T) {
+	var (
+		changed   = common.Address{0x01}
+		destroyed = common.Address{0x02}
+		created   = common.Address{0x03}
+		reverted  = common.Address{0x04}
+		untouched = common.Address{0x05}
+		empty     = common.Address{0x06}
+
+		slot1 = common.Hash{0x01}
+		slot2 = common.Hash{0x02}
+	)
+	// Create the initial state and commit it
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+
+	state.SetBalance(changed, big.NewInt(100))
+	state.SetNonce(changed, 1)
+	state.SetCode(changed, []byte{0x01})
+	state.SetState(changed, slot1, common.Hash{0x0a})
+	state.SetState(changed, slot2, common.Hash{0x0b})
+	state.SetBalance(destroyed, big.NewInt(50))
+	state.SetState(destroyed, slot1, common.Hash{0x0c})
+	state.SetBalance(reverted, big.NewInt(10))
+	state.SetBalance(untouched, big.NewInt(20))
+
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	state.Reset(root)
+
+	// Modify the state, recording the changes
+	state.StartStateDiff()
+
+	state.AddBalance(changed, big.NewInt(5))
+	state.SetState(changed, slot1, common.Hash{0x0d})
+	state.SetState(changed, slot2, common.Hash{0x0e})
+	state.SetState(changed, slot2, common.Hash{0x0b}) // restored, not a change
+	state.Suicide(destroyed)
+	state.Finalise(true)
+
+	state.SetNonce(created, 1)
+	state.SetCode(created, []byte{0x02})
+	state.GetBalance(untouched)
+	state.AddBalance(empty, new(big.Int)) // touched, removed as empty
+
+	snap := state.Snapshot()
+	state.SetBalance(reverted, big.NewInt(0))
+	state.RevertToSnapshot(snap)
+
+	state.IntermediateRoot(true)
+
+	diff, err := state.StateDiff()
+	if err != nil {
+		t.Fatalf("failed to retrieve state diff: %v", err)
+	}
+	want := StateDiff{
+		changed: {
+			Balance: &BalanceDiff{Pre: (*hexutil.Big)(big.NewInt(100)), Post: (*hexutil.Big)(big.NewInt(105))},
+			Storage: map[common.Hash]*StorageDiff{
+				slot1: {Pre: common.Hash{0x0a}, Post: common.Hash{0x0d}},
+			},
+		},
+		destroyed: {
+			Deleted:        true,
+			StorageCleared: true,
+			Balance:        &BalanceDiff{Pre: (*hexutil.Big)(big.NewInt(50)), Post: (*hexutil.Big)(new(big.Int))},
+			Storage: map[common.Hash]*StorageDiff{
+				slot1: {Pre: common.Hash{0x0c}},
+			},
+		},
+		created: {
+			Created: true,
+			Nonce:   &NonceDiff{Pre: 0, Post: 1},
+			Code:    &CodeDiff{Post: []byte{0x02}},
+		},
+	}
+	have, _ := json.Marshal(diff)
+	exp, _ := json.Marshal(want)
+	if !reflect.DeepEqual(have, exp) {
+		t.Errorf("state diff mismatch:\nhave %s\nwant %s", have, exp)
+	}
+}
+
+// Tests that accounts whose storage is dropped by self-destructing, or by being
+// recreated, are flagged and report all of their original slots as cleared, as
+// far as the preimages of the slot keys are known.
+func TestStateDiffClearedStorage(t *testing.T) {
+	var (
+		destroyed = common.Address{0x01}
+		hidden    = common.Address{0x02}
+		recreated = common.Address{0x03}
+		revived   = common.Address{0x04}
+
+		slot1  = common.Hash{0x01}
+		slot2  = common.Hash{0x02}
+		slot3  = common.Hash{0x03}
+		secret = common.Hash{0x51}
+		known  = common.Hash{0x52}
+	)
+	diskdb := rawdb.NewMemoryDatabase()
+	db := NewDatabase(diskdb)
+	state, _ := New(common.Hash{}, db)
+
+	for _, addr := range []common.Address{destroyed, hidden, recreated, revived} {
+		state.SetBalance(addr, big.NewInt(1))
+	}
+	state.SetState(destroyed, slot1, common.Hash{0x11})
+	state.SetState(destroyed, slot2, common.Hash{0x12})
+	state.SetState(destroyed, slot3, common.Hash{0x13})
+	state.SetState(hidden, secret, common.Hash{0x21})
+	state.SetState(hidden, known, common.Hash{0x22})
+	state.SetState(recreated, slot1, common.Hash{0x31})
+	state.SetState(recreated, slot2, common.Hash{0x32})
+	state.SetState(revived, slot1, common.Hash{0x41})
+
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	// Forget the preimage of one of the slot keys
+	if err := diskdb.Delete(append([]byte("secure-key-"), crypto.Keccak256(secret[:])...)); err != nil {
+		t.Fatalf("failed to delete preimage: %v", err)
+	}
+	state, _ = New(root, db)
+	state.StartStateDiff()
+
+	// Self-destruct the accounts in a first transaction, one of them after
+	// writing to its storage
+	state.SetState(destroyed, slot1, common.Hash{0xff})
+	state.Suicide(destroyed)
+	state.Suicide(hidden)
+	state.Suicide(recreated)
+	state.Finalise(true)
+
+	// Redeploy one of them in a second transaction, and revert the recreation of
+	// another
+	state.CreateAccount(recreated)
+	state.SetNonce(recreated, 1)
+	state.SetState(recreated, slot2, common.Hash{0x33})
+
+	snap := state.Snapshot()
+	state.CreateAccount(revived)
+	state.RevertToSnapshot(snap)
+	state.AddBalance(revived, big.NewInt(1))
+
+	state.IntermediateRoot(true)
+
+	diff, err := state.StateDiff()
+	if err != nil {
+		t.Fatalf("failed to retrieve state diff: %v", err)
+	}
+	var (
+		one  = (*hexutil.Big)(big.NewInt(1))
+		zero = (*hexutil.Big)(new(big.Int))
+	)
+	want := StateDiff{
+		destroyed: {
+			Deleted:        true,
+			StorageCleared: true,
+			Balance:        &BalanceDiff{Pre: one, Post: zero},
+			Storage: map[common.Hash]*StorageDiff{
+				slot1: {Pre: common.Hash{0x11}},
+				slot2: {Pre: common.Hash{0x12}},
+				slot3: {Pre: common.Hash{0x13}},
+			},
+		},
+		hidden: {
+			Deleted:        true,
+			StorageCleared: true,
+			Balance:        &BalanceDiff{Pre: one, Post: zero},
+			Storage: map[common.Hash]*StorageDiff{
+				known: {Pre: common.Hash{0x22}},
+			},
+		},
+		recreated: {
+			StorageCleared: true,
+			Balance:        &BalanceDiff{Pre: one, Post: zero},
+			Nonce:          &NonceDiff{Pre: 0, Post: 1},
+			Storage: map[common.Hash]*StorageDiff{
+				slot1: {Pre: common.Hash{0x31}},
+				slot2: {Pre: common.Hash{0x32}, Post: common.Hash{0x33}},
+			},
+		},
+		revived: {
+			Balance: &BalanceDiff{Pre: one, Post: (*hexutil.Big)(big.NewInt(2))},
+		},
+	}
+	have, _ := json.Marshal(diff)
+	exp, _ := json.Marshal(want)
+	if !reflect.DeepEqual(have, exp) {
+		t.Errorf("state diff mismatch:\nhave %s\nwant %s", have, exp)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// VerifyFault describes a problem found while verifying the integrity of a state.
+type VerifyFault struct {
+	Owner common.Hash // Hashed address of the account the fault belongs to, zero for the account trie
+	Err   error       // Missing or corrupt trie node, undecodable account or missing code
+}
+
+func (f *VerifyFault) Error() string {
+	if f.Owner == (common.Hash{}) {
+		return fmt.Sprintf("account trie: %v", f.Err)
+	}
+	return fmt.Sprintf("account %x: %v", f.Owner, f.Err)
+}
+
+// VerifyState walks the account trie with the given root and the storage trie of
+// every account in it, ensuring that all the trie nodes are present and match their
+// hashes, and that the code of every contract is available. All the problems found
+// are reported to onFault, the verification continuing past them.
+//
+// Accounts whose hashed address sorts before start are skipped, allowing an
+// interrupted verification to be resumed. onAccount is invoked with the hashed
+// address of each account before it is verified, and returning an error from it
+// aborts the verification.
+func VerifyState(db Database, root common.Hash, start common.Hash, onAccount func(hash common.Hash) error, onFault func(*VerifyFault)) error {
+	triedb := db.TrieDB()
+
+	return trie.VerifyTrie(triedb, root, start.Bytes(), func(key, value []byte) error {
+		owner := common.BytesToHash(key)
+		if onAccount != nil {
+			if err := onAccount(owner); err != nil {
+				return err
+			}
+		}
+		var account Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			onFault(&VerifyFault{Owner: owner, Err: fmt.Errorf("invalid account: %v", err)})
+			return nil
+		}
+		trie.VerifyTrie(triedb, account.Root, nil, nil, func(err error) {
+			onFault(&VerifyFault{Owner: owner, Err: err})
+		})
+		if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			hash := common.BytesToHash(account.CodeHash)
+			code, err := db.ContractCode(owner, hash)
+			switch {
+			case err != nil:
+				onFault(&VerifyFault{Owner: owner, Err: fmt.Errorf("missing code %x", hash)})
+			case crypto.Keccak256Hash(code) != hash:
+				onFault(&VerifyFault{Owner: owner, Err: fmt.Errorf("corrupt code %x", hash)})
+			}
+		}
+		return nil
+	}, func(err error) {
+		onFault(&VerifyFault{Err: err})
+	})
+}
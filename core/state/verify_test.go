@@ -0,0 +1,103 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that state verification detects missing and corrupt trie nodes as well as
+// missing contract code, and that it can be resumed from an account.
+func TestVerifyState(t *testing.T) {
+	diskdb := rawdb.NewMemoryDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(diskdb))
+
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		if i%4 == 0 {
+			state.SetCode(addr, []byte{i, i, i, i})
+			for j := byte(0); j < 16; j++ {
+				state.SetState(addr, common.BytesToHash([]byte{j}), common.BytesToHash([]byte{i, j}))
+			}
+		}
+	}
+	root, _ := state.Commit(false)
+	state.Database().TrieDB().Commit(root, false)
+
+	// verify runs a state verification, returning the faults and visited accounts
+	verify := func(start common.Hash) ([]*VerifyFault, []common.Hash) {
+		var (
+			faults   []*VerifyFault
+			accounts []common.Hash
+		)
+		err := VerifyState(NewDatabase(diskdb), root, start, func(hash common.Hash) error {
+			accounts = append(accounts, hash)
+			return nil
+		}, func(fault *VerifyFault) {
+			faults = append(faults, fault)
+		})
+		if err != nil {
+			t.Fatalf("failed to verify state: %v", err)
+		}
+		return faults, accounts
+	}
+	faults, accounts := verify(common.Hash{})
+	if len(faults) != 0 {
+		t.Fatalf("intact state reported faults: %v", faults)
+	}
+	if len(accounts) != 64 {
+		t.Fatalf("visited account count mismatch: have %d, want %d", len(accounts), 64)
+	}
+	// Resuming from an account must skip all preceding ones
+	if _, resumed := verify(accounts[32]); len(resumed) != 32 || resumed[0] != accounts[32] {
+		t.Fatalf("resumed verification mismatch: have %d accounts, want %d", len(resumed), 32)
+	}
+	// Damage the code of a contract and the storage trie of another one
+	var (
+		codeOwner    = crypto.Keccak256Hash(common.BytesToAddress([]byte{4}).Bytes())
+		storageOwner = crypto.Keccak256Hash(common.BytesToAddress([]byte{8}).Bytes())
+	)
+	diskdb.Delete(crypto.Keccak256([]byte{4, 4, 4, 4}))
+
+	storageRoot := state.StorageTrie(common.BytesToAddress([]byte{8})).Hash()
+	diskdb.Put(storageRoot.Bytes(), []byte{0xc0})
+
+	faults, _ = verify(common.Hash{})
+	if len(faults) != 2 {
+		t.Fatalf("fault count mismatch: have %d, want %d: %v", len(faults), 2, faults)
+	}
+	for _, fault := range faults {
+		switch fault.Owner {
+		case codeOwner:
+		case storageOwner:
+			var corrupt *trie.CorruptNodeError
+			if !errors.As(fault.Err, &corrupt) || corrupt.NodeHash != storageRoot {
+				t.Errorf("storage fault mismatch: %v", fault)
+			}
+		default:
+			t.Errorf("unexpected fault: %v", fault)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Witness is the part of a state accessed while executing on top of it. It holds
+// every trie node resolved and every contract code loaded, which is enough to
+// replay the same execution without access to the rest of the state.
+type Witness struct {
+	Root     common.Hash                                 // State root the witness was recorded against
+	Nodes    map[common.Hash][]byte                      // Trie nodes resolved from the database
+	Codes    map[common.Hash][]byte                      // Contract codes loaded
+	Accounts map[common.Address]map[common.Hash]struct{} // Accounts and storage slots accessed
+
+	owners map[common.Hash]common.Address // Hashed addresses of the accessed accounts
+	lock   sync.Mutex
+}
+
+// NewWitness creates an empty witness for the state with the given root.
+func NewWitness(root common.Hash) *Witness {
+	return &Witness{
+		Root:     root,
+		Nodes:    make(map[common.Hash][]byte),
+		Codes:    make(map[common.Hash][]byte),
+		Accounts: make(map[common.Address]map[common.Hash]struct{}),
+		owners:   make(map[common.Hash]common.Address),
+	}
+}
+
+// Size returns the total size of the trie nodes and codes in the witness.
+func (w *Witness) Size() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var size int
+	for _, blob := range w.Nodes {
+		size += len(blob)
+	}
+	for _, code := range w.Codes {
+		size += len(code)
+	}
+	return size
+}
+
+// SortedNodes returns the trie nodes in the witness, ordered by their hashes.
+func (w *Witness) SortedNodes() []hexutil.Bytes {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return sortedBlobs(w.Nodes)
+}
+
+// SortedCodes returns the contract codes in the witness, ordered by their hashes.
+func (w *Witness) SortedCodes() []hexutil.Bytes {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return sortedBlobs(w.Codes)
+}
+
+// sortedBlobs returns the blobs of a hash keyed set, ordered by their hashes to
+// keep anything derived from a witness reproducible.
+func sortedBlobs(blobs map[common.Hash][]byte) []hexutil.Bytes {
+	hashes := make([]common.Hash, 0, len(blobs))
+	for hash := range blobs {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	sorted := make([]hexutil.Bytes, len(hashes))
+	for i, hash := range hashes {
+		sorted[i] = blobs[hash]
+	}
+	return sorted
+}
+
+// Database returns a state database containing nothing but the content of the
+// witness. Accessing any state outside of it fails with a missing node error.
+func (w *Witness) Database() Database {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	db := memorydb.New()
+	for hash, blob := range w.Nodes {
+		db.Put(hash.Bytes(), blob)
+	}
+	for hash, code := range w.Codes {
+		db.Put(hash.Bytes(), code)
+	}
+	return NewDatabase(rawdb.NewDatabase(db))
+}
+
+func (w *Witness) addNode(hash common.Hash, blob []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.Nodes[hash] = common.CopyBytes(blob)
+}
+
+func (w *Witness) addCode(hash common.Hash, code []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.Codes[hash] = common.CopyBytes(code)
+}
+
+func (w *Witness) addAccount(addr common.Address) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.Accounts[addr]; !ok {
+		w.Accounts[addr] = make(map[common.Hash]struct{})
+		w.owners[crypto.Keccak256Hash(addr.Bytes())] = addr
+	}
+}
+
+func (w *Witness) addSlot(owner common.Hash, slot common.Hash) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Storage is only ever accessed after loading the owning account
+	if addr, ok := w.owners[owner]; ok {
+		w.Accounts[addr][slot] = struct{}{}
+	}
+}
+
+// NewWitnessDatabase wraps a state database, recording everything read through
+// it into a witness of the state with the given root. Trie nodes written by the
+// returned database are kept in memory and never reach the wrapped one.
+func NewWitnessDatabase(db Database, root common.Hash) (Database, *Witness) {
+	witness := NewWitness(root)
+	recorder := &witnessRecorder{
+		KeyValueStore: memorydb.New(),
+		source:        db.TrieDB(),
+		witness:       witness,
+	}
+	return &witnessDB{
+		cachingDB: NewDatabase(rawdb.NewDatabase(recorder)).(*cachingDB),
+		source:    db,
+		witness:   witness,
+	}, witness
+}
+
+// witnessRecorder is a key-value store serving trie nodes from a source trie
+// database, recording each of them into a witness.
+type witnessRecorder struct {
+	ethdb.KeyValueStore // Holds the nodes written through the recorder
+
+	source  *trie.Database
+	witness *Witness
+}
+
+// Has retrieves if a node is present locally or in the source database.
+func (r *witnessRecorder) Has(key []byte) (bool, error) {
+	if _, err := r.Get(key); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Get retrieves a node, recording it if it was loaded from the source database.
+func (r *witnessRecorder) Get(key []byte) ([]byte, error) {
+	if blob, err := r.KeyValueStore.Get(key); err == nil {
+		return blob, nil
+	}
+	if len(key) != common.HashLength {
+		return nil, fmt.Errorf("non-node key %x", key)
+	}
+	hash := common.BytesToHash(key)
+	blob, err := r.source.Node(hash)
+	if err != nil {
+		return nil, err
+	}
+	r.witness.addNode(hash, blob)
+	return blob, nil
+}
+
+// witnessDB is a state database recording all accessed state into a witness.
+type witnessDB struct {
+	*cachingDB
+
+	source  Database
+	witness *Witness
+}
+
+// OpenTrie opens the main account trie at a specific root hash.
+func (db *witnessDB) OpenTrie(root common.Hash) (Trie, error) {
+	tr, err := db.cachingDB.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	return &witnessTrie{Trie: tr, witness: db.witness}, nil
+}
+
+// OpenStorageTrie opens the storage trie of an account.
+func (db *witnessDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	tr, err := db.cachingDB.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return nil, err
+	}
+	return &witnessTrie{Trie: tr, owner: &addrHash, witness: db.witness}, nil
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *witnessDB) CopyTrie(t Trie) Trie {
+	switch t := t.(type) {
+	case *witnessTrie:
+		return &witnessTrie{Trie: db.cachingDB.CopyTrie(t.Trie), owner: t.owner, witness: t.witness}
+	default:
+		return db.cachingDB.CopyTrie(t)
+	}
+}
+
+// ContractCode retrieves a particular contract's code.
+func (db *witnessDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.source.ContractCode(addrHash, codeHash)
+	if err == nil {
+		db.witness.addCode(codeHash, code)
+	}
+	return code, err
+}
+
+// ContractCodeSize retrieves a particular contracts code's size. The whole code
+// is recorded, as it is needed to prove the size.
+func (db *witnessDB) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// witnessTrie is a trie recording the accessed keys into a witness.
+type witnessTrie struct {
+	Trie
+
+	owner   *common.Hash // Hashed address of the owning account, nil for the account trie
+	witness *Witness
+}
+
+func (t *witnessTrie) record(key []byte) {
+	if t.owner == nil {
+		t.witness.addAccount(common.BytesToAddress(key))
+	} else {
+		t.witness.addSlot(*t.owner, common.BytesToHash(key))
+	}
+}
+
+// TryGet returns the value for key stored in the trie.
+func (t *witnessTrie) TryGet(key []byte) ([]byte, error) {
+	t.record(key)
+	return t.Trie.TryGet(key)
+}
+
+// TryUpdate associates key with value in the trie.
+func (t *witnessTrie) TryUpdate(key, value []byte) error {
+	t.record(key)
+	return t.Trie.TryUpdate(key, value)
+}
+
+// TryDelete removes any existing value for key from the trie.
+func (t *witnessTrie) TryDelete(key []byte) error {
+	t.record(key)
+	return t.Trie.TryDelete(key)
+}
+
+// witnessTracker collects the state accesses which aren't retained by the live
+// state objects, so that a witness can be assembled after the fact.
+type witnessTracker struct {
+	root     common.Hash                 // State root at the start of tracking
+	absent   map[common.Address]struct{} // Accounts looked up but not found
+	replaced []*stateObject              // Objects overwritten by re-creating their account
+}
+
+// StartWitness starts tracking the state accessed, to be assembled into a witness
+// by Witness. Any previous tracking is discarded. Tracking must be started on a
+// state which wasn't accessed yet.
+func (s *StateDB) StartWitness() {
+	s.witness = &witnessTracker{
+		root:   s.trie.Hash(),
+		absent: make(map[common.Address]struct{}),
+	}
+}
+
+// Witness assembles the witness of the state accessed since StartWitness was
+// called, without re-executing anything: the accounts and storage slots cached
+// by the state are looked up again in the original tries and their writes are
+// replayed on top, so the nodes needed to hash the modified state are included
+// too. The codes of all accessed contracts are included, as their size might
+// have been queried without loading them. Nil is returned if no tracking was
+// started.
+func (s *StateDB) Witness() (*Witness, error) {
+	if s.witness == nil {
+		return nil, nil
+	}
+	db, witness := NewWitnessDatabase(s.db, s.witness.root)
+	tr, err := db.OpenTrie(s.witness.root)
+	if err != nil {
+		return nil, err
+	}
+	for addr := range s.witness.absent {
+		if _, err := tr.TryGet(addr[:]); err != nil {
+			return nil, err
+		}
+	}
+	// Overwritten objects only accessed the original storage, the live ones
+	// replacing them start out empty and need no storage of the original state
+	for _, obj := range s.witness.replaced {
+		if err := s.witnessObject(db, tr, obj, false); err != nil {
+			return nil, err
+		}
+	}
+	for addr, obj := range s.stateObjects {
+		recreated := false
+		for _, prev := range s.witness.replaced {
+			if prev.address == addr {
+				recreated = true
+				break
+			}
+		}
+		if err := s.witnessObject(db, tr, obj, !recreated); err != nil {
+			return nil, err
+		}
+	}
+	// Replay the account writes and hash the trie to resolve the nodes needed
+	// to collapse it after deletions
+	for addr, obj := range s.stateObjects {
+		if obj.deleted {
+			err = tr.TryDelete(addr[:])
+		} else {
+			var enc []byte
+			if enc, err = rlp.EncodeToBytes(obj); err == nil {
+				err = tr.TryUpdate(addr[:], enc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	tr.Hash()
+	return witness, nil
+}
+
+// witnessObject looks up an account in the original account trie, along with its
+// code and the storage slots cached by the state object. If the object still
+// holds the original storage, its writes are replayed on the storage trie too.
+func (s *StateDB) witnessObject(db Database, tr Trie, obj *stateObject, original bool) error {
+	enc, err := tr.TryGet(obj.address[:])
+	if err != nil || len(enc) == 0 {
+		return err
+	}
+	var data Account
+	if err := rlp.DecodeBytes(enc, &data); err != nil {
+		return err
+	}
+	if !bytes.Equal(data.CodeHash, emptyCodeHash) {
+		if _, err := db.ContractCode(obj.addrHash, common.BytesToHash(data.CodeHash)); err != nil {
+			return err
+		}
+	}
+	if data.Root == emptyRoot {
+		return nil
+	}
+	st, err := db.OpenStorageTrie(obj.addrHash, data.Root)
+	if err != nil {
+		return err
+	}
+	keys := make(map[common.Hash]struct{})
+	for _, storage := range []Storage{obj.originStorage, obj.pendingStorage, obj.dirtyStorage} {
+		for key := range storage {
+			keys[key] = struct{}{}
+		}
+	}
+	for key := range keys {
+		if _, err := st.TryGet(key[:]); err != nil {
+			return err
+		}
+	}
+	if !original || obj.deleted {
+		return nil
+	}
+	for key := range keys {
+		if value := obj.GetState(s.db, key); value == (common.Hash{}) {
+			err = st.TryDelete(key[:])
+		} else {
+			v, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+			err = st.TryUpdate(key[:], v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	st.Hash()
+	return nil
+}
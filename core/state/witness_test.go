@@ -0,0 +1,113 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the witness assembled from the accesses of a state is enough to
+// repeat them statelessly, including hashing the tries after deletions.
+func TestStateWitness(t *testing.T) {
+	var (
+		db       = NewDatabase(rawdb.NewMemoryDatabase())
+		storer   = common.Address{0x01}
+		contract = common.Address{0x02}
+		recreate = common.Address{0x03}
+		value    = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	)
+	// Two large slots hang off the storage root, so that deleting one of them
+	// collapses the trie into the other
+	statedb, _ := New(common.Hash{}, db)
+	statedb.SetState(storer, common.Hash{0x01}, value)
+	statedb.SetState(storer, common.Hash{0x02}, value)
+	statedb.SetBalance(storer, big.NewInt(1))
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+	statedb.SetState(recreate, common.Hash{0x11}, value)
+	statedb.SetState(recreate, common.Hash{0x12}, value)
+	statedb.SetBalance(recreate, big.NewInt(1))
+
+	// Pick a missing account sharing its path with untouched ones only, so that
+	// proving its absence needs nodes nothing else accesses
+	accessed := make(map[byte]bool)
+	for _, addr := range []common.Address{storer, contract, recreate} {
+		accessed[crypto.Keccak256(addr[:])[0]>>4] = true
+	}
+	untouched := make(map[byte]bool)
+	for i := 0; i < 16; i++ {
+		addr := common.Address{0x10, byte(i)}
+		statedb.SetBalance(addr, big.NewInt(1))
+		untouched[crypto.Keccak256(addr[:])[0]>>4] = true
+	}
+	var missing common.Address
+	for i := 0; ; i++ {
+		missing = common.Address{0x20, byte(i)}
+		if nibble := crypto.Keccak256(missing[:])[0] >> 4; untouched[nibble] && !accessed[nibble] {
+			break
+		}
+	}
+	root, _ := statedb.Commit(false)
+	db.TrieDB().Commit(root, false)
+
+	type result struct {
+		root common.Hash
+		size int
+		slot common.Hash
+	}
+	access := func(statedb *StateDB) (res result) {
+		statedb.SetState(storer, common.Hash{0x01}, common.Hash{})
+		res.size = statedb.GetCodeSize(contract)
+		statedb.GetBalance(missing)
+		res.slot = statedb.GetState(recreate, common.Hash{0x11})
+		statedb.CreateAccount(recreate)
+		statedb.SetState(recreate, common.Hash{0x13}, value)
+		res.root = statedb.IntermediateRoot(true)
+		return res
+	}
+	statedb, _ = New(root, db)
+	statedb.StartWitness()
+	post := access(statedb)
+
+	witness, err := statedb.Witness()
+	if err != nil {
+		t.Fatalf("failed to assemble witness: %v", err)
+	}
+	if witness.Root != root {
+		t.Fatalf("witness root mismatch: have %x, want %x", witness.Root, root)
+	}
+	stateless, err := New(root, witness.Database())
+	if err != nil {
+		t.Fatalf("failed to open witness state: %v", err)
+	}
+	if have := access(stateless); have != post {
+		t.Fatalf("stateless access mismatch: have %+v, want %+v", have, post)
+	}
+	if err := stateless.Error(); err != nil {
+		t.Fatalf("stateless access failed: %v", err)
+	}
+	// Without tracking no witness is assembled
+	statedb, _ = New(root, db)
+	access(statedb)
+	if witness, err := statedb.Witness(); witness != nil || err != nil {
+		t.Fatalf("witness assembled without tracking: %v, %v", witness, err)
+	}
+}
@@ -0,0 +1,452 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	parallelAppliedMeter  = metrics.NewRegisteredMeter("chain/parallel/applied", nil)
+	parallelConflictMeter = metrics.NewRegisteredMeter("chain/parallel/conflicts", nil)
+)
+
+// accessRecorder is a vm.StateDB recording the parts of the state a transaction
+// accesses and modifies, allowing to detect conflicts between transactions that
+// were executed independently of each other.
+type accessRecorder struct {
+	*state.StateDB
+
+	coinbase common.Address // Block beneficiary, whose fee credits are tracked separately
+	credit   *big.Int       // Total amount credited to the coinbase
+	credited bool           // Whether the coinbase was credited at all, possibly touching it
+
+	reads   map[common.Address]struct{}                 // Accounts whose balance, nonce, code or existence was accessed
+	fields  map[common.Address]struct{}                 // Accounts whose balance, nonce, code or existence was modified
+	wiped   map[common.Address]struct{}                 // Accounts created or destroyed, wiping their storage
+	slots   map[common.Address]map[common.Hash]struct{} // Storage slots read or written
+	written map[common.Address]map[common.Hash]struct{} // Storage slots written
+	touched map[common.Address]bool                     // Accounts touched by zero transfers and whether they existed before
+
+	unsafe bool // Whether the transaction did something the recorder can't replay (e.g. reverts)
+}
+
+func newAccessRecorder(statedb *state.StateDB, coinbase common.Address) *accessRecorder {
+	return &accessRecorder{
+		StateDB:  statedb,
+		coinbase: coinbase,
+		credit:   new(big.Int),
+		reads:    make(map[common.Address]struct{}),
+		fields:   make(map[common.Address]struct{}),
+		wiped:    make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+		written:  make(map[common.Address]map[common.Hash]struct{}),
+		touched:  make(map[common.Address]bool),
+	}
+}
+
+func (r *accessRecorder) read(addr common.Address) {
+	r.reads[addr] = struct{}{}
+}
+
+func (r *accessRecorder) write(addr common.Address) {
+	r.reads[addr] = struct{}{}
+	r.fields[addr] = struct{}{}
+}
+
+func (r *accessRecorder) access(addr common.Address, slot common.Hash, write bool) {
+	if r.slots[addr] == nil {
+		r.slots[addr] = make(map[common.Hash]struct{})
+	}
+	r.slots[addr][slot] = struct{}{}
+
+	if write {
+		if r.written[addr] == nil {
+			r.written[addr] = make(map[common.Hash]struct{})
+		}
+		r.written[addr][slot] = struct{}{}
+	}
+}
+
+func (r *accessRecorder) CreateAccount(addr common.Address) {
+	r.write(addr)
+	r.wiped[addr] = struct{}{}
+	r.StateDB.CreateAccount(addr)
+}
+
+func (r *accessRecorder) SubBalance(addr common.Address, amount *big.Int) {
+	r.write(addr)
+	r.StateDB.SubBalance(addr, amount)
+}
+
+func (r *accessRecorder) AddBalance(addr common.Address, amount *big.Int) {
+	switch {
+	case addr == r.coinbase:
+		// Credits to the coinbase commute, track them instead of the balance
+		r.credit.Add(r.credit, amount)
+		r.credited = true
+	case amount.Sign() == 0:
+		// Zero transfers only touch the account, which may create or delete it
+		if _, ok := r.touched[addr]; !ok {
+			r.touched[addr] = r.StateDB.Exist(addr)
+		}
+		r.read(addr)
+	default:
+		r.write(addr)
+	}
+	r.StateDB.AddBalance(addr, amount)
+}
+
+func (r *accessRecorder) GetBalance(addr common.Address) *big.Int {
+	r.read(addr)
+	return r.StateDB.GetBalance(addr)
+}
+
+func (r *accessRecorder) GetNonce(addr common.Address) uint64 {
+	r.read(addr)
+	return r.StateDB.GetNonce(addr)
+}
+
+func (r *accessRecorder) SetNonce(addr common.Address, nonce uint64) {
+	r.write(addr)
+	r.StateDB.SetNonce(addr, nonce)
+}
+
+func (r *accessRecorder) GetCodeHash(addr common.Address) common.Hash {
+	r.read(addr)
+	return r.StateDB.GetCodeHash(addr)
+}
+
+func (r *accessRecorder) GetCode(addr common.Address) []byte {
+	r.read(addr)
+	return r.StateDB.GetCode(addr)
+}
+
+func (r *accessRecorder) SetCode(addr common.Address, code []byte) {
+	r.write(addr)
+	r.StateDB.SetCode(addr, code)
+}
+
+func (r *accessRecorder) GetCodeSize(addr common.Address) int {
+	r.read(addr)
+	return r.StateDB.GetCodeSize(addr)
+}
+
+func (r *accessRecorder) GetCommittedState(addr common.Address, slot common.Hash) common.Hash {
+	r.access(addr, slot, false)
+	return r.StateDB.GetCommittedState(addr, slot)
+}
+
+func (r *accessRecorder) GetState(addr common.Address, slot common.Hash) common.Hash {
+	r.access(addr, slot, false)
+	return r.StateDB.GetState(addr, slot)
+}
+
+func (r *accessRecorder) SetState(addr common.Address, slot common.Hash, value common.Hash) {
+	r.access(addr, slot, true)
+	r.StateDB.SetState(addr, slot, value)
+}
+
+func (r *accessRecorder) Suicide(addr common.Address) bool {
+	r.write(addr)
+	r.wiped[addr] = struct{}{}
+	return r.StateDB.Suicide(addr)
+}
+
+func (r *accessRecorder) HasSuicided(addr common.Address) bool {
+	r.read(addr)
+	return r.StateDB.HasSuicided(addr)
+}
+
+func (r *accessRecorder) Exist(addr common.Address) bool {
+	r.read(addr)
+	return r.StateDB.Exist(addr)
+}
+
+func (r *accessRecorder) Empty(addr common.Address) bool {
+	r.read(addr)
+	return r.StateDB.Empty(addr)
+}
+
+func (r *accessRecorder) RevertToSnapshot(revid int) {
+	// Reverted changes would be recorded as writes, don't bother tracking them
+	r.unsafe = true
+	r.StateDB.RevertToSnapshot(revid)
+}
+
+func (r *accessRecorder) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
+	r.unsafe = true
+	return r.StateDB.ForEachStorage(addr, cb)
+}
+
+// finalise records the accounts created or deleted by being touched, once the
+// state was finalised. If the coinbase was accessed beyond being credited, its
+// modifications are tracked like for any other account.
+func (r *accessRecorder) finalise() {
+	if _, ok := r.reads[r.coinbase]; ok {
+		r.fields[r.coinbase] = struct{}{}
+	}
+	for addr, existed := range r.touched {
+		if r.StateDB.Exist(addr) != existed {
+			r.write(addr)
+		}
+	}
+}
+
+// blockWrites is the set of state modifications made by the transactions of a
+// block that were already applied.
+type blockWrites struct {
+	fields   map[common.Address]struct{}
+	wiped    map[common.Address]struct{}
+	slots    map[common.Address]map[common.Hash]struct{}
+	credited bool // Whether the coinbase was credited
+}
+
+// conflicts reports whether a transaction accessed state modified by the ones
+// applied before it.
+func (w *blockWrites) conflicts(r *accessRecorder) bool {
+	for addr := range r.reads {
+		if _, ok := w.fields[addr]; ok {
+			return true
+		}
+		if addr == r.coinbase && w.credited {
+			return true
+		}
+	}
+	for addr, slots := range r.slots {
+		if _, ok := w.wiped[addr]; ok {
+			return true
+		}
+		for slot := range slots {
+			if _, ok := w.slots[addr][slot]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add records the modifications made by a transaction.
+func (w *blockWrites) add(r *accessRecorder) {
+	for addr := range r.fields {
+		w.fields[addr] = struct{}{}
+	}
+	for addr := range r.wiped {
+		w.wiped[addr] = struct{}{}
+	}
+	for addr, slots := range r.written {
+		if w.slots[addr] == nil {
+			w.slots[addr] = make(map[common.Hash]struct{})
+		}
+		for slot := range slots {
+			w.slots[addr][slot] = struct{}{}
+		}
+	}
+	if r.credited {
+		w.credited = true
+	}
+}
+
+// speculation is the result of executing a transaction on top of the state of
+// the parent block, independently of the other transactions in the block.
+type speculation struct {
+	statedb  *state.StateDB
+	recorder *accessRecorder
+	msg      Message
+	gas      uint64
+	failed   bool
+	err      error
+}
+
+// processParallel executes the transactions of a block optimistically in parallel,
+// each on top of the parent state. The results are then applied in order, any
+// transaction accessing state modified by an earlier one being re-executed on the
+// real state. The outcome is identical to processing the block serially.
+func (p *StateProcessor) processParallel(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+
+		txs     = block.Transactions()
+		signer  = types.MakeSigner(p.config, header.Number)
+		eip161d = p.config.IsEnabled(p.config.GetEIP161dTransition, header.Number)
+	)
+	if p.config.IsEnabled(p.config.GetEthashEIP779Transition, block.Number()) {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	// Speculatively execute all the transactions on copies of the parent state. The
+	// copies are made upfront, as the state is modified while applying the results.
+	var (
+		results = make([]*speculation, len(txs))
+		done    = make([]chan struct{}, len(txs))
+		jobs    = make(chan int, len(txs))
+		abort   = make(chan struct{})
+	)
+	for i, tx := range txs {
+		results[i] = &speculation{statedb: statedb.Copy()}
+		results[i].statedb.Prepare(tx.Hash(), block.Hash(), i)
+		done[i] = make(chan struct{})
+		jobs <- i
+	}
+	close(jobs)
+	defer close(abort)
+
+	threads := runtime.NumCPU()
+	if threads > len(txs) {
+		threads = len(txs)
+	}
+	for th := 0; th < threads; th++ {
+		go func() {
+			for i := range jobs {
+				select {
+				case <-abort:
+					return
+				default:
+				}
+				p.speculate(results[i], header, txs[i], signer, eip161d, cfg)
+				close(done[i])
+			}
+		}()
+	}
+	// Apply the results in order, re-executing the conflicting transactions
+	writes := &blockWrites{
+		fields: make(map[common.Address]struct{}),
+		wiped:  make(map[common.Address]struct{}),
+		slots:  make(map[common.Address]map[common.Hash]struct{}),
+	}
+	for i, tx := range txs {
+		<-done[i]
+		res := results[i]
+
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if res.err != nil || res.recorder.unsafe || writes.conflicts(res.recorder) || gp.Gas() < res.msg.Gas() {
+			parallelConflictMeter.Mark(1)
+
+			// Speculation can't be used, execute the transaction on the real state
+			msg, err := tx.AsMessage(signer)
+			if err != nil {
+				return receipts, allLogs, *usedGas, err
+			}
+			recorder := newAccessRecorder(statedb, header.Coinbase)
+			vmenv := vm.NewEVM(NewEVMContext(msg, header, p.bc, nil), recorder, p.config, cfg)
+			_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+			if err != nil {
+				return receipts, allLogs, *usedGas, err
+			}
+			receipt := finaliseTransaction(p.config, statedb, header, tx, msg, gas, failed, usedGas)
+			recorder.finalise()
+			writes.add(recorder)
+
+			receipts = append(receipts, receipt)
+			allLogs = append(allLogs, receipt.Logs...)
+			continue
+		}
+		parallelAppliedMeter.Mark(1)
+
+		if err := gp.SubGas(res.gas); err != nil {
+			return receipts, allLogs, *usedGas, err
+		}
+		applySpeculation(statedb, tx, res, cfg)
+		receipt := finaliseTransaction(p.config, statedb, header, tx, res.msg, res.gas, res.failed, usedGas)
+		writes.add(res.recorder)
+
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	p.engine.Finalize(p.bc, header, statedb, txs, block.Uncles())
+
+	return receipts, allLogs, *usedGas, nil
+}
+
+// speculate executes a transaction on its own copy of the parent state, recording
+// the state it accesses.
+func (p *StateProcessor) speculate(res *speculation, header *types.Header, tx *types.Transaction, signer types.Signer, eip161d bool, cfg vm.Config) {
+	res.recorder = newAccessRecorder(res.statedb, header.Coinbase)
+
+	res.msg, res.err = tx.AsMessage(signer)
+	if res.err != nil {
+		return
+	}
+	vmenv := vm.NewEVM(NewEVMContext(res.msg, header, p.bc, nil), res.recorder, p.config, cfg)
+	if _, res.gas, res.failed, res.err = ApplyMessage(vmenv, res.msg, new(GasPool).AddGas(res.msg.Gas())); res.err != nil {
+		return
+	}
+	res.statedb.Finalise(eip161d)
+	res.recorder.finalise()
+}
+
+// applySpeculation transfers the modifications made by a speculatively executed
+// transaction onto the real state.
+func applySpeculation(statedb *state.StateDB, tx *types.Transaction, res *speculation, cfg vm.Config) {
+	var (
+		spec     = res.statedb
+		recorder = res.recorder
+	)
+	for addr := range recorder.fields {
+		if !spec.Exist(addr) {
+			if statedb.Exist(addr) {
+				statedb.Suicide(addr)
+			}
+			continue
+		}
+		if _, ok := recorder.wiped[addr]; ok || !statedb.Exist(addr) {
+			statedb.CreateAccount(addr)
+		}
+		if balance := spec.GetBalance(addr); balance.Cmp(statedb.GetBalance(addr)) != 0 {
+			statedb.SetBalance(addr, balance)
+		}
+		if nonce := spec.GetNonce(addr); nonce != statedb.GetNonce(addr) {
+			statedb.SetNonce(addr, nonce)
+		}
+		if hash := spec.GetCodeHash(addr); hash != statedb.GetCodeHash(addr) {
+			statedb.SetCode(addr, spec.GetCode(addr))
+		}
+	}
+	for addr, slots := range recorder.written {
+		if !spec.Exist(addr) {
+			continue
+		}
+		for slot := range slots {
+			statedb.SetState(addr, slot, spec.GetState(addr, slot))
+		}
+	}
+	// The coinbase balance is only modified by the credits, unless accessed otherwise
+	if _, ok := recorder.fields[recorder.coinbase]; !ok && recorder.credited {
+		statedb.AddBalance(recorder.coinbase, recorder.credit)
+	}
+	for _, log := range spec.GetLogs(tx.Hash()) {
+		cpy := *log
+		statedb.AddLog(&cpy)
+	}
+	if cfg.EnablePreimageRecording {
+		for hash, preimage := range spec.Preimages() {
+			statedb.AddPreimage(hash, preimage)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/types/goethereum"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that executing blocks in parallel yields the same results as executing
+// them serially, both for independent and for conflicting transactions.
+func TestParallelExecution(t *testing.T) {
+	t.Run("Istanbul", func(t *testing.T) { testParallelExecution(t, params.TestChainConfig) })
+	t.Run("Homestead", func(t *testing.T) {
+		testParallelExecution(t, &goethereum.ChainConfig{
+			ChainID:        big.NewInt(1),
+			HomesteadBlock: big.NewInt(0),
+			Ethash:         new(ctypes.EthashConfig),
+		})
+	})
+}
+
+func testParallelExecution(t *testing.T, config ctypes.ChainConfigurator) {
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 8)
+		addrs = make([]common.Address, len(keys))
+		alloc = make(genesisT.GenesisAlloc)
+
+		coinbase = common.HexToAddress("0xc0ffee")
+		counter  = common.HexToAddress("0xc1")              // Increments slot 0
+		suicider = common.HexToAddress("0xc2")              // Self destructs to the caller
+		reverter = common.HexToAddress("0xc3")              // Always reverts
+		observer = common.HexToAddress("0xc4")              // Stores the coinbase balance in slot 0
+		deployer = common.FromHex("0x600160005560016000f3") // Sets slot 0 and deploys a single zero byte
+		signer   = types.MakeSigner(config, new(big.Int))
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+		alloc[addrs[i]] = genesisT.GenesisAccount{Balance: big.NewInt(vars.Ether)}
+	}
+	alloc[counter] = genesisT.GenesisAccount{Balance: new(big.Int), Code: common.FromHex("0x60005460010160005500")}
+	alloc[suicider] = genesisT.GenesisAccount{Balance: big.NewInt(1000), Code: common.FromHex("0x33ff")}
+	alloc[reverter] = genesisT.GenesisAccount{Balance: new(big.Int), Code: common.FromHex("0x60006000fd")}
+	alloc[observer] = genesisT.GenesisAccount{Balance: new(big.Int), Code: common.FromHex("0x413160005500")}
+
+	var (
+		gspec   = &genesisT.Genesis{Config: config, Alloc: alloc}
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := GenerateChain(config, genesis, engine, gendb, 8, func(i int, block *BlockGen) {
+		block.SetCoinbase(coinbase)
+
+		add := func(key *ecdsa.PrivateKey, to *common.Address, value int64, gas uint64, data []byte) {
+			from := crypto.PubkeyToAddress(key.PublicKey)
+
+			var tx *types.Transaction
+			if to == nil {
+				tx = types.NewContractCreation(block.TxNonce(from), big.NewInt(value), gas, big.NewInt(1), data)
+			} else {
+				tx = types.NewTransaction(block.TxNonce(from), *to, big.NewInt(value), gas, big.NewInt(1), data)
+			}
+			tx, err := types.SignTx(tx, signer, key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+		for j, key := range keys {
+			switch (i + j) % 7 {
+			case 0: // Independent transfer to a fresh account
+				to := common.Address{byte(i), byte(j), 0x01}
+				add(key, &to, 1000, vars.TxGas, nil)
+			case 1: // Conflicting storage access
+				add(key, &counter, 0, 100000, nil)
+			case 2: // Account destruction, later calls hitting a missing account
+				add(key, &suicider, 0, 100000, nil)
+			case 3: // Reverted execution
+				add(key, &reverter, 0, 100000, nil)
+			case 4: // Coinbase access
+				add(key, &observer, 0, 100000, nil)
+			case 5: // Contract creation
+				add(key, nil, 0, 100000, deployer)
+			case 6: // Zero value transfer touching an empty account
+				to := common.Address{0xee}
+				add(key, &to, 0, vars.TxGas, nil)
+			}
+		}
+		// Multiple transactions from the same sender and transfers between senders
+		add(keys[0], &addrs[1], 1000, vars.TxGas, nil)
+		add(keys[1], &addrs[2], 1000, vars.TxGas, nil)
+		add(keys[0], &coinbase, 1000, vars.TxGas, nil)
+	})
+	db := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(db, gspec)
+
+	chain, err := NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true, ParallelExec: true}, config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Block validation ensures the state root, receipts and gas usage all match
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	for _, block := range blocks {
+		receipts := chain.GetReceiptsByHash(block.Hash())
+		if len(receipts) != len(block.Transactions()) {
+			t.Fatalf("block %d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+		}
+		for i, receipt := range receipts {
+			if receipt.TxHash != block.Transactions()[i].Hash() {
+				t.Fatalf("block %d, receipt %d: transaction hash mismatch", block.NumberU64(), i)
+			}
+		}
+	}
+}
+
+// Tests that transactions accessing state modified by earlier ones in the same
+// block are detected as conflicting, while credits to the coinbase are not.
+func TestAccessConflicts(t *testing.T) {
+	var (
+		coinbase = common.Address{0xc0}
+		addr     = common.Address{0x01}
+		slot     = common.Hash{0x02}
+	)
+	writes := &blockWrites{
+		fields: make(map[common.Address]struct{}),
+		wiped:  make(map[common.Address]struct{}),
+		slots:  make(map[common.Address]map[common.Hash]struct{}),
+	}
+	first := newAccessRecorder(nil, coinbase)
+	first.write(addr)
+	first.access(addr, slot, true)
+	first.credit, first.credited = big.NewInt(1), true
+	writes.add(first)
+
+	tests := []struct {
+		name     string
+		record   func(r *accessRecorder)
+		conflict bool
+	}{
+		{"credit only", func(r *accessRecorder) { r.credited = true }, false},
+		{"coinbase read", func(r *accessRecorder) { r.read(coinbase) }, true},
+		{"account read", func(r *accessRecorder) { r.read(addr) }, true},
+		{"other account", func(r *accessRecorder) { r.write(common.Address{0x03}) }, false},
+		{"slot read", func(r *accessRecorder) { r.access(addr, slot, false) }, true},
+		{"other slot", func(r *accessRecorder) { r.access(addr, common.Hash{0x03}, true) }, false},
+	}
+	for _, tt := range tests {
+		r := newAccessRecorder(nil, coinbase)
+		tt.record(r)
+		if conflict := writes.conflicts(r); conflict != tt.conflict {
+			t.Errorf("%s: conflict mismatch: have %v, want %v", tt.name, conflict, tt.conflict)
+		}
+	}
+}
@@ -52,8 +52,41 @@ func NewStateProcessor(config ctypes.ChainConfigurator, bc *BlockChain, engine c
 //
 // Process returns the receipts and logs accumulated during the process and
 // returns the amount of gas that was used in the process. If any of the
-// transactions failed to execute due to insufficient gas it will return an error.
+// transactions failed to execute due to insufficient gas it will return an error,
+// along with the receipts of the transactions executed before the failing one.
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	// Execute the transactions in parallel if enabled, unless they're being traced
+	if p.bc.cacheConfig.ParallelExec && !cfg.Debug && len(block.Transactions()) > 1 {
+		return p.processParallel(block, statedb, cfg)
+	}
+	return p.process(p.bc, block, statedb, cfg)
+}
+
+// StateDiff processes the block on top of the given state of its parent like
+// Process does, returning every change the block made to the state along with
+// the values they replaced. The diff is collected from the dirty sets of the
+// state as it is finalised, without tracing the transactions.
+func (p *StateProcessor) StateDiff(block *types.Block, statedb *state.StateDB, cfg vm.Config) (state.StateDiff, error) {
+	statedb.StartStateDiff()
+	if _, _, _, err := p.Process(block, statedb, cfg); err != nil {
+		return nil, err
+	}
+	statedb.Finalise(p.config.IsEnabled(p.config.GetEIP161dTransition, block.Number()))
+	return statedb.StateDiff()
+}
+
+// processChain is the chain access needed for processing a block, covering both
+// the header lookups of the EVM and the needs of the consensus engine.
+type processChain interface {
+	consensus.ChainReader
+
+	// Engine retrieves the chain's consensus engine.
+	Engine() consensus.Engine
+}
+
+// process runs the transactions of a block and finalizes it, accessing the chain
+// through the given reader instead of the canonical chain.
+func (p *StateProcessor) process(chain processChain, block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
 	var (
 		receipts types.Receipts
 		usedGas  = new(uint64)
@@ -68,15 +101,15 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
-		receipt, err := ApplyTransaction(p.config, p.bc, nil, gp, statedb, header, tx, usedGas, cfg)
+		receipt, err := ApplyTransaction(p.config, chain, nil, gp, statedb, header, tx, usedGas, cfg)
 		if err != nil {
-			return nil, nil, 0, err
+			return receipts, allLogs, *usedGas, err
 		}
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, receipt.Logs...)
 	}
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
+	p.engine.Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
 
 	return receipts, allLogs, *usedGas, nil
 }
@@ -100,6 +133,12 @@ func ApplyTransaction(config ctypes.ChainConfigurator, bc ChainContext, author *
 	if err != nil {
 		return nil, err
 	}
+	return finaliseTransaction(config, statedb, header, tx, msg, gas, failed, usedGas), nil
+}
+
+// finaliseTransaction updates the state with the pending changes of an executed
+// transaction and creates its receipt.
+func finaliseTransaction(config ctypes.ChainConfigurator, statedb *state.StateDB, header *types.Header, tx *types.Transaction, msg Message, gas uint64, failed bool, usedGas *uint64) *types.Receipt {
 	// Update the state with pending changes
 	var root []byte
 	eip161d := config.IsEnabled(config.GetEIP161dTransition, header.Number)
@@ -117,7 +156,7 @@ func ApplyTransaction(config ctypes.ChainConfigurator, bc ChainContext, author *
 	receipt.GasUsed = gas
 	// if the transaction created a contract, store the creation address in the receipt.
 	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
 	}
 	// Set the receipt logs and create a bloom for filtering
 	receipt.Logs = statedb.GetLogs(tx.Hash())
@@ -126,5 +165,5 @@ func ApplyTransaction(config ctypes.ChainConfigurator, bc ChainContext, author *
 	receipt.BlockNumber = header.Number
 	receipt.TransactionIndex = uint(statedb.TxIndex())
 
-	return receipt, err
+	return receipt
 }
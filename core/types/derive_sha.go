@@ -29,13 +29,29 @@ type DerivableList interface {
 	GetRlp(i int) []byte
 }
 
+// DeriveSha computes the root hash of the trie holding the items of the list keyed
+// by their RLP encoded indices. The trie is built in a streaming fashion, so only
+// the path to the last inserted item is kept in memory.
 func DeriveSha(list DerivableList) common.Hash {
-	keybuf := new(bytes.Buffer)
-	trie := new(trie.Trie)
-	for i := 0; i < list.Len(); i++ {
+	var (
+		keybuf = new(bytes.Buffer)
+		trie   = trie.NewStackTrie(nil)
+	)
+	// The stack trie needs the keys in order. As the RLP encoding of 0 sorts after
+	// all single byte integers (1..127), the first item is inserted after them.
+	insert := func(i int) {
 		keybuf.Reset()
 		rlp.Encode(keybuf, uint(i))
 		trie.Update(keybuf.Bytes(), list.GetRlp(i))
 	}
+	for i := 1; i < list.Len() && i <= 0x7f; i++ {
+		insert(i)
+	}
+	if list.Len() > 0 {
+		insert(0)
+	}
+	for i := 0x80; i < list.Len(); i++ {
+		insert(i)
+	}
 	return trie.Hash()
 }
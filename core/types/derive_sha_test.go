@@ -0,0 +1,50 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that the streaming DeriveSha matches the root of a regular trie for lists
+// around the single byte index boundaries.
+func TestDeriveSha(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 127, 128, 129, 256, 1000} {
+		txs := make(Transactions, n)
+		for i := range txs {
+			txs[i] = NewTransaction(uint64(i), common.Address{byte(i)}, big.NewInt(int64(i)), 21000, big.NewInt(1), nil)
+		}
+		var (
+			keybuf = new(bytes.Buffer)
+			tr     = new(trie.Trie)
+		)
+		for i := 0; i < txs.Len(); i++ {
+			keybuf.Reset()
+			rlp.Encode(keybuf, uint(i))
+			tr.Update(keybuf.Bytes(), txs.GetRlp(i))
+		}
+		if have, want := DeriveSha(txs), tr.Hash(); have != want {
+			t.Errorf("%d items: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
@@ -18,29 +18,343 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/vars"
 )
 
+// EIP is a change to the instruction set of the EVM on top of Frontier, either
+// adding opcodes or changing the gas cost of existing ones.
+type EIP struct {
+	Name     string   // Identifier of the proposal, e.g. "EIP-1884"
+	Title    string   // Short description of the change
+	Requires []string // Proposals defining the opcodes this one modifies, applied before it
+
+	// Transition returns the block the change activates at in a chain
+	// configuration, and Disable the block it deactivates at, if it can be.
+	Transition func(ctypes.ChainConfigurator) *uint64
+	Disable    func(ctypes.ChainConfigurator) *uint64
+
+	operations map[OpCode]operation // Opcodes added by the proposal
+	gasChanges []GasChange          // Gas cost changes of existing opcodes
+}
+
+// GasChange is a change to the gas cost of an existing opcode.
+type GasChange struct {
+	Op          OpCode
+	ConstantGas *uint64 // New constant gas of the opcode, nil if unchanged
+
+	dynamicGas gasFunc // New dynamic gas function of the opcode, nil if unchanged
+}
+
+// DynamicGas returns whether the change replaces the dynamic gas function of the
+// opcode.
+func (c GasChange) DynamicGas() bool {
+	return c.dynamicGas != nil
+}
+
+// Opcodes returns the opcodes added by the proposal, in ascending order.
+func (e *EIP) Opcodes() []OpCode {
+	ops := make([]OpCode, 0, len(e.operations))
+	for op := range e.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	return ops
+}
+
+// GasChanges returns the gas cost changes of existing opcodes.
+func (e *EIP) GasChanges() []GasChange {
+	return append([]GasChange(nil), e.gasChanges...)
+}
+
+// Enabled returns whether the proposal is active at the given block of a chain.
+func (e *EIP) Enabled(config ctypes.ChainConfigurator, bn *big.Int) bool {
+	if e.Transition == nil || !config.IsEnabled(func() *uint64 { return e.Transition(config) }, bn) {
+		return false
+	}
+	return e.Disable == nil || !config.IsEnabled(func() *uint64 { return e.Disable(config) }, bn)
+}
+
+// apply makes the changes of the proposal to the given jump table. Gas changes
+// of opcodes not defined in the table are skipped.
+func (e *EIP) apply(jt *JumpTable) {
+	for op, operation := range e.operations {
+		jt[op] = operation
+	}
+	for _, change := range e.gasChanges {
+		if !jt[change.Op].valid {
+			continue
+		}
+		if change.ConstantGas != nil {
+			jt[change.Op].constantGas = *change.ConstantGas
+		}
+		if change.dynamicGas != nil {
+			jt[change.Op].dynamicGas = change.dynamicGas
+		}
+	}
+}
+
+var (
+	eips       []*EIP          // Registered proposals, in the order they're applied
+	eipsByName map[string]*EIP // Registered proposals by name
+)
+
+// registerEIP adds a proposal to the registry. Proposals are applied in the
+// order they're registered, so the ones they require must be registered first.
+func registerEIP(eip *EIP) {
+	if eipsByName == nil {
+		eipsByName = make(map[string]*EIP)
+	}
+	if _, ok := eipsByName[eip.Name]; ok {
+		panic(fmt.Sprintf("duplicate registration of %s", eip.Name))
+	}
+	for _, name := range eip.Requires {
+		if _, ok := eipsByName[name]; !ok {
+			panic(fmt.Sprintf("%s registered before %s it requires", eip.Name, name))
+		}
+	}
+	eips = append(eips, eip)
+	eipsByName[eip.Name] = eip
+}
+
+// EIPs returns all the proposals the interpreter knows about, in the order they
+// are applied to the instruction set.
+func EIPs() []*EIP {
+	return append([]*EIP(nil), eips...)
+}
+
 // EnableEIP enables the given EIP on the config.
 // This operation writes in-place, and callers need to ensure that the globally
-// defined jump tables are not polluted.
+// defined jump tables are not polluted. Only the opcodes present in the table
+// are repriced, so an EIP may be enabled on top of a fork predating the ones it
+// requires, e.g. EIP-1884 on Byzantium.
 func EnableEIP(eipNum int, jt *JumpTable) error {
-	switch eipNum {
-	case 2200:
-		enable2200(jt)
-	case 1884:
-		enable1884(jt)
-	case 1344:
-		enable1344(jt)
-	default:
+	eip, ok := eipsByName[fmt.Sprintf("EIP-%d", eipNum)]
+	if !ok {
 		return fmt.Errorf("undefined eip %d", eipNum)
 	}
+	eip.apply(jt)
 	return nil
 }
 
-func enableSelfBalance(jt *JumpTable) {
-	jt[SELFBALANCE] = operation{
+// constGas returns a pointer to the given gas cost.
+func constGas(cost uint64) *uint64 {
+	return &cost
+}
+
+func init() {
+	registerEIP(&EIP{
+		Name:       "EIP-7",
+		Title:      "DELEGATECALL",
+		Transition: ctypes.ChainConfigurator.GetEIP7Transition,
+		operations: map[OpCode]operation{
+			DELEGATECALL: {
+				execute:     opDelegateCall,
+				dynamicGas:  gasDelegateCall,
+				constantGas: vars.CallGasFrontier,
+				minStack:    minStack(6, 1),
+				maxStack:    maxStack(6, 1),
+				memorySize:  memoryDelegateCall,
+				valid:       true,
+				returns:     true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-150",
+		Title:      "Gas cost changes for IO-heavy operations",
+		Requires:   []string{"EIP-7"},
+		Transition: ctypes.ChainConfigurator.GetEIP150Transition,
+		gasChanges: []GasChange{
+			{Op: BALANCE, ConstantGas: constGas(vars.BalanceGasEIP150)},
+			{Op: EXTCODESIZE, ConstantGas: constGas(vars.ExtcodeSizeGasEIP150)},
+			{Op: SLOAD, ConstantGas: constGas(vars.SloadGasEIP150)},
+			{Op: EXTCODECOPY, ConstantGas: constGas(vars.ExtcodeCopyBaseEIP150)},
+			{Op: CALL, ConstantGas: constGas(vars.CallGasEIP150)},
+			{Op: CALLCODE, ConstantGas: constGas(vars.CallGasEIP150)},
+			{Op: DELEGATECALL, ConstantGas: constGas(vars.CallGasEIP150)},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-160",
+		Title:      "EXP cost increase",
+		Transition: ctypes.ChainConfigurator.GetEIP160Transition,
+		gasChanges: []GasChange{
+			{Op: EXP, dynamicGas: gasExpEIP158},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-140",
+		Title:      "REVERT instruction",
+		Transition: ctypes.ChainConfigurator.GetEIP140Transition,
+		operations: map[OpCode]operation{
+			REVERT: {
+				execute:    opRevert,
+				dynamicGas: gasRevert,
+				minStack:   minStack(2, 0),
+				maxStack:   maxStack(2, 0),
+				memorySize: memoryRevert,
+				valid:      true,
+				reverts:    true,
+				returns:    true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-214",
+		Title:      "STATICCALL",
+		Transition: ctypes.ChainConfigurator.GetEIP214Transition,
+		operations: map[OpCode]operation{
+			STATICCALL: {
+				execute:     opStaticCall,
+				constantGas: vars.CallGasEIP150,
+				dynamicGas:  gasStaticCall,
+				minStack:    minStack(6, 1),
+				maxStack:    maxStack(6, 1),
+				memorySize:  memoryStaticCall,
+				valid:       true,
+				returns:     true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-211",
+		Title:      "RETURNDATASIZE and RETURNDATACOPY",
+		Transition: ctypes.ChainConfigurator.GetEIP211Transition,
+		operations: map[OpCode]operation{
+			RETURNDATASIZE: {
+				execute:     opReturnDataSize,
+				constantGas: GasQuickStep,
+				minStack:    minStack(0, 1),
+				maxStack:    maxStack(0, 1),
+				valid:       true,
+			},
+			RETURNDATACOPY: {
+				execute:     opReturnDataCopy,
+				constantGas: GasFastestStep,
+				dynamicGas:  gasReturnDataCopy,
+				minStack:    minStack(3, 0),
+				maxStack:    maxStack(3, 0),
+				memorySize:  memoryReturnDataCopy,
+				valid:       true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-145",
+		Title:      "Bitwise shifting instructions",
+		Transition: ctypes.ChainConfigurator.GetEIP145Transition,
+		operations: map[OpCode]operation{
+			SHL: {
+				execute:     opSHL,
+				constantGas: GasFastestStep,
+				minStack:    minStack(2, 1),
+				maxStack:    maxStack(2, 1),
+				valid:       true,
+			},
+			SHR: {
+				execute:     opSHR,
+				constantGas: GasFastestStep,
+				minStack:    minStack(2, 1),
+				maxStack:    maxStack(2, 1),
+				valid:       true,
+			},
+			SAR: {
+				execute:     opSAR,
+				constantGas: GasFastestStep,
+				minStack:    minStack(2, 1),
+				maxStack:    maxStack(2, 1),
+				valid:       true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-1014",
+		Title:      "CREATE2",
+		Transition: ctypes.ChainConfigurator.GetEIP1014Transition,
+		operations: map[OpCode]operation{
+			CREATE2: {
+				execute:     opCreate2,
+				constantGas: vars.Create2Gas,
+				dynamicGas:  gasCreate2,
+				minStack:    minStack(4, 1),
+				maxStack:    maxStack(4, 1),
+				memorySize:  memoryCreate2,
+				valid:       true,
+				writes:      true,
+				returns:     true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-1052",
+		Title:      "EXTCODEHASH",
+		Transition: ctypes.ChainConfigurator.GetEIP1052Transition,
+		operations: map[OpCode]operation{
+			EXTCODEHASH: {
+				execute:     opExtCodeHash,
+				constantGas: vars.ExtcodeHashGasConstantinople,
+				minStack:    minStack(1, 1),
+				maxStack:    maxStack(1, 1),
+				valid:       true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-1344",
+		Title:      "CHAINID",
+		Transition: ctypes.ChainConfigurator.GetEIP1344Transition,
+		operations: map[OpCode]operation{
+			CHAINID: {
+				execute:     opChainID,
+				constantGas: GasQuickStep,
+				minStack:    minStack(0, 1),
+				maxStack:    maxStack(0, 1),
+				valid:       true,
+			},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-1884",
+		Title:      "Repricing for trie-size-dependent opcodes",
+		Requires:   []string{"EIP-1052"},
+		Transition: ctypes.ChainConfigurator.GetEIP1884Transition,
+		operations: map[OpCode]operation{
+			SELFBALANCE: selfBalanceOperation(),
+		},
+		gasChanges: []GasChange{
+			{Op: SLOAD, ConstantGas: constGas(vars.SloadGasEIP1884)},
+			{Op: BALANCE, ConstantGas: constGas(vars.BalanceGasEIP1884)},
+			{Op: EXTCODEHASH, ConstantGas: constGas(vars.ExtcodeHashGasEIP1884)},
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "ECIP-1080",
+		Title:      "SELFBALANCE without the repricing of EIP-1884",
+		Transition: ctypes.ChainConfigurator.GetECIP1080Transition,
+		operations: map[OpCode]operation{
+			SELFBALANCE: selfBalanceOperation(),
+		},
+	})
+	registerEIP(&EIP{
+		Name:       "EIP-2200",
+		Title:      "Structured definitions for net gas metering",
+		Transition: ctypes.ChainConfigurator.GetEIP2200Transition,
+		Disable:    ctypes.ChainConfigurator.GetEIP2200DisableTransition,
+		gasChanges: []GasChange{
+			{Op: SLOAD, ConstantGas: constGas(vars.SloadGasEIP2200)},
+			{Op: SSTORE, dynamicGas: gasSStoreEIP2200},
+		},
+	})
+}
+
+// selfBalanceOperation returns the SELFBALANCE opcode, defined both by EIP-1884
+// and ECIP-1080.
+func selfBalanceOperation() operation {
+	return operation{
 		execute:     opSelfBalance,
 		constantGas: GasFastStep,
 		minStack:    minStack(0, 1),
@@ -49,49 +363,15 @@ func enableSelfBalance(jt *JumpTable) {
 	}
 }
 
-// enable1884 applies EIP-1884 to the given jump table:
-// - Increase cost of BALANCE to 700
-// - Increase cost of EXTCODEHASH to 700
-// - Increase cost of SLOAD to 800
-// - Define SELFBALANCE, with cost GasFastStep (5)
-func enable1884(jt *JumpTable) {
-	// Gas cost changes
-	jt[SLOAD].constantGas = vars.SloadGasEIP1884
-	jt[BALANCE].constantGas = vars.BalanceGasEIP1884
-	jt[EXTCODEHASH].constantGas = vars.ExtcodeHashGasEIP1884
-
-	// New opcode
-	enableSelfBalance(jt)
-}
-
 func opSelfBalance(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	balance := interpreter.intPool.get().Set(interpreter.evm.StateDB.GetBalance(contract.Address()))
 	stack.push(balance)
 	return nil, nil
 }
 
-// enable1344 applies EIP-1344 (ChainID Opcode)
-// - Adds an opcode that returns the current chain’s EIP-155 unique identifier
-func enable1344(jt *JumpTable) {
-	// New opcode
-	jt[CHAINID] = operation{
-		execute:     opChainID,
-		constantGas: GasQuickStep,
-		minStack:    minStack(0, 1),
-		maxStack:    maxStack(0, 1),
-		valid:       true,
-	}
-}
-
 // opChainID implements CHAINID opcode
 func opChainID(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	chainId := interpreter.intPool.get().Set(interpreter.evm.chainConfig.GetChainID())
 	stack.push(chainId)
 	return nil, nil
 }
-
-// enable2200 applies EIP-2200 (Rebalance net-metered SSTORE)
-func enable2200(jt *JumpTable) {
-	jt[SLOAD].constantGas = vars.SloadGasEIP2200
-	jt[SSTORE].dynamicGas = gasSStoreEIP2200
-}
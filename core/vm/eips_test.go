@@ -0,0 +1,336 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/goethereum"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that the instruction set is assembled from the EIPs active at a block.
+func TestInstructionSetForConfig(t *testing.T) {
+	frontier := instructionSetForConfig(&goethereum.ChainConfig{ChainID: big.NewInt(1)}, new(big.Int))
+	for _, op := range []OpCode{DELEGATECALL, REVERT, SHL, CREATE2, EXTCODEHASH, CHAINID, SELFBALANCE} {
+		if frontier[op].valid {
+			t.Errorf("%v defined in frontier", op)
+		}
+	}
+	if frontier[SLOAD].constantGas != vars.SloadGasFrontier {
+		t.Errorf("frontier SLOAD gas mismatch: have %d, want %d", frontier[SLOAD].constantGas, vars.SloadGasFrontier)
+	}
+	latest := instructionSetForConfig(params.TestChainConfig, new(big.Int))
+	for _, eip := range EIPs() {
+		if !eip.Enabled(params.TestChainConfig, new(big.Int)) {
+			continue
+		}
+		for _, op := range eip.Opcodes() {
+			if !latest[op].valid {
+				t.Errorf("%v of %s not defined", op, eip.Name)
+			}
+		}
+	}
+	if latest[SLOAD].constantGas != vars.SloadGasEIP2200 {
+		t.Errorf("SLOAD gas mismatch: have %d, want %d", latest[SLOAD].constantGas, vars.SloadGasEIP2200)
+	}
+	if latest[DELEGATECALL].constantGas != vars.CallGasEIP150 {
+		t.Errorf("DELEGATECALL gas mismatch: have %d, want %d", latest[DELEGATECALL].constantGas, vars.CallGasEIP150)
+	}
+}
+
+// Tests that extra EIPs can be enabled on top of any fork, only repricing the
+// opcodes present in the instruction set.
+func TestEnableEIP(t *testing.T) {
+	jt := newBaseInstructionSet()
+	if err := EnableEIP(1884, &jt); err != nil {
+		t.Fatalf("failed to enable EIP-1884 on frontier: %v", err)
+	}
+	if !jt[SELFBALANCE].valid || jt[SLOAD].constantGas != vars.SloadGasEIP1884 {
+		t.Errorf("EIP-1884 not applied")
+	}
+	if jt[EXTCODEHASH].valid || jt[EXTCODEHASH].constantGas != 0 {
+		t.Errorf("EIP-1884 repriced undefined EXTCODEHASH")
+	}
+	if err := EnableEIP(2200, &jt); err != nil {
+		t.Fatalf("failed to enable EIP-2200: %v", err)
+	}
+	if jt[SLOAD].constantGas != vars.SloadGasEIP2200 {
+		t.Errorf("SLOAD gas mismatch: have %d, want %d", jt[SLOAD].constantGas, vars.SloadGasEIP2200)
+	}
+	// Enabling the EIPs in order reprices the opcodes defined in between
+	jt = newBaseInstructionSet()
+	for _, eip := range []int{1052, 1884} {
+		if err := EnableEIP(eip, &jt); err != nil {
+			t.Fatalf("failed to enable EIP-%d: %v", eip, err)
+		}
+	}
+	if !jt[EXTCODEHASH].valid || jt[EXTCODEHASH].constantGas != vars.ExtcodeHashGasEIP1884 {
+		t.Errorf("EIP-1884 not applied to EXTCODEHASH")
+	}
+	if err := EnableEIP(1, &jt); err == nil {
+		t.Errorf("undefined EIP enabled")
+	}
+}
+
+// Tests that the instruction sets assembled from the EIP registry are identical
+// to the ones of the fork by fork construction they replaced.
+func TestInstructionSetEquivalence(t *testing.T) {
+	forks := []struct {
+		name   string
+		config *goethereum.ChainConfig
+	}{
+		{"Frontier", &goethereum.ChainConfig{ChainID: big.NewInt(1)}},
+		{"Homestead", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}},
+		{"EIP150", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0)}},
+		{"EIP158", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0)}},
+		{"Byzantium", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}},
+		{"Constantinople", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0), ConstantinopleBlock: big.NewInt(0)}},
+		{"Petersburg", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0), ConstantinopleBlock: big.NewInt(0), PetersburgBlock: big.NewInt(0)}},
+		{"Istanbul", &goethereum.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0), ConstantinopleBlock: big.NewInt(0), PetersburgBlock: big.NewInt(0), IstanbulBlock: big.NewInt(0)}},
+	}
+	for _, fork := range forks {
+		compareInstructionSets(t, fork.name, fork.config, new(big.Int))
+	}
+	// Check the Classic networks on both sides of each of their transitions
+	networks := []struct {
+		name   string
+		config ctypes.ChainConfigurator
+	}{
+		{"Classic", params.ClassicChainConfig},
+		{"Mordor", params.MordorChainConfig},
+	}
+	for _, network := range networks {
+		transitions, _ := confp.Transitions(network.config)
+		for _, transition := range transitions {
+			bn := transition()
+			if bn == nil {
+				continue
+			}
+			for _, n := range []uint64{*bn - 1, *bn} {
+				if *bn == 0 && n != 0 {
+					continue
+				}
+				compareInstructionSets(t, fmt.Sprintf("%s #%d", network.name, n), network.config, new(big.Int).SetUint64(n))
+			}
+		}
+	}
+}
+
+// compareInstructionSets checks that the instruction set of a chain at a block
+// matches the one assembled by legacyInstructionSetForConfig.
+func compareInstructionSets(t *testing.T, name string, config ctypes.ChainConfigurator, bn *big.Int) {
+	t.Helper()
+
+	have, want := instructionSetForConfig(config, bn), legacyInstructionSetForConfig(config, bn)
+	for i := range have {
+		op, h, w := OpCode(i), have[i], want[i]
+		if h.valid != w.valid {
+			t.Errorf("%s: %v validity mismatch: have %v, want %v", name, op, h.valid, w.valid)
+			continue
+		}
+		if !h.valid {
+			continue
+		}
+		if h.constantGas != w.constantGas {
+			t.Errorf("%s: %v constant gas mismatch: have %d, want %d", name, op, h.constantGas, w.constantGas)
+		}
+		if funcPointer(h.execute) != funcPointer(w.execute) || funcPointer(h.dynamicGas) != funcPointer(w.dynamicGas) || funcPointer(h.memorySize) != funcPointer(w.memorySize) {
+			t.Errorf("%s: %v functions mismatch", name, op)
+		}
+		if h.minStack != w.minStack || h.maxStack != w.maxStack {
+			t.Errorf("%s: %v stack bounds mismatch: have %d-%d, want %d-%d", name, op, h.minStack, h.maxStack, w.minStack, w.maxStack)
+		}
+		if h.halts != w.halts || h.jumps != w.jumps || h.writes != w.writes || h.reverts != w.reverts || h.returns != w.returns {
+			t.Errorf("%s: %v flags mismatch: have %+v, want %+v", name, op, h, w)
+		}
+	}
+}
+
+// funcPointer returns the code pointer of a function, zero if it's nil.
+func funcPointer(fn interface{}) uintptr {
+	v := reflect.ValueOf(fn)
+	if v.IsNil() {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// legacyInstructionSetForConfig is the fork by fork construction of the
+// instruction set which predates the EIP registry, kept to check that the two
+// are equivalent.
+func legacyInstructionSetForConfig(config ctypes.ChainConfigurator, bn *big.Int) JumpTable {
+	instructionSet := newBaseInstructionSet()
+
+	// Homestead
+	if config.IsEnabled(config.GetEIP7Transition, bn) {
+		instructionSet[DELEGATECALL] = operation{
+			execute:     opDelegateCall,
+			dynamicGas:  gasDelegateCall,
+			constantGas: vars.CallGasFrontier,
+			minStack:    minStack(6, 1),
+			maxStack:    maxStack(6, 1),
+			memorySize:  memoryDelegateCall,
+			valid:       true,
+			returns:     true,
+		}
+	}
+	// Tangerine Whistle
+	if config.IsEnabled(config.GetEIP150Transition, bn) {
+		instructionSet[BALANCE].constantGas = vars.BalanceGasEIP150
+		instructionSet[EXTCODESIZE].constantGas = vars.ExtcodeSizeGasEIP150
+		instructionSet[SLOAD].constantGas = vars.SloadGasEIP150
+		instructionSet[EXTCODECOPY].constantGas = vars.ExtcodeCopyBaseEIP150
+		instructionSet[CALL].constantGas = vars.CallGasEIP150
+		instructionSet[CALLCODE].constantGas = vars.CallGasEIP150
+		instructionSet[DELEGATECALL].constantGas = vars.CallGasEIP150
+	}
+	// Spurious Dragon
+	if config.IsEnabled(config.GetEIP160Transition, bn) {
+		instructionSet[EXP].dynamicGas = gasExpEIP158
+	}
+	// Byzantium
+	if config.IsEnabled(config.GetEIP140Transition, bn) {
+		instructionSet[REVERT] = operation{
+			execute:    opRevert,
+			dynamicGas: gasRevert,
+			minStack:   minStack(2, 0),
+			maxStack:   maxStack(2, 0),
+			memorySize: memoryRevert,
+			valid:      true,
+			reverts:    true,
+			returns:    true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP214Transition, bn) {
+		instructionSet[STATICCALL] = operation{
+			execute:     opStaticCall,
+			constantGas: vars.CallGasEIP150,
+			dynamicGas:  gasStaticCall,
+			minStack:    minStack(6, 1),
+			maxStack:    maxStack(6, 1),
+			memorySize:  memoryStaticCall,
+			valid:       true,
+			returns:     true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP211Transition, bn) {
+		instructionSet[RETURNDATASIZE] = operation{
+			execute:     opReturnDataSize,
+			constantGas: GasQuickStep,
+			minStack:    minStack(0, 1),
+			maxStack:    maxStack(0, 1),
+			valid:       true,
+		}
+		instructionSet[RETURNDATACOPY] = operation{
+			execute:     opReturnDataCopy,
+			constantGas: GasFastestStep,
+			dynamicGas:  gasReturnDataCopy,
+			minStack:    minStack(3, 0),
+			maxStack:    maxStack(3, 0),
+			memorySize:  memoryReturnDataCopy,
+			valid:       true,
+		}
+	}
+	// Constantinople
+	if config.IsEnabled(config.GetEIP145Transition, bn) {
+		instructionSet[SHL] = operation{
+			execute:     opSHL,
+			constantGas: GasFastestStep,
+			minStack:    minStack(2, 1),
+			maxStack:    maxStack(2, 1),
+			valid:       true,
+		}
+		instructionSet[SHR] = operation{
+			execute:     opSHR,
+			constantGas: GasFastestStep,
+			minStack:    minStack(2, 1),
+			maxStack:    maxStack(2, 1),
+			valid:       true,
+		}
+		instructionSet[SAR] = operation{
+			execute:     opSAR,
+			constantGas: GasFastestStep,
+			minStack:    minStack(2, 1),
+			maxStack:    maxStack(2, 1),
+			valid:       true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP1014Transition, bn) {
+		instructionSet[CREATE2] = operation{
+			execute:     opCreate2,
+			constantGas: vars.Create2Gas,
+			dynamicGas:  gasCreate2,
+			minStack:    minStack(4, 1),
+			maxStack:    maxStack(4, 1),
+			memorySize:  memoryCreate2,
+			valid:       true,
+			writes:      true,
+			returns:     true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP1052Transition, bn) {
+		instructionSet[EXTCODEHASH] = operation{
+			execute:     opExtCodeHash,
+			constantGas: vars.ExtcodeHashGasConstantinople,
+			minStack:    minStack(1, 1),
+			maxStack:    maxStack(1, 1),
+			valid:       true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP1344Transition, bn) {
+		instructionSet[CHAINID] = operation{
+			execute:     opChainID,
+			constantGas: GasQuickStep,
+			minStack:    minStack(0, 1),
+			maxStack:    maxStack(0, 1),
+			valid:       true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP1884Transition, bn) {
+		instructionSet[SLOAD].constantGas = vars.SloadGasEIP1884
+		instructionSet[BALANCE].constantGas = vars.BalanceGasEIP1884
+		instructionSet[EXTCODEHASH].constantGas = vars.ExtcodeHashGasEIP1884
+		instructionSet[SELFBALANCE] = operation{
+			execute:     opSelfBalance,
+			constantGas: GasFastStep,
+			minStack:    minStack(0, 1),
+			maxStack:    maxStack(0, 1),
+			valid:       true,
+		}
+	}
+	if config.IsEnabled(config.GetECIP1080Transition, bn) {
+		instructionSet[SELFBALANCE] = operation{
+			execute:     opSelfBalance,
+			constantGas: GasFastStep,
+			minStack:    minStack(0, 1),
+			maxStack:    maxStack(0, 1),
+			valid:       true,
+		}
+	}
+	if config.IsEnabled(config.GetEIP2200Transition, bn) && !config.IsEnabled(config.GetEIP2200DisableTransition, bn) {
+		instructionSet[SLOAD].constantGas = vars.SloadGasEIP2200
+		instructionSet[SSTORE].dynamicGas = gasSStoreEIP2200
+	}
+	return instructionSet
+}
@@ -169,6 +169,13 @@ func (evm *EVM) Cancelled() bool {
 	return atomic.LoadInt32(&evm.abort) == 1
 }
 
+// CallGas returns the gas allotted to the callee of the call opcode currently
+// being executed, excluding any stipend. It's only meaningful to tracers while
+// capturing the state of a call opcode.
+func (evm *EVM) CallGas() uint64 {
+	return evm.callGasTemp
+}
+
 // Interpreter returns the current interpreter
 func (evm *EVM) Interpreter() Interpreter {
 	return evm.interpreter
@@ -284,3 +284,9 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 func (in *EVMInterpreter) CanRun(code []byte) bool {
 	return true
 }
+
+// ReturnData returns the return data of the last call made by the contract
+// currently being executed.
+func (in *EVMInterpreter) ReturnData() []byte {
+	return in.returnData
+}
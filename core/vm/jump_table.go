@@ -60,138 +60,15 @@ type operation struct {
 type JumpTable [256]operation
 
 // instructionSetForConfig determines an instruction set for the vm using
-// the chain config params and a current block number
+// the chain config params and a current block number, applying the registered
+// EIPs active at that block on top of the Frontier instructions.
 func instructionSetForConfig(config ctypes.ChainConfigurator, bn *big.Int) JumpTable {
 	instructionSet := newBaseInstructionSet()
-
-	// Homestead
-	if config.IsEnabled(config.GetEIP7Transition, bn) {
-		instructionSet[DELEGATECALL] = operation{
-			execute:     opDelegateCall,
-			dynamicGas:  gasDelegateCall,
-			constantGas: vars.CallGasFrontier,
-			minStack:    minStack(6, 1),
-			maxStack:    maxStack(6, 1),
-			memorySize:  memoryDelegateCall,
-			valid:       true,
-			returns:     true,
-		}
-	}
-	// Tangerine Whistle
-	if config.IsEnabled(config.GetEIP150Transition, bn) {
-		instructionSet[BALANCE].constantGas = vars.BalanceGasEIP150
-		instructionSet[EXTCODESIZE].constantGas = vars.ExtcodeSizeGasEIP150
-		instructionSet[SLOAD].constantGas = vars.SloadGasEIP150
-		instructionSet[EXTCODECOPY].constantGas = vars.ExtcodeCopyBaseEIP150
-		instructionSet[CALL].constantGas = vars.CallGasEIP150
-		instructionSet[CALLCODE].constantGas = vars.CallGasEIP150
-		instructionSet[DELEGATECALL].constantGas = vars.CallGasEIP150
-	}
-	// Spurious Dragon
-	if config.IsEnabled(config.GetEIP160Transition, bn) {
-		instructionSet[EXP].dynamicGas = gasExpEIP158
-	}
-	// Byzantium
-	if config.IsEnabled(config.GetEIP140Transition, bn) {
-		instructionSet[REVERT] = operation{
-			execute:    opRevert,
-			dynamicGas: gasRevert,
-			minStack:   minStack(2, 0),
-			maxStack:   maxStack(2, 0),
-			memorySize: memoryRevert,
-			valid:      true,
-			reverts:    true,
-			returns:    true,
-		}
-	}
-	if config.IsEnabled(config.GetEIP214Transition, bn) {
-		instructionSet[STATICCALL] = operation{
-			execute:     opStaticCall,
-			constantGas: vars.CallGasEIP150,
-			dynamicGas:  gasStaticCall,
-			minStack:    minStack(6, 1),
-			maxStack:    maxStack(6, 1),
-			memorySize:  memoryStaticCall,
-			valid:       true,
-			returns:     true,
-		}
-	}
-	if config.IsEnabled(config.GetEIP211Transition, bn) {
-		instructionSet[RETURNDATASIZE] = operation{
-			execute:     opReturnDataSize,
-			constantGas: GasQuickStep,
-			minStack:    minStack(0, 1),
-			maxStack:    maxStack(0, 1),
-			valid:       true,
-		}
-		instructionSet[RETURNDATACOPY] = operation{
-			execute:     opReturnDataCopy,
-			constantGas: GasFastestStep,
-			dynamicGas:  gasReturnDataCopy,
-			minStack:    minStack(3, 0),
-			maxStack:    maxStack(3, 0),
-			memorySize:  memoryReturnDataCopy,
-			valid:       true,
-		}
-	}
-	// Constantinople
-	if config.IsEnabled(config.GetEIP145Transition, bn) {
-		instructionSet[SHL] = operation{
-			execute:     opSHL,
-			constantGas: GasFastestStep,
-			minStack:    minStack(2, 1),
-			maxStack:    maxStack(2, 1),
-			valid:       true,
-		}
-		instructionSet[SHR] = operation{
-			execute:     opSHR,
-			constantGas: GasFastestStep,
-			minStack:    minStack(2, 1),
-			maxStack:    maxStack(2, 1),
-			valid:       true,
-		}
-		instructionSet[SAR] = operation{
-			execute:     opSAR,
-			constantGas: GasFastestStep,
-			minStack:    minStack(2, 1),
-			maxStack:    maxStack(2, 1),
-			valid:       true,
+	for _, eip := range eips {
+		if eip.Enabled(config, bn) {
+			eip.apply(&instructionSet)
 		}
 	}
-	if config.IsEnabled(config.GetEIP1014Transition, bn) {
-		instructionSet[CREATE2] = operation{
-			execute:     opCreate2,
-			constantGas: vars.Create2Gas,
-			dynamicGas:  gasCreate2,
-			minStack:    minStack(4, 1),
-			maxStack:    maxStack(4, 1),
-			memorySize:  memoryCreate2,
-			valid:       true,
-			writes:      true,
-			returns:     true,
-		}
-	}
-	if config.IsEnabled(config.GetEIP1052Transition, bn) {
-		instructionSet[EXTCODEHASH] = operation{
-			execute:     opExtCodeHash,
-			constantGas: vars.ExtcodeHashGasConstantinople,
-			minStack:    minStack(1, 1),
-			maxStack:    maxStack(1, 1),
-			valid:       true,
-		}
-	}
-	if config.IsEnabled(config.GetEIP1344Transition, bn) {
-		enable1344(&instructionSet) // ChainID opcode - https://eips.ethereum.org/EIPS/eip-1344
-	}
-	if config.IsEnabled(config.GetEIP1884Transition, bn) {
-		enable1884(&instructionSet) // Reprice reader opcodes - https://eips.ethereum.org/EIPS/eip-1884
-	}
-	if config.IsEnabled(config.GetECIP1080Transition, bn) {
-		enableSelfBalance(&instructionSet)
-	}
-	if config.IsEnabled(config.GetEIP2200Transition, bn) && !config.IsEnabled(config.GetEIP2200DisableTransition, bn) {
-		enable2200(&instructionSet) // Net metered SSTORE - https://eips.ethereum.org/EIPS/eip-2200
-	}
 	return instructionSet
 }
 
@@ -0,0 +1,127 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccessTuple is an account touched during execution, along with the storage
+// slots of it that were accessed.
+type AccessTuple struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+// AccessListTracer is a tracer that records every account and storage slot
+// touched during execution and implements Tracer.
+//
+// Accounts are recorded when they are the sender or recipient of the message,
+// when they execute code, and when they are the target of a BALANCE, EXTCODE*,
+// CALL* or SELFDESTRUCT operation. Storage slots are recorded on SLOAD and SSTORE.
+type AccessListTracer struct {
+	list map[common.Address]map[common.Hash]struct{}
+}
+
+// NewAccessListTracer returns a new access list tracer.
+func NewAccessListTracer() *AccessListTracer {
+	return &AccessListTracer{
+		list: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// addAddress records an account as touched.
+func (t *AccessListTracer) addAddress(addr common.Address) {
+	if _, ok := t.list[addr]; !ok {
+		t.list[addr] = make(map[common.Hash]struct{})
+	}
+}
+
+// addSlot records a storage slot of an account as touched.
+func (t *AccessListTracer) addSlot(addr common.Address, slot common.Hash) {
+	t.addAddress(addr)
+	t.list[addr][slot] = struct{}{}
+}
+
+// CaptureStart implements the Tracer interface to record the parties of the
+// message being executed.
+func (t *AccessListTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.addAddress(from)
+	t.addAddress(to)
+	return nil
+}
+
+// CaptureState implements the Tracer interface to record the accounts and
+// storage slots accessed by the operation about to be executed.
+func (t *AccessListTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	t.addAddress(contract.Address())
+
+	switch {
+	case (op == SLOAD || op == SSTORE) && stack.len() >= 1:
+		t.addSlot(contract.Address(), common.BigToHash(stack.Back(0)))
+
+	case (op == BALANCE || op == EXTCODESIZE || op == EXTCODECOPY || op == EXTCODEHASH || op == SELFDESTRUCT) && stack.len() >= 1:
+		t.addAddress(common.BigToAddress(stack.Back(0)))
+
+	case (op == CALL || op == CALLCODE || op == DELEGATECALL || op == STATICCALL) && stack.len() >= 2:
+		t.addAddress(common.BigToAddress(stack.Back(1)))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface, but does nothing as faults
+// don't touch any further state.
+func (t *AccessListTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface, but does nothing as the access
+// list is complete by the time execution ends.
+func (t *AccessListTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// AccessList returns the accounts and storage slots touched so far, sorted by
+// address and storage key.
+func (t *AccessListTracer) AccessList() []AccessTuple {
+	list := make([]AccessTuple, 0, len(t.list))
+	for addr, slots := range t.list {
+		tuple := AccessTuple{
+			Address:     addr,
+			StorageKeys: make([]common.Hash, 0, len(slots)),
+		}
+		for slot := range slots {
+			tuple.StorageKeys = append(tuple.StorageKeys, slot)
+		}
+		sort.Slice(tuple.StorageKeys, func(i, j int) bool {
+			return bytes.Compare(tuple.StorageKeys[i][:], tuple.StorageKeys[j][:]) < 0
+		})
+		list = append(list, tuple)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0
+	})
+	return list
+}
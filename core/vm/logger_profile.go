@@ -0,0 +1,227 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// ProfileEntry is the aggregated cost of a group of executed operations.
+type ProfileEntry struct {
+	Count uint64        `json:"count"`
+	Gas   uint64        `json:"gas"`
+	Time  time.Duration `json:"time"` // Wall clock time in nanoseconds
+}
+
+// ContractProfile is the aggregated cost of the operations executed by the code
+// of a contract, both in total and per opcode.
+type ContractProfile struct {
+	ProfileEntry
+	Ops map[string]*ProfileEntry `json:"ops"`
+}
+
+// Profile is the aggregated cost of an execution per opcode, per contract and
+// per precompiled contract.
+type Profile struct {
+	Ops         map[string]*ProfileEntry            `json:"ops"`
+	Contracts   map[common.Address]*ContractProfile `json:"contracts"`
+	Precompiles map[common.Address]*ProfileEntry    `json:"precompiles"`
+}
+
+// contractProfile is the cost accumulated by the code of a single contract.
+type contractProfile struct {
+	total ProfileEntry
+	ops   [256]ProfileEntry
+}
+
+// pendingOp is an executed operation whose duration isn't known until the next
+// one starts.
+type pendingOp struct {
+	op       OpCode
+	contract *contractProfile
+	depth    int
+	start    time.Time
+
+	precompile    *ProfileEntry // Precompile called by the operation, if any
+	precompileGas uint64        // Gas allotted to the precompile, including any stipend
+	gasLeft       uint64        // Gas left to the caller once the call was charged
+}
+
+// Profiler is a tracer aggregating the number of executions, the gas used and
+// the wall clock time spent per opcode, per contract and per precompiled
+// contract, and implements Tracer.
+//
+// Operations are attributed to the contract whose code executes them, so the
+// code run by a DELEGATECALL counts towards the callee. Gas is the cost of the
+// operation itself, excluding any gas it forwards to a call. Time is measured
+// from the start of an operation to the start of the next one, at any depth. The
+// cost of precompiled contracts is reported separately from the calls to them.
+//
+// Profiler only keeps aggregates, so it's suitable to profile long executions,
+// and can be reused across several of them to profile them together.
+type Profiler struct {
+	ops         [256]ProfileEntry
+	contracts   map[common.Address]*contractProfile
+	precompiles map[common.Address]*ProfileEntry
+
+	active  map[common.Address]PrecompiledContract // Precompiles of the current execution
+	pending *pendingOp
+}
+
+// NewProfiler returns a new profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		contracts:   make(map[common.Address]*contractProfile),
+		precompiles: make(map[common.Address]*ProfileEntry),
+	}
+}
+
+// CaptureStart implements the Tracer interface to start profiling a new
+// execution.
+func (p *Profiler) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	p.active, p.pending = nil, nil
+	return nil
+}
+
+// CaptureState implements the Tracer interface to account the operation about
+// to be executed, and the time taken by the previous one.
+func (p *Profiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	now := time.Now()
+	p.flush(now, gas, depth)
+
+	// Operations failing before execution aren't charged for
+	if err != nil {
+		return nil
+	}
+	codeAddr := contract.Address()
+	if contract.CodeAddr != nil {
+		codeAddr = *contract.CodeAddr
+	}
+	profile := p.contracts[codeAddr]
+	if profile == nil {
+		profile = new(contractProfile)
+		p.contracts[codeAddr] = profile
+	}
+	pending := &pendingOp{op: op, contract: profile, depth: depth, start: now}
+
+	// The cost of calls includes the gas allotted to the callee, which is
+	// accounted to the operations it executes instead
+	if (op == CALL || op == CALLCODE || op == DELEGATECALL || op == STATICCALL) && stack.len() >= 3 {
+		callGas := env.CallGas()
+		if cost >= callGas {
+			cost -= callGas
+		}
+		if p.active == nil {
+			p.active = PrecompiledContractsForConfig(env.ChainConfig(), env.BlockNumber)
+		}
+		if target := common.BigToAddress(stack.Back(1)); p.active[target] != nil {
+			if p.precompiles[target] == nil {
+				p.precompiles[target] = new(ProfileEntry)
+			}
+			pending.precompile = p.precompiles[target]
+			pending.precompileGas = callGas
+			if (op == CALL || op == CALLCODE) && stack.Back(2).Sign() != 0 {
+				pending.precompileGas += vars.CallStipend
+			}
+			pending.gasLeft = gas - cost - callGas
+		}
+	}
+	p.ops[op].Count++
+	p.ops[op].Gas += cost
+	profile.total.Count++
+	profile.total.Gas += cost
+	profile.ops[op].Count++
+	profile.ops[op].Gas += cost
+
+	p.pending = pending
+	return nil
+}
+
+// flush accounts the time taken by the pending operation, given the gas left and
+// the depth at the start of the operation following it. Calls into precompiles
+// execute without any operations in between, so their cost is derived from the
+// gas returned by the time the caller resumes.
+func (p *Profiler) flush(now time.Time, gas uint64, depth int) {
+	pending := p.pending
+	if pending == nil {
+		return
+	}
+	p.pending = nil
+
+	elapsed := now.Sub(pending.start)
+	if pending.precompile != nil && depth == pending.depth {
+		pending.precompile.Count++
+		pending.precompile.Time += elapsed
+		if returned := gas - pending.gasLeft; gas >= pending.gasLeft && returned <= pending.precompileGas {
+			pending.precompile.Gas += pending.precompileGas - returned
+		}
+		return
+	}
+	p.ops[pending.op].Time += elapsed
+	pending.contract.total.Time += elapsed
+	pending.contract.ops[pending.op].Time += elapsed
+}
+
+// CaptureFault implements the Tracer interface, but does nothing as faulting
+// operations were already accounted for.
+func (p *Profiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface to account the time taken by the
+// last operation of the execution.
+func (p *Profiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	p.flush(time.Now(), 0, -1)
+	return nil
+}
+
+// Profile returns the costs aggregated so far, leaving out the opcodes that
+// weren't executed.
+func (p *Profiler) Profile() *Profile {
+	profile := &Profile{
+		Ops:         opProfiles(&p.ops),
+		Contracts:   make(map[common.Address]*ContractProfile, len(p.contracts)),
+		Precompiles: make(map[common.Address]*ProfileEntry, len(p.precompiles)),
+	}
+	for addr, contract := range p.contracts {
+		profile.Contracts[addr] = &ContractProfile{
+			ProfileEntry: contract.total,
+			Ops:          opProfiles(&contract.ops),
+		}
+	}
+	for addr, entry := range p.precompiles {
+		entry := *entry
+		profile.Precompiles[addr] = &entry
+	}
+	return profile
+}
+
+// opProfiles converts the costs per opcode to a map keyed by opcode name.
+func opProfiles(ops *[256]ProfileEntry) map[string]*ProfileEntry {
+	profiles := make(map[string]*ProfileEntry)
+	for op := range ops {
+		if ops[op].Count > 0 {
+			entry := ops[op]
+			profiles[OpCode(op).String()] = &entry
+		}
+	}
+	return profiles
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WritePprof writes the costs aggregated so far as a gzipped protobuf profile in
+// the format of pprof, which can be explored with `go tool pprof`.
+//
+// Every sample carries the number of executions, the gas used and the time in
+// nanoseconds. Opcodes are reported as functions called by the contract that
+// executed them, and precompiles as functions of their own.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := newPprofBuilder()
+
+	// Sort the contracts for a deterministic output
+	addrs := make([]common.Address, 0, len(p.contracts))
+	for addr := range p.contracts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, addr := range addrs {
+		contract := p.contracts[addr]
+		for op := range contract.ops {
+			if entry := &contract.ops[op]; entry.Count > 0 {
+				b.sample(entry, OpCode(op).String(), addr.Hex())
+			}
+		}
+	}
+	addrs = addrs[:0]
+	for addr := range p.precompiles {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, addr := range addrs {
+		b.sample(p.precompiles[addr], "precompile "+addr.Hex())
+	}
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.encode()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Field numbers of the pprof profile.proto messages used by the profiler.
+const (
+	pprofProfileSampleType        = 1
+	pprofProfileSample            = 2
+	pprofProfileLocation          = 4
+	pprofProfileFunction          = 5
+	pprofProfileStringTable       = 6
+	pprofProfileDefaultSampleType = 14
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+
+	pprofFunctionID   = 1
+	pprofFunctionName = 2
+)
+
+// pprofBuilder assembles a pprof profile, interning the strings and functions
+// referenced by the samples.
+type pprofBuilder struct {
+	strings   []string
+	stringIDs map[string]int
+	functions []int // Name of each function, its id being the index plus one
+	funcIDs   map[string]int
+	samples   protobuf
+}
+
+func newPprofBuilder() *pprofBuilder {
+	b := &pprofBuilder{
+		stringIDs: make(map[string]int),
+		funcIDs:   make(map[string]int),
+	}
+	b.string("") // The first entry of the string table must be empty
+	return b
+}
+
+// string returns the index of the given string in the string table.
+func (b *pprofBuilder) string(s string) int {
+	id, ok := b.stringIDs[s]
+	if !ok {
+		id = len(b.strings)
+		b.strings = append(b.strings, s)
+		b.stringIDs[s] = id
+	}
+	return id
+}
+
+// function returns the id of the function, and of its location, with the given
+// name.
+func (b *pprofBuilder) function(name string) uint64 {
+	id, ok := b.funcIDs[name]
+	if !ok {
+		b.functions = append(b.functions, b.string(name))
+		id = len(b.functions)
+		b.funcIDs[name] = id
+	}
+	return uint64(id)
+}
+
+// sample adds a sample with the costs of the entry, at the stack of functions
+// given from the innermost one out.
+func (b *pprofBuilder) sample(entry *ProfileEntry, stack ...string) {
+	locations := make([]uint64, len(stack))
+	for i, name := range stack {
+		locations[i] = b.function(name)
+	}
+	b.samples.message(pprofProfileSample, func(m *protobuf) {
+		m.packed(pprofSampleLocationID, locations)
+		m.packed(pprofSampleValue, []uint64{entry.Count, entry.Gas, uint64(entry.Time)})
+	})
+}
+
+// encode returns the protobuf encoding of the profile.
+func (b *pprofBuilder) encode() []byte {
+	var profile protobuf
+	for _, sampleType := range [][2]string{{"executions", "count"}, {"gas", "gas"}, {"time", "nanoseconds"}} {
+		typ, unit := b.string(sampleType[0]), b.string(sampleType[1])
+		profile.message(pprofProfileSampleType, func(m *protobuf) {
+			m.uint64(pprofValueTypeType, uint64(typ))
+			m.uint64(pprofValueTypeUnit, uint64(unit))
+		})
+	}
+	profile.data = append(profile.data, b.samples.data...)
+
+	for i := range b.functions {
+		id := uint64(i + 1)
+		profile.message(pprofProfileLocation, func(m *protobuf) {
+			m.uint64(pprofLocationID, id)
+			m.message(pprofLocationLine, func(m *protobuf) {
+				m.uint64(pprofLineFunctionID, id)
+			})
+		})
+	}
+	for i, name := range b.functions {
+		id := uint64(i + 1)
+		profile.message(pprofProfileFunction, func(m *protobuf) {
+			m.uint64(pprofFunctionID, id)
+			m.uint64(pprofFunctionName, uint64(name))
+		})
+	}
+	defaultType := b.string("gas")
+	for _, s := range b.strings {
+		profile.bytes(pprofProfileStringTable, []byte(s))
+	}
+	profile.uint64(pprofProfileDefaultSampleType, uint64(defaultType))
+	return profile.data
+}
+
+// protobuf is a minimal protocol buffer encoder, sufficient to write profiles.
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.data = append(b.data, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// uint64 encodes an integer field. Zero values are omitted as per proto3.
+func (b *protobuf) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(tag)<<3 | 0)
+	b.varint(x)
+}
+
+// packed encodes a repeated integer field.
+func (b *protobuf) packed(tag int, xs []uint64) {
+	var m protobuf
+	for _, x := range xs {
+		m.varint(x)
+	}
+	b.bytes(tag, m.data)
+}
+
+// bytes encodes a length delimited field.
+func (b *protobuf) bytes(tag int, data []byte) {
+	b.varint(uint64(tag)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// message encodes an embedded message, filled in by fn.
+func (b *protobuf) message(tag int, fn func(m *protobuf)) {
+	var m protobuf
+	fn(&m)
+	b.bytes(tag, m.data)
+}
@@ -17,7 +17,15 @@
 package vm
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -68,3 +76,308 @@ func TestStoreCapture(t *testing.T) {
 		t.Errorf("expected %x, got %x", exp, logger.changedValues[contract.Address()][index])
 	}
 }
+
+func TestAccessListCapture(t *testing.T) {
+	var (
+		env      = NewEVM(Context{}, &dummyStatedb{}, params.TestChainConfig, Config{})
+		tracer   = NewAccessListTracer()
+		mem      = NewMemory()
+		contract = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 0)
+		other    = common.HexToAddress("0x1337")
+	)
+	tracer.CaptureStart(common.Address{}, contract.Address(), false, nil, 0, nil)
+
+	// Access the same slot twice and look up the balance of another account
+	for i := 0; i < 2; i++ {
+		stack := newstack()
+		stack.push(big.NewInt(1))
+		tracer.CaptureState(env, 0, SLOAD, 0, 0, mem, stack, contract, 0, nil)
+	}
+	stack := newstack()
+	stack.push(new(big.Int).SetBytes(other.Bytes()))
+	tracer.CaptureState(env, 0, BALANCE, 0, 0, mem, stack, contract, 0, nil)
+
+	list := tracer.AccessList()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(list))
+	}
+	if list[0].Address != contract.Address() || len(list[0].StorageKeys) != 1 || list[0].StorageKeys[0] != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("unexpected access of %x: %v", contract.Address(), list[0])
+	}
+	if list[1].Address != other || len(list[1].StorageKeys) != 0 {
+		t.Errorf("unexpected access of %x: %v", other, list[1])
+	}
+}
+
+func TestProfilerCapture(t *testing.T) {
+	var (
+		env        = NewEVM(Context{BlockNumber: new(big.Int)}, &dummyStatedb{}, params.TestChainConfig, Config{})
+		profiler   = NewProfiler()
+		mem        = NewMemory()
+		contract   = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 0)
+		precompile = common.BytesToAddress([]byte{4})
+	)
+	profiler.CaptureStart(common.Address{}, contract.Address(), false, nil, 0, nil)
+
+	// Execute an addition, then call the identity precompile with 100 gas of
+	// which it uses 15, and stop
+	profiler.CaptureState(env, 0, ADD, 10000, 3, mem, newstack(), contract, 1, nil)
+
+	stack := newstack()
+	stack.push(new(big.Int))
+	stack.push(new(big.Int).SetBytes(precompile.Bytes()))
+	stack.push(big.NewInt(100))
+	env.callGasTemp = 100
+	profiler.CaptureState(env, 1, CALL, 9997, 800, mem, stack, contract, 1, nil)
+	profiler.CaptureState(env, 2, STOP, 9997-800+100-15, 0, mem, newstack(), contract, 1, nil)
+	profiler.CaptureEnd(nil, 0, 0, nil)
+
+	profile := profiler.Profile()
+	if len(profile.Ops) != 3 {
+		t.Fatalf("expected 3 opcodes, got %d", len(profile.Ops))
+	}
+	if ops := profile.Ops; ops["ADD"].Count != 1 || ops["ADD"].Gas != 3 || ops["CALL"].Gas != 700 || ops["STOP"].Gas != 0 {
+		t.Errorf("unexpected opcode costs: ADD %+v, CALL %+v, STOP %+v", ops["ADD"], ops["CALL"], ops["STOP"])
+	}
+	if entry := profile.Contracts[contract.Address()]; entry == nil || entry.Count != 3 || entry.Gas != 703 || len(entry.Ops) != 3 {
+		t.Errorf("unexpected contract costs: %+v", entry)
+	}
+	if entry := profile.Precompiles[precompile]; entry == nil || entry.Count != 1 || entry.Gas != 15 {
+		t.Errorf("unexpected precompile costs: %+v", entry)
+	}
+	var buf bytes.Buffer
+	if err := profiler.WritePprof(&buf); err != nil {
+		t.Fatalf("failed to write pprof profile: %v", err)
+	}
+	pprof, err := decodePprof(&buf)
+	if err != nil {
+		t.Fatalf("invalid pprof profile: %v", err)
+	}
+	wantTypes := [][2]string{{"executions", "count"}, {"gas", "gas"}, {"time", "nanoseconds"}}
+	if !reflect.DeepEqual(pprof.sampleTypes, wantTypes) {
+		t.Errorf("sample types mismatch: have %v, want %v", pprof.sampleTypes, wantTypes)
+	}
+	if pprof.defaultSampleType != "gas" {
+		t.Errorf("default sample type mismatch: have %q, want %q", pprof.defaultSampleType, "gas")
+	}
+	// Opcodes are called from the executing contract in opcode order, while
+	// precompiles stand alone
+	wantSamples := []pprofSample{
+		{[]string{"STOP", contract.Address().Hex()}, []uint64{1, 0}},
+		{[]string{"ADD", contract.Address().Hex()}, []uint64{1, 3}},
+		{[]string{"CALL", contract.Address().Hex()}, []uint64{1, 700}},
+		{[]string{"precompile " + precompile.Hex()}, []uint64{1, 15}},
+	}
+	if len(pprof.samples) != len(wantSamples) {
+		t.Fatalf("sample count mismatch: have %d, want %d", len(pprof.samples), len(wantSamples))
+	}
+	for i, want := range wantSamples {
+		have := pprof.samples[i]
+		if len(have.values) != len(wantTypes) {
+			t.Errorf("sample %d: value count mismatch: have %d, want %d", i, len(have.values), len(wantTypes))
+			continue
+		}
+		// Time is measured, so only the executions and gas are deterministic
+		have.values = have.values[:2]
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("sample %d mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// pprofSample is a sample of a decoded pprof profile, with the names of the
+// functions of its stack from the innermost one out.
+type pprofSample struct {
+	stack  []string
+	values []uint64
+}
+
+// pprofProfile is the subset of a pprof profile written by the profiler.
+type pprofProfile struct {
+	sampleTypes       [][2]string
+	defaultSampleType string
+	samples           []pprofSample
+}
+
+// protoField is a varint or length delimited field of a protobuf message.
+type protoField struct {
+	tag   uint64
+	value uint64
+	data  []byte
+}
+
+// decodeProto splits a protobuf message into its fields, rejecting the wire
+// types not used by the profiler.
+func decodeProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid field key")
+		}
+		data = data[n:]
+
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid field value")
+		}
+		data = data[n:]
+
+		field := protoField{tag: key >> 3, value: value}
+		switch key & 7 {
+		case 0:
+		case 2:
+			if value > uint64(len(data)) {
+				return nil, errors.New("field data out of bounds")
+			}
+			field.data, data = data[:value], data[value:]
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// decodePacked decodes a packed repeated integer field.
+func decodePacked(data []byte) ([]uint64, error) {
+	var values []uint64
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid packed value")
+		}
+		values, data = append(values, value), data[n:]
+	}
+	return values, nil
+}
+
+// decodePprof decodes a gzipped pprof profile, resolving the functions of the
+// samples through their locations and the string table.
+func decodePprof(r io.Reader) (*pprofProfile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := decodeProto(blob)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		strings     []string
+		sampleTypes [][2]uint64
+		samples     [][2][]uint64 // Locations and values of every sample
+		locations   = make(map[uint64]uint64)
+		functions   = make(map[uint64]uint64)
+		defaultType uint64
+	)
+	for _, field := range fields {
+		var sub []protoField
+		switch field.tag {
+		case pprofProfileSampleType, pprofProfileSample, pprofProfileLocation, pprofProfileFunction:
+			if sub, err = decodeProto(field.data); err != nil {
+				return nil, err
+			}
+		}
+		switch field.tag {
+		case pprofProfileSampleType:
+			var typ [2]uint64
+			for _, f := range sub {
+				typ[f.tag-pprofValueTypeType] = f.value
+			}
+			sampleTypes = append(sampleTypes, typ)
+
+		case pprofProfileSample:
+			var sample [2][]uint64
+			for _, f := range sub {
+				if sample[f.tag-pprofSampleLocationID], err = decodePacked(f.data); err != nil {
+					return nil, err
+				}
+			}
+			samples = append(samples, sample)
+
+		case pprofProfileLocation:
+			var id, function uint64
+			for _, f := range sub {
+				switch f.tag {
+				case pprofLocationID:
+					id = f.value
+				case pprofLocationLine:
+					line, err := decodeProto(f.data)
+					if err != nil {
+						return nil, err
+					}
+					for _, f := range line {
+						if f.tag == pprofLineFunctionID {
+							function = f.value
+						}
+					}
+				}
+			}
+			locations[id] = function
+
+		case pprofProfileFunction:
+			var id, name uint64
+			for _, f := range sub {
+				switch f.tag {
+				case pprofFunctionID:
+					id = f.value
+				case pprofFunctionName:
+					name = f.value
+				}
+			}
+			functions[id] = name
+
+		case pprofProfileStringTable:
+			strings = append(strings, string(field.data))
+
+		case pprofProfileDefaultSampleType:
+			defaultType = field.value
+		}
+	}
+	str := func(id uint64) (string, error) {
+		if id >= uint64(len(strings)) {
+			return "", fmt.Errorf("string %d out of bounds", id)
+		}
+		return strings[id], nil
+	}
+	profile := new(pprofProfile)
+	for _, typ := range sampleTypes {
+		name, err := str(typ[0])
+		if err != nil {
+			return nil, err
+		}
+		unit, err := str(typ[1])
+		if err != nil {
+			return nil, err
+		}
+		profile.sampleTypes = append(profile.sampleTypes, [2]string{name, unit})
+	}
+	if profile.defaultSampleType, err = str(defaultType); err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		resolved := pprofSample{values: sample[1]}
+		for _, location := range sample[0] {
+			function, ok := locations[location]
+			if !ok {
+				return nil, fmt.Errorf("unknown location %d", location)
+			}
+			name, ok := functions[function]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %d", function)
+			}
+			s, err := str(name)
+			if err != nil {
+				return nil, err
+			}
+			resolved.stack = append(resolved.stack, s)
+		}
+		profile.samples = append(profile.samples, resolved)
+	}
+	return profile, nil
+}
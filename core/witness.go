@@ -0,0 +1,242 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+var (
+	// errWitnessNoParent is returned if a witness doesn't start with the header
+	// of the parent of the block it is verified against.
+	errWitnessNoParent = errors.New("witness missing parent header")
+
+	// errWitnessRoot is returned if the state of a witness isn't rooted in the
+	// state of the parent block.
+	errWitnessRoot = errors.New("witness state root mismatch")
+)
+
+// BlockWitness is everything needed to execute a block without access to the
+// chain it belongs to: the part of the parent state accessed by the block and
+// the ancestor headers looked up during execution.
+type BlockWitness struct {
+	Headers []*types.Header // Parent header followed by any older ancestor accessed
+	State   *state.Witness  // Part of the parent state accessed by the block
+}
+
+// Witness executes the block on top of the state of its parent like Process does,
+// recording everything accessed into a stateless witness. The state is read from
+// the given database, but none of the changes made by the block are written to
+// it.
+//
+// If the block fails to execute, the witness recorded up to the failure is still
+// returned along with the error, allowing the failure to be reproduced statelessly.
+func (p *StateProcessor) Witness(block *types.Block, db state.Database, cfg vm.Config) (*BlockWitness, error) {
+	parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	witnessdb, witness := state.NewWitnessDatabase(db, parent.Root)
+	statedb, err := state.New(parent.Root, witnessdb)
+	if err != nil {
+		return nil, err
+	}
+	chain := &witnessRecorder{
+		BlockChain: p.bc,
+		headers:    map[common.Hash]*types.Header{parent.Hash(): parent},
+	}
+	_, _, _, err = p.process(chain, block, statedb, cfg)
+	if err == nil {
+		// Hashing the post state may need to resolve further nodes to collapse
+		// the tries after deletions, record those too.
+		statedb.IntermediateRoot(p.config.IsEnabled(p.config.GetEIP161dTransition, block.Number()))
+	}
+	return &BlockWitness{
+		Headers: chain.recorded(),
+		State:   witness,
+	}, err
+}
+
+// badBlockWitness assembles the witness of a block rejected after executing it
+// on top of the given state, from the accesses made by that execution. As the
+// ancestors looked up by the block aren't known without re-executing it, all the
+// ones within reach of the BLOCKHASH opcode are included.
+func (bc *BlockChain) badBlockWitness(block *types.Block, statedb *state.StateDB) (*rawdb.BadBlockWitness, error) {
+	accessed, err := statedb.Witness()
+	if accessed == nil || err != nil {
+		return nil, err
+	}
+	witness := &rawdb.BadBlockWitness{Root: accessed.Root}
+	for header := bc.GetHeader(block.ParentHash(), block.NumberU64()-1); header != nil && len(witness.Headers) < 256; {
+		witness.Headers = append(witness.Headers, header)
+		if header.Number.Sign() == 0 {
+			break
+		}
+		header = bc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if len(witness.Headers) == 0 {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	for _, blob := range accessed.SortedNodes() {
+		witness.Nodes = append(witness.Nodes, blob)
+	}
+	for _, code := range accessed.SortedCodes() {
+		witness.Codes = append(witness.Codes, code)
+	}
+	return witness, nil
+}
+
+// VerifyWitness re-executes a block using nothing but the content of its witness,
+// ensuring that the witness is complete and that the block is valid on top of it.
+func VerifyWitness(config ctypes.ChainConfigurator, engine consensus.Engine, block *types.Block, witness *BlockWitness) error {
+	if len(witness.Headers) == 0 || witness.Headers[0].Hash() != block.ParentHash() {
+		return errWitnessNoParent
+	}
+	parent := witness.Headers[0]
+	if witness.State.Root != parent.Root {
+		return fmt.Errorf("%w: have %x, want %x", errWitnessRoot, witness.State.Root, parent.Root)
+	}
+	statedb, err := state.New(parent.Root, witness.State.Database())
+	if err != nil {
+		return err
+	}
+	chain := newWitnessChain(config, engine, witness.Headers)
+
+	processor := &StateProcessor{config: config, engine: engine}
+	receipts, _, usedGas, err := processor.process(chain, block, statedb, vm.Config{})
+	if err != nil {
+		return err
+	}
+	validator := &BlockValidator{config: config, engine: engine}
+	return validator.ValidateState(block, statedb, receipts, usedGas)
+}
+
+// witnessRecorder is a view of the blockchain recording all the headers looked
+// up during the processing of a block.
+type witnessRecorder struct {
+	*BlockChain
+
+	headers map[common.Hash]*types.Header
+	lock    sync.Mutex
+}
+
+// GetHeader retrieves a block header by hash and number, recording it.
+func (r *witnessRecorder) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := r.BlockChain.GetHeader(hash, number)
+	if header != nil {
+		r.lock.Lock()
+		r.headers[hash] = header
+		r.lock.Unlock()
+	}
+	return header
+}
+
+// GetHeaderByHash retrieves a block header by hash, recording it.
+func (r *witnessRecorder) GetHeaderByHash(hash common.Hash) *types.Header {
+	header := r.BlockChain.GetHeaderByHash(hash)
+	if header != nil {
+		r.lock.Lock()
+		r.headers[hash] = header
+		r.lock.Unlock()
+	}
+	return header
+}
+
+// recorded returns the recorded headers, newest first.
+func (r *witnessRecorder) recorded() []*types.Header {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	headers := make([]*types.Header, 0, len(r.headers))
+	for _, header := range r.headers {
+		headers = append(headers, header)
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Number.Cmp(headers[j].Number) > 0
+	})
+	return headers
+}
+
+// witnessChain is a chain consisting of the headers of a witness, serving the
+// header lookups of a block processed statelessly.
+type witnessChain struct {
+	config  ctypes.ChainConfigurator
+	engine  consensus.Engine
+	headers map[common.Hash]*types.Header
+	head    *types.Header
+}
+
+func newWitnessChain(config ctypes.ChainConfigurator, engine consensus.Engine, headers []*types.Header) *witnessChain {
+	chain := &witnessChain{
+		config:  config,
+		engine:  engine,
+		headers: make(map[common.Hash]*types.Header),
+		head:    headers[0],
+	}
+	for _, header := range headers {
+		chain.headers[header.Hash()] = header
+	}
+	return chain
+}
+
+// Config retrieves the chain configuration.
+func (c *witnessChain) Config() ctypes.ChainConfigurator { return c.config }
+
+// Engine retrieves the consensus engine.
+func (c *witnessChain) Engine() consensus.Engine { return c.engine }
+
+// CurrentHeader retrieves the parent of the block being processed.
+func (c *witnessChain) CurrentHeader() *types.Header { return c.head }
+
+// GetHeader retrieves a header of the witness by hash and number.
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByHash retrieves a header of the witness by hash.
+func (c *witnessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+
+// GetHeaderByNumber retrieves a header of the witness by number.
+func (c *witnessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for _, header := range c.headers {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// GetBlock always returns nil, as witnesses contain no block bodies.
+func (c *witnessChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that a witness recorded while processing a block is enough to execute
+// the block statelessly, and that incomplete witnesses are rejected.
+func TestBlockWitness(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+
+		// Stores the parent block hash in slot 0 and counts the calls in slot 1
+		contract = common.HexToAddress("0xaaaa")
+		code     = common.FromHex("4360019003406000556001546001016001550000")
+
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address:  {Balance: big.NewInt(1000000000000000)},
+				contract: {Balance: big.NewInt(0), Code: code},
+			},
+		}
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 4, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), contract, big.NewInt(0), 100000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+
+		tx, err = types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{byte(i)}, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	db := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(db, gspec)
+
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	block := blocks[len(blocks)-1]
+
+	processor := NewStateProcessor(gspec.Config, chain, engine)
+	witness, err := processor.Witness(block, chain.StateCache(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to record witness: %v", err)
+	}
+	if witness.Headers[0].Hash() != block.ParentHash() {
+		t.Fatalf("first witness header mismatch: have %x, want %x", witness.Headers[0].Hash(), block.ParentHash())
+	}
+	if slots, ok := witness.State.Accounts[contract]; !ok || len(slots) != 2 {
+		t.Fatalf("contract storage access mismatch: have %v, want 2 slots", slots)
+	}
+	if _, ok := witness.State.Codes[crypto.Keccak256Hash(code)]; !ok {
+		t.Fatalf("contract code missing from witness")
+	}
+	if err := VerifyWitness(gspec.Config, engine, block, witness); err != nil {
+		t.Fatalf("failed to verify witness: %v", err)
+	}
+	// The state of the chain must not have been touched by recording
+	if head := chain.CurrentBlock(); head.Hash() != block.Hash() {
+		t.Fatalf("chain head changed: have %x, want %x", head.Hash(), block.Hash())
+	}
+	// Dropping any node from the witness must fail the verification
+	for hash, blob := range witness.State.Nodes {
+		delete(witness.State.Nodes, hash)
+		if err := VerifyWitness(gspec.Config, engine, block, witness); err == nil {
+			t.Fatalf("verification succeeded without node %x", hash)
+		}
+		witness.State.Nodes[hash] = blob
+	}
+	// Verifying against the wrong block must fail
+	if err := VerifyWitness(gspec.Config, engine, blocks[len(blocks)-2], witness); err == nil {
+		t.Fatalf("verification succeeded for the wrong block")
+	}
+}
+
+// Tests that blocks rejected after execution are persisted with a witness built
+// from the state they accessed, which reproduces the rejection statelessly, while
+// blocks rejected before execution are persisted without one.
+func TestBadBlockWitness(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+
+		// Stores the parent block hash in slot 0 and counts the calls in slot 1
+		contract = common.HexToAddress("0xaaaa")
+		code     = common.FromHex("4360019003406000556001546001016001550000")
+
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address:  {Balance: big.NewInt(1000000000000000)},
+				contract: {Balance: big.NewInt(0), Code: code},
+			},
+		}
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 3, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), contract, big.NewInt(0), 100000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	db := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(db, gspec)
+
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks[:2]); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	corrupt := func(modify func(header *types.Header)) *types.Block {
+		header := types.CopyHeader(blocks[2].Header())
+		modify(header)
+		return types.NewBlockWithHeader(header).WithBody(blocks[2].Transactions(), blocks[2].Uncles())
+	}
+	// A block failing state validation is recorded with a replayable witness
+	bad := corrupt(func(header *types.Header) { header.Root = common.Hash{0x01} })
+	if _, err := chain.InsertChain(types.Blocks{bad}); err == nil {
+		t.Fatalf("block with invalid root accepted")
+	}
+	recorded := rawdb.ReadBadBlock(db, bad.Hash())
+	if recorded == nil || recorded.Witness == nil {
+		t.Fatalf("bad block witness not recorded")
+	}
+	if len(recorded.Witness.Headers) != 3 || recorded.Witness.Headers[0].Hash() != bad.ParentHash() {
+		t.Fatalf("witness headers mismatch: have %d headers", len(recorded.Witness.Headers))
+	}
+	witness := &BlockWitness{Headers: recorded.Witness.Headers, State: state.NewWitness(recorded.Witness.Root)}
+	for _, blob := range recorded.Witness.Nodes {
+		witness.State.Nodes[crypto.Keccak256Hash(blob)] = blob
+	}
+	for _, code := range recorded.Witness.Codes {
+		witness.State.Codes[crypto.Keccak256Hash(code)] = code
+	}
+	if err := VerifyWitness(gspec.Config, engine, bad, witness); err == nil || err.Error() != recorded.Reason {
+		t.Fatalf("replay error mismatch: have %v, want %q", err, recorded.Reason)
+	}
+	// Blocks failing header verification or being blacklisted are recorded
+	// without executing them
+	invalid := corrupt(func(header *types.Header) { header.GasLimit = 1 })
+	if _, err := chain.InsertChain(types.Blocks{invalid}); err == nil {
+		t.Fatalf("block with invalid header accepted")
+	}
+	banned := corrupt(func(header *types.Header) { header.Extra = []byte("banned") })
+	BadHashes[banned.Hash()] = true
+	defer delete(BadHashes, banned.Hash())
+
+	if _, err := chain.InsertChain(types.Blocks{banned}); err != ErrBlacklistedHash {
+		t.Fatalf("blacklisted block error mismatch: have %v, want %v", err, ErrBlacklistedHash)
+	}
+	for _, block := range []*types.Block{invalid, banned} {
+		if rawdb.ReadBadBlock(db, block.Hash()) == nil {
+			t.Fatalf("bad block %x not recorded", block.Hash())
+		}
+		if rawdb.ReadBadBlockWitness(db, block.Hash()) != nil {
+			t.Fatalf("witness recorded for block %x rejected before execution", block.Hash())
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"errors"
@@ -25,6 +26,7 @@ import (
 	"math/big"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -309,23 +312,68 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// GetAddressByHash is a debug API function that returns the address whose hash is
+// the given hashed account key of the state trie, if its preimage is known.
+func (api *PrivateDebugAPI) GetAddressByHash(ctx context.Context, hash common.Hash) (common.Address, error) {
+	preimage := rawdb.ReadPreimage(api.eth.ChainDb(), hash)
+	if preimage == nil {
+		return common.Address{}, errors.New("unknown preimage")
+	}
+	if len(preimage) != common.AddressLength {
+		return common.Address{}, fmt.Errorf("preimage is not an address: %#x", preimage)
+	}
+	return common.BytesToAddress(preimage), nil
+}
+
+// ReconcilePreimages starts checking in the background which accounts and storage
+// slots of the state at the given block (head by default) have no known preimage,
+// i.e. which of them a state dump would be unable to name. The progress can be
+// followed with PreimageCoverage.
+func (api *PrivateDebugAPI) ReconcilePreimages(ctx context.Context, number *rpc.BlockNumber) (*PreimageReport, error) {
+	header := api.eth.blockchain.CurrentHeader()
+	if number != nil && *number != rpc.LatestBlockNumber && *number != rpc.PendingBlockNumber {
+		if header = api.eth.blockchain.GetHeaderByNumber(uint64(*number)); header == nil {
+			return nil, fmt.Errorf("block #%d not found", *number)
+		}
+	}
+	if _, err := api.eth.blockchain.StateAt(header.Root); err != nil {
+		return nil, fmt.Errorf("state of block #%d unavailable: %v", header.Number, err)
+	}
+	if err := api.eth.preimages.start(header.Root); err != nil {
+		return nil, err
+	}
+	return api.eth.preimages.status(), nil
+}
+
+// PreimageCoverage returns the progress or the outcome of the latest preimage
+// reconciliation started with ReconcilePreimages.
+func (api *PrivateDebugAPI) PreimageCoverage(ctx context.Context) (*PreimageReport, error) {
+	if report := api.eth.preimages.status(); report != nil {
+		return report, nil
+	}
+	return nil, errors.New("no preimage reconciliation started")
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
-	Hash  common.Hash            `json:"hash"`
-	Block map[string]interface{} `json:"block"`
-	RLP   string                 `json:"rlp"`
+	Hash   common.Hash            `json:"hash"`
+	Block  map[string]interface{} `json:"block"`
+	RLP    string                 `json:"rlp"`
+	Reason string                 `json:"reason,omitempty"`
 }
 
 // GetBadBlocks returns a list of the last 'bad blocks' that the client has seen on the network
 // and returns them as a JSON list of block-hashes
 func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs, error) {
-	blocks := api.eth.BlockChain().BadBlocks()
-	results := make([]*BadBlockArgs, len(blocks))
+	bad := rawdb.ReadAllBadBlocks(api.eth.ChainDb())
+	results := make([]*BadBlockArgs, len(bad))
 
 	var err error
-	for i, block := range blocks {
+	for i, b := range bad {
+		block := b.Block
 		results[i] = &BadBlockArgs{
-			Hash: block.Hash(),
+			Hash:   block.Hash(),
+			Reason: b.Reason,
 		}
 		if rlpBytes, err := rlp.EncodeToBytes(block); err != nil {
 			results[i].RLP = err.Error() // Hacky, but hey, it works
@@ -382,20 +430,22 @@ const AccountRangeMaxResults = 256
 // AccountRange enumerates all accounts in the latest state
 func (api *PrivateDebugAPI) AccountRange(ctx context.Context, start *common.Hash, maxResults int) (AccountRangeResult, error) {
 	var statedb *state.StateDB
+	var release func()
 	var err error
 	block := api.eth.blockchain.CurrentBlock()
 
 	if len(block.Transactions()) == 0 {
-		statedb, err = api.computeStateDB(block, defaultTraceReexec)
+		statedb, release, err = api.computeStateDB(block, defaultTraceReexec)
 		if err != nil {
 			return AccountRangeResult{}, err
 		}
 	} else {
-		_, _, statedb, err = api.computeTxEnv(block.Hash(), len(block.Transactions())-1, 0)
+		_, _, statedb, release, err = api.computeTxEnv(block.Hash(), len(block.Transactions())-1, 0)
 		if err != nil {
 			return AccountRangeResult{}, err
 		}
 	}
+	defer release()
 
 	trie, err := statedb.Database().OpenTrie(block.Header().Root)
 	if err != nil {
@@ -420,10 +470,11 @@ type storageEntry struct {
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
 func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
-	_, _, statedb, err := api.computeTxEnv(blockHash, txIndex, 0)
+	_, _, statedb, release, err := api.computeTxEnv(blockHash, txIndex, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
+	defer release()
 	st := statedb.StorageTrie(contractAddress)
 	if st == nil {
 		return StorageRangeResult{}, fmt.Errorf("account %x doesn't exist", contractAddress)
@@ -454,6 +505,184 @@ func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeRes
 	return result, nil
 }
 
+// RangeProofResult is the result of a debug_getAccountRangeProof or
+// debug_getStorageRangeProof API call. The edge proofs contain the RLP encoded
+// trie nodes on the paths to the requested start of the range, which might not
+// exist, and to the last key of it, proving together with the leaves that the
+// range is complete (see trie.VerifyRangeProof).
+type RangeProofResult struct {
+	Root       common.Hash     `json:"root"`
+	Keys       []common.Hash   `json:"keys"`
+	Values     []hexutil.Bytes `json:"values"`
+	FirstProof rangeProofList  `json:"firstProof"`
+	LastProof  rangeProofList  `json:"lastProof"`
+	Next       *common.Hash    `json:"next"` // nil if the range includes the last key in the trie
+}
+
+// rangeProofList collects the RLP encoded trie nodes of a merkle proof.
+type rangeProofList []hexutil.Bytes
+
+func (l *rangeProofList) Put(key []byte, value []byte) error {
+	*l = append(*l, common.CopyBytes(value))
+	return nil
+}
+
+func (l *rangeProofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// GetAccountRangeProof returns a range of consecutive entries of the account trie
+// at the given block, starting at the given hashed address, along with the proofs
+// of its completeness.
+func (api *PrivateDebugAPI) GetAccountRangeProof(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, start common.Hash, maxResults int) (*RangeProofResult, error) {
+	statedb, header, err := api.eth.APIBackend.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	st, err := statedb.Database().OpenTrie(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	return rangeProof(st, start, maxResults)
+}
+
+// GetStorageRangeProof returns a range of consecutive entries of the storage trie
+// of an account at the given block, starting at the given hashed slot, along with
+// the proofs of its completeness.
+func (api *PrivateDebugAPI) GetStorageRangeProof(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, address common.Address, start common.Hash, maxResults int) (*RangeProofResult, error) {
+	statedb, _, err := api.eth.APIBackend.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	st := statedb.StorageTrie(address)
+	if st == nil {
+		return nil, fmt.Errorf("account %x doesn't exist", address)
+	}
+	return rangeProof(st, start, maxResults)
+}
+
+// rangeProof collects at most maxResults consecutive entries of a trie starting
+// at the given key, and proves the start of the range and its last entry.
+func rangeProof(st state.Trie, start common.Hash, maxResults int) (*RangeProofResult, error) {
+	if maxResults <= 0 || maxResults > AccountRangeMaxResults {
+		maxResults = AccountRangeMaxResults
+	}
+	result := &RangeProofResult{
+		Root:       st.Hash(),
+		Keys:       []common.Hash{},
+		Values:     []hexutil.Bytes{},
+		FirstProof: rangeProofList{},
+		LastProof:  rangeProofList{},
+	}
+	it := trie.NewIterator(st.NodeIterator(start.Bytes()))
+	for len(result.Keys) < maxResults && it.Next() {
+		result.Keys = append(result.Keys, common.BytesToHash(it.Key))
+		result.Values = append(result.Values, common.CopyBytes(it.Value))
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	if err := st.Prove(start.Bytes(), 0, &result.FirstProof); err != nil {
+		return nil, err
+	}
+	if len(result.Keys) == 0 {
+		return result, nil
+	}
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.Next = &next
+	}
+	if err := st.Prove(result.Keys[len(result.Keys)-1].Bytes(), 0, &result.LastProof); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BlockWitnessResult is the result of a debug_getBlockWitness API call.
+type BlockWitnessResult struct {
+	Headers  []*types.Header                  `json:"headers"`  // Parent header followed by the accessed ancestors
+	Root     common.Hash                      `json:"root"`     // State root of the parent block
+	Nodes    []hexutil.Bytes                  `json:"nodes"`    // Trie nodes accessed, ordered by hash
+	Codes    []hexutil.Bytes                  `json:"codes"`    // Contract codes accessed, ordered by hash
+	Accounts map[common.Address][]common.Hash `json:"accounts"` // Accounts and storage slots accessed
+	Size     int                              `json:"size"`     // Total size of the nodes and codes
+}
+
+// GetBlockWitness re-executes a block on top of the state of its parent and returns
+// the stateless witness of it: every trie node, contract code and header accessed.
+func (api *PrivateDebugAPI) GetBlockWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*BlockWitnessResult, error) {
+	block, err := api.eth.APIBackend.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not executable")
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	statedb, release, err := api.computeStateDB(parent, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	processor := core.NewStateProcessor(api.eth.blockchain.Config(), api.eth.blockchain, api.eth.engine)
+	witness, err := processor.Witness(block, statedb.Database(), vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	result := &BlockWitnessResult{
+		Headers:  witness.Headers,
+		Root:     witness.State.Root,
+		Nodes:    witness.State.SortedNodes(),
+		Codes:    witness.State.SortedCodes(),
+		Accounts: make(map[common.Address][]common.Hash),
+		Size:     witness.State.Size(),
+	}
+	for addr, slots := range witness.State.Accounts {
+		keys := make([]common.Hash, 0, len(slots))
+		for slot := range slots {
+			keys = append(keys, slot)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		result.Accounts[addr] = keys
+	}
+	return result, nil
+}
+
+// GetStateDiff re-executes a block on top of the state of its parent and returns
+// every account changed by it, with the pre and post values of its balance, nonce,
+// code and written storage slots.
+func (api *PrivateDebugAPI) GetStateDiff(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (state.StateDiff, error) {
+	block, err := api.eth.APIBackend.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not executable")
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	statedb, release, err := api.computeStateDB(parent, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	processor := core.NewStateProcessor(api.eth.blockchain.Config(), api.eth.blockchain, api.eth.engine)
+	return processor.StateDiff(block, statedb, vm.Config{})
+}
+
 // GetModifiedAccountsByNumber returns all accounts that have changed between the
 // two blocks specified. A change is defined as a difference in nonce, balance,
 // code hash, or storage hash.
@@ -0,0 +1,175 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the calls of a bundle see the state changes of the ones before them,
+// and that each call is attributed only the logs it emitted, even though all of
+// them are filed under the same empty transaction hash.
+func TestCallBundle(t *testing.T) {
+	eth := newTestCallBackend(t, 2)
+	defer eth.blockchain.Stop()
+
+	// The contract logs its counter in the first storage slot, then increments it
+	var (
+		sender   = common.Address{0x02}
+		contract = common.Address{0x01}
+		empty    = common.Address{0x03}
+		code     = hexutil.Bytes(common.FromHex("60005460005260206000a060005460010160005500"))
+		gas      = hexutil.Uint64(100000)
+	)
+	call := func(to *common.Address) ethapi.CallArgs {
+		return ethapi.CallArgs{From: &sender, To: to, Gas: &gas, GasPrice: new(hexutil.Big)}
+	}
+	calls := []ethapi.CallArgs{call(&contract), call(&contract), call(&empty), call(&contract)}
+	overrides := &ethapi.StateOverride{contract: {Code: &code}}
+
+	results, err := ethapi.DoCallBundle(context.Background(), eth.APIBackend, calls, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), overrides, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	want := []*big.Int{big.NewInt(0), big.NewInt(1), nil, big.NewInt(2)}
+	for i, res := range results {
+		if res.Failed {
+			t.Fatalf("call %d failed", i)
+		}
+		if want[i] == nil {
+			if len(res.Logs) != 0 {
+				t.Errorf("call %d: logs of other calls attributed: %v", i, res.Logs)
+			}
+			continue
+		}
+		if len(res.Logs) != 1 {
+			t.Fatalf("call %d: log count mismatch: have %d, want 1", i, len(res.Logs))
+		}
+		log := res.Logs[0]
+		if counter := new(big.Int).SetBytes(log.Data); counter.Cmp(want[i]) != 0 {
+			t.Errorf("call %d: logged counter mismatch: have %v, want %v", i, counter, want[i])
+		}
+		if log.TxIndex != uint(i) || log.Address != contract {
+			t.Errorf("call %d: log attribution mismatch: index %d, address %x", i, log.TxIndex, log.Address)
+		}
+	}
+	// A failing override must abort the bundle before running any of the calls
+	conflict := &ethapi.StateOverride{contract: {State: &map[common.Hash]common.Hash{}, StateDiff: &map[common.Hash]common.Hash{}}}
+	if _, err := ethapi.DoCallBundle(context.Background(), eth.APIBackend, calls, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), conflict, 0, nil); err == nil {
+		t.Fatalf("bundle executed with conflicting storage overrides")
+	}
+}
+
+// Tests that transactions missing from the lookup indices are reported with an
+// error naming the index tail if old blocks were unindexed, and as null otherwise.
+func TestTransactionIndexTail(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 8, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), vars.TxGas, nil, nil), types.HomesteadSigner{}, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	var (
+		old     = blocks[0].Transactions()[0].Hash()
+		recent  = blocks[7].Transactions()[0].Hash()
+		unknown = common.Hash{0x01}
+	)
+	for _, limit := range []uint64{0, 4} {
+		db := rawdb.NewMemoryDatabase()
+		core.MustCommitGenesis(db, gspec)
+
+		chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true, TxLookupLimit: limit}, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if n, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+		}
+		// Wait for the background indexer to settle on the tail
+		var tail uint64
+		if limit > 0 {
+			tail = uint64(len(blocks)) - limit + 1
+		}
+		for i := 0; chain.TxIndexTail() != tail; i++ {
+			if i == 100 {
+				t.Fatalf("limit %d: index tail mismatch: have %d, want %d", limit, chain.TxIndexTail(), tail)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		pool := core.NewTxPool(core.DefaultTxPoolConfig, gspec.Config, chain)
+
+		eth := &Ethereum{config: &Config{}, chainDb: db, blockchain: chain, txPool: pool, engine: ethash.NewFaker()}
+		eth.APIBackend = &EthAPIBackend{eth: eth}
+		api := ethapi.NewPublicTransactionPoolAPI(eth.APIBackend, new(ethapi.AddrLocker))
+
+		if tx, err := api.GetTransactionByHash(context.Background(), recent); tx == nil || err != nil {
+			t.Fatalf("limit %d: indexed transaction not found: %v", limit, err)
+		}
+		for _, hash := range []common.Hash{old, unknown} {
+			tx, err := api.GetTransactionByHash(context.Background(), hash)
+			if tx != nil && hash == unknown {
+				t.Fatalf("limit %d: unknown transaction found", limit)
+			}
+			if limit == 0 {
+				if err != nil {
+					t.Fatalf("limit %d: unexpected error for %x: %v", limit, hash, err)
+				}
+				continue
+			}
+			if tx != nil || err == nil || !strings.Contains(err.Error(), "from block #5 onward") {
+				t.Fatalf("limit %d: unindexed lookup mismatch for %x: have %v, %v", limit, hash, tx, err)
+			}
+			if _, err := api.GetTransactionReceipt(context.Background(), hash); err == nil {
+				t.Fatalf("limit %d: unindexed receipt lookup succeeded for %x", limit, hash)
+			}
+		}
+		pool.Stop()
+		chain.Stop()
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// StateDivergence describes the first point where the execution of a block on
+// the local node differs from its execution on a remote node.
+type StateDivergence struct {
+	TxIndex    int         `json:"txIndex"`    // Index of the first transaction with a differing post state
+	TxHash     common.Hash `json:"txHash"`     // Hash of the first transaction with a differing post state
+	LocalRoot  common.Hash `json:"localRoot"`  // Local state root after the transaction, zero if not executed
+	RemoteRoot common.Hash `json:"remoteRoot"` // Remote state root after the transaction, zero if not executed or unknown
+
+	Step    *int            `json:"step,omitempty"`    // Index of the first differing execution step, nil if the traces match
+	Account *common.Address `json:"account,omitempty"` // Contract executing at the differing step
+	Slot    *common.Hash    `json:"slot,omitempty"`    // Storage slot accessed or changed differently, if any
+
+	Local  *divergenceLog `json:"local,omitempty"`  // Local execution step at the divergence
+	Remote *divergenceLog `json:"remote,omitempty"` // Remote execution step at the divergence
+}
+
+// divergenceTrace is the execution trace of a transaction, as reported by the
+// struct logger of the local node or a remote one.
+type divergenceTrace struct {
+	Gas         uint64          `json:"gas"`
+	Failed      bool            `json:"failed"`
+	ReturnValue string          `json:"returnValue"`
+	StructLogs  []divergenceLog `json:"structLogs"`
+
+	contracts []common.Address // Contract executing each step, only known locally
+}
+
+// divergenceLog is a single execution step of a transaction, as reported by the
+// struct logger of the local node or a remote one.
+type divergenceLog struct {
+	Pc      uint64            `json:"pc"`
+	Op      string            `json:"op"`
+	Gas     uint64            `json:"gas"`
+	GasCost uint64            `json:"gasCost"`
+	Depth   int               `json:"depth"`
+	Stack   []string          `json:"stack,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// BisectStateDivergence re-executes a block, known good or bad, and compares its
+// execution with the one of a remote node over RPC, to find the first diverging
+// transaction, along with its first diverging step, account and storage slot.
+// The result is nil if the block executes identically on both nodes.
+//
+// If the remote node serves debug_intermediateRoots, the diverging transaction is
+// singled out by the state roots after each transaction and only its execution
+// is traced on both nodes, which the remote needs to serve debug_traceTransaction
+// for. Otherwise the block is sent to the remote to be traced as a whole with
+// debug_traceBlock, and the traces of all its transactions are compared. The
+// latter can't detect divergences leaving no trace in the execution, such as in
+// the gas refunds or the block rewards.
+func (api *PrivateDebugAPI) BisectStateDivergence(ctx context.Context, hash common.Hash, url string) (*StateDivergence, error) {
+	block := api.blockOrBadBlock(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	local, err := api.IntermediateRoots(ctx, hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var remote []common.Hash
+	if err := client.CallContext(ctx, &remote, "debug_intermediateRoots", hash); err != nil {
+		log.Debug("Remote intermediate roots unavailable, comparing block traces", "err", err)
+		return api.bisectByTraces(ctx, client, block, local)
+	}
+	return api.bisectByRoots(ctx, client, block, local, remote)
+}
+
+// bisectByRoots finds the first transaction of a block with a differing post state
+// root on the local and the remote node, and compares its traces on both.
+func (api *PrivateDebugAPI) bisectByRoots(ctx context.Context, client *rpc.Client, block *types.Block, local, remote []common.Hash) (*StateDivergence, error) {
+	index := -1
+	for i := range block.Transactions() {
+		if i >= len(local) || i >= len(remote) || local[i] != remote[i] {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+	tx := block.Transactions()[index]
+	config := &vm.LogConfig{DisableMemory: true}
+
+	localTraces, err := api.traceBlockTxs(ctx, block, index, index, config)
+	if err != nil {
+		return nil, err
+	}
+	remoteTrace := new(divergenceTrace)
+	if err := client.CallContext(ctx, remoteTrace, "debug_traceTransaction", tx.Hash(), &TraceConfig{LogConfig: config}); err != nil {
+		return nil, fmt.Errorf("remote trace unavailable: %v", err)
+	}
+	result := newStateDivergence(block, index, local, localTraces[index], remoteTrace)
+	if index < len(remote) {
+		result.RemoteRoot = remote[index]
+	}
+	return result, nil
+}
+
+// bisectByTraces traces a block on the local and the remote node, and compares
+// the traces of its transactions to find the first one executing differently.
+func (api *PrivateDebugAPI) bisectByTraces(ctx context.Context, client *rpc.Client, block *types.Block, local []common.Hash) (*StateDivergence, error) {
+	if len(block.Transactions()) == 0 {
+		return nil, nil
+	}
+	config := &vm.LogConfig{DisableMemory: true}
+
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	var remote []struct {
+		Result *divergenceTrace `json:"result"`
+		Error  string           `json:"error"`
+	}
+	if err := client.CallContext(ctx, &remote, "debug_traceBlock", hexutil.Bytes(blob), &TraceConfig{LogConfig: config}); err != nil {
+		return nil, fmt.Errorf("remote block trace unavailable: %v", err)
+	}
+	if len(remote) != len(block.Transactions()) {
+		return nil, fmt.Errorf("remote block trace has %d transactions, want %d", len(remote), len(block.Transactions()))
+	}
+	localTraces, err := api.traceBlockTxs(ctx, block, 0, len(block.Transactions())-1, config)
+	if err != nil {
+		return nil, err
+	}
+	remoteTraces := make([]*divergenceTrace, len(remote))
+	for i, trace := range remote {
+		if trace.Error != "" || trace.Result == nil {
+			// The remote failed to execute the transaction, compare with an empty trace
+			trace.Result = new(divergenceTrace)
+		}
+		remoteTraces[i] = trace.Result
+	}
+	index := firstTraceDivergence(localTraces, remoteTraces)
+	if index < 0 {
+		return nil, nil
+	}
+	return newStateDivergence(block, index, local, localTraces[index], remoteTraces[index]), nil
+}
+
+// newStateDivergence assembles the divergence found at the given transaction of a
+// block from its local and remote traces.
+func newStateDivergence(block *types.Block, index int, localRoots []common.Hash, local, remote *divergenceTrace) *StateDivergence {
+	result := &StateDivergence{
+		TxIndex: index,
+		TxHash:  block.Transactions()[index].Hash(),
+	}
+	if index < len(localRoots) {
+		result.LocalRoot = localRoots[index]
+	}
+	step, slot := firstLogDivergence(local.StructLogs, remote.StructLogs)
+	if step < 0 {
+		return result
+	}
+	result.Step, result.Slot = &step, slot
+	if step < len(local.StructLogs) {
+		result.Local = &local.StructLogs[step]
+	}
+	if step < len(remote.StructLogs) {
+		result.Remote = &remote.StructLogs[step]
+	}
+	if contracts := local.contracts; len(contracts) > 0 {
+		account := contracts[len(contracts)-1]
+		if step < len(contracts) {
+			account = contracts[step]
+		}
+		result.Account = &account
+	}
+	return result
+}
+
+// traceBlockTxs replays a block, known good or bad, up to the last given
+// transaction and traces the transactions from the first given one with the
+// struct logger. The traces are indexed by transaction, and alongside the logs
+// they hold the address of the contract executing each step.
+func (api *PrivateDebugAPI) traceBlockTxs(ctx context.Context, block *types.Block, first, last int, config *vm.LogConfig) ([]*divergenceTrace, error) {
+	traces := make([]*divergenceTrace, last+1)
+
+	err := api.replayBlock(ctx, block, defaultTraceReexec, func(i int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error) {
+		var (
+			tracer = &contractTracer{StructLogger: vm.NewStructLogger(config)}
+			cfg    vm.Config
+		)
+		if i >= first {
+			cfg = vm.Config{Debug: true, Tracer: tracer}
+		}
+		vmenv := vm.NewEVM(vmctx, statedb, api.eth.blockchain.Config(), cfg)
+
+		ret, gas, failed, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+		if err != nil {
+			return false, fmt.Errorf("transaction %#x failed: %v", block.Transactions()[i].Hash(), err)
+		}
+		statedb.Finalise(vmenv.ChainConfig().IsEnabled(vmenv.ChainConfig().GetEIP161dTransition, block.Number()))
+
+		traces[i] = &divergenceTrace{
+			Gas:         gas,
+			Failed:      failed,
+			ReturnValue: fmt.Sprintf("%x", ret),
+			StructLogs:  formatDivergenceLogs(tracer.StructLogs()),
+			contracts:   tracer.contracts,
+		}
+		return i < last, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// formatDivergenceLogs converts struct logs into the format reported over RPC.
+func formatDivergenceLogs(structLogs []vm.StructLog) []divergenceLog {
+	formatted := ethapi.FormatLogs(structLogs)
+
+	logs := make([]divergenceLog, len(formatted))
+	for i, l := range formatted {
+		logs[i] = divergenceLog{
+			Pc:      l.Pc,
+			Op:      l.Op,
+			Gas:     l.Gas,
+			GasCost: l.GasCost,
+			Depth:   l.Depth,
+		}
+		if l.Stack != nil {
+			logs[i].Stack = *l.Stack
+		}
+		if l.Storage != nil {
+			logs[i].Storage = *l.Storage
+		}
+	}
+	return logs
+}
+
+// contractTracer is a struct logger which also records the address of the contract
+// executing each logged step.
+type contractTracer struct {
+	*vm.StructLogger
+	contracts []common.Address
+}
+
+// CaptureState logs a new structured log message and records the executing contract.
+func (t *contractTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if err := t.StructLogger.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err); err != nil {
+		return err
+	}
+	t.contracts = append(t.contracts, contract.Address())
+	return nil
+}
+
+// firstTraceDivergence returns the index of the first transaction executing
+// differently in two lists of transaction traces, or -1 if they are identical.
+func firstTraceDivergence(local, remote []*divergenceTrace) int {
+	for i := 0; i < len(local) || i < len(remote); i++ {
+		if i >= len(local) || i >= len(remote) {
+			return i
+		}
+		l, r := local[i], remote[i]
+		if l.Gas != r.Gas || l.Failed != r.Failed || l.ReturnValue != r.ReturnValue {
+			return i
+		}
+		if step, _ := firstLogDivergence(l.StructLogs, r.StructLogs); step >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstLogDivergence returns the index of the first differing step of two execution
+// traces, or -1 if they are identical. If the divergence is caused by a storage
+// access, the accessed slot is returned too.
+func firstLogDivergence(local, remote []divergenceLog) (int, *common.Hash) {
+	for i := 0; i < len(local) || i < len(remote); i++ {
+		if i >= len(local) || i >= len(remote) {
+			return i, nil
+		}
+		l, r := local[i], remote[i]
+		if l.Pc == r.Pc && l.Op == r.Op && l.Gas == r.Gas && l.GasCost == r.GasCost && l.Depth == r.Depth &&
+			equalWords(l.Stack, r.Stack) && len(differingSlots(l.Storage, r.Storage)) == 0 {
+			continue
+		}
+		// Steps differ, blame the storage if it did or the preceding storage access
+		if slots := differingSlots(l.Storage, r.Storage); len(slots) > 0 {
+			return i, &slots[0]
+		}
+		if i > 0 && (local[i-1].Op == vm.SLOAD.String() || local[i-1].Op == vm.SSTORE.String()) {
+			if stack := local[i-1].Stack; len(stack) > 0 {
+				slot := common.HexToHash(stack[len(stack)-1])
+				return i, &slot
+			}
+		}
+		return i, nil
+	}
+	return -1, nil
+}
+
+// equalWords reports whether two lists of hex encoded words hold the same values,
+// regardless of prefixing and padding.
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// differingSlots returns the sorted storage slots having different values in the
+// two storage snapshots.
+func differingSlots(a, b map[string]string) []common.Hash {
+	normalize := func(storage map[string]string) map[string]string {
+		normalized := make(map[string]string, len(storage))
+		for key, value := range storage {
+			normalized[normalizeWord(key)] = normalizeWord(value)
+		}
+		return normalized
+	}
+	na, nb := normalize(a), normalize(b)
+
+	var slots []common.Hash
+	for key, value := range na {
+		if nb[key] != value {
+			slots = append(slots, common.HexToHash(key))
+		}
+	}
+	for key := range nb {
+		if _, ok := na[key]; !ok {
+			slots = append(slots, common.HexToHash(key))
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Big().Cmp(slots[j].Big()) < 0 })
+	return slots
+}
+
+// normalizeWord converts a hex encoded word to its minimal form.
+func normalizeWord(word string) string {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(word), "0x"), 16)
+	if !ok {
+		return word
+	}
+	return n.Text(16)
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the first diverging step of two execution traces is found, along
+// with the storage slot responsible for it.
+func TestFirstLogDivergence(t *testing.T) {
+	base := []divergenceLog{
+		{Pc: 0, Op: "PUSH1", Gas: 100, GasCost: 3, Depth: 1},
+		{Pc: 2, Op: "SLOAD", Gas: 97, GasCost: 800, Depth: 1, Stack: []string{"0000000000000000000000000000000000000000000000000000000000000005"}},
+		{Pc: 3, Op: "PUSH1", Gas: 60, GasCost: 3, Depth: 1, Stack: []string{"0000000000000000000000000000000000000000000000000000000000000001"}},
+		{Pc: 5, Op: "SSTORE", Gas: 57, GasCost: 20000, Depth: 1, Stack: []string{"01", "07"}, Storage: map[string]string{"07": "01"}},
+	}
+	copyLogs := func() []divergenceLog {
+		logs := make([]divergenceLog, len(base))
+		copy(logs, base)
+		return logs
+	}
+	// Identical traces, even if formatted differently, don't diverge
+	remote := copyLogs()
+	remote[1].Stack = []string{"0x5"}
+	if step, slot := firstLogDivergence(base, remote); step != -1 || slot != nil {
+		t.Fatalf("identical traces diverged: step %d, slot %v", step, slot)
+	}
+	// A value loaded differently blames the slot of the load
+	remote = copyLogs()
+	remote[2].Stack = []string{"0x2"}
+	step, slot := firstLogDivergence(base, remote)
+	if step != 2 || slot == nil || *slot != common.HexToHash("0x5") {
+		t.Fatalf("load divergence mismatch: have step %d, slot %v; want step 2, slot 0x5", step, slot)
+	}
+	// Storage written differently blames the written slot
+	remote = copyLogs()
+	remote[3].Storage = map[string]string{"0x7": "0x2"}
+	step, slot = firstLogDivergence(base, remote)
+	if step != 3 || slot == nil || *slot != common.HexToHash("0x7") {
+		t.Fatalf("store divergence mismatch: have step %d, slot %v; want step 3, slot 0x7", step, slot)
+	}
+	// Differing gas accounting is found without a slot
+	remote = copyLogs()
+	remote[1].GasCost = 200
+	if step, slot := firstLogDivergence(base, remote); step != 1 || slot != nil {
+		t.Fatalf("gas divergence mismatch: have step %d, slot %v; want step 1, no slot", step, slot)
+	}
+	// A shorter trace diverges where it ends
+	if step, _ := firstLogDivergence(base, base[:2]); step != 2 {
+		t.Fatalf("truncated trace divergence mismatch: have step %d, want 2", step)
+	}
+}
+
+// Tests that the first transaction executing differently in two lists of block
+// traces is found.
+func TestFirstTraceDivergence(t *testing.T) {
+	base := func() []*divergenceTrace {
+		return []*divergenceTrace{
+			{Gas: 21000},
+			{Gas: 30000, ReturnValue: "01", StructLogs: []divergenceLog{{Pc: 0, Op: "PUSH1", Gas: 100, GasCost: 3, Depth: 1}}},
+			{Gas: 25000, Failed: true},
+		}
+	}
+	if index := firstTraceDivergence(base(), base()); index != -1 {
+		t.Fatalf("identical traces diverged at transaction %d", index)
+	}
+	tests := []struct {
+		mutate func(traces []*divergenceTrace) []*divergenceTrace
+		want   int
+	}{
+		{func(traces []*divergenceTrace) []*divergenceTrace { traces[1].StructLogs[0].GasCost = 5; return traces }, 1},
+		{func(traces []*divergenceTrace) []*divergenceTrace { traces[1].ReturnValue = "02"; return traces }, 1},
+		{func(traces []*divergenceTrace) []*divergenceTrace { traces[2].Failed = false; return traces }, 2},
+		{func(traces []*divergenceTrace) []*divergenceTrace { traces[0].Gas = 21001; return traces }, 0},
+		{func(traces []*divergenceTrace) []*divergenceTrace { return traces[:2] }, 2},
+	}
+	for i, tt := range tests {
+		if index := firstTraceDivergence(base(), tt.mutate(base())); index != tt.want {
+			t.Errorf("test %d: divergence mismatch: have transaction %d, want %d", i, index, tt.want)
+		}
+	}
+}
+
+// divergingDebugAPI is a remote debug API only serving block traces, tampering
+// with the trace of a transaction.
+type divergingDebugAPI struct {
+	api    *PrivateDebugAPI
+	tamper func(results []*txTraceResult)
+}
+
+func (d *divergingDebugAPI) TraceBlock(ctx context.Context, blob hexutil.Bytes, config *TraceConfig) ([]*txTraceResult, error) {
+	results, err := d.api.TraceBlock(ctx, blob, config)
+	if err == nil && d.tamper != nil {
+		d.tamper(results)
+	}
+	return results, err
+}
+
+// Tests that state divergences are bisected from the block traces of a remote
+// node not serving intermediate roots.
+func TestBisectStateDivergenceByTraces(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		gspec    = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000000)},
+				// Increment slot 0: PUSH1 1 PUSH1 0 SLOAD ADD PUSH1 0 SSTORE STOP
+				contract: {Code: common.Hex2Bytes("600160005401600055" + "00"), Balance: big.NewInt(0)},
+			},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(db, gspec)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 1, func(i int, block *core.BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), contract, new(big.Int), 100000, big.NewInt(1), nil), signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	defer chain.Stop()
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	api := NewPrivateDebugAPI(&Ethereum{config: &Config{}, blockchain: chain, engine: ethash.NewFaker(), stateRegen: newStateRegen(chain, db)})
+
+	remote := &divergingDebugAPI{api: api}
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("debug", remote); err != nil {
+		t.Fatalf("failed to register remote API: %v", err)
+	}
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	// Identical executions don't diverge
+	hash := blocks[0].Hash()
+	result, err := api.BisectStateDivergence(context.Background(), hash, httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to bisect identical execution: %v", err)
+	}
+	if result != nil {
+		t.Fatalf("identical execution diverged: %+v", result)
+	}
+	// A different value loaded by the second transaction is pinned down
+	remote.tamper = func(results []*txTraceResult) {
+		stack := *results[1].Result.(*ethapi.ExecutionResult).StructLogs[3].Stack
+		stack[len(stack)-1] = "0x2a"
+	}
+	result, err = api.BisectStateDivergence(context.Background(), hash, httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to bisect diverging execution: %v", err)
+	}
+	if result == nil {
+		t.Fatalf("diverging execution not detected")
+	}
+	if result.TxIndex != 1 || result.TxHash != blocks[0].Transactions()[1].Hash() {
+		t.Errorf("transaction mismatch: have #%d %x, want #1", result.TxIndex, result.TxHash)
+	}
+	if result.Step == nil || *result.Step != 3 {
+		t.Errorf("step mismatch: have %v, want 3", result.Step)
+	}
+	if result.Account == nil || *result.Account != contract {
+		t.Errorf("account mismatch: have %v, want %x", result.Account, contract)
+	}
+	if result.Slot == nil || *result.Slot != (common.Hash{}) {
+		t.Errorf("slot mismatch: have %v, want %x", result.Slot, common.Hash{})
+	}
+}
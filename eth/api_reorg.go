@@ -0,0 +1,106 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// reorgChanSize is the size of channel listening to ChainReorgEvent.
+const reorgChanSize = 10
+
+// ReorgResult is a chain reorganisation recorded in the reorg journal.
+type ReorgResult struct {
+	Number    hexutil.Uint64 `json:"number"`           // Number of the common ancestor
+	Ancestor  common.Hash    `json:"ancestor"`         // Hash of the common ancestor
+	Depth     int            `json:"depth"`            // Number of blocks removed from the canonical chain
+	Dropped   []common.Hash  `json:"dropped"`          // Blocks removed from the canonical chain, newest first
+	Added     []common.Hash  `json:"added"`            // Blocks added to the canonical chain, newest first
+	TdDelta   *hexutil.Big   `json:"tdDelta"`          // Total difficulty of the new head minus that of the old one
+	Timestamp hexutil.Uint64 `json:"timestamp"`        // Unix timestamp of the reorg
+	Origin    string         `json:"origin,omitempty"` // Peer which supplied the new chain, if known
+}
+
+// newReorgResult converts a journaled reorg into its RPC representation.
+func newReorgResult(reorg *rawdb.Reorg) *ReorgResult {
+	return &ReorgResult{
+		Number:    hexutil.Uint64(reorg.Number),
+		Ancestor:  reorg.Ancestor,
+		Depth:     reorg.Depth(),
+		Dropped:   reorg.Dropped,
+		Added:     reorg.Added,
+		TdDelta:   (*hexutil.Big)(reorg.TdDelta),
+		Timestamp: hexutil.Uint64(reorg.Time),
+		Origin:    reorg.Origin,
+	}
+}
+
+// GetReorgs returns the chain reorganisations recorded with a common ancestor
+// between the two given block numbers, inclusive. With one parameter, all the
+// reorgs since the given block are returned.
+func (api *PrivateDebugAPI) GetReorgs(from uint64, to *uint64) ([]*ReorgResult, error) {
+	last := api.eth.blockchain.CurrentBlock().NumberU64()
+	if to != nil {
+		last = *to
+	}
+	if from > last {
+		return nil, fmt.Errorf("invalid range: %d > %d", from, last)
+	}
+	reorgs := rawdb.ReadReorgs(api.eth.ChainDb(), from, last)
+
+	results := make([]*ReorgResult, len(reorgs))
+	for i, reorg := range reorgs {
+		results[i] = newReorgResult(reorg)
+	}
+	return results, nil
+}
+
+// Reorgs creates a subscription that fires for every chain reorganisation, as
+// soon as it is recorded in the reorg journal.
+func (api *PrivateDebugAPI) Reorgs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		reorgs := make(chan core.ChainReorgEvent, reorgChanSize)
+		reorgsSub := api.eth.blockchain.SubscribeChainReorgEvent(reorgs)
+
+		for {
+			select {
+			case ev := <-reorgs:
+				notifier.Notify(rpcSub.ID, newReorgResult(ev.Reorg))
+			case <-rpcSub.Err():
+				reorgsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				reorgsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
@@ -29,6 +29,8 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 var dumper = spew.ConfigState{Indent: "    "}
@@ -245,3 +247,80 @@ func TestStorageRangeAt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that account range proofs can be paged through and verified against the
+// state root without trusting the returned leaves.
+func TestAccountRangeProof(t *testing.T) {
+	var (
+		statedb  = state.NewDatabase(rawdb.NewMemoryDatabase())
+		state, _ = state.New(common.Hash{}, statedb)
+	)
+	for i := 0; i < AccountRangeMaxResults*2+10; i++ {
+		state.SetBalance(common.BytesToAddress([]byte{byte(i >> 8), byte(i)}), big.NewInt(int64(i)+1))
+	}
+	root, _ := state.Commit(true)
+
+	st, err := statedb.OpenTrie(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		start common.Hash
+		total int
+	)
+	for page := 0; ; page++ {
+		result, err := rangeProof(st, start, AccountRangeMaxResults)
+		if err != nil {
+			t.Fatalf("page %d: failed to retrieve range proof: %v", page, err)
+		}
+		if result.Root != root {
+			t.Fatalf("page %d: root mismatch: have %x, want %x", page, result.Root, root)
+		}
+		keys := make([][]byte, len(result.Keys))
+		values := make([][]byte, len(result.Values))
+		for i := range result.Keys {
+			keys[i], values[i] = result.Keys[i].Bytes(), result.Values[i]
+		}
+		if err := trie.VerifyRangeProof(root, start.Bytes(), keys, values, proofDb(result.FirstProof), proofDb(result.LastProof)); err != nil {
+			t.Fatalf("page %d: failed to verify range proof: %v", page, err)
+		}
+		// Tampering with the range must be detected
+		if len(keys) > 2 {
+			if err := trie.VerifyRangeProof(root, start.Bytes(), append(keys[:1:1], keys[2:]...), append(values[:1:1], values[2:]...), proofDb(result.FirstProof), proofDb(result.LastProof)); err == nil {
+				t.Fatalf("page %d: gapped range verified", page)
+			}
+			if err := trie.VerifyRangeProof(root, start.Bytes(), keys[1:], values[1:], proofDb(result.FirstProof), proofDb(result.LastProof)); err == nil {
+				t.Fatalf("page %d: range without its leading key verified", page)
+			}
+		}
+		total += len(keys)
+		if result.Next == nil {
+			break
+		}
+		start = *result.Next
+	}
+	if total != AccountRangeMaxResults*2+10 {
+		t.Fatalf("account count mismatch: have %d, want %d", total, AccountRangeMaxResults*2+10)
+	}
+	// Ranges past the last account must be proven empty
+	start = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	result, err := rangeProof(st, start, AccountRangeMaxResults)
+	if err != nil {
+		t.Fatalf("failed to retrieve empty range proof: %v", err)
+	}
+	if len(result.Keys) != 0 {
+		t.Fatalf("empty range has %d keys", len(result.Keys))
+	}
+	if err := trie.VerifyRangeProof(root, start.Bytes(), nil, nil, proofDb(result.FirstProof), proofDb(result.LastProof)); err != nil {
+		t.Fatalf("failed to verify empty range proof: %v", err)
+	}
+}
+
+// proofDb creates a proof database out of a list of RLP encoded trie nodes.
+func proofDb(nodes rangeProofList) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
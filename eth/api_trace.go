@@ -0,0 +1,513 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// The trace types that can be requested from the replaying trace methods.
+const (
+	traceTypeTrace     = "trace"
+	traceTypeVMTrace   = "vmTrace"
+	traceTypeStateDiff = "stateDiff"
+)
+
+// maxTraceFilterRange is the maximum number of blocks trace_filter replays in a
+// single request.
+const maxTraceFilterRange = 100
+
+// LocalizedTrace is a Parity flat trace of a transaction or a block reward,
+// along with its position in the chain.
+type LocalizedTrace struct {
+	*tracers.ParityTrace
+	BlockHash           common.Hash  `json:"blockHash"`
+	BlockNumber         uint64       `json:"blockNumber"`
+	TransactionHash     *common.Hash `json:"transactionHash"`     // Nil for block rewards
+	TransactionPosition *uint64      `json:"transactionPosition"` // Nil for block rewards
+}
+
+// TraceResults are the traces of a replayed transaction or call, in the format
+// of Parity. Trace types that weren't requested are left nil.
+type TraceResults struct {
+	Output          hexutil.Bytes                         `json:"output"`
+	StateDiff       map[common.Address]*ParityAccountDiff `json:"stateDiff"`
+	Trace           []*tracers.ParityTrace                `json:"trace"`
+	VMTrace         *tracers.ParityVMTrace                `json:"vmTrace"`
+	TransactionHash *common.Hash                          `json:"transactionHash,omitempty"` // Only set when replaying blocks
+}
+
+// ParityAccountDiff is the change of a single account in the state diff format of
+// Parity. Each field is either "=" if unchanged, or an object keyed by "+" if the
+// account was created, "-" if it was deleted or "*" if the value was changed.
+type ParityAccountDiff struct {
+	Balance interface{}                 `json:"balance"`
+	Nonce   interface{}                 `json:"nonce"`
+	Code    interface{}                 `json:"code"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+// TraceFilterArgs are the criteria of the traces to return by trace_filter.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`   // First block to search, latest if nil
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`     // Last block to search, latest if nil
+	FromAddress []common.Address `json:"fromAddress"` // Senders to match, any if empty
+	ToAddress   []common.Address `json:"toAddress"`   // Recipients to match, any if empty
+	After       *hexutil.Uint64  `json:"after"`       // Number of matching traces to skip
+	Count       *hexutil.Uint64  `json:"count"`       // Maximum number of traces to return
+}
+
+// PrivateTraceAPI provides the Parity compatible trace methods, replaying the
+// transactions of the chain to trace them.
+type PrivateTraceAPI struct {
+	eth   *Ethereum
+	debug *PrivateDebugAPI
+}
+
+// NewPrivateTraceAPI creates a new API definition for the Parity compatible
+// trace methods of the Ethereum service.
+func NewPrivateTraceAPI(eth *Ethereum) *PrivateTraceAPI {
+	return &PrivateTraceAPI{eth: eth, debug: NewPrivateDebugAPI(eth)}
+}
+
+// blockByNumber retrieves a block by number, including the pending one.
+func (api *PrivateTraceAPI) blockByNumber(number rpc.BlockNumber) (*types.Block, error) {
+	var block *types.Block
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
+}
+
+// Block returns the flat call traces of all the transactions in a block, along
+// with the block rewards.
+func (api *PrivateTraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*LocalizedTrace, error) {
+	block, err := api.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// Transaction returns the flat call traces of a transaction.
+func (api *PrivateTraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*LocalizedTrace, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	msg, vmctx, statedb, release, err := api.debug.computeTxEnv(blockHash, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	res, err := api.traceMessage(ctx, msg, vmctx, statedb, []string{traceTypeTrace})
+	if err != nil {
+		return nil, err
+	}
+	return localizeTraces(res.Trace, blockHash, blockNumber, tx.Hash(), index), nil
+}
+
+// Get returns the flat call trace of a transaction at the given trace address,
+// or nil if there is none.
+func (api *PrivateTraceAPI) Get(ctx context.Context, hash common.Hash, indices []hexutil.Uint64) (*LocalizedTrace, error) {
+	traces, err := api.Transaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, trace := range traces {
+		if len(trace.TraceAddress) != len(indices) {
+			continue
+		}
+		match := true
+		for i, index := range indices {
+			if trace.TraceAddress[i] != int(index) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return trace, nil
+		}
+	}
+	return nil, nil
+}
+
+// Filter returns the flat call traces and block rewards of a range of blocks
+// matching the given criteria.
+func (api *PrivateTraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*LocalizedTrace, error) {
+	from, to := rpc.LatestBlockNumber, rpc.LatestBlockNumber
+	if args.FromBlock != nil {
+		from = *args.FromBlock
+	}
+	if args.ToBlock != nil {
+		to = *args.ToBlock
+	}
+	first, err := api.blockByNumber(from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := api.blockByNumber(to)
+	if err != nil {
+		return nil, err
+	}
+	if first.NumberU64() > last.NumberU64() {
+		return nil, fmt.Errorf("invalid block range %d-%d", first.NumberU64(), last.NumberU64())
+	}
+	if last.NumberU64()-first.NumberU64() >= maxTraceFilterRange {
+		return nil, fmt.Errorf("block range %d-%d exceeds the maximum of %d blocks", first.NumberU64(), last.NumberU64(), maxTraceFilterRange)
+	}
+	var (
+		froms = make(map[common.Address]bool)
+		tos   = make(map[common.Address]bool)
+
+		skip    uint64
+		results = []*LocalizedTrace{}
+	)
+	for _, addr := range args.FromAddress {
+		froms[addr] = true
+	}
+	for _, addr := range args.ToAddress {
+		tos[addr] = true
+	}
+	if args.After != nil {
+		skip = uint64(*args.After)
+	}
+	for number := first.NumberU64(); number <= last.NumberU64(); number++ {
+		block := last
+		if number != last.NumberU64() {
+			if block = api.eth.blockchain.GetBlockByNumber(number); block == nil {
+				return nil, fmt.Errorf("block #%d not found", number)
+			}
+		}
+		traces, err := api.traceBlock(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range traces {
+			sender, recipient := traceParties(trace.ParityTrace)
+			if len(froms) > 0 && (sender == nil || !froms[*sender]) {
+				continue
+			}
+			if len(tos) > 0 && (recipient == nil || !tos[*recipient]) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			results = append(results, trace)
+			if args.Count != nil && uint64(len(results)) >= uint64(*args.Count) {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// ReplayTransaction replays a transaction, returning the requested trace types:
+// any of "trace", "vmTrace" and "stateDiff".
+func (api *PrivateTraceAPI) ReplayTransaction(ctx context.Context, hash common.Hash, traceTypes []string) (*TraceResults, error) {
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	msg, vmctx, statedb, release, err := api.debug.computeTxEnv(blockHash, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return api.traceMessage(ctx, msg, vmctx, statedb, traceTypes)
+}
+
+// ReplayBlockTransactions replays all the transactions of a block, returning the
+// requested trace types of each of them.
+func (api *PrivateTraceAPI) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*TraceResults, error) {
+	block, err := api.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	results := []*TraceResults{}
+	err = api.debug.replayBlock(ctx, block, defaultTraceReexec, func(index int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error) {
+		res, err := api.traceMessage(ctx, msg, vmctx, statedb, traceTypes)
+		if err != nil {
+			return false, err
+		}
+		hash := block.Transactions()[index].Hash()
+		res.TransactionHash = &hash
+		results = append(results, res)
+
+		statedb.Finalise(api.eth.blockchain.Config().IsEnabled(api.eth.blockchain.Config().GetEIP161dTransition, block.Number()))
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Call executes a message call on top of the given block, returning the requested
+// trace types.
+func (api *PrivateTraceAPI) Call(ctx context.Context, args ethapi.CallArgs, traceTypes []string, blockNrOrHash *rpc.BlockNumberOrHash) (*TraceResults, error) {
+	number := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		number = *blockNrOrHash
+	}
+	statedb, header, err := api.eth.APIBackend.CallStateAndHeader(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	msg := args.ToMessage(api.eth.APIBackend.RPCGasCap())
+	vmctx := core.NewEVMContext(msg, header, api.eth.blockchain, nil)
+
+	return api.traceMessage(ctx, msg, vmctx, statedb, traceTypes)
+}
+
+// traceBlock replays all the transactions of a block, returning their flat call
+// traces followed by the block rewards.
+func (api *PrivateTraceAPI) traceBlock(ctx context.Context, block *types.Block) ([]*LocalizedTrace, error) {
+	traces := []*LocalizedTrace{}
+	err := api.debug.replayBlock(ctx, block, defaultTraceReexec, func(index int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error) {
+		res, err := api.traceMessage(ctx, msg, vmctx, statedb, []string{traceTypeTrace})
+		if err != nil {
+			return false, err
+		}
+		traces = append(traces, localizeTraces(res.Trace, block.Hash(), block.NumberU64(), block.Transactions()[index].Hash(), uint64(index))...)
+
+		statedb.Finalise(api.eth.blockchain.Config().IsEnabled(api.eth.blockchain.Config().GetEIP161dTransition, block.Number()))
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(traces, api.traceRewards(block)...), nil
+}
+
+// traceRewards returns the reward traces of a block, as credited by ethash to
+// the coinbase of the block and to the coinbase of each of its uncles. Blocks
+// sealed by other engines aren't rewarded.
+func (api *PrivateTraceAPI) traceRewards(block *types.Block) []*LocalizedTrace {
+	if _, ok := api.eth.engine.(*ethash.Ethash); !ok {
+		return nil
+	}
+	minerReward, uncleRewards := ethash.BlockRewards(api.eth.blockchain.Config(), block.Header(), block.Uncles(), nil)
+
+	var traces []*LocalizedTrace
+	reward := func(author common.Address, kind string, value *big.Int) {
+		if value.Sign() == 0 {
+			return
+		}
+		traces = append(traces, &LocalizedTrace{
+			ParityTrace: &tracers.ParityTrace{
+				Action: &tracers.ParityRewardAction{
+					Author:     author,
+					RewardType: kind,
+					Value:      (*hexutil.Big)(new(big.Int).Set(value)),
+				},
+				Result:       json.RawMessage("null"),
+				TraceAddress: []int{},
+				Type:         "reward",
+			},
+			BlockHash:   block.Hash(),
+			BlockNumber: block.NumberU64(),
+		})
+	}
+	reward(block.Coinbase(), "block", minerReward)
+	for i, uncle := range block.Uncles() {
+		reward(uncle.Coinbase, "uncle", uncleRewards[i])
+	}
+	return traces
+}
+
+// traceMessage executes a message on top of the given state, collecting the
+// requested trace types.
+func (api *PrivateTraceAPI) traceMessage(ctx context.Context, msg core.Message, vmctx vm.Context, statedb *state.StateDB, traceTypes []string) (*TraceResults, error) {
+	var wantTrace, wantVMTrace, wantStateDiff bool
+	for _, kind := range traceTypes {
+		switch kind {
+		case traceTypeTrace:
+			wantTrace = true
+		case traceTypeVMTrace:
+			wantVMTrace = true
+		case traceTypeStateDiff:
+			wantStateDiff = true
+		default:
+			return nil, fmt.Errorf("unknown trace type %q", kind)
+		}
+	}
+	var (
+		config      = api.eth.blockchain.Config()
+		deleteEmpty = config.IsEnabled(config.GetEIP161dTransition, vmctx.BlockNumber)
+		tracer      = tracers.NewParityTracer(wantVMTrace)
+	)
+	if wantStateDiff {
+		// Flush all previous changes, the diff is computed against the trie
+		statedb.IntermediateRoot(deleteEmpty)
+		statedb.StartStateDiff()
+	}
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, defaultTraceTimeout)
+	go func() {
+		<-deadlineCtx.Done()
+		tracer.Stop(errors.New("execution timeout"))
+	}()
+	defer cancel()
+
+	vmenv := vm.NewEVM(vmctx, statedb, config, vm.Config{Debug: true, Tracer: tracer})
+	ret, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+	if err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	if err := tracer.Err(); err != nil {
+		return nil, err
+	}
+	results := &TraceResults{Output: ret}
+	if wantTrace {
+		results.Trace = tracer.Traces()
+	}
+	if wantVMTrace {
+		results.VMTrace = tracer.VMTrace()
+	}
+	if wantStateDiff {
+		statedb.Finalise(deleteEmpty)
+		diff, err := statedb.StateDiff()
+		if err != nil {
+			return nil, err
+		}
+		results.StateDiff = parityStateDiff(diff)
+	}
+	return results, nil
+}
+
+// localizeTraces attaches the position of a transaction to its traces.
+func localizeTraces(traces []*tracers.ParityTrace, blockHash common.Hash, blockNumber uint64, txHash common.Hash, txIndex uint64) []*LocalizedTrace {
+	localized := make([]*LocalizedTrace, len(traces))
+	for i, trace := range traces {
+		position := txIndex
+		localized[i] = &LocalizedTrace{
+			ParityTrace:         trace,
+			BlockHash:           blockHash,
+			BlockNumber:         blockNumber,
+			TransactionHash:     &txHash,
+			TransactionPosition: &position,
+		}
+	}
+	return localized
+}
+
+// traceParties returns the sender and the recipient of a trace, as matched by
+// trace_filter.
+func traceParties(trace *tracers.ParityTrace) (*common.Address, *common.Address) {
+	switch action := trace.Action.(type) {
+	case *tracers.ParityCallAction:
+		return &action.From, &action.To
+	case *tracers.ParityCreateAction:
+		if result, ok := trace.Result.(*tracers.ParityCreateResult); ok {
+			return &action.From, &result.Address
+		}
+		return &action.From, nil
+	case *tracers.ParitySuicideAction:
+		return &action.Address, &action.RefundAddress
+	case *tracers.ParityRewardAction:
+		return nil, &action.Author
+	}
+	return nil, nil
+}
+
+// parityStateDiff converts a state diff into the format of Parity.
+func parityStateDiff(diff state.StateDiff) map[common.Address]*ParityAccountDiff {
+	result := make(map[common.Address]*ParityAccountDiff, len(diff))
+	for addr, account := range diff {
+		var (
+			preBalance, postBalance = new(hexutil.Big), new(hexutil.Big)
+			preNonce, postNonce     hexutil.Uint64
+			preCode, postCode       = hexutil.Bytes{}, hexutil.Bytes{}
+		)
+		if account.Balance != nil {
+			preBalance, postBalance = account.Balance.Pre, account.Balance.Post
+		}
+		if account.Nonce != nil {
+			preNonce, postNonce = account.Nonce.Pre, account.Nonce.Post
+		}
+		if account.Code != nil {
+			preCode, postCode = account.Code.Pre, account.Code.Post
+		}
+		entry := &ParityAccountDiff{Storage: make(map[common.Hash]interface{})}
+		switch {
+		case account.Created:
+			entry.Balance = map[string]interface{}{"+": postBalance}
+			entry.Nonce = map[string]interface{}{"+": postNonce}
+			entry.Code = map[string]interface{}{"+": postCode}
+			for key, slot := range account.Storage {
+				entry.Storage[key] = map[string]interface{}{"+": slot.Post}
+			}
+		case account.Deleted:
+			entry.Balance = map[string]interface{}{"-": preBalance}
+			entry.Nonce = map[string]interface{}{"-": preNonce}
+			entry.Code = map[string]interface{}{"-": preCode}
+			for key, slot := range account.Storage {
+				entry.Storage[key] = map[string]interface{}{"-": slot.Pre}
+			}
+		default:
+			entry.Balance, entry.Nonce, entry.Code = "=", "=", "="
+			if account.Balance != nil {
+				entry.Balance = parityChange(preBalance, postBalance)
+			}
+			if account.Nonce != nil {
+				entry.Nonce = parityChange(preNonce, postNonce)
+			}
+			if account.Code != nil {
+				entry.Code = parityChange(preCode, postCode)
+			}
+			for key, slot := range account.Storage {
+				entry.Storage[key] = parityChange(slot.Pre, slot.Post)
+			}
+		}
+		result[addr] = entry
+	}
+	return result
+}
+
+// parityChange formats a changed value in the state diff format of Parity.
+func parityChange(from, to interface{}) interface{} {
+	return map[string]interface{}{"*": map[string]interface{}{"from": from, "to": to}}
+}
@@ -0,0 +1,356 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	traceTestKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	traceTestSender  = crypto.PubkeyToAddress(traceTestKey.PublicKey)
+	traceTestMiner   = common.Address{0xc0}
+	traceTestUncle   = common.Address{0x0c}
+	traceTestPayee   = common.Address{0xcc}
+	traceTestForward = common.HexToAddress("0xbb")
+
+	// Stores the call value in slot 0 and forwards 1 wei to traceTestForward
+	traceTestContract = common.Address{0xaa}
+	traceTestCode     = common.FromHex("346000556000600060006000600160bb5af15000")
+)
+
+// newTestTraceBackend creates an Ethereum service backed by a chain of the given
+// number of blocks. Block 1 calls the test contract, block 2 transfers ether to
+// the payee, block 3 includes a sibling of block 2 as uncle and the rest are
+// empty.
+func newTestTraceBackend(t *testing.T, blocks int) *Ethereum {
+	var (
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				traceTestSender:   {Balance: big.NewInt(1000000000000000)},
+				traceTestContract: {Balance: big.NewInt(1000), Code: traceTestCode},
+			},
+		}
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+		db      = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	generated, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, blocks, func(i int, block *core.BlockGen) {
+		block.SetCoinbase(traceTestMiner)
+
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			tx = types.NewTransaction(block.TxNonce(traceTestSender), traceTestContract, big.NewInt(10), 100000, big.NewInt(1), nil)
+		case 1:
+			tx = types.NewTransaction(block.TxNonce(traceTestSender), traceTestPayee, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil)
+		case 2:
+			uncle := block.PrevBlock(1).Header()
+			uncle.Extra = []byte("uncle")
+			uncle.Coinbase = traceTestUncle
+			block.AddUncle(uncle)
+		}
+		if tx != nil {
+			signed, err := types.SignTx(tx, signer, traceTestKey)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(signed)
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(generated); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	eth := &Ethereum{config: &Config{}, chainDb: db, blockchain: chain, engine: ethash.NewFaker(), stateRegen: newStateRegen(chain, db)}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	return eth
+}
+
+// Tests that the rewards of a block are traced for its miner and for the miners
+// of its uncles, as credited by the consensus engine.
+func TestTraceRewards(t *testing.T) {
+	eth := newTestTraceBackend(t, 3)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateTraceAPI(eth)
+
+	block := eth.blockchain.GetBlockByNumber(3)
+	if len(block.Uncles()) != 1 {
+		t.Fatalf("uncle count mismatch: have %d, want 1", len(block.Uncles()))
+	}
+	var (
+		base  = ctypes.EthashBlockReward(eth.blockchain.Config(), block.Number())
+		miner = new(big.Int).Add(base, new(big.Int).Div(base, big.NewInt(32)))
+		uncle = new(big.Int).Div(new(big.Int).Mul(base, big.NewInt(7)), big.NewInt(8))
+	)
+	traces := api.traceRewards(block)
+	if len(traces) != 2 {
+		t.Fatalf("reward trace count mismatch: have %d, want 2", len(traces))
+	}
+	want := []*tracers.ParityRewardAction{
+		{Author: traceTestMiner, RewardType: "block", Value: (*hexutil.Big)(miner)},
+		{Author: traceTestUncle, RewardType: "uncle", Value: (*hexutil.Big)(uncle)},
+	}
+	for i, trace := range traces {
+		if !reflect.DeepEqual(trace.Action, want[i]) {
+			t.Errorf("reward %d mismatch: have %+v, want %+v", i, trace.Action, want[i])
+		}
+		if trace.BlockHash != block.Hash() || trace.TransactionHash != nil || trace.Type != "reward" {
+			t.Errorf("reward %d not localized to the block: %+v", i, trace)
+		}
+	}
+	// The rewards must add up to what the chain credited the miners with
+	statedb, _ := eth.blockchain.State()
+	if have := statedb.GetBalance(traceTestUncle); have.Cmp(uncle) != 0 {
+		t.Errorf("credited uncle reward mismatch: have %v, want %v", have, uncle)
+	}
+}
+
+// Tests that trace_filter returns the traces of a block range matching the given
+// criteria, paginated, and refuses ranges too long to replay.
+func TestTraceFilter(t *testing.T) {
+	eth := newTestTraceBackend(t, maxTraceFilterRange+1)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateTraceAPI(eth)
+
+	blockNumber := func(n int64) *rpc.BlockNumber {
+		number := rpc.BlockNumber(n)
+		return &number
+	}
+	filter := func(args TraceFilterArgs) []*LocalizedTrace {
+		traces, err := api.Filter(context.Background(), args)
+		if err != nil {
+			t.Fatalf("failed to filter traces: %v", err)
+		}
+		return traces
+	}
+	// Blocks 1 and 2 each have a transaction and a block reward, block 1 with a
+	// nested call, and block 3 the block and uncle rewards
+	traces := filter(TraceFilterArgs{FromBlock: blockNumber(1), ToBlock: blockNumber(3)})
+	if len(traces) != 7 {
+		t.Fatalf("trace count mismatch: have %d, want 7", len(traces))
+	}
+	kinds := []string{"call", "call", "reward", "call", "reward", "reward", "reward"}
+	for i, trace := range traces {
+		if trace.Type != kinds[i] {
+			t.Errorf("trace %d type mismatch: have %s, want %s", i, trace.Type, kinds[i])
+		}
+	}
+	if traces[1].TraceAddress[0] != 0 || *traces[1].TransactionPosition != 0 || traces[1].BlockNumber != 1 {
+		t.Errorf("nested call mislocated: %+v", traces[1])
+	}
+	// Filter by sender and by recipient
+	traces = filter(TraceFilterArgs{FromBlock: blockNumber(1), ToBlock: blockNumber(3), FromAddress: []common.Address{traceTestContract}})
+	if len(traces) != 1 || traces[0].Action.(*tracers.ParityCallAction).To != traceTestForward {
+		t.Fatalf("sender filter mismatch: %v", traces)
+	}
+	traces = filter(TraceFilterArgs{FromBlock: blockNumber(1), ToBlock: blockNumber(3), ToAddress: []common.Address{traceTestUncle, traceTestPayee}})
+	if len(traces) != 2 || traces[0].BlockNumber != 2 || traces[1].Action.(*tracers.ParityRewardAction).RewardType != "uncle" {
+		t.Fatalf("recipient filter mismatch: %v", traces)
+	}
+	// Paginate the miner rewards
+	after, count := hexutil.Uint64(1), hexutil.Uint64(1)
+	traces = filter(TraceFilterArgs{FromBlock: blockNumber(1), ToBlock: blockNumber(3), ToAddress: []common.Address{traceTestMiner}, After: &after, Count: &count})
+	if len(traces) != 1 || traces[0].BlockNumber != 2 {
+		t.Fatalf("paginated filter mismatch: %v", traces)
+	}
+	// The longest allowed range goes through, anything longer or inverted fails
+	if traces = filter(TraceFilterArgs{FromBlock: blockNumber(2), ToBlock: blockNumber(maxTraceFilterRange + 1)}); len(traces) != maxTraceFilterRange+2 {
+		t.Fatalf("maximum range trace count mismatch: have %d, want %d", len(traces), maxTraceFilterRange+2)
+	}
+	if _, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: blockNumber(1), ToBlock: blockNumber(maxTraceFilterRange + 1)}); err == nil {
+		t.Fatalf("filtered range beyond the maximum")
+	}
+	if _, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: blockNumber(3), ToBlock: blockNumber(2)}); err == nil {
+		t.Fatalf("filtered inverted range")
+	}
+}
+
+// Tests that replaying the transactions of a block returns the requested trace
+// types of each of them.
+func TestTraceReplayBlockTransactions(t *testing.T) {
+	eth := newTestTraceBackend(t, 3)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateTraceAPI(eth)
+
+	results, err := api.ReplayBlockTransactions(context.Background(), 1, []string{traceTypeTrace, traceTypeStateDiff})
+	if err != nil {
+		t.Fatalf("failed to replay block: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("result count mismatch: have %d, want 1", len(results))
+	}
+	res := results[0]
+	if hash := eth.blockchain.GetBlockByNumber(1).Transactions()[0].Hash(); res.TransactionHash == nil || *res.TransactionHash != hash {
+		t.Fatalf("transaction hash mismatch: have %v, want %x", res.TransactionHash, hash)
+	}
+	if len(res.Trace) != 2 || res.Trace[0].Subtraces != 1 || res.VMTrace != nil {
+		t.Fatalf("trace mismatch: %d traces, vm trace %v", len(res.Trace), res.VMTrace)
+	}
+	// The contract stored the call value and forwarded a wei to a new account
+	contract := res.StateDiff[traceTestContract]
+	if contract == nil {
+		t.Fatalf("contract missing from state diff")
+	}
+	slot := parityChange(common.Hash{}, common.BigToHash(big.NewInt(10)))
+	if !reflect.DeepEqual(contract.Storage[common.Hash{}], slot) || contract.Code != "=" {
+		t.Errorf("contract diff mismatch: %+v", contract)
+	}
+	forward := res.StateDiff[traceTestForward]
+	if forward == nil || !reflect.DeepEqual(forward.Balance, map[string]interface{}{"+": (*hexutil.Big)(big.NewInt(1))}) {
+		t.Errorf("forwarded account diff mismatch: %+v", forward)
+	}
+	if _, ok := res.StateDiff[traceTestSender]; !ok {
+		t.Errorf("sender missing from state diff")
+	}
+	// Block 2 replays with a VM trace only
+	if results, err = api.ReplayBlockTransactions(context.Background(), 2, []string{traceTypeVMTrace}); err != nil {
+		t.Fatalf("failed to replay block: %v", err)
+	}
+	if len(results) != 1 || results[0].VMTrace == nil || results[0].Trace != nil || results[0].StateDiff != nil {
+		t.Fatalf("vm trace result mismatch: %+v", results)
+	}
+	if _, err := api.ReplayBlockTransactions(context.Background(), 1, []string{"bogus"}); err == nil {
+		t.Fatalf("replayed block with unknown trace type")
+	}
+}
+
+// Tests that calls are traced on top of the requested block.
+func TestTraceCallParity(t *testing.T) {
+	eth := newTestTraceBackend(t, 3)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateTraceAPI(eth)
+
+	var (
+		gas   = hexutil.Uint64(100000)
+		value = (*hexutil.Big)(big.NewInt(7))
+		args  = ethapi.CallArgs{From: &traceTestSender, To: &traceTestContract, Gas: &gas, GasPrice: new(hexutil.Big), Value: value}
+	)
+	res, err := api.Call(context.Background(), args, []string{traceTypeTrace, traceTypeVMTrace, traceTypeStateDiff}, nil)
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	if len(res.Trace) != 2 || res.VMTrace == nil || len(res.VMTrace.Ops) == 0 {
+		t.Fatalf("trace mismatch: %d traces, vm trace %v", len(res.Trace), res.VMTrace)
+	}
+	action := res.Trace[0].Action.(*tracers.ParityCallAction)
+	if action.From != traceTestSender || action.To != traceTestContract || action.Value.ToInt().Int64() != 7 {
+		t.Errorf("call action mismatch: %+v", action)
+	}
+	// On top of block 1 the slot holds the previous call value
+	slot := parityChange(common.BigToHash(big.NewInt(10)), common.BigToHash(big.NewInt(7)))
+	if have := res.StateDiff[traceTestContract].Storage[common.Hash{}]; !reflect.DeepEqual(have, slot) {
+		t.Errorf("slot diff mismatch: have %v, want %v", have, slot)
+	}
+	// On top of the genesis the slot is set from zero
+	number := rpc.BlockNumberOrHashWithNumber(0)
+	if res, err = api.Call(context.Background(), args, []string{traceTypeStateDiff}, &number); err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	slot = parityChange(common.Hash{}, common.BigToHash(big.NewInt(7)))
+	if have := res.StateDiff[traceTestContract].Storage[common.Hash{}]; !reflect.DeepEqual(have, slot) {
+		t.Errorf("genesis slot diff mismatch: have %v, want %v", have, slot)
+	}
+}
+
+// Tests the conversion of state diffs into the format of Parity.
+func TestParityStateDiff(t *testing.T) {
+	var (
+		created   = common.Address{0x01}
+		deleted   = common.Address{0x02}
+		changed   = common.Address{0x03}
+		untouched = common.Address{0x04}
+	)
+	diff := state.StateDiff{
+		created: {
+			Created: true,
+			Balance: &state.BalanceDiff{Pre: (*hexutil.Big)(big.NewInt(0)), Post: (*hexutil.Big)(big.NewInt(5))},
+			Storage: map[common.Hash]*state.StorageDiff{{0x01}: {Post: common.Hash{0x11}}},
+		},
+		deleted: {
+			Deleted: true,
+			Balance: &state.BalanceDiff{Pre: (*hexutil.Big)(big.NewInt(3)), Post: (*hexutil.Big)(big.NewInt(0))},
+			Nonce:   &state.NonceDiff{Pre: 2},
+			Code:    &state.CodeDiff{Pre: hexutil.Bytes{0x60}, Post: hexutil.Bytes{}},
+			Storage: map[common.Hash]*state.StorageDiff{{0x02}: {Pre: common.Hash{0x22}}},
+		},
+		changed: {
+			Nonce:   &state.NonceDiff{Pre: 1, Post: 2},
+			Storage: map[common.Hash]*state.StorageDiff{{0x03}: {Pre: common.Hash{0x33}, Post: common.Hash{0x34}}},
+		},
+		untouched: {},
+	}
+	result := parityStateDiff(diff)
+
+	want := map[common.Address]*ParityAccountDiff{
+		created: {
+			Balance: map[string]interface{}{"+": (*hexutil.Big)(big.NewInt(5))},
+			Nonce:   map[string]interface{}{"+": hexutil.Uint64(0)},
+			Code:    map[string]interface{}{"+": hexutil.Bytes{}},
+			Storage: map[common.Hash]interface{}{{0x01}: map[string]interface{}{"+": common.Hash{0x11}}},
+		},
+		deleted: {
+			Balance: map[string]interface{}{"-": (*hexutil.Big)(big.NewInt(3))},
+			Nonce:   map[string]interface{}{"-": hexutil.Uint64(2)},
+			Code:    map[string]interface{}{"-": hexutil.Bytes{0x60}},
+			Storage: map[common.Hash]interface{}{{0x02}: map[string]interface{}{"-": common.Hash{0x22}}},
+		},
+		changed: {
+			Balance: "=",
+			Nonce:   parityChange(hexutil.Uint64(1), hexutil.Uint64(2)),
+			Code:    "=",
+			Storage: map[common.Hash]interface{}{{0x03}: parityChange(common.Hash{0x33}, common.Hash{0x34})},
+		},
+		untouched: {Balance: "=", Nonce: "=", Code: "=", Storage: map[common.Hash]interface{}{}},
+	}
+	for addr, entry := range want {
+		if !reflect.DeepEqual(result[addr], entry) {
+			t.Errorf("account %x mismatch: have %+v, want %+v", addr, result[addr], entry)
+		}
+	}
+	if len(result) != len(want) {
+		t.Errorf("account count mismatch: have %d, want %d", len(result), len(want))
+	}
+}
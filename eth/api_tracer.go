@@ -62,6 +62,14 @@ type TraceConfig struct {
 	Reexec  *uint64
 }
 
+// TraceCallConfig holds extra parameters to the call tracing function, on top
+// of the ones of regular traces.
+type TraceCallConfig struct {
+	TraceConfig
+	StateOverrides *ethapi.StateOverride
+	BlockOverrides *ethapi.BlockOverrides
+}
+
 // StdTraceConfig holds extra parameters to standard-json trace functions.
 type StdTraceConfig struct {
 	*vm.LogConfig
@@ -414,6 +422,77 @@ func (api *PrivateDebugAPI) TraceBadBlock(ctx context.Context, hash common.Hash,
 	return nil, fmt.Errorf("bad block %#x not found", hash)
 }
 
+// IntermediateRoots executes a block, known good or bad, and returns the state
+// root after each of its transactions.
+func (api *PrivateDebugAPI) IntermediateRoots(ctx context.Context, hash common.Hash, config *TraceConfig) ([]common.Hash, error) {
+	block := api.blockOrBadBlock(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	var roots []common.Hash
+	err := api.replayBlock(ctx, block, reexec, func(index int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error) {
+		vmenv := vm.NewEVM(vmctx, statedb, api.eth.blockchain.Config(), vm.Config{})
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			return false, fmt.Errorf("transaction %#x failed: %v", block.Transactions()[index].Hash(), err)
+		}
+		roots = append(roots, statedb.IntermediateRoot(vmenv.ChainConfig().IsEnabled(vmenv.ChainConfig().GetEIP161dTransition, block.Number())))
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// blockOrBadBlock retrieves a block by hash, either from the chain or from the
+// recently seen bad blocks.
+func (api *PrivateDebugAPI) blockOrBadBlock(hash common.Hash) *types.Block {
+	if block := api.eth.blockchain.GetBlockByHash(hash); block != nil {
+		return block
+	}
+	for _, block := range api.eth.blockchain.BadBlocks() {
+		if block.Hash() == hash {
+			return block
+		}
+	}
+	return nil
+}
+
+// replayBlock regenerates the state of the parent of a block and invokes fn with
+// the execution environment of each transaction in turn. fn is responsible for
+// applying the transaction to the state, and may stop the replay by returning
+// false.
+func (api *PrivateDebugAPI) replayBlock(ctx context.Context, block *types.Block, reexec uint64, fn func(index int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error)) error {
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	statedb, release, err := api.computeStateDB(parent, reexec)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	signer := types.MakeSigner(api.eth.blockchain.Config(), block.Number())
+	for i, tx := range block.Transactions() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+
+		msg, _ := tx.AsMessage(signer)
+		vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
+		if cont, err := fn(i, msg, vmctx, statedb); err != nil || !cont {
+			return err
+		}
+	}
+	return nil
+}
+
 // StandardTraceBlockToFile dumps the structured logs created during the
 // execution of EVM to the local file system and returns a list of files
 // to the caller.
@@ -454,10 +533,11 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	// Execute all the transaction contained within the block concurrently
 	var (
 		signer = types.MakeSigner(api.eth.blockchain.Config(), block.Number())
@@ -542,10 +622,11 @@ func (api *PrivateDebugAPI) standardTraceBlockToFile(ctx context.Context, block
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	// Retrieve the tracing configurations, or use default values
 	var (
 		logConfig vm.LogConfig
@@ -632,77 +713,186 @@ func containsTx(block *types.Block, hash common.Hash) bool {
 
 // computeStateDB retrieves the state database associated with a certain block.
 // If no state is locally available for the given block, a number of blocks are
-// attempted to be reexecuted to generate the desired state.
-func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, error) {
-	// If we have the state fully available, use that
-	statedb, err := api.eth.blockchain.StateAt(block.Root())
-	if err == nil {
-		return statedb, nil
-	}
-	// Otherwise try to reexec blocks until we find a state or reach our limit
-	origin := block.NumberU64()
-	database := state.NewDatabaseWithCache(api.eth.ChainDb(), 16)
-
-	for i := uint64(0); i < reexec; i++ {
-		block = api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
-		if block == nil {
-			break
-		}
-		if statedb, err = state.New(block.Root(), database); err == nil {
-			break
-		}
+// attempted to be reexecuted to generate the desired state. The returned release
+// function must be called once the state is no longer needed.
+func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, func(), error) {
+	return api.eth.stateRegen.StateAt(block, reexec)
+}
+
+// TraceTransaction returns the structured logs created during the execution of EVM
+// and returns them as a JSON object.
+func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Hash, config *TraceConfig) (interface{}, error) {
+	// Retrieve the transaction and assemble its EVM context
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
 	}
+	msg, vmctx, statedb, release, err := api.computeTxEnv(blockHash, int(index), reexec)
 	if err != nil {
-		switch err.(type) {
-		case *trie.MissingNodeError:
-			return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
-		default:
-			return nil, err
-		}
+		return nil, err
 	}
-	// State was available at historical point, regenerate
-	var (
-		start  = time.Now()
-		logged time.Time
-		proot  common.Hash
-	)
-	for block.NumberU64() < origin {
-		// Print progress logs if long enough time elapsed
-		if time.Since(logged) > 8*time.Second {
-			log.Info("Regenerating historical state", "block", block.NumberU64()+1, "target", origin, "remaining", origin-block.NumberU64()-1, "elapsed", time.Since(start))
-			logged = time.Now()
-		}
-		// Retrieve the next block to regenerate and process it
-		if block = api.eth.blockchain.GetBlockByNumber(block.NumberU64() + 1); block == nil {
-			return nil, fmt.Errorf("block #%d not found", block.NumberU64()+1)
-		}
-		_, _, _, err := api.eth.blockchain.Processor().Process(block, statedb, vm.Config{})
-		if err != nil {
-			return nil, fmt.Errorf("processing block %d failed: %v", block.NumberU64(), err)
-		}
-		// Finalize the state so any modifications are written to the trie
-		root, err := statedb.Commit(api.eth.blockchain.Config().IsEnabled(api.eth.blockchain.Config().GetEIP161dTransition, block.Number()))
-		if err != nil {
+	defer release()
+	// Trace the transaction and return
+	return api.traceTx(ctx, msg, vmctx, statedb, config)
+}
+
+// TraceCall lets you trace a given eth_call. It collects the structured logs
+// created during the execution of EVM if the given transaction was added on
+// top of the provided block and returns them as a JSON object. Both the state
+// the call runs on and the block context may be overridden beforehand.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
+	// Fetch the block that we want to trace on top of
+	block, err := api.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, release, err := api.computeStateDB(block, reexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Apply the customized state and block overrides, if any
+	var traceConfig *TraceConfig
+	if config != nil {
+		if err := config.StateOverrides.Apply(statedb); err != nil {
 			return nil, err
 		}
-		if err := statedb.Reset(root); err != nil {
-			return nil, fmt.Errorf("state reset after block %d failed: %v", block.NumberU64(), err)
-		}
-		database.TrieDB().Reference(root, common.Hash{})
-		if proot != (common.Hash{}) {
-			database.TrieDB().Dereference(proot)
+		traceConfig = &config.TraceConfig
+	}
+	msg := args.ToMessage(api.eth.APIBackend.RPCGasCap())
+	vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
+	if config != nil {
+		config.BlockOverrides.Apply(&vmctx)
+	}
+	return api.traceTx(ctx, msg, vmctx, statedb, traceConfig)
+}
+
+// blockByNumberOrHash retrieves the block with the given number or hash, also
+// accepting the pending and latest meta block numbers.
+func (api *PrivateDebugAPI) blockByNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		block := api.eth.blockchain.GetBlockByHash(hash)
+		if block == nil {
+			return nil, fmt.Errorf("block %#x not found", hash)
 		}
-		proot = root
+		return block, nil
+	}
+	number, ok := blockNrOrHash.Number()
+	if !ok {
+		return nil, errors.New("invalid arguments; neither block nor hash specified")
 	}
-	nodes, imgs := database.TrieDB().Size()
-	log.Info("Historical state regenerated", "block", block.NumberU64(), "elapsed", time.Since(start), "nodes", nodes, "preimages", imgs)
-	return statedb, nil
+	var block *types.Block
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
 }
 
-// TraceTransaction returns the structured logs created during the execution of EVM
-// and returns them as a JSON object.
-func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Hash, config *TraceConfig) (interface{}, error) {
-	// Retrieve the transaction and assemble its EVM context
+// AccessListResult is the set of accounts and storage slots touched by a call
+// or transaction, along with the gas it used.
+type AccessListResult struct {
+	AccessList []vm.AccessTuple `json:"accessList"`
+	GasUsed    hexutil.Uint64   `json:"gasUsed"`
+	Failed     bool             `json:"failed"`
+}
+
+// AccessList executes the given call on top of the provided block and returns
+// every account and storage slot it touched.
+func (api *PrivateDebugAPI) AccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash) (*AccessListResult, error) {
+	block, err := api.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	statedb, release, err := api.computeStateDB(block, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	msg := args.ToMessage(api.eth.APIBackend.RPCGasCap())
+	vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
+
+	return api.accessList(ctx, msg, vmctx, statedb)
+}
+
+// TransactionAccessList replays the given mined transaction and returns every
+// account and storage slot it touched.
+func (api *PrivateDebugAPI) TransactionAccessList(ctx context.Context, hash common.Hash) (*AccessListResult, error) {
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	msg, vmctx, statedb, release, err := api.computeTxEnv(blockHash, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return api.accessList(ctx, msg, vmctx, statedb)
+}
+
+// accessList executes the given message in the provided environment, recording
+// the accounts and storage slots touched.
+func (api *PrivateDebugAPI) accessList(ctx context.Context, message core.Message, vmctx vm.Context, statedb *state.StateDB) (*AccessListResult, error) {
+	tracer := vm.NewAccessListTracer()
+	vmenv := vm.NewEVM(vmctx, statedb, api.eth.blockchain.Config(), vm.Config{Debug: true, Tracer: tracer})
+
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, defaultTraceTimeout)
+	go func() {
+		<-deadlineCtx.Done()
+		vmenv.Cancel()
+	}()
+	defer cancel()
+
+	_, gas, failed, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
+	if err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	if vmenv.Cancelled() {
+		return nil, fmt.Errorf("execution aborted (timeout = %v)", defaultTraceTimeout)
+	}
+	return &AccessListResult{
+		AccessList: tracer.AccessList(),
+		GasUsed:    hexutil.Uint64(gas),
+		Failed:     failed,
+	}, nil
+}
+
+// ProfileConfig holds extra parameters to profiling functions.
+type ProfileConfig struct {
+	Pprof  bool // Whether to also write the profile in pprof format to a file
+	Reexec *uint64
+}
+
+// ProfileResult is the aggregated cost of the operations executed by a
+// transaction or a block, along with the pprof profile written, if requested.
+type ProfileResult struct {
+	*vm.Profile
+	PprofFile string `json:"pprofFile,omitempty"`
+}
+
+// ProfileTransaction replays the given mined transaction and returns the number
+// of executions, the gas used and the time spent per opcode, per contract and
+// per precompiled contract.
+func (api *PrivateDebugAPI) ProfileTransaction(ctx context.Context, hash common.Hash, config *ProfileConfig) (*ProfileResult, error) {
 	tx, blockHash, _, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
 	if tx == nil {
 		return nil, fmt.Errorf("transaction %#x not found", hash)
@@ -711,12 +901,86 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	msg, vmctx, statedb, err := api.computeTxEnv(blockHash, int(index), reexec)
+	msg, vmctx, statedb, release, err := api.computeTxEnv(blockHash, int(index), reexec)
 	if err != nil {
 		return nil, err
 	}
-	// Trace the transaction and return
-	return api.traceTx(ctx, msg, vmctx, statedb, config)
+	defer release()
+
+	profiler := vm.NewProfiler()
+	if err := api.profileMessage(ctx, profiler, msg, vmctx, statedb); err != nil {
+		return nil, err
+	}
+	return api.profileResult(profiler, config, fmt.Sprintf("profile_tx_%#x-", hash.Bytes()[:4]))
+}
+
+// ProfileBlock replays all the transactions of the given block and returns the
+// number of executions, the gas used and the time spent per opcode, per contract
+// and per precompiled contract, aggregated over the whole block.
+func (api *PrivateDebugAPI) ProfileBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, config *ProfileConfig) (*ProfileResult, error) {
+	block, err := api.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	profiler := vm.NewProfiler()
+	err = api.replayBlock(ctx, block, reexec, func(index int, msg core.Message, vmctx vm.Context, statedb *state.StateDB) (bool, error) {
+		if err := api.profileMessage(ctx, profiler, msg, vmctx, statedb); err != nil {
+			return false, fmt.Errorf("transaction %#x failed: %v", block.Transactions()[index].Hash(), err)
+		}
+		statedb.Finalise(api.eth.blockchain.Config().IsEnabled(api.eth.blockchain.Config().GetEIP161dTransition, block.Number()))
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return api.profileResult(profiler, config, fmt.Sprintf("profile_block_%#x-", block.Hash().Bytes()[:4]))
+}
+
+// profileMessage executes the given message in the provided environment,
+// accumulating the costs of its operations into the profiler.
+func (api *PrivateDebugAPI) profileMessage(ctx context.Context, profiler *vm.Profiler, message core.Message, vmctx vm.Context, statedb *state.StateDB) error {
+	vmenv := vm.NewEVM(vmctx, statedb, api.eth.blockchain.Config(), vm.Config{Debug: true, Tracer: profiler})
+
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, defaultTraceTimeout)
+	go func() {
+		<-deadlineCtx.Done()
+		vmenv.Cancel()
+	}()
+	defer cancel()
+
+	if _, _, _, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas())); err != nil {
+		return fmt.Errorf("profiling failed: %v", err)
+	}
+	if vmenv.Cancelled() {
+		return fmt.Errorf("execution aborted (timeout = %v)", defaultTraceTimeout)
+	}
+	return nil
+}
+
+// profileResult assembles the result of a profiling run, writing the pprof
+// profile to a temporary file with the given prefix if requested.
+func (api *PrivateDebugAPI) profileResult(profiler *vm.Profiler, config *ProfileConfig, prefix string) (*ProfileResult, error) {
+	result := &ProfileResult{Profile: profiler.Profile()}
+	if config == nil || !config.Pprof {
+		return result, nil
+	}
+	dump, err := ioutil.TempFile(os.TempDir(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+
+	if err := profiler.WritePprof(dump); err != nil {
+		return nil, err
+	}
+	log.Info("Wrote EVM profile", "file", dump.Name())
+	result.PprofFile = dump.Name()
+	return result, nil
 }
 
 // traceTx configures a new tracer according to the provided configuration, and
@@ -737,15 +1001,17 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer); err != nil {
+		// Constuct the native or JavaScript tracer to execute with
+		if native, ok := tracers.NewNative(*config.Tracer); ok {
+			tracer = native
+		} else if tracer, err = tracers.New(*config.Tracer); err != nil {
 			return nil, err
 		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			tracer.(interface{ Stop(error) }).Stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 
@@ -775,29 +1041,33 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	case *tracers.Tracer:
 		return tracer.GetResult()
 
+	case tracers.NativeTracer:
+		return tracer.GetResult()
+
 	default:
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
 	}
 }
 
-// computeTxEnv returns the execution environment of a certain transaction.
-func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
+// computeTxEnv returns the execution environment of a certain transaction. The
+// returned release function must be called once the state is no longer needed.
+func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, func(), error) {
 	// Create the parent state database
 	block := api.eth.blockchain.GetBlockByHash(blockHash)
 	if block == nil {
-		return nil, vm.Context{}, nil, fmt.Errorf("block %#x not found", blockHash)
+		return nil, vm.Context{}, nil, nil, fmt.Errorf("block %#x not found", blockHash)
 	}
 	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 	if parent == nil {
-		return nil, vm.Context{}, nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+		return nil, vm.Context{}, nil, nil, fmt.Errorf("parent %#x not found", block.ParentHash())
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
-		return nil, vm.Context{}, nil, err
+		return nil, vm.Context{}, nil, nil, err
 	}
 
 	if txIndex == 0 && len(block.Transactions()) == 0 {
-		return nil, vm.Context{}, statedb, nil
+		return nil, vm.Context{}, statedb, release, nil
 	}
 
 	// Recompute transactions up to the target index.
@@ -808,16 +1078,18 @@ func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, ree
 		msg, _ := tx.AsMessage(signer)
 		context := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 		if idx == txIndex {
-			return msg, context, statedb, nil
+			return msg, context, statedb, release, nil
 		}
 		// Not yet the searched for transaction, execute on top of the current state
 		vmenv := vm.NewEVM(context, statedb, api.eth.blockchain.Config(), vm.Config{})
 		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
-			return nil, vm.Context{}, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+			release()
+			return nil, vm.Context{}, nil, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
 		}
 		// Ensure any modifications are committed to the state
 		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
 		statedb.Finalise(vmenv.ChainConfig().IsEnabled(vmenv.ChainConfig().GetEIP161dTransition, block.Number()))
 	}
-	return nil, vm.Context{}, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, blockHash)
+	release()
+	return nil, vm.Context{}, nil, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, blockHash)
 }
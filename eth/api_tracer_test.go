@@ -0,0 +1,215 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTestCallBackend creates an Ethereum service backed by a chain of the given
+// number of empty blocks, sufficient to execute and trace calls on top of it.
+func newTestCallBackend(t *testing.T, blocks int) *Ethereum {
+	var (
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	generated, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, blocks, nil)
+	if n, err := chain.InsertChain(generated); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	eth := &Ethereum{config: &Config{}, blockchain: chain, engine: ethash.NewFaker(), stateRegen: newStateRegen(chain, db)}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	return eth
+}
+
+// Tests that calls are traced on top of the requested block, with the state and
+// the block context overridden beforehand.
+func TestTraceCall(t *testing.T) {
+	eth := newTestCallBackend(t, 2)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateDebugAPI(eth)
+
+	// The contract returns the block number plus its first storage slot
+	var (
+		contract = common.Address{0x01}
+		code     = hexutil.Bytes(common.FromHex("436000540160005260206000f3"))
+		diff     = map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5))}
+		gas      = hexutil.Uint64(100000)
+		args     = ethapi.CallArgs{To: &contract, Gas: &gas, GasPrice: new(hexutil.Big)}
+	)
+	trace := func(config *TraceCallConfig) (*ethapi.ExecutionResult, error) {
+		res, err := api.TraceCall(context.Background(), args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), config)
+		if err != nil {
+			return nil, err
+		}
+		return res.(*ethapi.ExecutionResult), nil
+	}
+	// Without overrides the call ends in an account without code
+	res, err := trace(nil)
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	if res.Failed || len(res.StructLogs) != 0 {
+		t.Fatalf("call to empty account traced: %+v", res)
+	}
+	// With the state overridden, the code runs against the latest block
+	stateOverrides := &ethapi.StateOverride{contract: {Code: &code, StateDiff: &diff}}
+	if res, err = trace(&TraceCallConfig{StateOverrides: stateOverrides}); err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	if want := fmt.Sprintf("%064x", 2+5); res.Failed || res.ReturnValue != want {
+		t.Fatalf("return value mismatch: have %s (failed %v), want %s", res.ReturnValue, res.Failed, want)
+	}
+	if len(res.StructLogs) != 9 {
+		t.Fatalf("struct log count mismatch: have %d, want 9", len(res.StructLogs))
+	}
+	if op := res.StructLogs[0].Op; op != "NUMBER" {
+		t.Fatalf("first traced op mismatch: have %s, want NUMBER", op)
+	}
+	// With the block overridden too, the code sees the overridden number
+	blockOverrides := &ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100))}
+	if res, err = trace(&TraceCallConfig{StateOverrides: stateOverrides, BlockOverrides: blockOverrides}); err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	if want := fmt.Sprintf("%064x", 100+5); res.ReturnValue != want {
+		t.Fatalf("return value mismatch with block overrides: have %s, want %s", res.ReturnValue, want)
+	}
+	// Conflicting storage overrides must be refused
+	conflict := &ethapi.StateOverride{contract: {Code: &code, State: &diff, StateDiff: &diff}}
+	if _, err := trace(&TraceCallConfig{StateOverrides: conflict}); err == nil {
+		t.Fatalf("call traced with conflicting storage overrides")
+	}
+}
+
+// Tests that the operations executed by a mined transaction are profiled per
+// opcode and per contract, and that the pprof profile is written on request.
+func TestProfileTransaction(t *testing.T) {
+	eth := newTestTraceBackend(t, 3)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateDebugAPI(eth)
+	tx := eth.blockchain.GetBlockByNumber(1).Transactions()[0]
+
+	res, err := api.ProfileTransaction(context.Background(), tx.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to profile transaction: %v", err)
+	}
+	// The test contract runs 13 operations, the call forwarding no code
+	want := map[string]uint64{"CALLVALUE": 1, "PUSH1": 7, "SSTORE": 1, "GAS": 1, "CALL": 1, "POP": 1, "STOP": 1}
+	if len(res.Ops) != len(want) {
+		t.Fatalf("opcode count mismatch: have %d, want %d", len(res.Ops), len(want))
+	}
+	for op, count := range want {
+		if entry := res.Ops[op]; entry == nil || entry.Count != count {
+			t.Errorf("%s: execution count mismatch: have %+v, want %d", op, entry, count)
+		}
+	}
+	if gas := res.Ops["PUSH1"].Gas; gas != 7*vm.GasFastestStep {
+		t.Errorf("PUSH1 gas mismatch: have %d, want %d", gas, 7*vm.GasFastestStep)
+	}
+	if gas := res.Ops["SSTORE"].Gas; gas != vars.SstoreSetGas {
+		t.Errorf("SSTORE gas mismatch: have %d, want %d", gas, vars.SstoreSetGas)
+	}
+	if len(res.Contracts) != 1 || res.Contracts[traceTestContract] == nil || res.Contracts[traceTestContract].Count != 13 {
+		t.Errorf("contract profile mismatch: %+v", res.Contracts)
+	}
+	if len(res.Precompiles) != 0 || res.PprofFile != "" {
+		t.Errorf("unexpected precompile profile or pprof file: %+v, %q", res.Precompiles, res.PprofFile)
+	}
+	// Requesting a pprof profile writes it to a file
+	if res, err = api.ProfileTransaction(context.Background(), tx.Hash(), &ProfileConfig{Pprof: true}); err != nil {
+		t.Fatalf("failed to profile transaction: %v", err)
+	}
+	defer os.Remove(res.PprofFile)
+
+	dump, err := os.Open(res.PprofFile)
+	if err != nil {
+		t.Fatalf("failed to open pprof profile: %v", err)
+	}
+	defer dump.Close()
+
+	if _, err := gzip.NewReader(dump); err != nil {
+		t.Errorf("invalid pprof profile: %v", err)
+	}
+	// Unknown transactions can't be profiled
+	if _, err := api.ProfileTransaction(context.Background(), common.Hash{0x01}, nil); err == nil {
+		t.Errorf("unknown transaction profiled")
+	}
+}
+
+// Tests that the operations executed by all the transactions of a block are
+// profiled together.
+func TestProfileBlock(t *testing.T) {
+	eth := newTestTraceBackend(t, 3)
+	defer eth.blockchain.Stop()
+
+	api := NewPrivateDebugAPI(eth)
+	profile := func(number int64) *ProfileResult {
+		res, err := api.ProfileBlock(context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(number)), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to profile: %v", number, err)
+		}
+		return res
+	}
+	// The block calling the test contract matches the profile of its transaction
+	tx := eth.blockchain.GetBlockByNumber(1).Transactions()[0]
+	want, err := api.ProfileTransaction(context.Background(), tx.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to profile transaction: %v", err)
+	}
+	res := profile(1)
+	if len(res.Ops) != len(want.Ops) {
+		t.Fatalf("opcode count mismatch: have %d, want %d", len(res.Ops), len(want.Ops))
+	}
+	for op, entry := range want.Ops {
+		if have := res.Ops[op]; have == nil || have.Count != entry.Count || have.Gas != entry.Gas {
+			t.Errorf("%s: profile mismatch: have %+v, want %+v", op, have, entry)
+		}
+	}
+	// Plain transfers and empty blocks execute no code at all
+	for _, number := range []int64{2, 3} {
+		if res := profile(number); len(res.Ops) != 0 || len(res.Contracts) != 0 {
+			t.Errorf("block %d: unexpected profile: %+v", number, res.Profile)
+		}
+	}
+	if _, err := api.ProfileBlock(context.Background(), rpc.BlockNumberOrHashWithNumber(10), nil); err == nil {
+		t.Errorf("unknown block profiled")
+	}
+}
@@ -58,7 +58,8 @@ var DefaultConfig = Config{
 		GasPrice: big.NewInt(vars.GWei),
 		Recommit: 3 * time.Second,
 	},
-	TxPool: core.DefaultTxPoolConfig,
+	TxPool:         core.DefaultTxPoolConfig,
+	RPCStateReexec: 128,
 	GPO: gasprice.Config{
 		Blocks:     20,
 		Percentile: 60,
@@ -100,6 +101,18 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
+	// HistoryLimit is the number of recent blocks to retain ancient bodies and
+	// receipts for. Older history is deleted from the freezer (0 = keep all).
+	HistoryLimit uint64 `toml:",omitempty"`
+
+	// TxLookupLimit is the number of recent blocks to maintain transaction lookup
+	// indices for. Older indices are deleted (0 = index the entire chain).
+	TxLookupLimit uint64 `toml:",omitempty"`
+
+	// ParallelExec enables the optimistic parallel execution of the transactions
+	// of imported blocks.
+	ParallelExec bool `toml:",omitempty"`
+
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
@@ -151,6 +164,10 @@ type Config struct {
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap *big.Int `toml:",omitempty"`
 
+	// RPCStateReexec is the number of blocks eth-call variants may re-execute to
+	// regenerate a pruned historical state (0 = disabled).
+	RPCStateReexec uint64
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *ctypes.TrustedCheckpoint `toml:",omitempty"`
 
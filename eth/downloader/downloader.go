@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -103,10 +104,11 @@ type Downloader struct {
 	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
 	mux  *event.TypeMux // Event multiplexer to announce sync operation events
 
-	checkpoint uint64   // Checkpoint block number to enforce head against (e.g. fast sync)
-	genesis    uint64   // Genesis block number to limit sync to (e.g. light client CHT)
-	queue      *queue   // Scheduler for selecting the hashes to download
-	peers      *peerSet // Set of active peers from which download can proceed
+	checkpoint     uint64      // Checkpoint block number to enforce head against (e.g. fast sync)
+	checkpointHash common.Hash // Checkpoint block hash to refuse contradicting chains with
+	genesis        uint64      // Genesis block number to limit sync to (e.g. light client CHT)
+	queue          *queue      // Scheduler for selecting the hashes to download
+	peers          *peerSet    // Set of active peers from which download can proceed
 
 	stateDB    ethdb.Database  // Database to state sync into (and deduplicate via)
 	stateBloom *trie.SyncBloom // Bloom filter for fast trie node existence checks
@@ -209,16 +211,26 @@ type BlockChain interface {
 	InsertReceiptChain(types.Blocks, []types.Receipts, uint64) (int, error)
 }
 
-// New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
+// New creates a new downloader to fetch hashes and blocks from remote peers. If
+// a trusted checkpoint is given, chains contradicting it are refused.
+func New(checkpoint *ctypes.TrustedCheckpoint, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
+	var (
+		checkpointNumber uint64
+		checkpointHash   common.Hash
+	)
+	if checkpoint != nil {
+		checkpointNumber = (checkpoint.SectionIndex+1)*vars.CHTFrequency - 1
+		checkpointHash = checkpoint.SectionHead
+	}
 	dl := &Downloader{
 		stateDB:        stateDb,
 		stateBloom:     stateBloom,
 		mux:            mux,
-		checkpoint:     checkpoint,
+		checkpoint:     checkpointNumber,
+		checkpointHash: checkpointHash,
 		queue:          newQueue(),
 		peers:          newPeerSet(),
 		rttEstimate:    uint64(rttMaxEstimate),
@@ -1452,6 +1464,11 @@ func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) er
 					limit = len(headers)
 				}
 				chunk := headers[:limit]
+
+				// Refuse any chain contradicting the trusted checkpoint
+				if err := d.verifyCheckpoint(chunk); err != nil {
+					return err
+				}
 				// In case of header only syncing, validate the chunk immediately
 				if d.mode == FastSync || d.mode == LightSync {
 					// Collect the yet unknown headers to mark them as uncertain
@@ -1534,6 +1551,23 @@ func (d *Downloader) processFullSyncContent() error {
 	}
 }
 
+// verifyCheckpoint ensures that a batch of contiguous headers doesn't contradict
+// the trusted checkpoint, if one is configured.
+func (d *Downloader) verifyCheckpoint(headers []*types.Header) error {
+	if d.checkpointHash == (common.Hash{}) || len(headers) == 0 {
+		return nil
+	}
+	first := headers[0].Number.Uint64()
+	if d.checkpoint < first || d.checkpoint >= first+uint64(len(headers)) {
+		return nil
+	}
+	if header := headers[d.checkpoint-first]; header.Hash() != d.checkpointHash {
+		log.Warn("Chain contradicts trusted checkpoint", "number", header.Number, "hash", header.Hash(), "want", d.checkpointHash)
+		return errInvalidChain
+	}
+	return nil
+}
+
 func (d *Downloader) importBlockResults(results []*fetchResult) error {
 	// Check for any early termination requests
 	if len(results) == 0 {
@@ -1550,9 +1584,15 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 		"firstnum", first.Number, "firsthash", first.Hash(),
 		"lastnum", last.Number, "lasthash", last.Hash(),
 	)
+	// Attribute the blocks to the master peer which supplied the chain
+	d.cancelLock.RLock()
+	origin := d.cancelPeer
+	d.cancelLock.RUnlock()
+
 	blocks := make([]*types.Block, len(results))
 	for i, result := range results {
 		blocks[i] = types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
+		blocks[i].ReceivedFrom = origin
 	}
 	if index, err := d.blockchain.InsertChain(blocks); err != nil {
 		if index < len(results) {
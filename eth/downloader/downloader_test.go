@@ -86,7 +86,7 @@ func newTester() *downloadTester {
 	tester.stateDb = rawdb.NewMemoryDatabase()
 	tester.stateDb.Put(testGenesis.Root().Bytes(), []byte{0x00})
 
-	tester.downloader = New(0, tester.stateDb, trie.NewSyncBloom(1, tester.stateDb), new(event.TypeMux), tester, nil, tester.dropPeer)
+	tester.downloader = New(nil, tester.stateDb, trie.NewSyncBloom(1, tester.stateDb), new(event.TypeMux), tester, nil, tester.dropPeer)
 	return tester
 }
 
@@ -1656,3 +1656,38 @@ func testCheckpointEnforcement(t *testing.T, protocol int, mode SyncMode) {
 		assertOwnChain(t, tester, chain.len())
 	}
 }
+
+// Tests that chains contradicting the trusted checkpoint are refused, while the
+// ones matching it are synchronised.
+func TestCheckpointContradiction64Full(t *testing.T)  { testCheckpointContradiction(t, 64, FullSync) }
+func TestCheckpointContradiction64Fast(t *testing.T)  { testCheckpointContradiction(t, 64, FastSync) }
+func TestCheckpointContradiction64Light(t *testing.T) { testCheckpointContradiction(t, 64, LightSync) }
+
+func testCheckpointContradiction(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	chain := testChainBase.shorten(blockCacheItems - 15)
+	checkpoint := uint64(chain.len() / 2)
+
+	for _, tt := range []struct {
+		hash common.Hash
+		err  error
+	}{
+		{common.Hash{0x01}, errInvalidChain},
+		{chain.chain[checkpoint], nil},
+	} {
+		tester := newTester()
+		tester.downloader.checkpoint, tester.downloader.checkpointHash = checkpoint, tt.hash
+		tester.newPeer("peer", protocol, chain)
+
+		if err := tester.sync("peer", nil, mode); err != tt.err {
+			t.Errorf("checkpoint %x: sync error mismatch: have %v, want %v", tt.hash, err, tt.err)
+		}
+		if tt.err == nil {
+			assertOwnChain(t, tester, chain.len())
+		} else if head := tester.downloader.lightchain.CurrentHeader().Number.Uint64(); head >= checkpoint {
+			t.Errorf("checkpoint %x: contradicting chain imported up to #%d", tt.hash, head)
+		}
+		tester.terminate()
+	}
+}
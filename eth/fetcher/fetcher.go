@@ -463,6 +463,7 @@ func (f *Fetcher) loop() {
 
 							block := types.NewBlockWithHeader(header)
 							block.ReceivedAt = task.time
+							block.ReceivedFrom = announce.origin
 
 							complete = append(complete, block)
 							f.completing[hash] = announce
@@ -530,6 +531,7 @@ func (f *Fetcher) loop() {
 							if f.getBlock(hash) == nil {
 								block := types.NewBlockWithHeader(announce.header).WithBody(task.transactions[i], task.uncles[i])
 								block.ReceivedAt = task.time
+								block.ReceivedFrom = announce.origin
 
 								blocks = append(blocks, block)
 							} else {
@@ -78,6 +78,8 @@ type ProtocolManager struct {
 	blockchain *core.BlockChain
 	maxPeers   int
 
+	historyTail func() uint64 // First block whose body and receipts can be served
+
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
@@ -110,6 +112,7 @@ func NewProtocolManager(config ctypes.ChainConfigurator, checkpoint *ctypes.Trus
 		eventMux:    mux,
 		txpool:      txpool,
 		blockchain:  blockchain,
+		historyTail: blockchain.HistoryTail,
 		peers:       newPeerSet(),
 		whitelist:   whitelist,
 		newPeerCh:   make(chan *peer),
@@ -153,7 +156,7 @@ func NewProtocolManager(config ctypes.ChainConfigurator, checkpoint *ctypes.Trus
 	if atomic.LoadUint32(&manager.fastSync) == 1 {
 		stateBloom = trie.NewSyncBloom(uint64(cacheLimit), chaindb)
 	}
-	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(checkpoint, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.removePeer)
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -533,6 +536,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			hash   common.Hash
 			bytes  int
 			bodies []rlp.RawValue
+			tail   = pm.historyTail()
 		)
 		for bytes < softResponseLimit && len(bodies) < downloader.MaxBlockFetch {
 			// Retrieve the hash of the next block
@@ -541,6 +545,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
+			// Bodies of pruned blocks are gone, skip them like unknown ones
+			if pm.historyPruned(hash, tail) {
+				p.Log().Trace("Peer requested pruned block bodies", "hash", hash, "tail", tail)
+				continue
+			}
 			// Retrieve the requested block body, stopping if enough was found
 			if data := pm.blockchain.GetBodyRLP(hash); len(data) != 0 {
 				bodies = append(bodies, data)
@@ -624,6 +633,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			hash     common.Hash
 			bytes    int
 			receipts []rlp.RawValue
+			tail     = pm.historyTail()
 		)
 		for bytes < softResponseLimit && len(receipts) < downloader.MaxReceiptFetch {
 			// Retrieve the hash of the next block
@@ -632,6 +642,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
+			// Receipts of pruned blocks are gone, skip them like unknown ones
+			if pm.historyPruned(hash, tail) {
+				p.Log().Trace("Peer requested pruned receipts", "hash", hash, "tail", tail)
+				continue
+			}
 			// Retrieve the requested block's receipts, skipping if unknown to us
 			results := pm.blockchain.GetReceiptsByHash(hash)
 			if results == nil {
@@ -823,6 +838,16 @@ func (pm *ProtocolManager) txBroadcastLoop() {
 	}
 }
 
+// historyPruned reports whether the body and receipts of the block with the
+// given hash were pruned, being older than the history tail.
+func (pm *ProtocolManager) historyPruned(hash common.Hash, tail uint64) bool {
+	if tail == 0 {
+		return false
+	}
+	header := pm.blockchain.GetHeaderByHash(hash)
+	return header != nil && header.Number.Uint64() < tail
+}
+
 // NodeInfo represents a short summary of the Ethereum sub-protocol metadata
 // known about the host peer.
 type NodeInfo struct {
@@ -831,16 +856,21 @@ type NodeInfo struct {
 	Genesis    common.Hash              `json:"genesis"`    // SHA3 hash of the host's genesis block
 	Config     ctypes.ChainConfigurator `json:"config"`     // Chain configuration for the fork rules
 	Head       common.Hash              `json:"head"`       // SHA3 hash of the host's best owned block
+
+	// TxIndexTail is the first block whose transactions can be looked up by hash,
+	// anything older was unindexed due to the configured lookup limit.
+	TxIndexTail uint64 `json:"txIndexTail,omitempty"`
 }
 
 // NodeInfo retrieves some protocol metadata about the running host node.
 func (pm *ProtocolManager) NodeInfo() *NodeInfo {
 	currentBlock := pm.blockchain.CurrentBlock()
 	return &NodeInfo{
-		Network:    pm.networkID,
-		Difficulty: pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64()),
-		Genesis:    pm.blockchain.Genesis().Hash(),
-		Config:     pm.blockchain.Config(),
-		Head:       currentBlock.Hash(),
+		Network:     pm.networkID,
+		Difficulty:  pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64()),
+		Genesis:     pm.blockchain.Genesis().Hash(),
+		Config:      pm.blockchain.Config(),
+		Head:        currentBlock.Hash(),
+		TxIndexTail: pm.blockchain.TxIndexTail(),
 	}
 }
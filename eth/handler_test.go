@@ -429,6 +429,54 @@ func testGetReceipt(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that block bodies and receipts older than the history tail are skipped
+// in responses like unknown ones, while the retained history is still served.
+func TestGetPrunedHistory63(t *testing.T) { testGetPrunedHistory(t, 63) }
+func TestGetPrunedHistory64(t *testing.T) { testGetPrunedHistory(t, 64) }
+
+func testGetPrunedHistory(t *testing.T, protocol int) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 16, nil, nil)
+	pm.historyTail = func() uint64 { return 8 }
+
+	peer, _ := newTestPeer("peer", protocol, pm, true)
+	defer peer.close()
+
+	// Interleave pruned and retained blocks, only the retained ones should be served
+	var (
+		hashes   []common.Hash
+		bodies   []*blockBody
+		receipts []types.Receipts
+	)
+	for _, number := range []uint64{12, 4, 8, 0, 7, 16} {
+		block := pm.blockchain.GetBlockByNumber(number)
+		hashes = append(hashes, block.Hash())
+		if number < 8 {
+			continue
+		}
+		bodies = append(bodies, &blockBody{Transactions: block.Transactions(), Uncles: block.Uncles()})
+		receipts = append(receipts, pm.blockchain.GetReceiptsByHash(block.Hash()))
+	}
+	p2p.Send(peer.app, 0x05, hashes)
+	if err := p2p.ExpectMsg(peer.app, 0x06, bodies); err != nil {
+		t.Errorf("bodies mismatch: %v", err)
+	}
+	p2p.Send(peer.app, 0x0f, hashes)
+	if err := p2p.ExpectMsg(peer.app, 0x10, receipts); err != nil {
+		t.Errorf("receipts mismatch: %v", err)
+	}
+	// Requests entirely within the pruned history should get nothing at all
+	pruned := []common.Hash{pm.blockchain.GetBlockByNumber(4).Hash(), pm.blockchain.GetBlockByNumber(7).Hash()}
+
+	p2p.Send(peer.app, 0x05, pruned)
+	if err := p2p.ExpectMsg(peer.app, 0x06, []*blockBody{}); err != nil {
+		t.Errorf("pruned bodies mismatch: %v", err)
+	}
+	p2p.Send(peer.app, 0x0f, pruned)
+	if err := p2p.ExpectMsg(peer.app, 0x10, []types.Receipts{}); err != nil {
+		t.Errorf("pruned receipts mismatch: %v", err)
+	}
+}
+
 // Tests that post eth protocol handshake, clients perform a mutual checkpoint
 // challenge to validate each other's chains. Hash mismatches, or missing ones
 // during a fast sync should lead to the peer getting dropped.
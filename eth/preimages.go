@@ -0,0 +1,161 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errReconcilerRunning is returned if a preimage reconciliation is requested
+	// while another one is still in progress.
+	errReconcilerRunning = errors.New("preimage reconciliation already running")
+
+	// errReconcilerStopped is returned by an aborted preimage reconciliation.
+	errReconcilerStopped = errors.New("preimage reconciliation stopped")
+)
+
+// PreimageReport is the progress or the outcome of a preimage reconciliation.
+type PreimageReport struct {
+	*state.PreimageCoverage
+	Running bool      `json:"running"`         // Whether the reconciliation is still in progress
+	Started time.Time `json:"started"`         // Time the reconciliation was started
+	Error   string    `json:"error,omitempty"` // Error the reconciliation was aborted with
+}
+
+// preimageReconciler walks a state in the background, checking which of its
+// hashed keys have a known preimage.
+type preimageReconciler struct {
+	db state.Database
+
+	lock   sync.Mutex
+	report *PreimageReport // Latest report, nil if never run
+	quit   chan struct{}   // Closed to abort the running reconciliation
+	wg     sync.WaitGroup
+}
+
+// newPreimageReconciler creates an idle preimage reconciler reading the state
+// through the given database.
+func newPreimageReconciler(db state.Database) *preimageReconciler {
+	return &preimageReconciler{db: db}
+}
+
+// start begins reconciling the state with the given root in the background.
+func (r *preimageReconciler) start(root common.Hash) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.report != nil && r.report.Running {
+		return errReconcilerRunning
+	}
+	r.report = &PreimageReport{
+		PreimageCoverage: &state.PreimageCoverage{Root: root},
+		Running:          true,
+		Started:          time.Now(),
+	}
+	r.quit = make(chan struct{})
+
+	r.wg.Add(1)
+	go r.run(root, r.quit)
+	return nil
+}
+
+// run walks the state, periodically publishing the progress.
+func (r *preimageReconciler) run(root common.Hash, quit chan struct{}) {
+	defer r.wg.Done()
+
+	log.Info("Reconciling state preimages", "root", root)
+
+	var (
+		start   = time.Now()
+		updated = time.Now()
+		logged  = time.Now()
+	)
+	coverage, err := state.CheckPreimages(r.db, root, func(coverage *state.PreimageCoverage) error {
+		select {
+		case <-quit:
+			return errReconcilerStopped
+		default:
+		}
+		if time.Since(updated) > time.Second {
+			r.lock.Lock()
+			r.report.PreimageCoverage = coverage.Copy()
+			r.lock.Unlock()
+			updated = time.Now()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Reconciling state preimages", "accounts", coverage.Accounts, "missing", coverage.MissingAccounts,
+				"slots", coverage.Slots, "missingslots", coverage.MissingSlots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		return nil
+	})
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if coverage != nil {
+		r.report.PreimageCoverage = coverage.Copy()
+	}
+	r.report.Running = false
+	if err != nil {
+		r.report.Error = err.Error()
+		log.Warn("Preimage reconciliation aborted", "root", root, "err", err)
+		return
+	}
+	context := []interface{}{
+		"root", root, "accounts", coverage.Accounts, "missing", coverage.MissingAccounts,
+		"slots", coverage.Slots, "missingslots", coverage.MissingSlots, "elapsed", common.PrettyDuration(time.Since(start)),
+	}
+	if coverage.MissingAccounts > 0 || coverage.MissingSlots > 0 {
+		log.Warn("State preimages incomplete", context...)
+	} else {
+		log.Info("State preimages complete", context...)
+	}
+}
+
+// status returns the latest reconciliation report, or nil if none was started.
+func (r *preimageReconciler) status() *PreimageReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.report == nil {
+		return nil
+	}
+	report := *r.report
+	return &report
+}
+
+// stop aborts any running reconciliation and waits for it to terminate.
+func (r *preimageReconciler) stop() {
+	r.lock.Lock()
+	if r.report != nil && r.report.Running {
+		select {
+		case <-r.quit:
+		default:
+			close(r.quit)
+		}
+	}
+	r.lock.Unlock()
+
+	r.wg.Wait()
+}
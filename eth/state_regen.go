@@ -0,0 +1,200 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// stateRegenCheckpoints is the number of regenerated state roots kept pinned in
+	// memory for subsequent requests to start from.
+	stateRegenCheckpoints = 128
+
+	// stateRegenInterval is the number of blocks between the intermediate state
+	// roots checkpointed while regenerating a historical state.
+	stateRegenInterval = 16
+
+	// stateRegenCache is the amount of memory (MB) allowed for caching clean trie
+	// nodes of the regenerated states.
+	stateRegenCache = 16
+)
+
+// stateRegen rebuilds historical states on demand for non-archive nodes by
+// re-executing blocks on top of the closest available ancestor state.
+//
+// All regenerated states share a single in-memory trie database. The roots of the
+// requested states, along with intermediate ones at regular intervals, are kept as
+// checkpoints in an LRU set, so that requests for nearby heights only need to
+// replay the few blocks since the closest checkpoint. Every state handed out holds
+// a reference to its root, preventing its eviction until released.
+type stateRegen struct {
+	chain    *core.BlockChain
+	database state.Database // Shared database holding the regenerated trie nodes
+
+	checkpoints *lru.Cache // Recently regenerated state roots, each holding a reference
+	lock        sync.Mutex // Serializes regenerations so nearby requests reuse each other's work
+}
+
+// newStateRegen creates a historical state regenerator on top of the given chain.
+func newStateRegen(chain *core.BlockChain, db ethdb.Database) *stateRegen {
+	r := &stateRegen{
+		chain:    chain,
+		database: state.NewDatabaseWithCache(db, stateRegenCache),
+	}
+	r.checkpoints, _ = lru.NewWithEvict(stateRegenCheckpoints, func(key, value interface{}) {
+		r.database.TrieDB().Dereference(key.(common.Hash))
+	})
+	return r
+}
+
+// StateAt returns the state of the given block, regenerating it from the closest
+// available ancestor state if it's not readily available. At most reexec blocks
+// are re-executed. The returned release function must be called once the state
+// is no longer used, allowing its trie nodes to be evicted.
+func (r *stateRegen) StateAt(block *types.Block, reexec uint64) (*state.StateDB, func(), error) {
+	// If we have the state fully available, use that
+	if statedb, err := r.chain.StateAt(block.Root()); err == nil {
+		return statedb, func() {}, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// If the state was regenerated recently, reuse it
+	if statedb, err := state.New(block.Root(), r.database); err == nil {
+		r.checkpoints.Get(block.Root())
+		return statedb, r.acquire(block.Root()), nil
+	}
+	// Otherwise find the closest ancestor with its state available, either from
+	// disk or from a previous regeneration
+	var (
+		origin  = block.NumberU64()
+		statedb *state.StateDB
+		err     error
+	)
+	for i := uint64(0); i < reexec; i++ {
+		block = r.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		if block == nil {
+			break
+		}
+		if statedb, err = state.New(block.Root(), r.database); err == nil {
+			r.checkpoints.Get(block.Root())
+			break
+		}
+	}
+	if err != nil {
+		switch err.(type) {
+		case *trie.MissingNodeError:
+			return nil, nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+		default:
+			return nil, nil, err
+		}
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+	}
+	// State was available at historical point, regenerate. Pin the starting state
+	// so that checkpointing can't evict it from underneath.
+	release := r.acquire(block.Root())
+	defer release()
+
+	var (
+		start  = time.Now()
+		logged time.Time
+		proot  common.Hash
+		triedb = r.database.TrieDB()
+		config = r.chain.Config()
+	)
+	for block.NumberU64() < origin {
+		// Print progress logs if long enough time elapsed
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Regenerating historical state", "block", block.NumberU64()+1, "target", origin, "remaining", origin-block.NumberU64()-1, "elapsed", time.Since(start))
+			logged = time.Now()
+		}
+		// Retrieve the next block to regenerate and process it
+		next := r.chain.GetBlockByNumber(block.NumberU64() + 1)
+		if next == nil {
+			return nil, nil, fmt.Errorf("block #%d not found", block.NumberU64()+1)
+		}
+		block = next
+		if _, _, _, err := r.chain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			return nil, nil, fmt.Errorf("processing block %d failed: %v", block.NumberU64(), err)
+		}
+		// Finalize the state so any modifications are written to the trie
+		root, err := statedb.Commit(config.IsEnabled(config.GetEIP161dTransition, block.Number()))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := statedb.Reset(root); err != nil {
+			return nil, nil, fmt.Errorf("state reset after block %d failed: %v", block.NumberU64(), err)
+		}
+		triedb.Reference(root, common.Hash{})
+		if proot != (common.Hash{}) {
+			triedb.Dereference(proot)
+		}
+		proot = root
+
+		// Checkpoint the intermediate and final states for later requests
+		if block.NumberU64()%stateRegenInterval == 0 || block.NumberU64() == origin {
+			r.checkpoint(root)
+		}
+	}
+	nodes, imgs := triedb.Size()
+	log.Info("Historical state regenerated", "block", block.NumberU64(), "elapsed", time.Since(start), "nodes", nodes, "preimages", imgs)
+
+	// Hand out the requested state with its own reference, dropping the one held
+	// by the regeneration loop
+	release = r.acquire(proot)
+	if proot != (common.Hash{}) {
+		triedb.Dereference(proot)
+	}
+	return statedb, release, nil
+}
+
+// checkpoint pins a regenerated state root in memory, evicting the least recently
+// used checkpoint if the limit is reached.
+func (r *stateRegen) checkpoint(root common.Hash) {
+	if r.checkpoints.Contains(root) {
+		r.checkpoints.Get(root)
+		return
+	}
+	r.database.TrieDB().Reference(root, common.Hash{})
+	r.checkpoints.Add(root, struct{}{})
+}
+
+// acquire references a state root in the shared trie database, returning the
+// function to release it with.
+func (r *stateRegen) acquire(root common.Hash) func() {
+	r.database.TrieDB().Reference(root, common.Hash{})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { r.database.TrieDB().Dereference(root) })
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that historical states are regenerated from the closest available state,
+// and that regenerated states are checkpointed for subsequent nearby requests.
+func TestStateRegeneration(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 64, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	// Fast import the chain, so that only the genesis state is available
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	defer chain.Stop()
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, 0); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	regen := newStateRegen(chain, db)
+
+	// check regenerates the state of a block and verifies its content
+	check := func(number uint64, reexec uint64) error {
+		block := blocks[number-1]
+		statedb, release, err := regen.StateAt(block, reexec)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		if root := statedb.IntermediateRoot(false); root != block.Root() {
+			t.Fatalf("block #%d: state root mismatch: have %x, want %x", number, root, block.Root())
+		}
+		if balance := statedb.GetBalance(common.Address{0x01}); balance.Uint64() != 1000*number {
+			t.Fatalf("block #%d: balance mismatch: have %v, want %d", number, balance, 1000*number)
+		}
+		return nil
+	}
+	if err := check(40, 32); err == nil {
+		t.Fatalf("regenerated state beyond the reexec limit")
+	}
+	if err := check(40, 64); err != nil {
+		t.Fatalf("failed to regenerate state: %v", err)
+	}
+	// Nearby states should be regenerated from the checkpoints
+	if err := check(45, 5); err != nil {
+		t.Fatalf("failed to regenerate state from checkpoint: %v", err)
+	}
+	if err := check(36, 4); err != nil {
+		t.Fatalf("failed to regenerate state from intermediate checkpoint: %v", err)
+	}
+	if err := check(40, 0); err != nil {
+		t.Fatalf("failed to reuse regenerated state: %v", err)
+	}
+	if err := check(60, 2); err == nil {
+		t.Fatalf("regenerated state beyond the reexec limit of the checkpoints")
+	}
+
+	// Only calls should regenerate states, and only if enabled
+	backend := &EthAPIBackend{eth: &Ethereum{config: &Config{}, blockchain: chain, stateRegen: regen}}
+	number := rpc.BlockNumberOrHashWithNumber(50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, _, err := backend.StateAndHeaderByNumberOrHash(ctx, number); err == nil {
+		t.Fatalf("regenerated state outside of a call")
+	}
+	if _, _, err := backend.CallStateAndHeader(ctx, number); err == nil {
+		t.Fatalf("regenerated state for call with regeneration disabled")
+	}
+	backend.eth.config.RPCStateReexec = 16
+	if _, _, err := backend.CallStateAndHeader(context.Background(), number); err == nil {
+		t.Fatalf("regenerated state for call that can't release it")
+	}
+	if statedb, _, err := backend.CallStateAndHeader(ctx, number); err != nil {
+		t.Fatalf("failed to regenerate state for call: %v", err)
+	} else if root := statedb.IntermediateRoot(false); root != blocks[49].Root() {
+		t.Fatalf("call state root mismatch: have %x, want %x", root, blocks[49].Root())
+	}
+}
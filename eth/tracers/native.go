@@ -0,0 +1,102 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// NativeTracer is a transaction tracer implemented in Go. Native tracers are drop
+// in replacements of the built in JavaScript tracers of the same name, producing
+// the same results without the overhead of the JavaScript VM.
+type NativeTracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON encoded result of the trace, or the error that
+	// interrupted it.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the trace, aborting the execution being traced. The given
+	// error is returned by GetResult.
+	Stop(err error)
+}
+
+// natives contains all the native tracer constructors by name.
+var natives = make(map[string]func() NativeTracer)
+
+// RegisterNative makes a native tracer available by name. Native tracers take
+// precedence over the JavaScript tracers of the same name.
+func RegisterNative(name string, ctor func() NativeTracer) {
+	natives[name] = ctor
+}
+
+// NewNative creates the native tracer registered with the given name, returning
+// false if there is none.
+func NewNative(name string) (NativeTracer, bool) {
+	ctor, ok := natives[name]
+	if !ok {
+		return nil, false
+	}
+	return ctor(), true
+}
+
+// nativeBase implements the interruption of native tracers.
+type nativeBase struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// Stop implements NativeTracer, terminating the trace at the next opcode.
+func (b *nativeBase) Stop(err error) {
+	b.reason = err
+	atomic.StoreUint32(&b.interrupt, 1)
+}
+
+// interrupted aborts the execution being traced if the trace was stopped.
+func (b *nativeBase) interrupted(env *vm.EVM) bool {
+	if atomic.LoadUint32(&b.interrupt) == 0 {
+		return false
+	}
+	env.Cancel()
+	return true
+}
+
+// stopped returns the reason the trace was stopped with, if any.
+func (b *nativeBase) stopped() error {
+	if atomic.LoadUint32(&b.interrupt) == 0 {
+		return nil
+	}
+	return b.reason
+}
+
+// memorySlice returns a copy of the memory between the given offsets, or nil if
+// it's out of bounds.
+func memorySlice(memory *vm.Memory, begin, end *big.Int) []byte {
+	if !begin.IsInt64() || !end.IsInt64() || begin.Cmp(end) > 0 {
+		return nil
+	}
+	if int64(memory.Len()) < end.Int64() {
+		log.Warn("Tracer accessed out of bound memory", "available", memory.Len(), "offset", begin, "size", new(big.Int).Sub(end, begin))
+		return nil
+	}
+	return memory.GetCopy(begin.Int64(), end.Int64()-begin.Int64())
+}
@@ -0,0 +1,297 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func init() {
+	RegisterNative("callTracer", func() NativeTracer { return newCallTracer() })
+}
+
+// callFrame is a single call reported by the call tracer. The exported fields are
+// the ones reported, the unexported ones track the call until it completes.
+type callFrame struct {
+	Type    string       `json:"type"`
+	From    string       `json:"from,omitempty"`
+	To      string       `json:"to,omitempty"`
+	Value   string       `json:"value,omitempty"`
+	Gas     string       `json:"gas,omitempty"`
+	GasUsed string       `json:"gasUsed,omitempty"`
+	Input   string       `json:"input,omitempty"`
+	Output  string       `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Time    string       `json:"time,omitempty"`
+	Calls   []*callFrame `json:"calls,omitempty"`
+
+	gas     *uint64  // Gas allowance of the call, if known
+	gasIn   uint64   // Gas available before the call opcode
+	gasCost uint64   // Gas cost of the call opcode
+	outOff  *big.Int // Memory offset of the call output
+	outLen  *big.Int // Length of the call output
+}
+
+// callTracer is the native version of the JavaScript callTracer, extracting and
+// reporting all the internal calls made by a transaction.
+type callTracer struct {
+	nativeBase
+
+	callstack []*callFrame // Current recursive call stack of the EVM execution
+	descended bool         // Whether we've just descended into an inner call
+
+	create bool // Context of the traced transaction, reported in the result
+	from   common.Address
+	to     common.Address
+	input  []byte
+	gas    uint64
+	value  *big.Int
+	output []byte
+	used   uint64
+	time   time.Duration
+	err    error
+}
+
+// newCallTracer creates a native call tracer.
+func newCallTracer() *callTracer {
+	return &callTracer{callstack: []*callFrame{{}}}
+}
+
+// hexBig formats a number the same way the JavaScript tracers do.
+func hexBig(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+// hexAddress formats an address the same way the JavaScript tracers do.
+func hexAddress(addr common.Address) string {
+	return hexutil.Encode(addr[:])
+}
+
+// isPrecompiled reports whether the address is a precompiled contract, using the
+// same precompile set as the JavaScript tracers.
+func isPrecompiled(addr common.Address) bool {
+	_, ok := vm.PrecompiledContractsForConfig(params.AllEthashProtocolChanges, big.NewInt(0))[addr]
+	return ok
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create, t.from, t.to, t.input, t.gas = create, from, to, common.CopyBytes(input), gas
+	t.value = new(big.Int)
+	if value != nil {
+		t.value.Set(value)
+	}
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.interrupted(env) {
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	peek := func(n int) *big.Int { return new(big.Int).Set(stack.Back(n)) }
+
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		// If a new contract is being created, add to the call stack
+		offset := peek(1)
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    hexAddress(contract.Address()),
+			Input:   hexutil.Encode(memorySlice(memory, offset, new(big.Int).Add(offset, stack.Back(2)))),
+			Value:   hexBig(peek(0)),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case vm.SELFDESTRUCT:
+		// If a contract is being self destructed, gather that as a subcall too
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{Type: op.String()})
+		return nil
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// Skip any pre-compile invocations, those are just fancy opcodes
+		to := common.BigToAddress(stack.Back(1))
+		if isPrecompiled(to) {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		offset := peek(2 + off)
+		call := &callFrame{
+			Type:    op.String(),
+			From:    hexAddress(contract.Address()),
+			To:      hexAddress(to),
+			Input:   hexutil.Encode(memorySlice(memory, offset, new(big.Int).Add(offset, stack.Back(3+off)))),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  peek(4 + off),
+			outLen:  peek(5 + off),
+		}
+		if off == 1 {
+			call.Value = hexBig(peek(2))
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve it's true allowance. Calls
+	// to plain accounts don't execute any code, so their allowance stays unknown.
+	if t.descended {
+		if depth >= len(t.callstack) {
+			allowance := gas
+			t.callstack[len(t.callstack)-1].gas = &allowance
+		}
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		ret := stack.Back(0)
+		if call.Type == vm.CREATE.String() || call.Type == vm.CREATE2.String() {
+			// If the call was a CREATE, retrieve the contract address and output code
+			used := new(big.Int).SetUint64(call.gasIn)
+			used.Sub(used, new(big.Int).SetUint64(call.gasCost))
+			used.Sub(used, new(big.Int).SetUint64(gas))
+			call.GasUsed = hexBig(used)
+
+			if ret.Sign() != 0 {
+				addr := common.BigToAddress(ret)
+				call.To = hexAddress(addr)
+				call.Output = hexutil.Encode(env.StateDB.GetCode(addr))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else if call.gas != nil {
+			// If the call was a contract call, retrieve the gas usage and output
+			used := new(big.Int).SetUint64(call.gasIn)
+			used.Sub(used, new(big.Int).SetUint64(call.gasCost))
+			used.Add(used, new(big.Int).SetUint64(*call.gas))
+			used.Sub(used, new(big.Int).SetUint64(gas))
+			call.GasUsed = hexBig(used)
+
+			if ret.Sign() != 0 {
+				end := new(big.Int).Add(call.outOff, call.outLen)
+				call.Output = hexutil.Encode(memorySlice(memory, call.outOff, end))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		if call.gas != nil {
+			call.Gas = hexBig(new(big.Int).SetUint64(*call.gas))
+		}
+		// Inject the call into the previous one
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.interrupted(env) {
+		return nil
+	}
+	t.fault(err)
+	return nil
+}
+
+// fault handles the failure of the topmost call.
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	// Pop off the just failed call, consuming all available gas
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	call.Error = err.Error()
+	if call.gas != nil {
+		call.Gas = hexBig(new(big.Int).SetUint64(*call.gas))
+		call.GasUsed = call.Gas
+	}
+	// Flatten the failed call into its parent, or leave it in the stack if it was
+	// the last one
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.output, t.used, t.time, t.err = common.CopyBytes(output), gasUsed, d, err
+	return nil
+}
+
+// GetResult returns the top level call with all the internal calls it made.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if err := t.stopped(); err != nil {
+		return nil, err
+	}
+	result := &callFrame{
+		Type:    vm.CALL.String(),
+		From:    hexAddress(t.from),
+		To:      hexAddress(t.to),
+		Value:   hexBig(t.value),
+		Gas:     hexBig(new(big.Int).SetUint64(t.gas)),
+		GasUsed: hexBig(new(big.Int).SetUint64(t.used)),
+		Input:   hexutil.Encode(t.input),
+		Output:  hexutil.Encode(t.output),
+		Time:    t.time.String(),
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.create {
+		result.Type = vm.CREATE.String()
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.err != nil {
+		result.Error = t.err.Error()
+	}
+	if result.Error != "" {
+		result.Output = ""
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,599 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+func init() {
+	RegisterNative("parityTracer", func() NativeTracer { return NewParityTracer(false) })
+}
+
+// parityNull is the explicit null result of the Parity traces without one.
+var parityNull = json.RawMessage("null")
+
+// ParityTrace is a single call, contract creation, self destruct or reward in
+// the flat trace format of Parity.
+type ParityTrace struct {
+	Action       interface{} `json:"action"`           // One of the Parity*Action types
+	Result       interface{} `json:"result,omitempty"` // One of the Parity*Result types, omitted on failure
+	Error        string      `json:"error,omitempty"`  // Parity style error the call failed with
+	Subtraces    int         `json:"subtraces"`        // Number of direct subcalls
+	TraceAddress []int       `json:"traceAddress"`     // Path of the call within the call tree
+	Type         string      `json:"type"`             // Either call, create, suicide or reward
+}
+
+// ParityCallAction is the action of a Parity call trace.
+type ParityCallAction struct {
+	CallType string         `json:"callType"`
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	Value    *hexutil.Big   `json:"value"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	Input    hexutil.Bytes  `json:"input"`
+}
+
+// ParityCreateAction is the action of a Parity create trace.
+type ParityCreateAction struct {
+	From  common.Address `json:"from"`
+	Value *hexutil.Big   `json:"value"`
+	Gas   hexutil.Uint64 `json:"gas"`
+	Init  hexutil.Bytes  `json:"init"`
+}
+
+// ParitySuicideAction is the action of a Parity suicide trace.
+type ParitySuicideAction struct {
+	Address       common.Address `json:"address"`
+	RefundAddress common.Address `json:"refundAddress"`
+	Balance       *hexutil.Big   `json:"balance"`
+}
+
+// ParityRewardAction is the action of a Parity reward trace.
+type ParityRewardAction struct {
+	Author     common.Address `json:"author"`
+	RewardType string         `json:"rewardType"`
+	Value      *hexutil.Big   `json:"value"`
+}
+
+// ParityCallResult is the result of a successful Parity call trace.
+type ParityCallResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Output  hexutil.Bytes  `json:"output"`
+}
+
+// ParityCreateResult is the result of a successful Parity create trace.
+type ParityCreateResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Code    hexutil.Bytes  `json:"code"`
+	Address common.Address `json:"address"`
+}
+
+// ParityVMTrace is the Parity trace of the opcodes executed by a single call.
+type ParityVMTrace struct {
+	Code hexutil.Bytes `json:"code"`
+	Ops  []*ParityVMOp `json:"ops"`
+}
+
+// ParityVMOp is a single executed opcode of a Parity VM trace.
+type ParityVMOp struct {
+	Cost uint64         `json:"cost"`
+	Ex   *ParityVMExec  `json:"ex"` // Effects of the opcode, nil if it failed
+	PC   uint64         `json:"pc"`
+	Sub  *ParityVMTrace `json:"sub"` // Trace of the call made by the opcode, if any
+}
+
+// ParityVMExec is the effect of an executed opcode in a Parity VM trace.
+type ParityVMExec struct {
+	Mem   *ParityVMMem   `json:"mem"`
+	Push  []*hexutil.Big `json:"push"`
+	Store *ParityVMStore `json:"store"`
+	Used  uint64         `json:"used"` // Gas left after the opcode
+}
+
+// ParityVMMem is the memory written by an opcode in a Parity VM trace.
+type ParityVMMem struct {
+	Data hexutil.Bytes `json:"data"`
+	Off  uint64        `json:"off"`
+}
+
+// ParityVMStore is the storage slot written by an opcode in a Parity VM trace.
+type ParityVMStore struct {
+	Key *hexutil.Big `json:"key"`
+	Val *hexutil.Big `json:"val"`
+}
+
+// parityFrame tracks a call of the traced transaction until it completes.
+type parityFrame struct {
+	trace    *ParityTrace
+	children []*parityFrame
+
+	gas     uint64 // Gas given to the call, including any stipend
+	base    uint64 // Gas left to the caller while the call executes
+	started bool   // Whether any code was executed by the call
+	builtin bool   // Whether the call is to a precompiled contract
+	err     error  // Error the call failed with, if any
+	output  []byte // Data returned by the call
+
+	outOff *big.Int // Memory region the caller receives the output in
+	outLen *big.Int
+
+	vmTrace *ParityVMTrace // Opcodes executed by the call, if collected
+	pending *parityVMStep  // Last opcode executed, waiting for its effects
+}
+
+// parityVMStep is an executed opcode whose effects are only known once the
+// execution continues.
+type parityVMStep struct {
+	op      *ParityVMOp
+	left    uint64   // Gas left after the opcode, if it terminates the call
+	push    int      // Number of stack items pushed by the opcode
+	memOff  *big.Int // Memory region written by the opcode, if any
+	memSize *big.Int
+	store   *ParityVMStore
+}
+
+// ParityTracer is a native tracer producing the flat call traces and the VM
+// traces of Parity.
+type ParityTracer struct {
+	nativeBase
+
+	vmTrace bool           // Whether to collect the executed opcodes
+	frames  []*parityFrame // Calls currently executing, the transaction first
+	root    *parityFrame   // Transaction level call, once started
+	output  []byte         // Output of the transaction
+}
+
+// NewParityTracer creates a tracer collecting Parity flat call traces, along with
+// the VM trace if requested.
+func NewParityTracer(vmTrace bool) *ParityTracer {
+	return &ParityTracer{vmTrace: vmTrace}
+}
+
+// parityError converts an EVM error into its Parity counterpart.
+func parityError(err error) string {
+	msg := err.Error()
+	switch {
+	case err == vm.ErrOutOfGas, err == vm.ErrCodeStoreOutOfGas,
+		msg == "gas uint64 overflow", msg == "not enough gas for reentrancy sentry":
+		return "Out of gas"
+	case msg == "evm: execution reverted":
+		return "Reverted"
+	case msg == "evm: invalid jump destination":
+		return "Bad jump destination"
+	case msg == "evm: write protection":
+		return "Mutable Call In Static Context"
+	case msg == "evm: return data out of bounds":
+		return "Out of bounds"
+	case err == vm.ErrDepth, strings.HasPrefix(msg, "stack limit reached"):
+		return "Out of stack"
+	case strings.HasPrefix(msg, "stack underflow"):
+		return "Stack underflow"
+	case strings.HasPrefix(msg, "invalid opcode"):
+		return "Bad instruction"
+	}
+	return msg
+}
+
+// parityPushes returns the number of stack items reported as pushed by an opcode.
+// Like Parity, duplications and swaps report all the stack items they touch.
+func parityPushes(op vm.OpCode) int {
+	switch {
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		return 1
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		return int(op-vm.DUP1) + 2
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		return int(op-vm.SWAP1) + 2
+	case op >= vm.LOG0 && op <= vm.LOG4:
+		return 0
+	}
+	switch op {
+	case vm.STOP, vm.POP, vm.MSTORE, vm.MSTORE8, vm.SSTORE, vm.JUMP, vm.JUMPI, vm.JUMPDEST,
+		vm.CALLDATACOPY, vm.CODECOPY, vm.EXTCODECOPY, vm.RETURNDATACOPY,
+		vm.RETURN, vm.REVERT, vm.SELFDESTRUCT:
+		return 0
+	}
+	return 1
+}
+
+// newFrame creates a call frame, starting its VM trace if enabled.
+func (t *ParityTracer) newFrame(trace *ParityTrace) *parityFrame {
+	frame := &parityFrame{trace: trace}
+	if t.vmTrace {
+		frame.vmTrace = &ParityVMTrace{Ops: []*ParityVMOp{}}
+	}
+	return frame
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *ParityTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if value == nil {
+		value = new(big.Int)
+	}
+	trace := &ParityTrace{TraceAddress: []int{}}
+	if create {
+		trace.Type = "create"
+		trace.Action = &ParityCreateAction{
+			From:  from,
+			Value: (*hexutil.Big)(new(big.Int).Set(value)),
+			Gas:   hexutil.Uint64(gas),
+			Init:  common.CopyBytes(input),
+		}
+		trace.Result = &ParityCreateResult{Address: to}
+	} else {
+		trace.Type = "call"
+		trace.Action = &ParityCallAction{
+			CallType: "call",
+			From:     from,
+			To:       to,
+			Value:    (*hexutil.Big)(new(big.Int).Set(value)),
+			Gas:      hexutil.Uint64(gas),
+			Input:    common.CopyBytes(input),
+		}
+	}
+	t.root = t.newFrame(trace)
+	t.root.gas = gas
+	t.frames = []*parityFrame{t.root}
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *ParityTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.interrupted(env) || len(t.frames) == 0 {
+		return nil
+	}
+	// Complete any calls that returned into this one
+	for len(t.frames) > depth && len(t.frames) > 1 {
+		var ret *big.Int
+		if len(stack.Data()) > 0 {
+			ret = stack.Back(0)
+		}
+		t.exit(env, gas, ret, memory)
+	}
+	frame := t.frames[len(t.frames)-1]
+	if !frame.started {
+		frame.started = true
+		if frame.vmTrace != nil {
+			frame.vmTrace.Code = common.CopyBytes(contract.Code)
+		}
+	}
+	// Collect the effects of the previous opcode of this call
+	if frame.pending != nil {
+		t.settle(frame, gas, stack, memory)
+	}
+	var step *parityVMStep
+	if frame.vmTrace != nil {
+		step = &parityVMStep{
+			op:   &ParityVMOp{Cost: cost, PC: pc},
+			left: gas - cost,
+			push: parityPushes(op),
+		}
+		if cost > gas {
+			step.left = 0
+		}
+		frame.vmTrace.Ops = append(frame.vmTrace.Ops, step.op)
+	}
+	if err != nil {
+		t.fail(frame, err)
+		return nil
+	}
+	if step != nil {
+		frame.pending = step
+	}
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		offset := stack.Back(1)
+		given := gas - cost
+		if env.ChainConfig().IsEnabled(env.ChainConfig().GetEIP150Transition, env.BlockNumber) {
+			given -= given / 64
+		}
+		child := t.newFrame(&ParityTrace{
+			Type: "create",
+			Action: &ParityCreateAction{
+				From:  contract.Address(),
+				Value: (*hexutil.Big)(new(big.Int).Set(stack.Back(0))),
+				Gas:   hexutil.Uint64(given),
+				Init:  memorySlice(memory, offset, new(big.Int).Add(offset, stack.Back(2))),
+			},
+		})
+		child.gas, child.base = given, gas-cost-given
+		t.enter(frame, child, step)
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		var (
+			given  = env.CallGas()
+			value  = new(big.Int)
+			offset = stack.Back(2 + off)
+		)
+		switch op {
+		case vm.CALL, vm.CALLCODE:
+			value.Set(stack.Back(2))
+			if value.Sign() != 0 {
+				given += vars.CallStipend
+			}
+		case vm.DELEGATECALL:
+			value.Set(contract.Value())
+		}
+		child := t.newFrame(&ParityTrace{
+			Type: "call",
+			Action: &ParityCallAction{
+				CallType: strings.ToLower(op.String()),
+				From:     contract.Address(),
+				To:       common.BigToAddress(stack.Back(1)),
+				Value:    (*hexutil.Big)(value),
+				Gas:      hexutil.Uint64(given),
+				Input:    memorySlice(memory, offset, new(big.Int).Add(offset, stack.Back(3+off))),
+			},
+		})
+		child.gas, child.base = given, gas-cost
+		child.builtin = vm.PrecompiledContractsForConfig(env.ChainConfig(), env.BlockNumber)[common.BigToAddress(stack.Back(1))] != nil
+		child.outOff = new(big.Int).Set(stack.Back(4 + off))
+		child.outLen = new(big.Int).Set(stack.Back(5 + off))
+		t.enter(frame, child, step)
+
+	case vm.RETURN, vm.REVERT:
+		offset := stack.Back(0)
+		frame.output = memorySlice(memory, offset, new(big.Int).Add(offset, stack.Back(1)))
+
+	case vm.SELFDESTRUCT:
+		frame.children = append(frame.children, &parityFrame{trace: &ParityTrace{
+			Type: "suicide",
+			Action: &ParitySuicideAction{
+				Address:       contract.Address(),
+				RefundAddress: common.BigToAddress(stack.Back(0)),
+				Balance:       (*hexutil.Big)(new(big.Int).Set(env.StateDB.GetBalance(contract.Address()))),
+			},
+			Result: parityNull,
+		}})
+
+	case vm.MSTORE:
+		step.setMem(stack.Back(0), big.NewInt(32))
+	case vm.MSTORE8:
+		step.setMem(stack.Back(0), big.NewInt(1))
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		step.setMem(stack.Back(0), stack.Back(2))
+	case vm.EXTCODECOPY:
+		step.setMem(stack.Back(1), stack.Back(3))
+
+	case vm.SSTORE:
+		if step != nil {
+			step.store = &ParityVMStore{
+				Key: (*hexutil.Big)(new(big.Int).Set(stack.Back(0))),
+				Val: (*hexutil.Big)(new(big.Int).Set(stack.Back(1))),
+			}
+		}
+	}
+	return nil
+}
+
+// setMem records the memory region written by the opcode, if any.
+func (s *parityVMStep) setMem(offset, size *big.Int) {
+	if s == nil || size.Sign() == 0 {
+		return
+	}
+	s.memOff, s.memSize = new(big.Int).Set(offset), new(big.Int).Set(size)
+}
+
+// enter starts tracking a call made by the given frame.
+func (t *ParityTracer) enter(parent, child *parityFrame, step *parityVMStep) {
+	if step != nil && child.outOff != nil {
+		step.setMem(child.outOff, child.outLen)
+	}
+	parent.children = append(parent.children, child)
+	t.frames = append(t.frames, child)
+}
+
+// settle fills in the effects of the pending opcode of a frame, now that the
+// execution moved on to the next one.
+func (t *ParityTracer) settle(frame *parityFrame, gas uint64, stack *vm.Stack, memory *vm.Memory) {
+	step := frame.pending
+	frame.pending = nil
+
+	ex := &ParityVMExec{Push: []*hexutil.Big{}, Store: step.store, Used: gas}
+	if stack != nil {
+		items := len(stack.Data())
+		for i := step.push - 1; i >= 0; i-- {
+			if i < items {
+				ex.Push = append(ex.Push, (*hexutil.Big)(new(big.Int).Set(stack.Back(i))))
+			}
+		}
+	} else {
+		ex.Used = step.left
+	}
+	if step.memOff != nil && memory != nil && step.memOff.IsUint64() {
+		if data := memorySlice(memory, step.memOff, new(big.Int).Add(step.memOff, step.memSize)); data != nil {
+			ex.Mem = &ParityVMMem{Data: data, Off: step.memOff.Uint64()}
+		}
+	}
+	step.op.Ex = ex
+}
+
+// exit completes the innermost call, given the gas left to its caller and the
+// value pushed onto the caller's stack.
+func (t *ParityTracer) exit(env *vm.EVM, gas uint64, ret *big.Int, memory *vm.Memory) {
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	parent := t.frames[len(t.frames)-1]
+
+	if frame.pending != nil {
+		t.settle(frame, 0, nil, nil)
+	}
+	if frame.started && parent.pending != nil && frame.vmTrace != nil {
+		parent.pending.op.Sub = frame.vmTrace
+	}
+	var left uint64
+	if gas > frame.base {
+		left = gas - frame.base
+	}
+	used := frame.gas
+	if left < used {
+		used -= left
+	} else {
+		used = 0
+	}
+	if ret == nil || ret.Sign() == 0 {
+		// Calls failing without executing anything (e.g. insufficient balance or
+		// call depth exceeded) aren't part of the trace
+		if !frame.started && used == 0 && frame.err == nil {
+			parent.children = parent.children[:len(parent.children)-1]
+			return
+		}
+		if frame.err == nil {
+			frame.err = vm.ErrOutOfGas
+		}
+		frame.trace.Error = parityError(frame.err)
+		return
+	}
+	switch frame.trace.Type {
+	case "create":
+		addr := common.BigToAddress(ret)
+		frame.trace.Result = &ParityCreateResult{
+			GasUsed: hexutil.Uint64(used),
+			Code:    common.CopyBytes(env.StateDB.GetCode(addr)),
+			Address: addr,
+		}
+	default:
+		output := frame.output
+		if frame.builtin {
+			// Precompiles don't execute code, their output is only available in
+			// the memory region of the caller
+			output = memorySlice(memory, frame.outOff, new(big.Int).Add(frame.outOff, frame.outLen))
+		}
+		frame.trace.Result = &ParityCallResult{
+			GasUsed: hexutil.Uint64(used),
+			Output:  common.CopyBytes(output),
+		}
+	}
+}
+
+// fail records the error the given call failed with, unless an earlier one was
+// already recorded.
+func (t *ParityTracer) fail(frame *parityFrame, err error) {
+	if frame.err == nil {
+		frame.err = err
+	}
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *ParityTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.interrupted(env) || len(t.frames) == 0 {
+		return nil
+	}
+	frame := t.frames[len(t.frames)-1]
+	if op != vm.REVERT {
+		// The opcode had no effects, as it failed
+		frame.pending = nil
+	}
+	t.fail(frame, err)
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *ParityTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if t.root == nil {
+		return nil
+	}
+	// Complete any calls left hanging by an aborted execution
+	for len(t.frames) > 1 {
+		frame := t.frames[len(t.frames)-1]
+		t.frames = t.frames[:len(t.frames)-1]
+		if frame.err == nil {
+			frame.err = vm.ErrOutOfGas
+		}
+		frame.trace.Error = parityError(frame.err)
+	}
+	t.frames = nil
+
+	root := t.root
+	if root.pending != nil {
+		t.settle(root, 0, nil, nil)
+	}
+	t.output = common.CopyBytes(output)
+	if err != nil {
+		root.trace.Error = parityError(err)
+		root.trace.Result = nil
+		return nil
+	}
+	switch result := root.trace.Result.(type) {
+	case *ParityCreateResult:
+		result.GasUsed, result.Code = hexutil.Uint64(gasUsed), t.output
+	default:
+		root.trace.Result = &ParityCallResult{GasUsed: hexutil.Uint64(gasUsed), Output: t.output}
+	}
+	return nil
+}
+
+// Err returns the error the trace was stopped with, if any.
+func (t *ParityTracer) Err() error {
+	return t.stopped()
+}
+
+// Traces returns the flat call traces of the transaction, in execution order.
+func (t *ParityTracer) Traces() []*ParityTrace {
+	if t.root == nil {
+		return []*ParityTrace{}
+	}
+	var (
+		traces  []*ParityTrace
+		flatten func(frame *parityFrame, address []int)
+	)
+	flatten = func(frame *parityFrame, address []int) {
+		frame.trace.TraceAddress = address
+		frame.trace.Subtraces = len(frame.children)
+		traces = append(traces, frame.trace)
+
+		for i, child := range frame.children {
+			flatten(child, append(append([]int{}, address...), i))
+		}
+	}
+	flatten(t.root, []int{})
+	return traces
+}
+
+// VMTrace returns the trace of the opcodes executed by the transaction, or nil
+// if it wasn't collected.
+func (t *ParityTracer) VMTrace() *ParityVMTrace {
+	if t.root == nil {
+		if t.vmTrace {
+			return &ParityVMTrace{Ops: []*ParityVMOp{}}
+		}
+		return nil
+	}
+	return t.root.vmTrace
+}
+
+// GetResult returns the flat call traces of the transaction.
+func (t *ParityTracer) GetResult() (json.RawMessage, error) {
+	if err := t.stopped(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(t.Traces())
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Tests that the Parity tracer produces the same call tree as the call tracer
+// on all the datasets of the call tracer test harness, flattened.
+func TestParityTracer(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+			if err != nil {
+				t.Fatalf("failed to read testcase: %v", err)
+			}
+			test := new(callTracerTest)
+			if err := json.Unmarshal(blob, test); err != nil {
+				t.Fatalf("failed to parse testcase: %v", err)
+			}
+			tracer := NewParityTracer(true)
+			runTracerTest(t, test, tracer)
+
+			// Flatten the expected call tree and compare it against the traces
+			var want []*callTrace
+			var flatten func(call *callTrace)
+			flatten = func(call *callTrace) {
+				want = append(want, call)
+				for i := range call.Calls {
+					flatten(&call.Calls[i])
+				}
+			}
+			flatten(test.Result)
+
+			traces := tracer.Traces()
+			if len(traces) != len(want) {
+				t.Fatalf("trace count mismatch: have %d, want %d", len(traces), len(want))
+			}
+			for i, trace := range traces {
+				call := want[i]
+				if trace.Subtraces != len(call.Calls) {
+					t.Errorf("trace %d: subtraces mismatch: have %d, want %d", i, trace.Subtraces, len(call.Calls))
+				}
+				if (trace.Error != "") != (call.Error != "") {
+					t.Errorf("trace %d: error mismatch: have %q, want %q", i, trace.Error, call.Error)
+				}
+				var gas hexutil.Uint64
+				switch action := trace.Action.(type) {
+				case *ParityCallAction:
+					if trace.Type != "call" || action.CallType != strings.ToLower(call.Type) {
+						t.Errorf("trace %d: type mismatch: have %s/%s, want %s", i, trace.Type, action.CallType, call.Type)
+					}
+					if action.From != call.From || action.To != call.To || !bytes.Equal(action.Input, call.Input) {
+						t.Errorf("trace %d: call mismatch: have %+v, want %+v", i, action, call)
+					}
+					if call.Value != nil && action.Value.ToInt().Cmp(call.Value.ToInt()) != 0 {
+						t.Errorf("trace %d: value mismatch: have %v, want %v", i, action.Value, call.Value)
+					}
+					gas = action.Gas
+					if result, ok := trace.Result.(*ParityCallResult); ok && call.GasUsed != nil && result.GasUsed != *call.GasUsed {
+						t.Errorf("trace %d: gas used mismatch: have %v, want %v", i, result.GasUsed, *call.GasUsed)
+					}
+				case *ParityCreateAction:
+					if trace.Type != "create" || call.Type != "CREATE" {
+						t.Errorf("trace %d: type mismatch: have %s, want %s", i, trace.Type, call.Type)
+					}
+					if action.From != call.From || !bytes.Equal(action.Init, call.Input) {
+						t.Errorf("trace %d: create mismatch: have %+v, want %+v", i, action, call)
+					}
+					gas = action.Gas
+					if result, ok := trace.Result.(*ParityCreateResult); ok {
+						if result.Address != call.To || !bytes.Equal(result.Code, call.Output) {
+							t.Errorf("trace %d: create result mismatch: have %+v, want %+v", i, result, call)
+						}
+					}
+				default:
+					t.Fatalf("trace %d: unexpected action %T", i, action)
+				}
+				if call.Gas != nil && gas != *call.Gas {
+					t.Errorf("trace %d: gas mismatch: have %v, want %v", i, gas, *call.Gas)
+				}
+			}
+			// Ensure the VM trace covers the executed code
+			if vmTrace := tracer.VMTrace(); vmTrace == nil || len(vmTrace.Ops) == 0 {
+				t.Errorf("missing VM trace")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Tests that state overrides replace the fields of the given accounts, with the
+// storage either replaced entirely or patched slot by slot.
+func TestStateOverrideApply(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+
+	var (
+		replaced = common.Address{0x01}
+		patched  = common.Address{0x02}
+		slot1    = common.Hash{0x01}
+		slot2    = common.Hash{0x02}
+	)
+	for _, addr := range []common.Address{replaced, patched} {
+		statedb.SetState(addr, slot1, common.Hash{0x11})
+		statedb.SetState(addr, slot2, common.Hash{0x22})
+	}
+	var (
+		nonce   = hexutil.Uint64(7)
+		code    = hexutil.Bytes{0x60, 0x00}
+		balance = (*hexutil.Big)(big.NewInt(1000))
+		storage = map[common.Hash]common.Hash{slot1: {0xaa}}
+		diff    = map[common.Hash]common.Hash{slot1: {0xbb}}
+	)
+	overrides := &StateOverride{
+		replaced: {Nonce: &nonce, Code: &code, Balance: &balance, State: &storage},
+		patched:  {StateDiff: &diff},
+	}
+	if err := overrides.Apply(statedb); err != nil {
+		t.Fatalf("failed to apply overrides: %v", err)
+	}
+	if have := statedb.GetNonce(replaced); have != 7 {
+		t.Errorf("nonce mismatch: have %d, want 7", have)
+	}
+	if have := statedb.GetCode(replaced); !bytes.Equal(have, code) {
+		t.Errorf("code mismatch: have %x, want %x", have, code)
+	}
+	if have := statedb.GetBalance(replaced); have.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 1000", have)
+	}
+	if have := statedb.GetState(replaced, slot1); have != (common.Hash{0xaa}) {
+		t.Errorf("replaced slot mismatch: have %x, want %x", have, common.Hash{0xaa})
+	}
+	if have := statedb.GetState(replaced, slot2); have != (common.Hash{}) {
+		t.Errorf("slot outside of replaced storage kept: %x", have)
+	}
+	if have := statedb.GetState(patched, slot1); have != (common.Hash{0xbb}) {
+		t.Errorf("patched slot mismatch: have %x, want %x", have, common.Hash{0xbb})
+	}
+	if have := statedb.GetState(patched, slot2); have != (common.Hash{0x22}) {
+		t.Errorf("unpatched slot mismatch: have %x, want %x", have, common.Hash{0x22})
+	}
+	// Overriding the storage both ways at once is ambiguous and must be refused
+	conflict := &StateOverride{patched: {State: &storage, StateDiff: &diff}}
+	if err := conflict.Apply(statedb); err == nil {
+		t.Errorf("conflicting storage overrides applied")
+	}
+	// Nil overrides leave the state untouched
+	if err := (*StateOverride)(nil).Apply(statedb); err != nil {
+		t.Errorf("failed to apply nil overrides: %v", err)
+	}
+}
+
+// Tests that block overrides only replace the given fields of the EVM context.
+func TestBlockOverridesApply(t *testing.T) {
+	context := vm.Context{
+		BlockNumber: big.NewInt(1),
+		Difficulty:  big.NewInt(2),
+		Time:        big.NewInt(3),
+		GasLimit:    4,
+		Coinbase:    common.Address{0x05},
+	}
+	(*BlockOverrides)(nil).Apply(&context)
+	if context.BlockNumber.Uint64() != 1 || context.GasLimit != 4 {
+		t.Fatalf("nil overrides changed the context: %+v", context)
+	}
+	var (
+		gasLimit = hexutil.Uint64(40)
+		coinbase = common.Address{0x50}
+	)
+	overrides := &BlockOverrides{
+		Number:   (*hexutil.Big)(big.NewInt(10)),
+		Time:     (*hexutil.Big)(big.NewInt(30)),
+		GasLimit: &gasLimit,
+		Coinbase: &coinbase,
+	}
+	overrides.Apply(&context)
+
+	if context.BlockNumber.Uint64() != 10 {
+		t.Errorf("number mismatch: have %v, want 10", context.BlockNumber)
+	}
+	if context.Difficulty.Uint64() != 2 {
+		t.Errorf("difficulty overridden: have %v, want 2", context.Difficulty)
+	}
+	if context.Time.Uint64() != 30 {
+		t.Errorf("time mismatch: have %v, want 30", context.Time)
+	}
+	if context.GasLimit != 40 {
+		t.Errorf("gas limit mismatch: have %d, want 40", context.GasLimit)
+	}
+	if context.Coinbase != coinbase {
+		t.Errorf("coinbase mismatch: have %x, want %x", context.Coinbase, coinbase)
+	}
+}
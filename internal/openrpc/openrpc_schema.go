@@ -158,6 +158,9 @@ const OpenRPCSchema = `
           },
           {
             "$ref": "#/components/contentDescriptors/BlockNumber"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/StateOverride"
           }
         ],
         "result": {
@@ -168,6 +171,38 @@ const OpenRPCSchema = `
           }
         }
       },
+      {
+        "name": "eth_callBundle",
+        "summary": "Executes a sequence of message calls (locally), each on top of the state changes of the previous ones, without creating transactions on the block chain.",
+        "params": [
+          {
+            "name": "transactions",
+            "required": true,
+            "schema": {
+              "type": "array",
+              "items": {
+                "$ref": "#/components/schemas/Transaction"
+              }
+            }
+          },
+          {
+            "$ref": "#/components/contentDescriptors/BlockNumber"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/StateOverride"
+          }
+        ],
+        "result": {
+          "name": "callBundleResults",
+          "description": "The outcome of every call of the bundle, in order",
+          "schema": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/CallBundleResult"
+            }
+          }
+        }
+      },
       {
         "name": "eth_chainId",
         "summary": "Returns the currently configured chain id",
@@ -1066,10 +1101,354 @@ const OpenRPCSchema = `
             "type": "boolean"
           }
         }
+      },
+      {
+        "name": "trace_block",
+        "summary": "Returns the Parity style flat call traces of all the transactions in a block, followed by the block rewards.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/BlockNumber"
+          }
+        ],
+        "result": {
+          "$ref": "#/components/contentDescriptors/Traces"
+        }
+      },
+      {
+        "name": "trace_transaction",
+        "summary": "Returns the Parity style flat call traces of a transaction.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/TransactionHash"
+          }
+        ],
+        "result": {
+          "$ref": "#/components/contentDescriptors/Traces"
+        }
+      },
+      {
+        "name": "trace_get",
+        "summary": "Returns the Parity style flat call trace of a transaction at the given trace address, or null if there is none.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/TransactionHash"
+          },
+          {
+            "name": "traceAddress",
+            "required": true,
+            "schema": {
+              "$ref": "#/components/schemas/TraceAddress"
+            }
+          }
+        ],
+        "result": {
+          "name": "trace",
+          "schema": {
+            "oneOf": [
+              {
+                "$ref": "#/components/schemas/Trace"
+              },
+              {
+                "$ref": "#/components/schemas/Null"
+              }
+            ]
+          }
+        }
+      },
+      {
+        "name": "trace_filter",
+        "summary": "Returns the Parity style flat call traces and block rewards of a range of blocks matching the given criteria.",
+        "params": [
+          {
+            "name": "filter",
+            "required": true,
+            "schema": {
+              "$ref": "#/components/schemas/TraceFilter"
+            }
+          }
+        ],
+        "result": {
+          "$ref": "#/components/contentDescriptors/Traces"
+        }
+      },
+      {
+        "name": "trace_replayTransaction",
+        "summary": "Replays a transaction, returning the requested Parity style trace types.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/TransactionHash"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/TraceTypes"
+          }
+        ],
+        "result": {
+          "name": "traceResults",
+          "schema": {
+            "$ref": "#/components/schemas/TraceResults"
+          }
+        }
+      },
+      {
+        "name": "trace_replayBlockTransactions",
+        "summary": "Replays all the transactions of a block, returning the requested Parity style trace types of each of them.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/BlockNumber"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/TraceTypes"
+          }
+        ],
+        "result": {
+          "name": "traceResults",
+          "schema": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/TraceResults"
+            }
+          }
+        }
+      },
+      {
+        "name": "trace_call",
+        "summary": "Executes a new message call on top of a block without creating a transaction, returning the requested Parity style trace types.",
+        "params": [
+          {
+            "$ref": "#/components/contentDescriptors/Transaction"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/TraceTypes"
+          },
+          {
+            "$ref": "#/components/contentDescriptors/BlockNumber"
+          }
+        ],
+        "result": {
+          "name": "traceResults",
+          "schema": {
+            "$ref": "#/components/schemas/TraceResults"
+          }
+        }
       }
     ],
     "components": {
       "schemas": {
+        "TraceAddress": {
+          "title": "traceAddress",
+          "type": "array",
+          "description": "Path of a call within the call tree of a transaction",
+          "items": {
+            "type": "integer"
+          }
+        },
+        "Trace": {
+          "title": "trace",
+          "type": "object",
+          "description": "A Parity style flat trace of a call, contract creation, self destruct or block reward",
+          "properties": {
+            "action": {
+              "title": "traceAction",
+              "type": "object",
+              "description": "The call, creation, self destruct or reward, depending on the trace type"
+            },
+            "result": {
+              "title": "traceResult",
+              "description": "The gas used and output of a successful call or creation, null for self destructs and rewards",
+              "oneOf": [
+                {
+                  "type": "object"
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            },
+            "error": {
+              "title": "traceError",
+              "type": "string",
+              "description": "The error a failed call or creation failed with"
+            },
+            "subtraces": {
+              "title": "subtraces",
+              "type": "integer",
+              "description": "Number of direct subcalls"
+            },
+            "traceAddress": {
+              "$ref": "#/components/schemas/TraceAddress"
+            },
+            "type": {
+              "title": "traceType",
+              "type": "string",
+              "enum": [
+                "call",
+                "create",
+                "suicide",
+                "reward"
+              ]
+            },
+            "blockHash": {
+              "$ref": "#/components/schemas/BlockHash"
+            },
+            "blockNumber": {
+              "title": "blockNumber",
+              "type": "integer"
+            },
+            "transactionHash": {
+              "oneOf": [
+                {
+                  "$ref": "#/components/schemas/TransactionHash"
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            },
+            "transactionPosition": {
+              "title": "transactionPosition",
+              "oneOf": [
+                {
+                  "type": "integer"
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            }
+          }
+        },
+        "TraceResults": {
+          "title": "traceResults",
+          "type": "object",
+          "description": "The Parity style traces of a transaction or call, with the trace types that weren't requested set to null",
+          "properties": {
+            "output": {
+              "$ref": "#/components/schemas/Bytes"
+            },
+            "trace": {
+              "title": "flatTraces",
+              "oneOf": [
+                {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Trace"
+                  }
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            },
+            "vmTrace": {
+              "title": "vmTrace",
+              "description": "The opcodes executed, with the effects of each of them",
+              "oneOf": [
+                {
+                  "type": "object"
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            },
+            "stateDiff": {
+              "title": "stateDiff",
+              "description": "The accounts changed, keyed by address",
+              "oneOf": [
+                {
+                  "type": "object"
+                },
+                {
+                  "$ref": "#/components/schemas/Null"
+                }
+              ]
+            },
+            "transactionHash": {
+              "$ref": "#/components/schemas/TransactionHash"
+            }
+          }
+        },
+        "TraceFilter": {
+          "title": "traceFilter",
+          "type": "object",
+          "description": "The criteria of the traces to return",
+          "properties": {
+            "fromBlock": {
+              "$ref": "#/components/schemas/BlockNumber"
+            },
+            "toBlock": {
+              "$ref": "#/components/schemas/BlockNumber"
+            },
+            "fromAddress": {
+              "$ref": "#/components/schemas/Addresses"
+            },
+            "toAddress": {
+              "$ref": "#/components/schemas/Addresses"
+            },
+            "after": {
+              "$ref": "#/components/schemas/Integer"
+            },
+            "count": {
+              "$ref": "#/components/schemas/Integer"
+            }
+          }
+        },
+        "AccountOverride": {
+          "title": "accountOverride",
+          "type": "object",
+          "description": "The account fields to override before executing a call. Only one of state and stateDiff may be set",
+          "properties": {
+            "balance": {
+              "$ref": "#/components/schemas/Integer"
+            },
+            "nonce": {
+              "$ref": "#/components/schemas/Integer"
+            },
+            "code": {
+              "$ref": "#/components/schemas/Bytes"
+            },
+            "state": {
+              "title": "state",
+              "type": "object",
+              "description": "Storage slots replacing the entire storage of the account",
+              "additionalProperties": {
+                "$ref": "#/components/schemas/Keccak"
+              }
+            },
+            "stateDiff": {
+              "title": "stateDiff",
+              "type": "object",
+              "description": "Storage slots replacing the individual slots of the account",
+              "additionalProperties": {
+                "$ref": "#/components/schemas/Keccak"
+              }
+            }
+          }
+        },
+        "CallBundleResult": {
+          "title": "callBundleResult",
+          "type": "object",
+          "description": "The outcome of a single call of a bundle",
+          "properties": {
+            "returnValue": {
+              "$ref": "#/components/schemas/Bytes"
+            },
+            "gasUsed": {
+              "$ref": "#/components/schemas/Integer"
+            },
+            "failed": {
+              "title": "failed",
+              "type": "boolean"
+            },
+            "logs": {
+              "title": "logs",
+              "type": "array",
+              "items": {
+                "$ref": "#/components/schemas/Log"
+              }
+            }
+          }
+        },
         "ProofNode": {
           "title": "proofNode",
           "type": "string",
@@ -1669,6 +2048,42 @@ const OpenRPCSchema = `
         }
       },
       "contentDescriptors": {
+        "Traces": {
+          "name": "traces",
+          "schema": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Trace"
+            }
+          }
+        },
+        "TraceTypes": {
+          "name": "traceTypes",
+          "required": true,
+          "schema": {
+            "title": "traceTypes",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "enum": [
+                "trace",
+                "vmTrace",
+                "stateDiff"
+              ]
+            }
+          }
+        },
+        "StateOverride": {
+          "name": "stateOverride",
+          "description": "The account fields to override before execution, keyed by address",
+          "schema": {
+            "title": "stateOverride",
+            "type": "object",
+            "additionalProperties": {
+              "$ref": "#/components/schemas/AccountOverride"
+            }
+          }
+        },
         "Block": {
           "name": "block",
           "summary": "A block",
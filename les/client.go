@@ -110,11 +110,7 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 
 	checkpoint := config.Checkpoint
 	if checkpoint == nil {
-		if p, ok := chainConfig.(*multigeth.MultiGethChainConfig); ok {
-			checkpoint = p.TrustedCheckpoint
-		} else if p, ok := chainConfig.(*goethereum.ChainConfig); ok {
-			checkpoint = p.TrustedCheckpoint
-		}
+		checkpoint = chainConfig.GetTrustedCheckpoint()
 	}
 	// Note: NewLightChain adds the trusted checkpoint so it needs an ODR with
 	// indexers already set but not started yet
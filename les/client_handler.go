@@ -29,7 +29,6 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
-	"github.com/ethereum/go-ethereum/params/vars"
 )
 
 // clientHandler is responsible for receiving and processing all incoming server
@@ -60,12 +59,8 @@ func newClientHandler(ulcServers []string, ulcFraction int, checkpoint *ctypes.T
 		handler.ulc = ulc
 		log.Info("Enable ultra light client mode")
 	}
-	var height uint64
-	if checkpoint != nil {
-		height = (checkpoint.SectionIndex+1)*vars.CHTFrequency - 1
-	}
 	handler.fetcher = newLightFetcher(handler)
-	handler.downloader = downloader.New(height, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.removePeer)
+	handler.downloader = downloader.New(checkpoint, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.removePeer)
 	handler.backend.peers.notify((*downloaderPeerNotify)(handler))
 	return handler
 }
@@ -83,6 +83,11 @@ var (
 			1920000: common.HexToHash("0x94365e3a8c0b35089c1d1195081fe7489b528a84b22199c916180db8b28ade7f"),
 			2500000: common.HexToHash("0xca12c63534f565899681965528d536c52cb05b7c48e269c2a6cb77ad864d878a"),
 		},
+
+		// No trusted checkpoint has been published for Classic yet, so sync isn't
+		// pinned to one. Set these once section heads are signed off for it.
+		TrustedCheckpoint:       nil,
+		TrustedCheckpointOracle: nil,
 	}
 
 	DisinflationRateQuotient = big.NewInt(4)      // Disinflation rate quotient for ECIP1017
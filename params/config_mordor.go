@@ -76,5 +76,10 @@ var (
 		ECIP1017EraRounds:  big.NewInt(2000000),
 		ECIP1010PauseBlock: nil,
 		ECIP1010Length:     nil,
+
+		// No trusted checkpoint has been published for Mordor yet, so sync isn't
+		// pinned to one. Set these once section heads are signed off for it.
+		TrustedCheckpoint:       nil,
+		TrustedCheckpointOracle: nil,
 	}
 )
@@ -82,6 +82,12 @@ func Convert(from, to interface{}) error {
 		}
 	}
 
+	// Set trusted checkpoint.
+	k = reflect.TypeOf((*ctypes.CHTer)(nil)).Elem()
+	if err := convert(k, fromChainer, toChainer); err != nil {
+		return err
+	}
+
 	// Set consensus engine params.
 	engineType := fromChainer.GetConsensusEngineType()
 	if err := toChainer.MustSetConsensusEngineType(engineType); err != nil {
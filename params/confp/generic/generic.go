@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/types/goethereum"
@@ -139,6 +140,28 @@ func UnmarshalChainConfigurator(input []byte) (ctypes.ChainConfigurator, error)
 	return nil, errors.New("invalid configurator schema")
 }
 
+// UnmarshalChainspec reads a chain configuration in any of the supported chainspec
+// formats. Unlike UnmarshalChainConfigurator, it also accepts a genesis wrapping
+// the configuration in its "config" field, as (multi-)geth genesis files do.
+func UnmarshalChainspec(input []byte) (ctypes.ChainConfigurator, error) {
+	var genesis struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(input, &genesis); err != nil {
+		return nil, err
+	}
+	conf, err := UnmarshalChainConfigurator(input)
+	if err != nil || len(genesis.Config) == 0 {
+		return conf, err
+	}
+	// The schema was detected on the whole genesis, so decode only its configuration
+	conf = reflect.New(reflect.TypeOf(conf).Elem()).Interface().(ctypes.ChainConfigurator)
+	if err := json.Unmarshal(genesis.Config, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
 func asMapHasAnyKey(input []byte, keys []string) (bool, error) {
 	results := gjson.GetManyBytes(input, keys...)
 	for _, g := range results {
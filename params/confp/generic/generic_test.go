@@ -299,3 +299,42 @@ func TestUnmarshalChainConfigurator2(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalChainspec(t *testing.T) {
+	cases := []struct {
+		file  string
+		wantT interface{}
+	}{
+		{
+			filepath.Join("..", "testdata", "stureby_parity.json"),
+			&parity.ParityChainSpec{},
+		},
+		{
+			filepath.Join("..", "testdata", "stureby_geth.json"),
+			&goethereum.ChainConfig{},
+		},
+		{
+			filepath.Join("..", "testdata", "stureby_multigeth.json"),
+			&multigeth.MultiGethChainConfig{},
+		},
+	}
+	for i, c := range cases {
+		b, err := ioutil.ReadFile(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnmarshalChainspec(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(got) != reflect.TypeOf(c.wantT) {
+			t.Errorf("%d / wrong type: want %T, got %T", i, c.wantT, got)
+		}
+		if id := got.GetChainID(); id == nil || id.Uint64() != 314158 {
+			t.Errorf("%d / wrong chain id: want 314158, got %v", i, id)
+		}
+		if n := got.GetEIP155Transition(); n == nil || *n != 23000 {
+			t.Errorf("%d / wrong EIP155 transition: want 23000, got %v", i, n)
+		}
+	}
+}
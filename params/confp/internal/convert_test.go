@@ -25,6 +25,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/params/confp"
 	"github.com/ethereum/go-ethereum/params/confp/tconvert"
 	"github.com/ethereum/go-ethereum/params/types/aleth"
@@ -150,3 +151,40 @@ func TestCompatible(t *testing.T) {
 	}
 	t.Log(fns)
 }
+
+// TestConvertTrustedCheckpoint tests that trusted checkpoints are carried across
+// the chain configuration formats and their JSON encodings.
+func TestConvertTrustedCheckpoint(t *testing.T) {
+	spec := &parity.ParityChainSpec{}
+	mustOpenF(t, "parity", spec)
+
+	checkpoint := &ctypes.TrustedCheckpoint{
+		SectionIndex: 42,
+		SectionHead:  common.HexToHash("0x01"),
+		CHTRoot:      common.HexToHash("0x02"),
+		BloomRoot:    common.HexToHash("0x03"),
+	}
+	if err := spec.SetTrustedCheckpoint(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	for _, newConfig := range []func() ctypes.ChainConfigurator{
+		func() ctypes.ChainConfigurator { return &multigeth.MultiGethChainConfig{} },
+		func() ctypes.ChainConfigurator { return &parity.ParityChainSpec{} },
+	} {
+		config := newConfig()
+		if err := confp.Convert(spec, config); err != nil {
+			t.Fatalf("%T: conversion failed: %v", config, err)
+		}
+		blob, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("%T: encoding failed: %v", config, err)
+		}
+		decoded := newConfig()
+		if err := json.Unmarshal(blob, decoded); err != nil {
+			t.Fatalf("%T: decoding failed: %v", config, err)
+		}
+		if have := decoded.GetTrustedCheckpoint(); !reflect.DeepEqual(have, checkpoint) {
+			t.Errorf("%T: checkpoint mismatch: have %+v, want %+v", config, have, checkpoint)
+		}
+	}
+}
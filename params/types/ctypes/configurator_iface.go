@@ -45,7 +45,7 @@ type ChainConfigurator interface {
 	ProtocolSpecifier
 	Forker
 	ConsensusEnginator // Consensus Engine
-	// CHTer
+	CHTer
 }
 
 // ProtocolSpecifier defines protocol interfaces that are agnostic of consensus engine.
@@ -134,6 +134,13 @@ type Forker interface {
 	GetForkCanonHashes() map[uint64]common.Hash
 }
 
+// CHTer defines the trusted checkpoint of a chain, anchoring the header chain
+// for both light clients and syncing full nodes.
+type CHTer interface {
+	GetTrustedCheckpoint() *TrustedCheckpoint
+	SetTrustedCheckpoint(c *TrustedCheckpoint) error
+}
+
 type ConsensusEnginator interface {
 	GetConsensusEngineType() ConsensusEngineT
 	MustSetConsensusEngineType(t ConsensusEngineT) error
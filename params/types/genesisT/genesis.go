@@ -552,6 +552,14 @@ func (g *Genesis) GetForkCanonHashes() map[uint64]common.Hash {
 	return g.Config.GetForkCanonHashes()
 }
 
+func (g *Genesis) GetTrustedCheckpoint() *ctypes.TrustedCheckpoint {
+	return g.Config.GetTrustedCheckpoint()
+}
+
+func (g *Genesis) SetTrustedCheckpoint(c *ctypes.TrustedCheckpoint) error {
+	return g.Config.SetTrustedCheckpoint(c)
+}
+
 func (g *Genesis) GetConsensusEngineType() ctypes.ConsensusEngineT {
 	return g.Config.GetConsensusEngineType()
 }
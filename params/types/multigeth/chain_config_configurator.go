@@ -404,6 +404,15 @@ func (c *MultiGethChainConfig) GetForkCanonHashes() map[uint64]common.Hash {
 	return c.RequireBlockHashes
 }
 
+func (c *MultiGethChainConfig) GetTrustedCheckpoint() *ctypes.TrustedCheckpoint {
+	return c.TrustedCheckpoint
+}
+
+func (c *MultiGethChainConfig) SetTrustedCheckpoint(cp *ctypes.TrustedCheckpoint) error {
+	c.TrustedCheckpoint = cp
+	return nil
+}
+
 func (c *MultiGethChainConfig) GetConsensusEngineType() ctypes.ConsensusEngineT {
 	if c.Ethash != nil {
 		return ctypes.ConsensusEngineT_Ethash
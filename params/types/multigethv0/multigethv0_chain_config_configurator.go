@@ -417,6 +417,15 @@ func (c *ChainConfig) GetForkCanonHashes() map[uint64]common.Hash {
 	}
 }
 
+func (c *ChainConfig) GetTrustedCheckpoint() *ctypes.TrustedCheckpoint {
+	return c.TrustedCheckpoint
+}
+
+func (c *ChainConfig) SetTrustedCheckpoint(cp *ctypes.TrustedCheckpoint) error {
+	c.TrustedCheckpoint = cp
+	return nil
+}
+
 func (c *ChainConfig) GetConsensusEngineType() ctypes.ConsensusEngineT {
 	if c.Clique != nil {
 		return ctypes.ConsensusEngineT_Clique
@@ -111,6 +111,8 @@ type ParityChainSpec struct {
 
 		ForkBlock     *ParityU64   `json:"forkBlock,omitempty"`
 		ForkCanonHash *common.Hash `json:"forkCanonHash,omitempty"`
+
+		TrustedCheckpoint *ctypes.TrustedCheckpoint `json:"trustedCheckpoint,omitempty"`
 	} `json:"params"`
 
 	Genesis struct {
@@ -510,6 +510,15 @@ func (spec *ParityChainSpec) GetForkCanonHashes() map[uint64]common.Hash {
 	}
 }
 
+func (spec *ParityChainSpec) GetTrustedCheckpoint() *ctypes.TrustedCheckpoint {
+	return spec.Params.TrustedCheckpoint
+}
+
+func (spec *ParityChainSpec) SetTrustedCheckpoint(c *ctypes.TrustedCheckpoint) error {
+	spec.Params.TrustedCheckpoint = c
+	return nil
+}
+
 func (spec *ParityChainSpec) GetConsensusEngineType() ctypes.ConsensusEngineT {
 	if !reflect.DeepEqual(spec.Engine.Ethash, reflect.Zero(reflect.TypeOf(spec.Engine.Ethash)).Interface()) {
 		return ctypes.ConsensusEngineT_Ethash
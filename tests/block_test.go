@@ -45,8 +45,11 @@ func TestBlockchain(t *testing.T) {
 	bt.skipLoad(`.*randomStatetest94.json.*`)
 
 	bt.walk(t, blockTestDir, func(t *testing.T, name string, test *BlockTest) {
-		if err := bt.checkFailure(t, name, test.Run()); err != nil {
-			t.Errorf("%v (config=%s)", err, test.json.Network)
+		if err := bt.checkFailure(t, name, test.Run(false)); err != nil {
+			t.Errorf("serial: %v (config=%s)", err, test.json.Network)
+		}
+		if err := bt.checkFailure(t, name, test.Run(true)); err != nil {
+			t.Errorf("parallel: %v (config=%s)", err, test.json.Network)
 		}
 	})
 
@@ -95,12 +95,22 @@ type btHeaderMarshaling struct {
 	Timestamp  math.HexOrDecimal64
 }
 
-func (t *BlockTest) Run() error {
+// Network returns the name of the fork the test is meant to run with.
+func (t *BlockTest) Network() string {
+	return t.json.Network
+}
+
+func (t *BlockTest) Run(parallel bool) error {
 	config, ok := Forks[t.json.Network]
 	if !ok {
 		return UnsupportedForkError{t.json.Network}
 	}
+	return t.RunWithConfig(config, parallel)
+}
 
+// RunWithConfig runs the test with the given chain configuration instead of the
+// one of the fork named by the test.
+func (t *BlockTest) RunWithConfig(config ctypes.ChainConfigurator, parallel bool) error {
 	// import pre accounts & construct test genesis block & state root
 	db := rawdb.NewMemoryDatabase()
 	gblock, err := core.CommitGenesis(t.genesis(config), db)
@@ -119,7 +129,7 @@ func (t *BlockTest) Run() error {
 	} else {
 		engine = ethash.NewShared()
 	}
-	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieCleanLimit: 0}, config, engine, vm.Config{}, nil)
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieCleanLimit: 0, ParallelExec: parallel}, config, engine, vm.Config{}, nil)
 	if err != nil {
 		return err
 	}
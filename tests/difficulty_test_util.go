@@ -100,6 +100,13 @@ var difficultyChainConfigurations = map[string]ctypes.ChainConfigurator{
 	},
 }
 
+// DifficultyConfig returns the chain configuration the difficulty tests of the
+// given network are run with.
+func DifficultyConfig(network string) (ctypes.ChainConfigurator, bool) {
+	config, ok := difficultyChainConfigurations[network]
+	return config, ok
+}
+
 type DifficultyTest struct {
 	ParentTimestamp    uint64       `json:"parentTimestamp"`
 	ParentDifficulty   *big.Int     `json:"parentDifficulty"`
@@ -33,3 +33,15 @@ type MissingNodeError struct {
 func (err *MissingNodeError) Error() string {
 	return fmt.Sprintf("missing trie node %x (path %x)", err.NodeHash, err.Path)
 }
+
+// CorruptNodeError is returned if the content of a trie node stored in the database
+// doesn't match its hash or can't be decoded.
+type CorruptNodeError struct {
+	NodeHash common.Hash // hash of the corrupt node
+	Path     []byte      // hex-encoded path to the corrupt node
+	Err      error       // reason the node was deemed corrupt
+}
+
+func (err *CorruptNodeError) Error() string {
+	return fmt.Sprintf("corrupt trie node %x (path %x): %v", err.NodeHash, err.Path, err.Err)
+}
@@ -18,10 +18,12 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -115,7 +117,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb ethdb.KeyValueReader)
 		if err != nil {
 			return nil, i, fmt.Errorf("bad proof node %d: %v", i, err)
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			// The trie doesn't contain the key.
@@ -129,7 +131,353 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb ethdb.KeyValueReader)
 	}
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// VerifyRangeProof checks whether the given sorted leaves form the complete,
+// consecutive set of trie entries from firstKey up to the last leaf in a trie
+// with the given root hash. The first key doesn't need to exist in the trie, so
+// firstProof may either be an existence or a non-existence proof of it, while
+// lastProof must contain the merkle proof of the last leaf.
+//
+// The edge proofs are used to reconstruct the two boundary paths of the trie, of
+// which everything between the boundaries is discarded and rebuilt from the given
+// leaves. Any missing, extra or modified leaf results in a root hash mismatch.
+//
+// If no leaves are given, the proof of the first key must show that the trie has
+// no entries from it onward.
+//
+// The first key may be shorter than the keys of the trie, or nil to prove a range
+// from the start of the trie, in which case it precedes all the keys it prefixes.
+func VerifyRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, values [][]byte, firstProof ethdb.KeyValueReader, lastProof ethdb.KeyValueReader) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			return errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return errors.New("range contains deletion")
+		}
+	}
+	// An empty range is proven by the absence of anything from the first key on
+	if len(keys) == 0 {
+		if rootHash == emptyRoot {
+			return nil
+		}
+		root, value, err := proofToPath(rootHash, nil, firstKey, firstProof, true)
+		if err != nil {
+			return err
+		}
+		if value != nil || hasRightElement(root, firstKey) {
+			return errors.New("more entries available")
+		}
+		return nil
+	}
+	if bytes.Compare(firstKey, keys[0]) > 0 {
+		return errors.New("range starts before the first key")
+	}
+	// A single leaf range starting at the leaf is proven by a plain merkle proof
+	if len(keys) == 1 && bytes.Equal(firstKey, keys[0]) {
+		value, _, err := VerifyProof(rootHash, keys[0], firstProof)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(value, values[0]) {
+			return errors.New("correct proof but invalid data")
+		}
+		return nil
+	}
+	// Convert the edge proofs into edge paths, the second merged into the first,
+	// reproducing the boundaries of the original trie
+	lastKey := keys[len(keys)-1]
+	root, _, err := proofToPath(rootHash, nil, firstKey, firstProof, true)
+	if err != nil {
+		return err
+	}
+	if root, _, err = proofToPath(rootHash, root, lastKey, lastProof, false); err != nil {
+		return err
+	}
+	// Remove all the references between the edge paths and refill them from the
+	// leaves. If the range is complete, the original trie is restored.
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return err
+	}
+	tr := &Trie{root: root, db: NewDatabase(memorydb.New())}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return err
+		}
+	}
+	if hash := tr.Hash(); hash != rootHash {
+		return fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, hash)
+	}
+	return nil
+}
+
+// proofToPath resolves the path to key from the nodes of a merkle proof, linking
+// them into the given root (resolved from the proof if nil), and returns the
+// value of the key. All nodes outside the path are left as hash nodes. If
+// allowNonExistent is set, the proof may show that the key isn't in the trie,
+// in which case the path is resolved up to the point where it diverges.
+func proofToPath(rootHash common.Hash, root node, key []byte, proofDb ethdb.KeyValueReader, allowNonExistent bool) (node, []byte, error) {
+	// resolveNode retrieves and decodes a trie node from the merkle proof
+	resolveNode := func(hash common.Hash) (node, error) {
+		buf, _ := proofDb.Get(hash[:])
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash[:], buf)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	if root == nil {
+		n, err := resolveNode(rootHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	key = keybytesToHex(key)
+	parent := root
+	for {
+		keyrest, child := get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the edge key is not contained in the trie")
+		case *shortNode, *fullNode:
+			// Already resolved, descend
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			resolved, err := resolveNode(common.BytesToHash(cld))
+			if err != nil {
+				return nil, nil, err
+			}
+			// Link the resolved child into its parent
+			switch pnode := parent.(type) {
+			case *shortNode:
+				pnode.Val = resolved
+			case *fullNode:
+				pnode.Children[key[0]] = resolved
+			}
+			key, parent = keyrest, resolved
+		case valueNode:
+			if len(keyrest) != 0 {
+				if allowNonExistent {
+					return root, nil, nil
+				}
+				return nil, nil, errors.New("the edge key is not contained in the trie")
+			}
+			return root, cld, nil
+		}
+	}
+}
+
+// unsetInternal removes all the references between the left and right edge paths,
+// which must already be resolved by proofToPath. The left key doesn't need to be
+// in the trie, the right one does. The removed part of the trie is expected to be
+// rebuilt from the leaves of the range, including the edge values, which are
+// removed too. It reports whether the whole trie lies within the range, in which
+// case nothing of it is kept.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Step down to the fork point of the two paths. It's either a shortnode if
+	// the left path diverges from its key, or a fullnode where the paths part.
+	var (
+		pos    int
+		parent *fullNode
+
+		forkLeft, forkRight int // Position of the paths relative to the key of a shortnode fork
+	)
+findFork:
+	for {
+		switch rn := n.(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+			forkLeft, forkRight = compareKeyPrefix(left[pos:], rn.Key), compareKeyPrefix(right[pos:], rn.Key)
+			if forkLeft != 0 || forkRight != 0 {
+				break findFork
+			}
+			n, pos = rn.Val, pos+len(rn.Key)
+
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+			if left[pos] != right[pos] || rn.Children[left[pos]] == nil {
+				break findFork
+			}
+			parent, n, pos = rn, rn.Children[left[pos]], pos+1
+
+		default:
+			return false, errors.New("invalid edge path")
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// The right path always exists, so only the left one may diverge. If it's
+		// to the right of the shortnode, the range would be empty.
+		if forkRight != 0 || forkLeft > 0 {
+			return false, errors.New("invalid edge path")
+		}
+		// The shortnode is entirely within the range if it's a leaf, otherwise only
+		// the part to the left of the right path is
+		if _, ok := rn.Val.(valueNode); ok {
+			if parent == nil {
+				return true, nil
+			}
+			parent.Children[left[pos-1]] = nil
+			return false, nil
+		}
+		return false, unset(rn, rn.Val, right, pos+len(rn.Key), true)
+
+	case *fullNode:
+		for i := rightOf(left[pos]); i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left, pos+1, false); err != nil {
+			return false, err
+		}
+		return false, unset(rn, rn.Children[right[pos]], right, pos+1, true)
+
+	default:
+		return false, errors.New("invalid edge path")
+	}
+}
+
+// unset removes the references on one side of the edge path going through the
+// given child of parent, at position pos of key: the ones to the right of the
+// path if removeLeft is false, or to the left if it's true. The edge leaf is
+// removed too. If the path diverges from the trie, the diverging branch is
+// removed if it lies within the range.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			// The value of the fullnode precedes all of its children, while a path
+			// ending at it has no children to its left
+			if key[pos] < 16 {
+				cld.Children[16] = nil
+			}
+			for i := byte(0); key[pos] < 16 && i < key[pos]; i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := rightOf(key[pos]); i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+
+	case *shortNode:
+		fn, ok := parent.(*fullNode)
+		if !ok {
+			return errors.New("invalid edge path")
+		}
+		if fork := compareKeyPrefix(key[pos:], cld.Key); fork != 0 {
+			// The path diverges from the shortnode, which is within the range
+			// if it lies on the inner side of the edge
+			if (removeLeft && fork > 0) || (!removeLeft && fork < 0) {
+				fn.Children[key[pos-1]] = nil
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			fn.Children[key[pos-1]] = nil
+			return nil
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+
+	case valueNode:
+		// The path ends in the value of a fullnode, which is the edge leaf
+		fn, ok := parent.(*fullNode)
+		if !ok {
+			return errors.New("invalid edge path")
+		}
+		fn.Children[16] = nil
+		return nil
+
+	case nil:
+		// The path diverges at the parent fullnode, nothing to remove
+		return nil
+
+	default:
+		return errors.New("invalid edge path")
+	}
+}
+
+// rightOf returns the first child index of a fullnode to the right of the given
+// path nibble. A path ending at the fullnode, as its key is shorter than the ones
+// below, lies to the left of all the children.
+func rightOf(nibble byte) byte {
+	if nibble == 16 {
+		return 0
+	}
+	return nibble + 1
+}
+
+// compareKeyPrefix compares the prefix of a path with the key of a shortnode,
+// returning 0 if the path goes through the shortnode, -1 if it passes to the left
+// of it and 1 if to the right. A key ending before the other one sorts first, as
+// it's a prefix of all the keys continuing it.
+func compareKeyPrefix(path []byte, key []byte) int {
+	for i := 0; i < len(path) && i < len(key); i++ {
+		switch {
+		case path[i] == key[i]:
+			continue
+		case path[i] == 16:
+			return -1
+		case key[i] == 16:
+			return 1
+		case path[i] < key[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+// hasRightElement reports whether the trie has any entries to the right of the
+// path to key, which must already be resolved by proofToPath.
+func hasRightElement(n node, key []byte) bool {
+	pos, key := 0, keybytesToHex(key)
+	for n != nil {
+		switch rn := n.(type) {
+		case *fullNode:
+			for i := rightOf(key[pos]); i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true
+				}
+			}
+			n, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if fork := compareKeyPrefix(key[pos:], rn.Key); fork != 0 {
+				return fork < 0
+			}
+			n, pos = rn.Val, pos+len(rn.Key)
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// get returns the child of the given node on the path to key, along with the rest
+// of the key. If skipResolved is set, already resolved children are descended into,
+// returning the first unresolved (hash) node or the value itself.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -138,9 +486,18 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
+			if len(key) == 0 {
+				return nil, n.Children[16]
+			}
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
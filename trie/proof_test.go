@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -148,6 +149,130 @@ func TestMissingKeyProof(t *testing.T) {
 	}
 }
 
+// Tests that range proofs of random contiguous ranges verify, and that ranges
+// with missing, modified or extra leaves are rejected.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+	// prove creates the edge proofs and leaves of the range [start, end), starting
+	// at the given origin
+	prove := func(origin []byte, start, end int) ([][]byte, [][]byte, *memorydb.Database, *memorydb.Database) {
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys = append(keys, common.CopyBytes(entry.k))
+			values = append(values, common.CopyBytes(entry.v))
+		}
+		firstProof, lastProof := memorydb.New(), memorydb.New()
+		if err := trie.Prove(origin, 0, firstProof); err != nil {
+			t.Fatalf("failed to prove the origin: %v", err)
+		}
+		if len(keys) > 0 {
+			if err := trie.Prove(keys[len(keys)-1], 0, lastProof); err != nil {
+				t.Fatalf("failed to prove the last node: %v", err)
+			}
+		}
+		return keys, values, firstProof, lastProof
+	}
+	for i := 0; i < 100; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		// Start the range either at its first key, or at a missing key before it
+		origin := entries[start].k
+		if i%2 == 1 {
+			origin = decreaseKey(common.CopyBytes(origin))
+			if start > 0 && bytes.Compare(origin, entries[start-1].k) <= 0 {
+				origin = entries[start].k
+			}
+		}
+		keys, values, firstProof, lastProof := prove(origin, start, end)
+		if err := VerifyRangeProof(trie.Hash(), origin, keys, values, firstProof, lastProof); err != nil {
+			t.Fatalf("range [%d, %d): failed to verify proof: %v", start, end, err)
+		}
+		// Omit the leading leaves of the range
+		if len(keys) > 1 {
+			keys, values, firstProof, lastProof = prove(origin, start, end)
+			if err := VerifyRangeProof(trie.Hash(), origin, keys[1:], values[1:], firstProof, lastProof); err == nil {
+				t.Fatalf("range [%d, %d): range without its leading leaf verified", start, end)
+			}
+		}
+		if start > 0 {
+			// Omit the leaves between an earlier origin and the range
+			earlier := entries[mrand.Intn(start)].k
+			keys, values, firstProof, lastProof = prove(earlier, start, end)
+			if err := VerifyRangeProof(trie.Hash(), earlier, keys, values, firstProof, lastProof); err == nil {
+				t.Fatalf("range [%d, %d): range starting after its origin verified", start, end)
+			}
+		}
+		if len(keys) < 3 {
+			continue
+		}
+		// Drop a leaf from the middle of the range
+		index := 1 + mrand.Intn(len(keys)-2)
+		dropKeys := append(append([][]byte{}, keys[:index]...), keys[index+1:]...)
+		dropValues := append(append([][]byte{}, values[:index]...), values[index+1:]...)
+
+		keys, values, firstProof, lastProof = prove(origin, start, end)
+		if err := VerifyRangeProof(trie.Hash(), origin, dropKeys, dropValues, firstProof, lastProof); err == nil {
+			t.Fatalf("range [%d, %d): gapped range verified", start, end)
+		}
+		// Modify a leaf in the range
+		keys, values, firstProof, lastProof = prove(origin, start, end)
+		values[index] = randBytes(20)
+		if err := VerifyRangeProof(trie.Hash(), origin, keys, values, firstProof, lastProof); err == nil {
+			t.Fatalf("range [%d, %d): modified range verified", start, end)
+		}
+		// Shuffle two leaves of the range
+		keys, values, firstProof, lastProof = prove(origin, start, end)
+		keys[index], keys[index-1] = keys[index-1], keys[index]
+		if err := VerifyRangeProof(trie.Hash(), origin, keys, values, firstProof, lastProof); err == nil {
+			t.Fatalf("range [%d, %d): unordered range verified", start, end)
+		}
+	}
+	// Ensure that a range with missing edge proofs is rejected
+	keys, values, firstProof, _ := prove(entries[10].k, 10, 20)
+	if err := VerifyRangeProof(trie.Hash(), entries[10].k, keys, values, firstProof, memorydb.New()); err == nil {
+		t.Fatalf("range without last proof verified")
+	}
+	// Ensure that empty ranges are only accepted past the last leaf
+	last := increaseKey(common.CopyBytes(entries[len(entries)-1].k))
+	_, _, firstProof, lastProof := prove(last, len(entries), len(entries))
+	if err := VerifyRangeProof(trie.Hash(), last, nil, nil, firstProof, lastProof); err != nil {
+		t.Fatalf("failed to verify empty range: %v", err)
+	}
+	_, _, firstProof, lastProof = prove(entries[100].k, 100, 100)
+	if err := VerifyRangeProof(trie.Hash(), entries[100].k, nil, nil, firstProof, lastProof); err == nil {
+		t.Fatalf("empty range with remaining leaves verified")
+	}
+}
+
+// decreaseKey returns the key immediately preceding the given one.
+func decreaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]--
+		if key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}
+
+// increaseKey returns the key immediately following the given one.
+func increaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x00 {
+			break
+		}
+	}
+	return key
+}
+
 // mutateByte changes one byte in b.
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {
@@ -221,3 +346,94 @@ func randBytes(n int) []byte {
 	crand.Read(r)
 	return r
 }
+
+// Tests that range proofs starting at a nil or shortened first key, which
+// precedes all the keys it prefixes, verify.
+func TestRangeProofShortFirstKey(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+	for i := 0; i < 100; i++ {
+		var origin []byte
+		if i > 0 {
+			key := entries[mrand.Intn(len(entries))].k
+			origin = common.CopyBytes(key[:mrand.Intn(len(key))])
+		}
+		start := sort.Search(len(entries), func(i int) bool { return bytes.Compare(entries[i].k, origin) >= 0 })
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys = append(keys, entry.k)
+			values = append(values, entry.v)
+		}
+		firstProof, lastProof := memorydb.New(), memorydb.New()
+		if err := trie.Prove(origin, 0, firstProof); err != nil {
+			t.Fatalf("failed to prove the origin: %v", err)
+		}
+		if err := trie.Prove(keys[len(keys)-1], 0, lastProof); err != nil {
+			t.Fatalf("failed to prove the last node: %v", err)
+		}
+		if err := VerifyRangeProof(trie.Hash(), origin, keys, values, firstProof, lastProof); err != nil {
+			t.Fatalf("origin %x, range [%d, %d): failed to verify proof: %v", origin, start, end, err)
+		}
+		if len(keys) > 1 {
+			if err := VerifyRangeProof(trie.Hash(), origin, keys[1:], values[1:], firstProof, lastProof); err == nil {
+				t.Fatalf("origin %x, range [%d, %d): range without its leading leaf verified", origin, start, end)
+			}
+		}
+	}
+}
+
+// Tests that range proofs verify in tries whose keys prefix each other, storing
+// values in the fullnodes along the paths to the longer keys.
+func TestRangeProofPrefixKeys(t *testing.T) {
+	trie := new(Trie)
+	var entries []*kv
+	for i := 0; i < 256; i++ {
+		// Store the key along with all of its prefixes
+		key := randBytes(1 + mrand.Intn(4))
+		for j := 1; j <= len(key); j++ {
+			if trie.Get(key[:j]) == nil {
+				entry := &kv{common.CopyBytes(key[:j]), randBytes(20), false}
+				trie.Update(entry.k, entry.v)
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys = append(keys, entry.k)
+			values = append(values, entry.v)
+		}
+		firstProof, lastProof := memorydb.New(), memorydb.New()
+		if err := trie.Prove(keys[0], 0, firstProof); err != nil {
+			t.Fatalf("failed to prove the first node: %v", err)
+		}
+		if err := trie.Prove(keys[len(keys)-1], 0, lastProof); err != nil {
+			t.Fatalf("failed to prove the last node: %v", err)
+		}
+		if err := VerifyRangeProof(trie.Hash(), keys[0], keys, values, firstProof, lastProof); err != nil {
+			t.Fatalf("range [%d, %d): failed to verify proof: %v", start, end, err)
+		}
+		if len(keys) < 3 {
+			continue
+		}
+		index := 1 + mrand.Intn(len(keys)-2)
+		dropKeys := append(append([][]byte{}, keys[:index]...), keys[index+1:]...)
+		dropValues := append(append([][]byte{}, values[:index]...), values[index+1:]...)
+		if err := VerifyRangeProof(trie.Hash(), keys[0], dropKeys, dropValues, firstProof, lastProof); err == nil {
+			t.Fatalf("range [%d, %d): gapped range verified", start, end)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// errStackTrieOrder is returned if keys are not inserted into a stack trie in
+	// strictly increasing order.
+	errStackTrieOrder = errors.New("stack trie keys out of order")
+
+	// errStackTrieEmptyValue is returned if an empty value is inserted into a stack
+	// trie. Deletions are not supported.
+	errStackTrieEmptyValue = errors.New("stack trie value empty")
+
+	// errStackTrieKeyPrefix is returned if a key inserted into a stack trie has
+	// the previously inserted one as its prefix, which the trie can't represent.
+	errStackTrieKeyPrefix = errors.New("stack trie key is a prefix of another")
+
+	// errStackTrieHashed is returned if a key is inserted into a stack trie that
+	// was already hashed.
+	errStackTrieHashed = errors.New("stack trie already hashed")
+)
+
+// Node types of a stack trie.
+const (
+	stEmptyNode = iota
+	stBranchNode
+	stExtNode
+	stLeafNode
+	stHashedNode
+)
+
+// StackTrie is a trie builder which expects its keys to be inserted in strictly
+// increasing order. Since no key can be inserted into a subtree once a greater key
+// was inserted into a subsequent one, the builder hashes (and optionally stores)
+// every subtree as soon as it's complete and frees it, only keeping the path to
+// the last inserted key in memory.
+//
+// Keys must not be prefixes of each other, which holds for fixed size keys (e.g.
+// hashes) and for RLP encoded integers alike.
+type StackTrie struct {
+	nodeType uint8
+	key      []byte         // Key segment of a leaf or an extension, in hex nibbles without terminator
+	val      []byte         // Value of a leaf, or the encoding or hash of a hashed node
+	children [16]*StackTrie // Children of a branch, or the only child of an extension at index 0
+	db       ethdb.KeyValueWriter
+	last     []byte // Last key inserted into the trie, only tracked at the root
+}
+
+// NewStackTrie creates a stack trie builder. If db is non-nil, all the hashed trie
+// nodes are written into it as soon as they are complete.
+func NewStackTrie(db ethdb.KeyValueWriter) *StackTrie {
+	return &StackTrie{db: db}
+}
+
+// newStackLeaf creates a leaf node of a stack trie.
+func newStackLeaf(key, val []byte, db ethdb.KeyValueWriter) *StackTrie {
+	return &StackTrie{nodeType: stLeafNode, key: key, val: val, db: db}
+}
+
+// Update inserts a key-value pair into the trie, logging an error if the key
+// doesn't follow the previously inserted one.
+func (st *StackTrie) Update(key, value []byte) {
+	if err := st.TryUpdate(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate inserts a key-value pair into the trie. The key must be greater than
+// all the previously inserted ones and the value must not be empty.
+func (st *StackTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return errStackTrieEmptyValue
+	}
+	if st.last != nil && bytes.Compare(key, st.last) <= 0 {
+		return errStackTrieOrder
+	}
+	// Keys are increasing, so only the last one can be a prefix of the new one
+	if st.last != nil && bytes.HasPrefix(key, st.last) {
+		return errStackTrieKeyPrefix
+	}
+	if st.nodeType == stHashedNode {
+		return errStackTrieHashed
+	}
+	k := keybytesToHex(key)
+	if err := st.insert(k[:len(k)-1], common.CopyBytes(value)); err != nil {
+		return err
+	}
+	st.last = common.CopyBytes(key)
+	return nil
+}
+
+// Reset clears the trie, allowing it to be reused.
+func (st *StackTrie) Reset() {
+	*st = StackTrie{db: st.db}
+}
+
+// insert adds the key (in hex nibbles) and value into the subtrie.
+func (st *StackTrie) insert(key, value []byte) error {
+	switch st.nodeType {
+	case stEmptyNode:
+		st.nodeType, st.key, st.val = stLeafNode, key, value
+
+	case stBranchNode:
+		idx := int(key[0])
+
+		// All the preceding siblings are complete, hash the last one still resolved
+		for i := idx - 1; i >= 0; i-- {
+			if st.children[i] != nil {
+				st.children[i].hash()
+				break
+			}
+		}
+		if st.children[idx] == nil {
+			st.children[idx] = newStackLeaf(key[1:], value, st.db)
+			return nil
+		}
+		return st.children[idx].insert(key[1:], value)
+
+	case stExtNode:
+		diff := prefixLen(st.key, key)
+		if diff == len(st.key) {
+			// The key passes through the extension, insert into its child
+			return st.children[0].insert(key[diff:], value)
+		}
+		// The key diverges within the extension: the original child (behind a
+		// shortened extension if needed) is complete and can be hashed
+		var orig *StackTrie
+		if diff < len(st.key)-1 {
+			orig = &StackTrie{nodeType: stExtNode, key: st.key[diff+1:], db: st.db}
+			orig.children[0] = st.children[0]
+		} else {
+			orig = st.children[0]
+		}
+		orig.hash()
+
+		// Split at a new branch, either replacing the extension or below it
+		branch := st
+		if diff == 0 {
+			st.nodeType, st.children[0] = stBranchNode, nil
+		} else {
+			branch = &StackTrie{nodeType: stBranchNode, db: st.db}
+			st.children[0] = branch
+		}
+		branch.children[st.key[diff]] = orig
+		branch.children[key[diff]] = newStackLeaf(key[diff+1:], value, st.db)
+		st.key = st.key[:diff]
+
+	case stLeafNode:
+		diff := prefixLen(st.key, key)
+		if diff >= len(st.key) {
+			return errStackTrieKeyPrefix
+		}
+		// Split the leaf at a new branch, either replacing it or below an extension
+		branch := st
+		if diff == 0 {
+			st.nodeType = stBranchNode
+		} else {
+			st.nodeType = stExtNode
+			branch = &StackTrie{nodeType: stBranchNode, db: st.db}
+			st.children[0] = branch
+		}
+		// The original leaf is complete and can be hashed right away
+		orig := newStackLeaf(st.key[diff+1:], st.val, st.db)
+		orig.hash()
+
+		branch.children[st.key[diff]] = orig
+		branch.children[key[diff]] = newStackLeaf(key[diff+1:], value, st.db)
+		st.key, st.val = st.key[:diff], nil
+
+	case stHashedNode:
+		return errStackTrieHashed
+	}
+	return nil
+}
+
+// encodedChild returns the encoding of a hashed child as referenced by its parent:
+// the hash itself, or the node encoding if it's small enough to be embedded.
+func (st *StackTrie) encodedChild() interface{} {
+	st.hash()
+	if len(st.val) < 32 {
+		return rlp.RawValue(st.val)
+	}
+	return st.val
+}
+
+// hash collapses the subtrie into a hashed node, replacing its content with its
+// hash, or with its encoding if shorter than 32 bytes. Nodes with an actual hash
+// are written into the database if one was configured.
+func (st *StackTrie) hash() {
+	var enc []byte
+	switch st.nodeType {
+	case stHashedNode:
+		return
+
+	case stEmptyNode:
+		st.nodeType, st.val = stHashedNode, emptyRoot.Bytes()
+		return
+
+	case stBranchNode:
+		var nodes [17]interface{}
+		for i, child := range st.children {
+			if child == nil {
+				nodes[i] = []byte(nil)
+				continue
+			}
+			nodes[i] = child.encodedChild()
+			st.children[i] = nil
+		}
+		nodes[16] = []byte(nil)
+		enc, _ = rlp.EncodeToBytes(nodes)
+
+	case stExtNode:
+		child := st.children[0].encodedChild()
+		st.children[0] = nil
+		enc, _ = rlp.EncodeToBytes([]interface{}{hexToCompact(st.key), child})
+
+	case stLeafNode:
+		enc, _ = rlp.EncodeToBytes([]interface{}{hexToCompact(append(common.CopyBytes(st.key), 16)), st.val})
+	}
+	st.nodeType, st.key = stHashedNode, nil
+	if len(enc) < 32 {
+		st.val = enc
+		return
+	}
+	h := newHasher(nil)
+	defer returnHasherToPool(h)
+
+	st.val = h.makeHashNode(enc)
+	if st.db != nil {
+		st.db.Put(st.val, enc)
+	}
+}
+
+// Hash returns the root hash of the trie. No more keys can be inserted afterwards.
+func (st *StackTrie) Hash() common.Hash {
+	st.hash()
+	if len(st.val) != 32 {
+		// The root is always hashed, even if its encoding is shorter
+		h := newHasher(nil)
+		defer returnHasherToPool(h)
+		return common.BytesToHash(h.makeHashNode(st.val))
+	}
+	return common.BytesToHash(st.val)
+}
+
+// Commit hashes the trie and writes the root node into the database, in addition
+// to all the other nodes already written. No more keys can be inserted afterwards.
+func (st *StackTrie) Commit() (common.Hash, error) {
+	if st.db == nil {
+		return common.Hash{}, errors.New("stack trie has no database")
+	}
+	st.hash()
+	if len(st.val) != 32 {
+		h := newHasher(nil)
+		defer returnHasherToPool(h)
+
+		hash := h.makeHashNode(st.val)
+		if err := st.db.Put(hash, st.val); err != nil {
+			return common.Hash{}, err
+		}
+		return common.BytesToHash(hash), nil
+	}
+	return common.BytesToHash(st.val), nil
+}
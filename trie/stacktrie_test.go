@@ -0,0 +1,139 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that the stack trie produces the same root hash as the regular trie for
+// various key sets, and that the committed nodes form a complete trie.
+func TestStackTrieHash(t *testing.T) {
+	if hash := NewStackTrie(nil).Hash(); hash != emptyRoot {
+		t.Fatalf("empty trie hash mismatch: have %x, want %x", hash, emptyRoot)
+	}
+	for _, n := range []int{1, 2, 3, 16, 17, 100, 1000, 5000} {
+		// Random fixed size keys with values of varying sizes
+		_, vals := randomTrie(n)
+		entries := make([]*kv, 0, len(vals))
+		for _, kv := range vals {
+			entries = append(entries, kv)
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+		entries = entries[:n]
+
+		var (
+			tr     = new(Trie)
+			diskdb = memorydb.New()
+			st     = NewStackTrie(diskdb)
+		)
+		for _, entry := range entries {
+			tr.Update(entry.k, entry.v)
+			st.Update(entry.k, entry.v)
+		}
+		root, err := st.Commit()
+		if err != nil {
+			t.Fatalf("%d keys: failed to commit stack trie: %v", n, err)
+		}
+		if want := tr.Hash(); root != want {
+			t.Fatalf("%d keys: root mismatch: have %x, want %x", n, root, want)
+		}
+		committed, err := New(root, NewDatabase(diskdb))
+		if err != nil {
+			t.Fatalf("%d keys: failed to open committed trie: %v", n, err)
+		}
+		for _, entry := range entries {
+			if have, err := committed.TryGet(entry.k); err != nil || !bytes.Equal(have, entry.v) {
+				t.Fatalf("%d keys: value mismatch for %x: have %x (err %v), want %x", n, entry.k, have, err, entry.v)
+			}
+		}
+	}
+}
+
+// Tests that the stack trie handles RLP encoded integer keys as used for the
+// transaction and receipt tries, including embedded (short) nodes.
+func TestStackTrieRLPKeys(t *testing.T) {
+	for _, n := range []int{1, 2, 127, 128, 129, 300, 70000} {
+		var (
+			tr = new(Trie)
+			st = NewStackTrie(nil)
+		)
+		// Insert in sorted key order: 1..127, then 0, then 128 onwards
+		order := make([]int, 0, n)
+		for i := 1; i < n && i < 0x80; i++ {
+			order = append(order, i)
+		}
+		order = append(order, 0)
+		for i := 0x80; i < n; i++ {
+			order = append(order, i)
+		}
+		for _, i := range order {
+			key, _ := rlp.EncodeToBytes(uint(i))
+			val := big.NewInt(int64(i)).Bytes()
+			if len(val) == 0 {
+				val = []byte{0xff}
+			}
+			tr.Update(key, val)
+			if err := st.TryUpdate(key, val); err != nil {
+				t.Fatalf("%d keys: failed to insert key %x: %v", n, key, err)
+			}
+		}
+		if have, want := st.Hash(), tr.Hash(); have != want {
+			t.Fatalf("%d keys: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
+
+// Tests that out of order, prefixed and empty insertions are rejected.
+func TestStackTrieInvalidInsert(t *testing.T) {
+	st := NewStackTrie(nil)
+	if err := st.TryUpdate(common.Hex2Bytes("02"), []byte{1}); err != nil {
+		t.Fatalf("failed to insert key: %v", err)
+	}
+	if err := st.TryUpdate(common.Hex2Bytes("01"), []byte{1}); err != errStackTrieOrder {
+		t.Fatalf("out of order insertion error mismatch: have %v, want %v", err, errStackTrieOrder)
+	}
+	if err := st.TryUpdate(common.Hex2Bytes("02"), []byte{1}); err != errStackTrieOrder {
+		t.Fatalf("duplicate insertion error mismatch: have %v, want %v", err, errStackTrieOrder)
+	}
+	if err := st.TryUpdate(common.Hex2Bytes("03"), nil); err != errStackTrieEmptyValue {
+		t.Fatalf("empty insertion error mismatch: have %v, want %v", err, errStackTrieEmptyValue)
+	}
+	if err := st.TryUpdate(common.Hex2Bytes("0201"), []byte{1}); err != errStackTrieKeyPrefix {
+		t.Fatalf("prefixed insertion error mismatch: have %v, want %v", err, errStackTrieKeyPrefix)
+	}
+	// Rejected insertions must leave the trie intact
+	if err := st.TryUpdate(common.Hex2Bytes("03"), []byte{1}); err != nil {
+		t.Fatalf("failed to insert key: %v", err)
+	}
+	tr := new(Trie)
+	tr.Update(common.Hex2Bytes("02"), []byte{1})
+	tr.Update(common.Hex2Bytes("03"), []byte{1})
+	if have, want := st.Hash(), tr.Hash(); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := st.TryUpdate(common.Hex2Bytes("04"), []byte{1}); err != errStackTrieHashed {
+		t.Fatalf("insertion after hashing error mismatch: have %v, want %v", err, errStackTrieHashed)
+	}
+}
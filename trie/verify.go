@@ -0,0 +1,117 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// VerifyTrie walks all the nodes of the trie with the given root, ensuring that each
+// one is present in the database and that its content matches its hash. Faulty
+// nodes are reported to onFault as *MissingNodeError or *CorruptNodeError, after
+// which the walk continues with the rest of the trie.
+//
+// Nodes and values sorting before the start key are skipped, allowing an interrupted
+// verification to be resumed. onLeaf is invoked for each value in key order, and
+// returning an error from it aborts the walk.
+func VerifyTrie(db *Database, root common.Hash, start []byte, onLeaf func(key, value []byte) error, onFault func(error)) error {
+	if root == emptyRoot || root == (common.Hash{}) {
+		return nil
+	}
+	v := &verifier{
+		db:      db,
+		start:   keybytesToHex(start),
+		onLeaf:  onLeaf,
+		onFault: onFault,
+	}
+	v.start = v.start[:len(v.start)-1] // drop the terminator
+	return v.walk(hashNode(root.Bytes()), nil)
+}
+
+// verifier is the state of a trie verification walk.
+type verifier struct {
+	db      *Database
+	start   []byte // Hex-encoded key to start the walk from
+	onLeaf  func(key, value []byte) error
+	onFault func(error)
+}
+
+// skip returns whether the subtrie at the given path sorts entirely before the
+// start key and can be skipped.
+func (v *verifier) skip(path []byte) bool {
+	if hasTerm(path) {
+		path = path[:len(path)-1]
+	}
+	prefix := v.start
+	if len(prefix) > len(path) {
+		prefix = prefix[:len(path)]
+	}
+	return bytes.Compare(path, prefix) < 0
+}
+
+// walk verifies the node at the given path, recursing into its children.
+func (v *verifier) walk(n node, path []byte) error {
+	if v.skip(path) {
+		return nil
+	}
+	switch n := n.(type) {
+	case hashNode:
+		hash := common.BytesToHash(n)
+		blob, err := v.db.Node(hash)
+		if err != nil || len(blob) == 0 {
+			v.onFault(&MissingNodeError{NodeHash: hash, Path: path})
+			return nil
+		}
+		if have := crypto.Keccak256Hash(blob); have != hash {
+			v.onFault(&CorruptNodeError{NodeHash: hash, Path: path, Err: fmt.Errorf("content hash %x", have)})
+			return nil
+		}
+		child, err := decodeNode(n, blob)
+		if err != nil {
+			v.onFault(&CorruptNodeError{NodeHash: hash, Path: path, Err: err})
+			return nil
+		}
+		return v.walk(child, path)
+
+	case *shortNode:
+		return v.walk(n.Val, append(append([]byte{}, path...), n.Key...))
+
+	case *fullNode:
+		for i, child := range &n.Children {
+			if child == nil {
+				continue
+			}
+			if err := v.walk(child, append(append([]byte{}, path...), byte(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case valueNode:
+		if v.onLeaf != nil {
+			return v.onLeaf(hexToKeybytes(path), n)
+		}
+		return nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// Tests that trie verification visits every value in order, can be resumed from a
+// key and reports missing nodes without aborting.
+func TestVerifyTrie(t *testing.T) {
+	triedb, trie, content := makeTestTrie()
+	root := trie.Hash()
+
+	diskdb := memorydb.New()
+	triedb.diskdb = diskdb
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	// verify runs a verification on a fresh database, returning the visited keys
+	// and the reported faults
+	verify := func(start []byte) ([][]byte, []error) {
+		var (
+			keys   [][]byte
+			faults []error
+		)
+		err := VerifyTrie(NewDatabase(diskdb), root, start, func(key, value []byte) error {
+			if !bytes.Equal(content[string(key)], value) {
+				t.Fatalf("value mismatch for key %x: have %x, want %x", key, value, content[string(key)])
+			}
+			keys = append(keys, key)
+			return nil
+		}, func(err error) {
+			faults = append(faults, err)
+		})
+		if err != nil {
+			t.Fatalf("failed to verify trie: %v", err)
+		}
+		return keys, faults
+	}
+	keys, faults := verify(nil)
+	if len(faults) != 0 {
+		t.Fatalf("intact trie reported faults: %v", faults)
+	}
+	if len(keys) != len(content) {
+		t.Fatalf("visited key count mismatch: have %d, want %d", len(keys), len(content))
+	}
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Fatalf("keys out of order: %x >= %x", keys[i-1], keys[i])
+		}
+	}
+	// Resume from a key in the middle of the trie
+	start := common.LeftPadBytes([]byte{7, 0}, 32)
+	resumed, _ := verify(start)
+	if !bytes.Equal(resumed[0], start) {
+		t.Fatalf("resumed walk start mismatch: have %x, want %x", resumed[0], start)
+	}
+	for i, key := range keys {
+		if bytes.Equal(key, start) {
+			if len(resumed) != len(keys)-i {
+				t.Fatalf("resumed key count mismatch: have %d, want %d", len(resumed), len(keys)-i)
+			}
+		}
+	}
+	// Delete a non-root node and ensure the rest of the trie is still verified
+	var victim common.Hash
+	it := diskdb.NewIterator()
+	for it.Next() {
+		if hash := common.BytesToHash(it.Key()); hash != root {
+			victim = hash
+			break
+		}
+	}
+	it.Release()
+	diskdb.Delete(victim.Bytes())
+
+	damaged, faults := verify(nil)
+	if len(faults) != 1 {
+		t.Fatalf("fault count mismatch: have %d, want 1: %v", len(faults), faults)
+	}
+	if missing, ok := faults[0].(*MissingNodeError); !ok || missing.NodeHash != victim {
+		t.Fatalf("fault mismatch: have %v, want missing node %x", faults[0], victim)
+	}
+	if len(damaged) == 0 || len(damaged) >= len(keys) {
+		t.Fatalf("damaged trie key count mismatch: have %d, total %d", len(damaged), len(keys))
+	}
+}